@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/sergeizaitcev/metrics/internal/migrate"
+	"github.com/sergeizaitcev/metrics/pkg/commands"
+	"github.com/sergeizaitcev/metrics/version"
+)
+
+func main() {
+	version.Print()
+	commands.Execute("migrate", migrate.Run)
+}
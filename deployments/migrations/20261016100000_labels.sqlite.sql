@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE metrics_labels (
+	name TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	kind INTEGER NOT NULL,
+	counter INTEGER,
+	gauge REAL,
+	PRIMARY KEY (name, labels, kind)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO metrics_labels (name, kind, counter, gauge)
+SELECT name, kind, counter, gauge FROM metrics;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE metrics;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE metrics_labels RENAME TO metrics;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE metrics_kind (
+	name TEXT NOT NULL,
+	kind INTEGER NOT NULL,
+	counter INTEGER,
+	gauge REAL,
+	PRIMARY KEY (name, kind)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO metrics_kind (name, kind, counter, gauge)
+SELECT name, kind, counter, gauge FROM metrics WHERE labels = '{}';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE metrics;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE metrics_kind RENAME TO metrics;
+-- +goose StatementEnd
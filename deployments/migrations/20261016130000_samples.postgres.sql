@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS samples (
+	name CHARACTER VARYING(256) NOT NULL,
+	labels JSONB NOT NULL DEFAULT '{}',
+	kind SMALLINT NOT NULL,
+	ts TIMESTAMPTZ NOT NULL,
+	counter BIGINT,
+	gauge DOUBLE PRECISION,
+	histogram BYTEA,
+	summary BYTEA
+);
+CREATE INDEX IF NOT EXISTS samples_name_labels_ts_idx ON samples (name, labels, ts);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS samples;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS samples (
+	name TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	kind INTEGER NOT NULL,
+	ts INTEGER NOT NULL,
+	counter INTEGER,
+	gauge REAL,
+	histogram BLOB,
+	summary BLOB
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS samples_name_labels_ts_idx ON samples (name, labels, ts);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS samples;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS rollups (
+	name CHARACTER VARYING(256) NOT NULL,
+	labels JSONB NOT NULL DEFAULT '{}',
+	kind SMALLINT NOT NULL,
+	resolution BIGINT NOT NULL,
+	ts TIMESTAMPTZ NOT NULL,
+	count BIGINT NOT NULL,
+	sum DOUBLE PRECISION NOT NULL,
+	rate DOUBLE PRECISION NOT NULL,
+	min DOUBLE PRECISION NOT NULL,
+	max DOUBLE PRECISION NOT NULL,
+	avg DOUBLE PRECISION NOT NULL,
+	counter BIGINT,
+	gauge DOUBLE PRECISION,
+	PRIMARY KEY(name, labels, kind, resolution, ts)
+);
+CREATE INDEX IF NOT EXISTS samples_ts_idx ON samples (ts);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS samples_ts_idx;
+DROP TABLE IF EXISTS rollups;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS rollups (
+	name TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	kind INTEGER NOT NULL,
+	resolution INTEGER NOT NULL,
+	ts INTEGER NOT NULL,
+	count INTEGER NOT NULL,
+	sum REAL NOT NULL,
+	rate REAL NOT NULL,
+	min REAL NOT NULL,
+	max REAL NOT NULL,
+	avg REAL NOT NULL,
+	counter INTEGER,
+	gauge REAL,
+	PRIMARY KEY (name, labels, kind, resolution, ts)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS samples_ts_idx ON samples (ts);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS samples_ts_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS rollups;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE metrics ADD COLUMN updated INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE metrics SET updated = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS metrics_updated_idx ON metrics (updated);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS metrics_updated_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE metrics DROP COLUMN updated;
+-- +goose StatementEnd
@@ -1,10 +1,19 @@
+// Package migrations содержит миграции БД PostgreSQL и SQLite.
+//
+// Миграции образуют одну последовательность версий. Миграция, которая
+// не может быть общей для обеих БД, состоит из файлов с суффиксом диалекта
+// "<версия>_<имя>.<диалект>.sql"; для каждой БД выбираются общие файлы
+// и файлы её диалекта.
 package migrations
 
 import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"strings"
 
 	"github.com/pressly/goose/v3"
 )
@@ -12,32 +21,147 @@ import (
 //go:embed *.sql
 var fsys embed.FS
 
+// ErrNotMigrated возвращается, если в БД применены не все миграции.
+var ErrNotMigrated = errors.New("migrations: database is not migrated")
+
+// Суффиксы файлов миграций диалектов.
+var suffixes = map[goose.Dialect]string{
+	goose.DialectPostgres: ".postgres.sql",
+	goose.DialectSQLite3:  ".sqlite.sql",
+}
+
 // Up запускает миграцию в БД.
 func Up(ctx context.Context, db *sql.DB) error {
-	goose.SetBaseFS(fsys)
+	return up(ctx, db, goose.DialectPostgres)
+}
+
+// Down откатывает все миграции в БД.
+func Down(ctx context.Context, db *sql.DB) error {
+	return down(ctx, db, goose.DialectPostgres)
+}
+
+// UpSQLite запускает миграцию в БД SQLite.
+func UpSQLite(ctx context.Context, db *sql.DB) error {
+	return up(ctx, db, goose.DialectSQLite3)
+}
+
+// DownSQLite откатывает все миграции в БД SQLite.
+func DownSQLite(ctx context.Context, db *sql.DB) error {
+	return down(ctx, db, goose.DialectSQLite3)
+}
 
-	if err := goose.SetDialect("postgres"); err != nil {
-		return fmt.Errorf("migrations: set dialect: %w", err)
+// Check возвращает ErrNotMigrated, если в БД применены не все миграции;
+// БД при этом не изменяется.
+func Check(ctx context.Context, db *sql.DB) error {
+	return check(ctx, db, goose.DialectPostgres)
+}
+
+// CheckSQLite возвращает ErrNotMigrated, если в БД SQLite применены
+// не все миграции; БД при этом не изменяется.
+func CheckSQLite(ctx context.Context, db *sql.DB) error {
+	return check(ctx, db, goose.DialectSQLite3)
+}
+
+func up(ctx context.Context, db *sql.DB, dialect goose.Dialect) error {
+	provider, err := newProvider(db, dialect)
+	if err != nil {
+		return err
 	}
 
-	if err := goose.UpContext(ctx, db, "."); err != nil {
+	if _, err = provider.Up(ctx); err != nil {
 		return fmt.Errorf("migrations: up migrations: %w", err)
 	}
 
 	return nil
 }
 
-// Down откатывает миграцию в БД.
-func Down(ctx context.Context, db *sql.DB) error {
-	goose.SetBaseFS(fsys)
-
-	if err := goose.SetDialect("postgres"); err != nil {
-		return fmt.Errorf("migrations: set dialect: %w", err)
+func down(ctx context.Context, db *sql.DB, dialect goose.Dialect) error {
+	provider, err := newProvider(db, dialect)
+	if err != nil {
+		return err
 	}
 
-	if err := goose.DownContext(ctx, db, "."); err != nil {
+	if _, err = provider.DownTo(ctx, 0); err != nil {
 		return fmt.Errorf("migrations: down migrations: %w", err)
 	}
 
 	return nil
 }
+
+// check возвращает ErrNotMigrated, если версия БД меньше версии последней
+// миграции диалекта dialect.
+//
+// NOTE: провайдер создаёт таблицу версий при первом обращении к БД,
+// поэтому версия БД читается из таблицы напрямую.
+func check(ctx context.Context, db *sql.DB, dialect goose.Dialect) error {
+	provider, err := newProvider(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	sources := provider.ListSources()
+	if len(sources) == 0 {
+		return nil
+	}
+
+	var version sql.NullInt64
+
+	err = db.QueryRowContext(ctx, "SELECT max(version_id) FROM "+goose.DefaultTablename).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("%w: reading the version: %v", ErrNotMigrated, err)
+	}
+	if !version.Valid || version.Int64 < sources[len(sources)-1].Version {
+		return ErrNotMigrated
+	}
+
+	return nil
+}
+
+// newProvider возвращает провайдер миграций диалекта dialect для db.
+//
+// NOTE: провайдер не закрывается, т.к. его закрытие закрывает db.
+func newProvider(db *sql.DB, dialect goose.Dialect) (*goose.Provider, error) {
+	provider, err := goose.NewProvider(dialect, db, dialectFS{fsys, suffixes[dialect]})
+	if err != nil {
+		return nil, fmt.Errorf("migrations: new provider: %w", err)
+	}
+	return provider, nil
+}
+
+// dialectFS определяет файловую систему миграций одного диалекта:
+// общих миграций и миграций с суффиксом suffix.
+type dialectFS struct {
+	fs.FS
+	suffix string
+}
+
+// ReadDir реализует интерфейс fs.ReadDirFS.
+func (d dialectFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(d.FS, name)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := entries[:0]
+
+	for _, entry := range entries {
+		if d.match(entry.Name()) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered, nil
+}
+
+// match возвращает true, если файл name относится к диалекту.
+func (d dialectFS) match(name string) bool {
+	if strings.HasSuffix(name, d.suffix) {
+		return true
+	}
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	return true
+}
@@ -23,6 +23,7 @@ type Agent struct {
 	pollInterval   time.Duration
 	reportInterval time.Duration
 	rateLimit      int
+	summaries      []string
 }
 
 // NewAgent инициализирует и возвращает новый экземпляр Agent.
@@ -33,6 +34,7 @@ func NewAgent(sender Sender, config *configs.Agent) *Agent {
 		pollInterval:   config.PollInterval,
 		reportInterval: config.ReportInterval,
 		rateLimit:      config.RateLimit,
+		summaries:      config.Summaries,
 	}
 	return agent
 }
@@ -118,9 +120,11 @@ func (a *Agent) collect(ctx context.Context, collectChan chan<- []metrics.Metric
 }
 
 // poll возвращает канал, в который отправляются снимки метрик с интервалом
-// PollInterval.
+// PollInterval. Значения датчиков, перечисленных в конфиге, накапливаются
+// в сводки до тех пор, пока снимок не будет передан в канал.
 func (a *Agent) poll(ctx context.Context) <-chan []metrics.Metric {
 	pollChan := make(chan []metrics.Metric)
+	summaries := newSummaries(a.summaries)
 
 	go func() {
 		ticker := time.NewTicker(a.pollInterval)
@@ -134,9 +138,12 @@ func (a *Agent) poll(ctx context.Context) <-chan []metrics.Metric {
 			}
 
 			snapshot := metrics.Snapshot()
+			summaries.observe(snapshot)
+			snapshot = append(snapshot, summaries.metrics()...)
 
 			select {
 			case pollChan <- snapshot:
+				summaries.reset()
 			default:
 			}
 		}
@@ -51,4 +51,34 @@ func TestAgent(t *testing.T) {
 
 		require.NoError(t, a.Run(cancelCtx))
 	})
+
+	t.Run("summaries", func(t *testing.T) {
+		config := &configs.Agent{
+			Address:        "localhost",
+			ReportInterval: 100 * time.Millisecond,
+			PollInterval:   20 * time.Millisecond,
+			RateLimit:      1,
+			Summaries:      []string{"Alloc"},
+		}
+
+		hasSummary := mock.MatchedBy(func(values []metrics.Metric) bool {
+			for _, value := range values {
+				if value.Kind() == metrics.KindSummary && value.Name() == "AllocSummary" {
+					return value.Summary().Count() > 1
+				}
+			}
+			return false
+		})
+
+		sender := new(senderMock)
+		sender.On("Send", mock.Anything, hasSummary).Return(nil)
+
+		a := agent.NewAgent(sender, config)
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 180*time.Millisecond)
+		defer cancel()
+
+		require.NoError(t, a.Run(cancelCtx))
+		sender.AssertExpectations(t)
+	})
 }
@@ -32,6 +32,8 @@ func Run(ctx context.Context, c *configs.Agent) (err error) {
 		senders.WithLogger(logger),
 		senders.WithIP(ip.String()),
 		senders.WithSHA256Key(c.SHA256Key),
+		senders.WithAPIKey(c.APIKey),
+		senders.WithTenant(c.Tenant),
 	}
 
 	var sender Sender
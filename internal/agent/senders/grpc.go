@@ -51,5 +51,11 @@ func (s *SenderGRPC) setMetadata(ctx context.Context, values []metrics.Metric) c
 	if s.opts.sha256key == "" {
 		ctx = md.SetHash256(ctx, metrics.Sign(s.opts.sha256key, values))
 	}
+	if s.opts.apiKey != "" {
+		ctx = md.SetAPIKey(ctx, s.opts.apiKey)
+	}
+	if s.opts.tenant != "" {
+		ctx = md.SetTenant(ctx, s.opts.tenant)
+	}
 	return ctx
 }
@@ -85,6 +85,12 @@ func (s *SenderHTTP) prepareRequest(
 		hash := signBody(body, s.opts.sha256key)
 		req.Header.Add(middleware.SignHeader, hash)
 	}
+	if s.opts.apiKey != "" {
+		req.Header.Add(middleware.APIKeyHeader, s.opts.apiKey)
+	}
+	if s.opts.tenant != "" {
+		req.Header.Add(middleware.TenantHeader, s.opts.tenant)
+	}
 
 	return req, nil
 }
@@ -13,6 +13,8 @@ type commonOptions struct {
 	logger    *logging.Logger
 	ip        string
 	sha256key string
+	apiKey    string
+	tenant    string
 }
 
 func WithEncrypt(key *rsa.PublicKey) Option {
@@ -38,3 +40,15 @@ func WithSHA256Key(key string) Option {
 		opt.sha256key = key
 	}
 }
+
+func WithAPIKey(key string) Option {
+	return func(opt *commonOptions) {
+		opt.apiKey = key
+	}
+}
+
+func WithTenant(tenant string) Option {
+	return func(opt *commonOptions) {
+		opt.tenant = tenant
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// summarySuffix определяет суффикс наименования сводки датчика.
+const summarySuffix = "Summary"
+
+// summaries накапливает значения датчиков в скетчи между отправками метрик.
+type summaries struct {
+	sketches map[string]*metrics.Sketch
+}
+
+// newSummaries возвращает накопитель для датчиков с наименованиями names.
+func newSummaries(names []string) *summaries {
+	s := &summaries{
+		sketches: make(map[string]*metrics.Sketch, len(names)),
+	}
+	for _, name := range names {
+		if name != "" {
+			s.sketches[name], _ = metrics.NewSketch(metrics.DefaultAccuracy)
+		}
+	}
+	return s
+}
+
+// observe добавляет значения датчиков из снимка в скетчи.
+func (s *summaries) observe(snapshot []metrics.Metric) {
+	if len(s.sketches) == 0 {
+		return
+	}
+	for _, value := range snapshot {
+		if value.Kind() != metrics.KindGauge {
+			continue
+		}
+		if sketch, ok := s.sketches[value.Name()]; ok {
+			sketch.Add(value.Float64())
+		}
+	}
+}
+
+// metrics возвращает накопленные сводки; пустые скетчи пропускаются.
+func (s *summaries) metrics() []metrics.Metric {
+	values := make([]metrics.Metric, 0, len(s.sketches))
+	for name, sketch := range s.sketches {
+		if sketch.Count() > 0 {
+			values = append(values, metrics.Summary(name+summarySuffix, sketch))
+		}
+	}
+	return values
+}
+
+// reset очищает накопленные скетчи.
+func (s *summaries) reset() {
+	for name := range s.sketches {
+		s.sketches[name], _ = metrics.NewSketch(metrics.DefaultAccuracy)
+	}
+}
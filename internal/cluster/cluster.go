@@ -0,0 +1,299 @@
+// Package cluster реализует кластерный режим сервера: метрики
+// распределяются по узлам консистентным хешированием имени, запись
+// перенаправляется узлу-владельцу, а выборка объединяет метрики всех узлов.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+// defaultTimeout определяет таймаут запроса к узлу кластера по умолчанию.
+const defaultTimeout = 10 * time.Second
+
+var defaultOpts = &Opts{
+	Client: &http.Client{Timeout: defaultTimeout},
+}
+
+// Opts определяет не обязательные параметры для Storage.
+type Opts struct {
+	// Ключ кластера, передаваемый узлам в заголовке KeyHeader.
+	Key string
+
+	// IP-адрес текущего узла, передаваемый узлам в заголовке
+	// middleware.IPHeader для проверки доверенной подсети.
+	IP string
+
+	// HTTP-клиент для запросов к узлам кластера.
+	Client *http.Client
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+// Storage определяет хранилище узла кластера.
+//
+// Метрики, которыми владеет текущий узел, хранятся в локальном хранилище;
+// вызовы с метриками других узлов перенаправляются их владельцам.
+// Get, Delete, Reset, Range и Rollups выполняются узлом-владельцем
+// метрики, а GetAll и Select объединяют метрики всех узлов.
+//
+// Watch, Retain и Expire выполняются только для метрик текущего узла,
+// так как каждый узел обслуживает свои метрики сам.
+type Storage struct {
+	storage.Storage
+	node  string
+	nodes []string
+	ring  *Ring
+	peers map[string]*peer
+}
+
+// New возвращает хранилище узла node кластера из узлов nodes с локальным
+// хранилищем s. Адреса узлов — это адреса их HTTP-серверов.
+func New(s storage.Storage, node string, nodes []string, opts *Opts) (*Storage, error) {
+	if opts == nil {
+		opts = defaultOpts
+	}
+	if opts.Client == nil {
+		opts.Client = defaultOpts.Client
+	}
+
+	c := &Storage{
+		Storage: s,
+		node:    node,
+		nodes:   nodes,
+		ring:    NewRing(nodes...),
+		peers:   make(map[string]*peer, len(nodes)),
+	}
+
+	for _, n := range nodes {
+		if n != node {
+			c.peers[n] = newPeer(n, opts)
+		}
+	}
+
+	if len(c.peers) == len(nodes) {
+		return nil, fmt.Errorf("cluster: node %q is not in the cluster", node)
+	}
+
+	return c, nil
+}
+
+// Owner возвращает узел, владеющий метрикой name.
+func (c *Storage) Owner(name string) string {
+	return c.ring.Owner(name)
+}
+
+// Save реализует интерфейс storage.Storage.
+//
+// NOTE: значения разных узлов сохраняются независимо, поэтому при ошибке
+// часть значений может оказаться сохранённой.
+func (c *Storage) Save(
+	ctx context.Context,
+	values ...metrics.Metric,
+) ([]metrics.Metric, error) {
+	// NOTE: пустые значения передаются локальному хранилищу, чтобы
+	// актуальные значения соответствовали переданным.
+	indexes := make(map[string][]int)
+	for i, value := range values {
+		node := c.node
+		if !value.IsEmpty() {
+			node = c.Owner(value.Name())
+		}
+		indexes[node] = append(indexes[node], i)
+	}
+
+	nodes := make([]string, 0, len(indexes))
+	for node := range indexes {
+		nodes = append(nodes, node)
+	}
+
+	actuals := make([]metrics.Metric, len(values))
+
+	err := fanout(nodes, func(node string) error {
+		idx := indexes[node]
+
+		batch := make([]metrics.Metric, len(idx))
+		for i, j := range idx {
+			batch[i] = values[j]
+		}
+
+		var (
+			got []metrics.Metric
+			err error
+		)
+		if node == c.node {
+			got, err = c.Storage.Save(ctx, batch...)
+		} else {
+			got, err = c.peers[node].save(ctx, batch)
+		}
+		if err != nil {
+			return err
+		}
+		if len(got) != len(batch) {
+			return fmt.Errorf("cluster: node %s: unexpected number of actuals", node)
+		}
+
+		// NOTE: индексы узлов не пересекаются.
+		for i, j := range idx {
+			actuals[j] = got[i]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return actuals, nil
+}
+
+// Get реализует интерфейс storage.Storage.
+func (c *Storage) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	p, ok := c.peers[c.Owner(name)]
+	if !ok {
+		return c.Storage.Get(ctx, name, labels)
+	}
+	return p.get(ctx, name, labels)
+}
+
+// GetAll реализует интерфейс storage.Storage.
+func (c *Storage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	values, err := c.Select(ctx, storage.Matcher{})
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return values, nil
+}
+
+// Select реализует интерфейс storage.Storage.
+func (c *Storage) Select(ctx context.Context, m storage.Matcher) ([]metrics.Metric, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		values []metrics.Metric
+	)
+
+	err := fanout(c.nodes, func(node string) error {
+		var (
+			got []metrics.Metric
+			err error
+		)
+		if node == c.node {
+			got, err = c.Storage.Select(ctx, m)
+		} else {
+			got, err = c.peers[node].selectBy(ctx, m)
+		}
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		values = append(values, got...)
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key() < values[j].Key()
+	})
+
+	return values, nil
+}
+
+// Delete реализует интерфейс storage.Storage.
+func (c *Storage) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	p, ok := c.peers[c.Owner(name)]
+	if !ok {
+		return c.Storage.Delete(ctx, name, labels)
+	}
+	return p.delete(ctx, name, labels)
+}
+
+// Reset реализует интерфейс storage.Storage.
+func (c *Storage) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	p, ok := c.peers[c.Owner(name)]
+	if !ok {
+		return c.Storage.Reset(ctx, name, labels)
+	}
+	return p.reset(ctx, name, labels)
+}
+
+// Range реализует интерфейс storage.Storage.
+func (c *Storage) Range(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]storage.Sample, error) {
+	p, ok := c.peers[c.Owner(name)]
+	if !ok {
+		return c.Storage.Range(ctx, name, labels, from, to)
+	}
+	return p.rangeOf(ctx, name, labels, from, to)
+}
+
+// Rollups реализует интерфейс storage.Storage.
+func (c *Storage) Rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]storage.Rollup, error) {
+	p, ok := c.peers[c.Owner(name)]
+	if !ok {
+		return c.Storage.Rollups(ctx, name, labels, resolution, from, to)
+	}
+	return p.rollups(ctx, name, labels, resolution, from, to)
+}
+
+// fanout параллельно вызывает f для каждого узла из nodes и возвращает
+// первую из ошибок.
+func fanout(nodes []string, f func(node string) error) error {
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			errs[i] = f(node)
+		}(i, node)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
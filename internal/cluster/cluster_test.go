@@ -0,0 +1,165 @@
+package cluster_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/cluster"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+const testKey = "secret"
+
+// node определяет узел тестового кластера.
+type node struct {
+	addr    string
+	local   storage.Storage
+	cluster *cluster.Storage
+}
+
+// testCluster возвращает узлы кластера из n узлов на loopback-адресах.
+func testCluster(t *testing.T, n int) []*node {
+	servers := make([]*httptest.Server, n)
+	addrs := make([]string, n)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		addrs[i] = servers[i].Listener.Addr().String()
+	}
+
+	nodes := make([]*node, n)
+
+	for i, srv := range servers {
+		local, err := storage.NewLocal(filepath.Join(t.TempDir(), "metrics.wal"), nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { local.Close() })
+
+		// NOTE: имена метрик ограничиваются на каждом узле.
+		limited := storage.NewLimited(local, storage.Limits{
+			NamePattern: regexp.MustCompile(`^[a-z]+$`),
+		})
+
+		c, err := cluster.New(limited, addrs[i], addrs, &cluster.Opts{Key: testKey})
+		require.NoError(t, err)
+
+		srv.Config.Handler = cluster.Handler(limited, testKey)
+		srv.Start()
+		t.Cleanup(srv.Close)
+
+		nodes[i] = &node{addr: addrs[i], local: limited, cluster: c}
+	}
+
+	return nodes
+}
+
+func TestStorage(t *testing.T) {
+	ctx := testutil.Context(t)
+	nodes := testCluster(t, 3)
+
+	names := []string{"alloc", "frees", "heap", "lookups", "mallocs", "sys"}
+
+	values := make([]metrics.Metric, 0, len(names))
+	for _, name := range names {
+		values = append(values, metrics.Counter(name, 1))
+	}
+
+	t.Run("save", func(t *testing.T) {
+		for _, n := range nodes {
+			actuals, err := n.cluster.Save(ctx, values...)
+			require.NoError(t, err)
+			require.Len(t, actuals, len(values))
+		}
+
+		owned := 0
+		for _, n := range nodes {
+			for _, name := range names {
+				got, err := n.local.Get(ctx, name, nil)
+				if nodes[0].cluster.Owner(name) != n.addr {
+					require.ErrorIs(t, err, storage.ErrNotFound)
+					continue
+				}
+				require.NoError(t, err)
+				require.EqualValues(t, len(nodes), got.Int64())
+				owned++
+			}
+		}
+		require.Equal(t, len(names), owned)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		for _, n := range nodes {
+			for _, name := range names {
+				got, err := n.cluster.Get(ctx, name, nil)
+				require.NoError(t, err)
+				require.EqualValues(t, len(nodes), got.Int64())
+				require.False(t, got.Updated().IsZero())
+			}
+
+			_, err := n.cluster.Get(ctx, "unknown", nil)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+		}
+	})
+
+	t.Run("select", func(t *testing.T) {
+		for _, n := range nodes {
+			got, err := n.cluster.Select(ctx, storage.Matcher{})
+			require.NoError(t, err)
+			require.Len(t, got, len(names))
+			for i, value := range got {
+				require.Equal(t, names[i], value.Name())
+			}
+
+			got, err = n.cluster.Select(ctx, storage.Matcher{Prefix: "m"})
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			require.Equal(t, "mallocs", got[0].Name())
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		for _, n := range nodes {
+			samples, err := n.cluster.Range(ctx, "heap", nil, time.Time{}, time.Now().Add(time.Second))
+			require.NoError(t, err)
+			require.Len(t, samples, len(nodes))
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		for _, n := range nodes {
+			_, err := n.cluster.Save(ctx, metrics.Gauge("heap_bytes", 1))
+
+			var limitErr *storage.LimitError
+			require.ErrorAs(t, err, &limitErr)
+			require.ErrorIs(t, err, storage.ErrNameInvalid)
+			require.Equal(t, "heap_bytes", limitErr.Name)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, nodes[0].cluster.Delete(ctx, "sys", nil))
+
+		for _, n := range nodes {
+			_, err := n.cluster.Get(ctx, "sys", nil)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			"http://"+nodes[0].addr+cluster.PathPrefix+"select", http.NoBody)
+		require.NoError(t, err)
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+var errKeyInvalid = errors.New("cluster key is invalid")
+
+// Handler возвращает обработчик HTTP-запросов узлов кластера к хранилищу
+// s текущего узла. Если ключ key не пуст, то запросы без этого ключа
+// в заголовке KeyHeader отклоняются.
+//
+// Хранилище s должно содержать только метрики, которыми владеет текущий
+// узел, поэтому запросы не перенаправляются другим узлам.
+func Handler(s storage.Storage, key string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		got := r.Header.Get(KeyHeader)
+		if key != "" && subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			sendFailure(w, http.StatusForbidden, failure{
+				Code:  codeUnauthorized,
+				Error: errKeyInvalid.Error(),
+			})
+			return
+		}
+
+		var req request
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			sendFailure(w, http.StatusBadRequest, newFailure(err))
+			return
+		}
+
+		ctx := r.Context()
+		labels := metrics.LabelsFromMap(req.Labels)
+
+		var (
+			resp  any
+			value metrics.Metric
+		)
+
+		// NOTE: значение метрики передаётся по указателю, иначе
+		// MarshalJSON не вызывается.
+		switch r.URL.Path {
+		case pathSave:
+			resp, err = s.Save(ctx, req.Values...)
+		case pathGet:
+			value, err = s.Get(ctx, req.Name, labels)
+			resp = &value
+		case pathSelect:
+			resp, err = s.Select(ctx, req.matcher())
+		case pathDelete:
+			err = s.Delete(ctx, req.Name, labels)
+		case pathReset:
+			value, err = s.Reset(ctx, req.Name, labels)
+			resp = &value
+		case pathRange:
+			resp, err = s.Range(ctx, req.Name, labels, req.From, req.To)
+		case pathRollups:
+			resp, err = s.Rollups(ctx, req.Name, labels, req.Resolution, req.From, req.To)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			sendFailure(w, failureStatus(err), newFailure(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// failureStatus возвращает код ответа для ошибки хранилища err.
+func failureStatus(err error) int {
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, storage.ErrReadOnly) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnprocessableEntity
+}
+
+func sendFailure(w http.ResponseWriter, code int, f failure) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&f)
+}
@@ -0,0 +1,66 @@
+package cluster_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/cluster"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/internal/storage/mocks"
+)
+
+func TestHandler_status(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mockError  error
+		wantStatus int
+	}{
+		{
+			name:       "ok",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "quota exceeded",
+			mockError:  fmt.Errorf("%w: series limit 1", storage.ErrQuotaExceeded),
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "read only",
+			mockError:  fmt.Errorf("local: %w", storage.ErrReadOnly),
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "conflict",
+			mockError:  storage.ErrConflict,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "internal",
+			mockError:  errors.New("error"),
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := mocks.NewMockStorage()
+			s.On("Save", mock.Anything, mock.Anything).Return([]metrics.Metric{}, tc.mockError)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, cluster.PathPrefix+"save", strings.NewReader("{}"))
+			req.Header.Set(cluster.KeyHeader, testKey)
+
+			cluster.Handler(s, testKey).ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantStatus, rec.Code)
+		})
+	}
+}
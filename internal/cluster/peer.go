@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+)
+
+// ErrUnavailable возвращается, если узел кластера недоступен.
+var ErrUnavailable = errors.New("cluster node is unavailable")
+
+// peer определяет клиент хранилища другого узла кластера.
+type peer struct {
+	addr   string
+	key    string
+	ip     string
+	client *http.Client
+}
+
+func newPeer(addr string, opts *Opts) *peer {
+	return &peer{
+		addr:   addr,
+		key:    opts.Key,
+		ip:     opts.IP,
+		client: opts.Client,
+	}
+}
+
+func (p *peer) save(ctx context.Context, values []metrics.Metric) ([]metrics.Metric, error) {
+	var actuals []metrics.Metric
+	err := p.call(ctx, pathSave, request{Values: values}, &actuals)
+	return actuals, err
+}
+
+func (p *peer) get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	var value metrics.Metric
+	err := p.call(ctx, pathGet, request{Name: name, Labels: labels.Map()}, &value)
+	return value, err
+}
+
+func (p *peer) selectBy(ctx context.Context, m storage.Matcher) ([]metrics.Metric, error) {
+	var values []metrics.Metric
+	err := p.call(ctx, pathSelect, matcherRequest(m), &values)
+	return values, err
+}
+
+func (p *peer) delete(ctx context.Context, name string, labels metrics.Labels) error {
+	return p.call(ctx, pathDelete, request{Name: name, Labels: labels.Map()}, nil)
+}
+
+func (p *peer) reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	var value metrics.Metric
+	err := p.call(ctx, pathReset, request{Name: name, Labels: labels.Map()}, &value)
+	return value, err
+}
+
+func (p *peer) rangeOf(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]storage.Sample, error) {
+	var samples []storage.Sample
+	err := p.call(ctx, pathRange, request{
+		Name:   name,
+		Labels: labels.Map(),
+		From:   from,
+		To:     to,
+	}, &samples)
+	return samples, err
+}
+
+func (p *peer) rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]storage.Rollup, error) {
+	var rollups []storage.Rollup
+	err := p.call(ctx, pathRollups, request{
+		Name:       name,
+		Labels:     labels.Map(),
+		Resolution: resolution,
+		From:       from,
+		To:         to,
+	}, &rollups)
+	return rollups, err
+}
+
+// call выполняет вызов path хранилища узла с параметрами req и декодирует
+// ответ в resp; при resp == nil ответ игнорируется.
+func (p *peer) call(ctx context.Context, path string, req request, resp any) error {
+	body, err := json.Marshal(&req)
+	if err != nil {
+		return fmt.Errorf("cluster: node %s: encode request: %w", p.addr, err)
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   p.addr,
+		Path:   path,
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cluster: node %s: create request: %w", p.addr, err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	if p.key != "" {
+		r.Header.Set(KeyHeader, p.key)
+	}
+	if p.ip != "" {
+		r.Header.Set(middleware.IPHeader, p.ip)
+	}
+
+	res, err := p.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("cluster: node %s: %w: %s", p.addr, ErrUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var f failure
+		if err = json.NewDecoder(res.Body).Decode(&f); err != nil || f.Code == "" {
+			return fmt.Errorf("cluster: node %s: unexpected status code %d", p.addr, res.StatusCode)
+		}
+		// NOTE: ошибка узла возвращается без обёртки, чтобы ответ
+		// не зависел от того, какой узел выполнил вызов.
+		return f.err()
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(res.Body).Decode(resp)
+	if err != nil {
+		return fmt.Errorf("cluster: node %s: decode response: %w", p.addr, err)
+	}
+
+	return nil
+}
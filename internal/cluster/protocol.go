@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+// PathPrefix определяет префикс путей HTTP-запросов между узлами кластера.
+const PathPrefix = "/cluster/"
+
+// KeyHeader определяет заголовок с ключом кластера.
+const KeyHeader = "X-Cluster-Key"
+
+// Пути вызовов хранилища узла кластера.
+const (
+	pathSave    = PathPrefix + "save"
+	pathGet     = PathPrefix + "get"
+	pathSelect  = PathPrefix + "select"
+	pathDelete  = PathPrefix + "delete"
+	pathReset   = PathPrefix + "reset"
+	pathRange   = PathPrefix + "range"
+	pathRollups = PathPrefix + "rollups"
+)
+
+// request определяет параметры вызова хранилища узла кластера.
+type request struct {
+	Values     []metrics.Metric  `json:"values,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Prefix     string            `json:"prefix,omitempty"`
+	Glob       string            `json:"glob,omitempty"`
+	Regex      string            `json:"regex,omitempty"`
+	Kind       string            `json:"type,omitempty"`
+	Resolution time.Duration     `json:"resolution,omitempty"`
+	From       time.Time         `json:"from,omitempty"`
+	To         time.Time         `json:"to,omitempty"`
+}
+
+// matcherRequest возвращает параметры вызова с условиями выборки m.
+func matcherRequest(m storage.Matcher) request {
+	req := request{
+		Labels: m.Labels.Map(),
+		Prefix: m.Prefix,
+		Glob:   m.Glob,
+		Regex:  m.Regex,
+	}
+	if m.Kind != metrics.KindUnknown {
+		req.Kind = m.Kind.String()
+	}
+	return req
+}
+
+// matcher возвращает условия выборки из параметров вызова.
+func (r *request) matcher() storage.Matcher {
+	m := storage.Matcher{
+		Prefix: r.Prefix,
+		Glob:   r.Glob,
+		Regex:  r.Regex,
+		Labels: metrics.LabelsFromMap(r.Labels),
+	}
+	if r.Kind != "" {
+		m.Kind = metrics.ParseKind(r.Kind)
+	}
+	return m
+}
+
+// Коды ошибок хранилища узла кластера.
+const (
+	codeNotFound     = "not_found"
+	codeConflict     = "conflict"
+	codeClosed       = "closed"
+	codeNameTooLong  = "name_too_long"
+	codeNameInvalid  = "name_invalid"
+	codeSeriesLimit  = "series_limit"
+	codeQuota        = "quota_exceeded"
+	codeReadOnly     = "read_only"
+	codeInternal     = "internal"
+	codeUnauthorized = "unauthorized"
+)
+
+var codes = map[string]error{
+	codeNotFound:    storage.ErrNotFound,
+	codeConflict:    storage.ErrConflict,
+	codeClosed:      storage.ErrStorageClosed,
+	codeNameTooLong: storage.ErrNameTooLong,
+	codeNameInvalid: storage.ErrNameInvalid,
+	codeSeriesLimit: storage.ErrSeriesLimit,
+	codeQuota:       storage.ErrQuotaExceeded,
+	codeReadOnly:    storage.ErrReadOnly,
+}
+
+// failure определяет ответ узла кластера с ошибкой.
+type failure struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+	Name  string `json:"name,omitempty"` // Имя метрики для *storage.LimitError.
+}
+
+// newFailure возвращает ответ с ошибкой err.
+func newFailure(err error) failure {
+	var limitErr *storage.LimitError
+	if errors.As(err, &limitErr) {
+		f := failure{Code: codeInternal, Error: limitErr.Err.Error(), Name: limitErr.Name}
+		for code, target := range codes {
+			if errors.Is(limitErr.Err, target) {
+				f.Code = code
+			}
+		}
+		return f
+	}
+
+	for code, target := range codes {
+		if errors.Is(err, target) {
+			return failure{Code: code, Error: err.Error()}
+		}
+	}
+
+	return failure{Code: codeInternal, Error: err.Error()}
+}
+
+// err возвращает ошибку из ответа узла кластера.
+func (f failure) err() error {
+	err := &remoteError{msg: f.Error, err: codes[f.Code]}
+	if f.Name != "" {
+		return &storage.LimitError{Name: f.Name, Err: err}
+	}
+	return err
+}
+
+// remoteError определяет ошибку, возвращённую узлом кластера.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// virtualNodes определяет количество точек узла на кольце.
+const virtualNodes = 128
+
+// Ring определяет кольцо консистентного хеширования имён метрик по узлам
+// кластера.
+//
+// Кольца, построенные из одного набора узлов, назначают имени одного
+// и того же владельца независимо от порядка узлов.
+type Ring struct {
+	hashes []uint64
+	nodes  map[uint64]string
+}
+
+// NewRing возвращает кольцо из узлов nodes.
+func NewRing(nodes ...string) *Ring {
+	r := &Ring{
+		hashes: make([]uint64, 0, len(nodes)*virtualNodes),
+		nodes:  make(map[uint64]string, len(nodes)*virtualNodes),
+	}
+
+	for _, node := range nodes {
+		for i := 0; i < virtualNodes; i++ {
+			h := hash(node + "#" + strconv.Itoa(i))
+			// NOTE: при коллизии точка достаётся меньшему узлу, чтобы
+			// владелец не зависел от порядка узлов.
+			if owner, ok := r.nodes[h]; ok {
+				if owner > node {
+					r.nodes[h] = node
+				}
+				continue
+			}
+			r.nodes[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+
+	return r
+}
+
+// Owner возвращает узел, владеющий метрикой name; для пустого кольца
+// возвращается пустая строка.
+func (r *Ring) Owner(name string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := hash(name)
+
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.nodes[r.hashes[i]]
+}
+
+// hash возвращает хеш строки s.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+
+	// NOTE: FNV плохо перемешивает строки с общим префиксом, поэтому
+	// хеш дополнительно перемешивается финализатором splitmix64.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,55 @@
+package cluster_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/cluster"
+)
+
+func TestRing(t *testing.T) {
+	nodes := []string{"a:8080", "b:8080", "c:8080"}
+
+	t.Run("empty", func(t *testing.T) {
+		require.Empty(t, cluster.NewRing().Owner("metric"))
+	})
+
+	t.Run("order", func(t *testing.T) {
+		ring := cluster.NewRing(nodes...)
+		reversed := cluster.NewRing(nodes[2], nodes[1], nodes[0])
+
+		for i := 0; i < 1000; i++ {
+			name := "metric" + strconv.Itoa(i)
+			require.Equal(t, ring.Owner(name), reversed.Owner(name))
+		}
+	})
+
+	t.Run("distribution", func(t *testing.T) {
+		ring := cluster.NewRing(nodes...)
+
+		counts := make(map[string]int)
+		for i := 0; i < 3000; i++ {
+			counts[ring.Owner("metric"+strconv.Itoa(i))]++
+		}
+
+		require.Len(t, counts, len(nodes))
+		for _, n := range counts {
+			require.InDelta(t, 1000, n, 300)
+		}
+	})
+
+	t.Run("rebalance", func(t *testing.T) {
+		ring := cluster.NewRing(nodes...)
+		grown := cluster.NewRing(append(nodes, "d:8080")...)
+
+		// NOTE: при добавлении узла метрики переходят только к нему.
+		for i := 0; i < 1000; i++ {
+			name := "metric" + strconv.Itoa(i)
+			if owner := grown.Owner(name); owner != "d:8080" {
+				require.Equal(t, ring.Owner(name), owner)
+			}
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"flag"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/sergeizaitcev/metrics/pkg/commands"
@@ -21,6 +22,9 @@ var DefaultAgent = &Agent{
 	ReportInterval: 2 * time.Second,
 	RateLimit:      1,
 	GRPCEnabled:    false,
+	Summaries:      nil,
+	APIKey:         "",
+	Tenant:         "",
 }
 
 var (
@@ -71,6 +75,18 @@ type Agent struct {
 	// По умолчанию false.
 	GRPCEnabled bool `env:"GRPC_ENABLED" json:"grpc_enabled"`
 
+	// Наименования датчиков, значения которых накапливаются в скетчи между
+	// отправками и передаются как сводки с суффиксом "Summary".
+	//
+	// По умолчанию пусто.
+	Summaries []string `env:"SUMMARIES" json:"summaries"`
+
+	// Ключ API, по которому сервер определяет арендатора метрик.
+	APIKey string `env:"API_KEY" json:"api_key"`
+
+	// Арендатор метрик; используется, если сервер не проверяет ключи API.
+	Tenant string `env:"TENANT" json:"tenant"`
+
 	pollInternval, reportInterval *int64
 }
 
@@ -96,6 +112,12 @@ func (a *Agent) SetFlags(fs *flag.FlagSet) {
 	)
 	fs.IntVar(&a.RateLimit, "l", DefaultAgent.RateLimit, "rate limit")
 	fs.BoolVar(&a.GRPCEnabled, "grpc", DefaultAgent.GRPCEnabled, "grpc on")
+	fs.StringVar(&a.APIKey, "api-key", DefaultAgent.APIKey, "tenant api key")
+	fs.StringVar(&a.Tenant, "tenant", DefaultAgent.Tenant, "tenant")
+	fs.Func("summaries", "comma-separated gauge names to summarize", func(s string) error {
+		a.Summaries = strings.Split(s, ",")
+		return nil
+	})
 	a.pollInternval = fs.Int64(
 		"p",
 		second(DefaultAgent.PollInterval),
@@ -0,0 +1,73 @@
+package configs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	_ encoding.TextMarshaler   = Nodes{}
+	_ encoding.TextUnmarshaler = (*Nodes)(nil)
+)
+
+// Nodes определяет адреса узлов кластера.
+//
+// Текстовое представление имеет вид "host1:8080,host2:8080".
+type Nodes []string
+
+// Validate возвращает ошибку, если адреса узлов некорректны.
+func (n Nodes) Validate() error {
+	seen := make(map[string]struct{}, len(n))
+	for _, node := range n {
+		if node == "" {
+			return errors.New("node address must be not empty")
+		}
+		if _, ok := seen[node]; ok {
+			return fmt.Errorf("duplicate node %q", node)
+		}
+		seen[node] = struct{}{}
+	}
+	return nil
+}
+
+// Contains возвращает true, если среди узлов есть узел node.
+func (n Nodes) Contains(node string) bool {
+	for _, v := range n {
+		if v == node {
+			return true
+		}
+	}
+	return false
+}
+
+// String возвращает текстовое представление адресов узлов.
+func (n Nodes) String() string {
+	return strings.Join(n, ",")
+}
+
+func (n Nodes) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+func (n *Nodes) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*n = nil
+		return nil
+	}
+
+	var nodes Nodes
+	for _, node := range strings.Split(s, ",") {
+		nodes = append(nodes, strings.TrimSpace(node))
+	}
+
+	if err := nodes.Validate(); err != nil {
+		return err
+	}
+
+	*n = nodes
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package configs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+)
+
+func TestNodes_UnmarshalText(t *testing.T) {
+	testCases := []struct {
+		name      string
+		text      string
+		want      configs.Nodes
+		wantText  string
+		wantError bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "nodes",
+			text:     "node1:8080, node2:8080",
+			want:     configs.Nodes{"node1:8080", "node2:8080"},
+			wantText: "node1:8080,node2:8080",
+		},
+		{
+			name:      "empty node",
+			text:      "node1:8080,,node2:8080",
+			wantError: true,
+		},
+		{
+			name:      "duplicate node",
+			text:      "node1:8080,node1:8080",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var nodes configs.Nodes
+
+			err := nodes.UnmarshalText([]byte(tc.text))
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, nodes)
+			require.Equal(t, tc.wantText, nodes.String())
+		})
+	}
+}
+
+func TestServer_Validate_cluster(t *testing.T) {
+	testCases := []struct {
+		name      string
+		nodes     configs.Nodes
+		key       string
+		wantError bool
+	}{
+		{
+			name: "without cluster",
+		},
+		{
+			name:  "cluster",
+			nodes: configs.Nodes{"localhost:8080", "node2:8080"},
+			key:   "secret",
+		},
+		{
+			name:      "without key",
+			nodes:     configs.Nodes{"localhost:8080", "node2:8080"},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := *configs.DefaultServer
+			cfg.ClusterNodes = tc.nodes
+			cfg.ClusterKey = tc.key
+
+			err := cfg.Validate()
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServer_Validate_replication(t *testing.T) {
+	testCases := []struct {
+		name      string
+		replicaOf string
+		key       string
+		wantError bool
+	}{
+		{
+			name: "leader",
+		},
+		{
+			name:      "follower",
+			replicaOf: "leader:3200",
+			key:       "secret",
+		},
+		{
+			name:      "without key",
+			replicaOf: "leader:3200",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := *configs.DefaultServer
+			cfg.ReplicaOf = tc.replicaOf
+			cfg.ReplicationKey = tc.key
+
+			err := cfg.Validate()
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
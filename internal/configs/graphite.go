@@ -0,0 +1,78 @@
+package configs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	_ encoding.TextMarshaler   = GraphiteRules{}
+	_ encoding.TextUnmarshaler = (*GraphiteRules)(nil)
+)
+
+// GraphiteRule определяет правило переименования пути Graphite.
+type GraphiteRule struct {
+	// Шаблон пути.
+	Pattern *regexp.Regexp
+
+	// Замена совпадений шаблона; $1 и ${name} заменяются группами шаблона.
+	Replacement string
+}
+
+// GraphiteRules определяет правила переименования путей Graphite в имена
+// метрик.
+//
+// Текстовое представление имеет вид "pattern1=replacement1;pattern2=replacement2",
+// где шаблон отделяется от замены последним знаком "=".
+type GraphiteRules []GraphiteRule
+
+// String возвращает текстовое представление правил.
+func (r GraphiteRules) String() string {
+	rules := make([]string, 0, len(r))
+	for _, rule := range r {
+		rules = append(rules, rule.Pattern.String()+"="+rule.Replacement)
+	}
+	return strings.Join(rules, ";")
+}
+
+func (r GraphiteRules) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *GraphiteRules) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*r = nil
+		return nil
+	}
+
+	var rules GraphiteRules
+	for _, rule := range strings.Split(s, ";") {
+		i := strings.LastIndexByte(rule, '=')
+		if i < 0 {
+			return fmt.Errorf("rule %q must have the format pattern=replacement", rule)
+		}
+
+		pattern := strings.TrimSpace(rule[:i])
+		if pattern == "" {
+			return errors.New("rule pattern must be not empty")
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid rule pattern: %w", err)
+		}
+
+		rules = append(rules, GraphiteRule{
+			Pattern:     re,
+			Replacement: strings.TrimSpace(rule[i+1:]),
+		})
+	}
+
+	*r = rules
+
+	return nil
+}
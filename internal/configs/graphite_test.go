@@ -0,0 +1,61 @@
+package configs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+)
+
+func TestGraphiteRules_UnmarshalText(t *testing.T) {
+	testCases := []struct {
+		name      string
+		text      string
+		wantText  string
+		wantError bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "rules",
+			text:     `^servers\.(?P<host>[^.]+)\.(.+)$ = $2; \.=_`,
+			wantText: `^servers\.(?P<host>[^.]+)\.(.+)$=$2;\.=_`,
+		},
+		{
+			name:     "empty replacement",
+			text:     `^prefix\.=`,
+			wantText: `^prefix\.=`,
+		},
+		{
+			name:      "without replacement",
+			text:      `^servers\.`,
+			wantError: true,
+		},
+		{
+			name:      "empty pattern",
+			text:      `=_`,
+			wantError: true,
+		},
+		{
+			name:      "invalid pattern",
+			text:      `(=_`,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var rules configs.GraphiteRules
+
+			err := rules.UnmarshalText([]byte(tc.text))
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantText, rules.String())
+		})
+	}
+}
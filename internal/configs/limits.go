@@ -0,0 +1,50 @@
+package configs
+
+import (
+	"encoding"
+	"fmt"
+	"regexp"
+)
+
+// DatabaseNameLength определяет максимальную длину имени метрики в БД
+// PostgreSQL.
+const DatabaseNameLength = 256
+
+var (
+	_ encoding.TextMarshaler   = NamePattern{}
+	_ encoding.TextUnmarshaler = (*NamePattern)(nil)
+)
+
+// NamePattern определяет шаблон допустимого имени метрики.
+//
+// Пустой шаблон допускает любое имя.
+type NamePattern struct {
+	*regexp.Regexp
+}
+
+// String возвращает текстовое представление шаблона.
+func (p NamePattern) String() string {
+	if p.Regexp == nil {
+		return ""
+	}
+	return p.Regexp.String()
+}
+
+func (p NamePattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *NamePattern) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = NamePattern{}
+		return nil
+	}
+
+	re, err := regexp.Compile(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid metric name pattern: %w", err)
+	}
+	*p = NamePattern{re}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package configs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+)
+
+func TestServer_Validate_maxNameLength(t *testing.T) {
+	testCases := []struct {
+		name      string
+		dsn       string
+		length    int
+		wantError bool
+	}{
+		{
+			name:   "default",
+			length: configs.DefaultServer.MaxNameLength,
+		},
+		{
+			name: "unlimited",
+		},
+		{
+			name:   "database",
+			dsn:    "postgres://localhost/metrics",
+			length: configs.DefaultServer.MaxNameLength,
+		},
+		{
+			name:      "database unlimited",
+			dsn:       "postgres://localhost/metrics",
+			wantError: true,
+		},
+		{
+			name:      "database too long",
+			dsn:       "postgres://localhost/metrics",
+			length:    configs.DatabaseNameLength + 1,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := *configs.DefaultServer
+			cfg.DatabaseDSN = tc.dsn
+			cfg.MaxNameLength = tc.length
+
+			err := cfg.Validate()
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package configs
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+
+	"github.com/sergeizaitcev/metrics/pkg/commands"
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+)
+
+var DefaultMigrate = &Migrate{
+	Level:      logging.LevelInfo,
+	ConfigPath: "",
+	From:       "",
+	To:         "",
+	BatchSize:  1000,
+	DryRun:     false,
+	Verify:     false,
+}
+
+var (
+	_ commands.Config = (*Migrate)(nil)
+	_ io.ReaderFrom   = (*Migrate)(nil)
+)
+
+// Migrate определяет конфиг для копирования метрик между хранилищами.
+//
+// Хранилища задаются строкой подключения: "postgres://..." или
+// "postgresql://..." для postgres, "sqlite://<path>" для SQLite,
+// "file://<path>" или путь к файлу для локального хранилища.
+type Migrate struct {
+	commands.UnimplementedConfig
+
+	// Путь к файлу конфигурации.
+	ConfigPath commands.ConfigPath `env:"CONFIG" json:"-"`
+
+	// Уровень логирования.
+	//
+	// По умолчанию "info".
+	Level logging.Level `env:"LEVEL" json:"level"`
+
+	// Хранилище, из которого копируются метрики.
+	From string `env:"FROM" json:"from"`
+
+	// Хранилище, в которое копируются метрики.
+	To string `env:"TO" json:"to"`
+
+	// Количество метрик, сохраняемых за один запрос.
+	//
+	// По умолчанию 1000.
+	BatchSize int `env:"BATCH_SIZE" json:"batch_size"`
+
+	// Индикатор пробного запуска: метрики сравниваются, но не сохраняются.
+	//
+	// По умолчанию false.
+	DryRun bool `env:"DRY_RUN" json:"dry_run"`
+
+	// Индикатор сверки значений метрик в хранилищах после копирования.
+	//
+	// По умолчанию false.
+	Verify bool `env:"VERIFY" json:"verify"`
+}
+
+func (m *Migrate) ReadFrom(r io.Reader) (int64, error) {
+	dec := json.NewDecoder(r)
+	err := dec.Decode(m)
+	if err != nil {
+		return 0, err
+	}
+	return dec.InputOffset(), nil
+}
+
+func (m *Migrate) Validate() error {
+	if m.From == "" {
+		return errors.New("source storage must be not empty")
+	}
+	if m.To == "" {
+		return errors.New("destination storage must be not empty")
+	}
+	if m.From == m.To {
+		return errors.New("source and destination storages must be different")
+	}
+	if m.BatchSize <= 0 {
+		return errors.New("batch size must be is greater than zero")
+	}
+	return nil
+}
+
+func (m *Migrate) SetFlags(fs *flag.FlagSet) {
+	fs.Var(&m.ConfigPath, "c", "path to config")
+	fs.TextVar(&m.Level, "v", DefaultMigrate.Level, "logging level")
+	fs.StringVar(&m.From, "from", DefaultMigrate.From, "source storage")
+	fs.StringVar(&m.To, "to", DefaultMigrate.To, "destination storage")
+	fs.IntVar(&m.BatchSize, "batch", DefaultMigrate.BatchSize, "batch size")
+	fs.BoolVar(&m.DryRun, "dry-run", DefaultMigrate.DryRun, "compare without writing")
+	fs.BoolVar(&m.Verify, "verify", DefaultMigrate.Verify, "verify after copying")
+}
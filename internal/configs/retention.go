@@ -0,0 +1,181 @@
+package configs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	_ encoding.TextMarshaler   = Retention{}
+	_ encoding.TextUnmarshaler = (*Retention)(nil)
+)
+
+// Retention определяет политику хранения истории метрик: срок хранения
+// исходных значений и уровни агрегирования.
+//
+// Текстовое представление имеет вид "raw:24h,1m:30d,1h:1y", где первый
+// элемент определяет срок хранения исходных значений, а остальные элементы
+// определяют разрешение и срок хранения уровней агрегирования. Допустимые
+// единицы измерения: s, m, h, d, w, y. Пустая политика отключает удаление
+// и агрегирование истории, поэтому сервер её не допускает.
+type Retention struct {
+	// Срок хранения исходных значений.
+	Raw time.Duration
+
+	// Уровни агрегирования в порядке возрастания разрешения.
+	Tiers []Tier
+}
+
+// Tier определяет уровень агрегирования истории метрик.
+type Tier struct {
+	// Длительность интервала агрегирования.
+	Resolution time.Duration
+
+	// Срок хранения агрегированных значений.
+	TTL time.Duration
+}
+
+// IsEmpty возвращает true, если политика хранения пуста.
+func (r Retention) IsEmpty() bool {
+	return r.Raw == 0 && len(r.Tiers) == 0
+}
+
+// Validate возвращает ошибку, если политика хранения некорректна.
+func (r Retention) Validate() error {
+	if r.IsEmpty() {
+		return nil
+	}
+	if r.Raw <= 0 {
+		return errors.New("raw retention must be is greater than zero")
+	}
+	for i, tier := range r.Tiers {
+		if tier.Resolution <= 0 {
+			return errors.New("rollup resolution must be is greater than zero")
+		}
+		if i > 0 && r.Tiers[i-1].Resolution >= tier.Resolution {
+			return errors.New("rollup resolutions must be in increasing order")
+		}
+		if tier.Resolution > r.Raw {
+			return errors.New("rollup resolution must not exceed raw retention")
+		}
+		if tier.TTL < tier.Resolution {
+			return errors.New("rollup retention must not be less than its resolution")
+		}
+	}
+	return nil
+}
+
+// String возвращает текстовое представление политики хранения.
+func (r Retention) String() string {
+	if r.IsEmpty() {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString("raw:")
+	b.WriteString(formatPeriod(r.Raw))
+
+	for _, tier := range r.Tiers {
+		b.WriteByte(',')
+		b.WriteString(formatPeriod(tier.Resolution))
+		b.WriteByte(':')
+		b.WriteString(formatPeriod(tier.TTL))
+	}
+
+	return b.String()
+}
+
+func (r Retention) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Retention) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*r = Retention{}
+		return nil
+	}
+
+	var retention Retention
+
+	for i, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return fmt.Errorf("invalid retention item %q", item)
+		}
+
+		ttl, err := parsePeriod(value)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			if key != "raw" {
+				return errors.New(`retention must start with the "raw" item`)
+			}
+			retention.Raw = ttl
+			continue
+		}
+
+		resolution, err := parsePeriod(key)
+		if err != nil {
+			return err
+		}
+
+		retention.Tiers = append(retention.Tiers, Tier{
+			Resolution: resolution,
+			TTL:        ttl,
+		})
+	}
+
+	if err := retention.Validate(); err != nil {
+		return err
+	}
+
+	*r = retention
+
+	return nil
+}
+
+var periodUnits = []struct {
+	suffix string
+	value  time.Duration
+}{
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// parsePeriod парсит период в формате "<число><единица измерения>".
+func parsePeriod(s string) (time.Duration, error) {
+	for _, unit := range periodUnits {
+		v, ok := strings.CutSuffix(s, unit.suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			break
+		}
+		return time.Duration(n) * unit.value, nil
+	}
+	return 0, fmt.Errorf("invalid retention period %q", s)
+}
+
+// formatPeriod возвращает период в наибольших целых единицах измерения.
+func formatPeriod(d time.Duration) string {
+	for _, unit := range periodUnits {
+		if d%unit.value == 0 {
+			return strconv.FormatInt(int64(d/unit.value), 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
@@ -0,0 +1,120 @@
+package configs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+)
+
+func TestRetention_UnmarshalText(t *testing.T) {
+	const day = 24 * time.Hour
+
+	testCases := []struct {
+		name      string
+		text      string
+		want      configs.Retention
+		wantText  string
+		wantError bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "default",
+			text: "raw:24h,1m:30d,1h:1y",
+			want: configs.Retention{
+				Raw: day,
+				Tiers: []configs.Tier{
+					{Resolution: time.Minute, TTL: 30 * day},
+					{Resolution: time.Hour, TTL: 365 * day},
+				},
+			},
+			wantText: "raw:1d,1m:30d,1h:1y",
+		},
+		{
+			name:     "raw only",
+			text:     "raw:90s",
+			want:     configs.Retention{Raw: 90 * time.Second},
+			wantText: "raw:90s",
+		},
+		{
+			name:      "without raw",
+			text:      "1m:30d",
+			wantError: true,
+		},
+		{
+			name:      "invalid period",
+			text:      "raw:24x",
+			wantError: true,
+		},
+		{
+			name:      "unordered tiers",
+			text:      "raw:24h,1h:1y,1m:30d",
+			wantError: true,
+		},
+		{
+			name:      "resolution exceeds raw",
+			text:      "raw:1h,1d:1y",
+			wantError: true,
+		},
+		{
+			name:      "ttl less than resolution",
+			text:      "raw:24h,1h:1m",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got configs.Retention
+
+			err := got.UnmarshalText([]byte(tc.text))
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+			require.Equal(t, tc.wantText, got.String())
+		})
+	}
+}
+
+func TestServer_Validate_retention(t *testing.T) {
+	testCases := []struct {
+		name      string
+		retention configs.Retention
+		wantError bool
+	}{
+		{
+			name:      "default",
+			retention: configs.DefaultServer.Retention,
+		},
+		{
+			name:      "raw only",
+			retention: configs.Retention{Raw: time.Hour},
+		},
+		{
+			name:      "empty",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := *configs.DefaultServer
+			cfg.Retention = tc.retention
+
+			err := cfg.Validate()
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
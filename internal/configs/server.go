@@ -14,17 +14,47 @@ import (
 )
 
 var DefaultServer = &Server{
-	Level:           logging.LevelInfo,
-	ConfigPath:      "",
-	Address:         "localhost:8080",
-	StreamAddress:   "localhost:8090",
-	SHA256Key:       "",
-	PrivateKeyPath:  "",
-	DatabaseDSN:     "",
-	FileStoragePath: "/tmp/metrics-db.wal",
-	StoreInterval:   300 * time.Second,
-	Restore:         true,
-	TrustedSubnet:   "",
+	Level:               logging.LevelInfo,
+	ConfigPath:          "",
+	Address:             "localhost:8080",
+	StreamAddress:       "localhost:8090",
+	StatsDAddress:       "",
+	StatsDFlushInterval: 10 * time.Second,
+	GraphiteAddress:     "",
+	GraphiteRules:       nil,
+	SHA256Key:           "",
+	PrivateKeyPath:      "",
+	DatabaseDSN:         "",
+	DatabaseCache:       false,
+	SQLitePath:          "",
+	FileStoragePath:     "/tmp/metrics-db.wal",
+	StoreInterval:       300 * time.Second,
+	SnapshotInterval:    300 * time.Second,
+	SegmentSize:         64 << 20,
+	Restore:             true,
+	TrustedSubnet:       "",
+	Retention: Retention{
+		Raw: 24 * time.Hour,
+		Tiers: []Tier{
+			{Resolution: time.Minute, TTL: 30 * 24 * time.Hour},
+			{Resolution: time.Hour, TTL: 365 * 24 * time.Hour},
+		},
+	},
+	RetentionInterval:  60 * time.Second,
+	MetricTTL:          0,
+	ExpireInterval:     60 * time.Second,
+	APIKeys:            nil,
+	TenantMaxSeries:    0,
+	TenantWriteRate:    0,
+	MaxSeries:          0,
+	MaxNameLength:      DatabaseNameLength,
+	NamePattern:        NamePattern{},
+	ClusterNodes:       nil,
+	ClusterNode:        "",
+	ClusterKey:         "",
+	ReplicaOf:          "",
+	ReplicationKey:     "",
+	ReplicationBacklog: 1 << 16,
 }
 
 var _ commands.Config = (*Server)(nil)
@@ -51,6 +81,24 @@ type Server struct {
 	// По умолчанию "localhost:8090".
 	StreamAddress string `env:"STREAM_ADDRESS" json:"stream_address"`
 
+	// Адрес UDP- и TCP-сервера StatsD. Если адрес пуст, то сервер
+	// StatsD не запускается.
+	StatsDAddress string `env:"STATSD_ADDRESS" json:"statsd_address"`
+
+	// Интервал сброса агрегированных метрик StatsD в хранилище.
+	//
+	// По умолчанию 10s.
+	StatsDFlushInterval time.Duration `env:"STATSD_FLUSH_INTERVAL" json:"statsd_flush_interval"`
+
+	// Адрес TCP-сервера Graphite. Если адрес пуст, то сервер Graphite
+	// не запускается.
+	GraphiteAddress string `env:"GRAPHITE_ADDRESS" json:"graphite_address"`
+
+	// Правила переименования путей Graphite в имена метрик в формате
+	// "pattern1=replacement1;pattern2=replacement2". Правила применяются
+	// последовательно, а именованные группы шаблонов становятся метками.
+	GraphiteRules GraphiteRules `env:"GRAPHITE_RULES" json:"graphite_rules"`
+
 	// Ключ подписи данных. Если ключ пуст, то данные не подписываются.
 	SHA256Key string `env:"KEY" json:"key"`
 
@@ -60,6 +108,15 @@ type Server struct {
 	// Строка подключения к postgres.
 	DatabaseDSN string `env:"DATABASE_DSN" json:"database_dsn"`
 
+	// Индикатор кеширования текущих значений метрик из postgres в памяти.
+	//
+	// По умолчанию false.
+	DatabaseCache bool `env:"DATABASE_CACHE" json:"database_cache"`
+
+	// Путь к файлу БД SQLite. Если путь не пуст, а строка подключения
+	// к postgres пуста, то метрики хранятся в SQLite.
+	SQLitePath string `env:"SQLITE_PATH" json:"sqlite_path"`
+
 	// Путь к файлу с метриками.
 	//
 	// По умолчанию "/tmp/metrics-db.wal".
@@ -70,6 +127,18 @@ type Server struct {
 	// По умолчанию 300s.
 	StoreInterval time.Duration `env:"STORE_INTERVAL" json:"store_interval"`
 
+	// Интервал записи снимка хранилища и удаления закрытых сегментов
+	// журнала. Нулевое значение отключает запись снимков.
+	//
+	// По умолчанию 300s.
+	SnapshotInterval time.Duration `env:"SNAPSHOT_INTERVAL" json:"snapshot_interval"`
+
+	// Размер сегмента журнала в байтах. Нулевое значение отключает
+	// разбиение журнала на сегменты.
+	//
+	// По умолчанию 64MiB.
+	SegmentSize int64 `env:"SEGMENT_SIZE" json:"segment_size"`
+
 	// Индикатор восстановления данных с диска.
 	//
 	// По умолчанию true.
@@ -78,7 +147,95 @@ type Server struct {
 	// Доверенная подсеть.
 	TrustedSubnet string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
 
-	storeInterval *int64
+	// Политика хранения истории метрик. Пустая политика не допускается:
+	// без неё история метрик и журнал растут неограниченно.
+	//
+	// По умолчанию "raw:24h,1m:30d,1h:1y".
+	Retention Retention `env:"RETENTION" json:"retention"`
+
+	// Интервал агрегирования и удаления истории метрик.
+	//
+	// По умолчанию 60s.
+	RetentionInterval time.Duration `env:"RETENTION_INTERVAL" json:"retention_interval"`
+
+	// Срок, по истечении которого метрика, не получавшая обновлений,
+	// скрывается при чтении и удаляется вместе с историей. Нулевое
+	// значение отключает устаревание метрик.
+	MetricTTL time.Duration `env:"METRIC_TTL" json:"metric_ttl"`
+
+	// Интервал удаления устаревших метрик.
+	//
+	// По умолчанию 60s.
+	ExpireInterval time.Duration `env:"EXPIRE_INTERVAL" json:"expire_interval"`
+
+	// Ключи API арендаторов в формате "key1:tenant1,key2:tenant2".
+	//
+	// Если ключи заданы, арендатор определяется по ключу API, а запросы
+	// без ключа выполняются от имени арендатора по умолчанию; иначе
+	// арендатор передаётся в запросе явно.
+	APIKeys APIKeys `env:"API_KEYS" json:"api_keys"`
+
+	// Максимальное количество метрик каждого арендатора. Нулевое значение
+	// отключает ограничение. Требует ключей API, так как арендатор
+	// из запроса не подтверждён.
+	TenantMaxSeries int `env:"TENANT_MAX_SERIES" json:"tenant_max_series"`
+
+	// Максимальная скорость записи значений метрик каждого арендатора
+	// в секунду. Нулевое значение отключает ограничение. Требует ключей API.
+	TenantWriteRate float64 `env:"TENANT_WRITE_RATE" json:"tenant_write_rate"`
+
+	// Максимальное количество метрик на сервере. Нулевое значение
+	// отключает ограничение.
+	MaxSeries int `env:"MAX_SERIES" json:"max_series"`
+
+	// Максимальная длина имени метрики в символах. Нулевое значение
+	// отключает ограничение; при DatabaseDSN длина не может превышать
+	// DatabaseNameLength.
+	//
+	// По умолчанию 256.
+	MaxNameLength int `env:"MAX_NAME_LENGTH" json:"max_name_length"`
+
+	// Шаблон допустимого имени метрики. Пустой шаблон допускает любое имя.
+	NamePattern NamePattern `env:"NAME_PATTERN" json:"name_pattern"`
+
+	// Адреса HTTP-серверов всех узлов кластера в формате
+	// "host1:8080,host2:8080". Если адреса заданы, метрики распределяются
+	// по узлам кластера по имени, а ограничение MaxSeries применяется
+	// к каждому узлу отдельно.
+	ClusterNodes Nodes `env:"CLUSTER_NODES" json:"cluster_nodes"`
+
+	// Адрес текущего узла среди ClusterNodes.
+	//
+	// По умолчанию совпадает с Address.
+	ClusterNode string `env:"CLUSTER_NODE" json:"cluster_node"`
+
+	// Ключ, который узлы кластера передают в запросах друг к другу.
+	// Обязателен, если задан ClusterNodes.
+	ClusterKey string `env:"CLUSTER_KEY" json:"cluster_key"`
+
+	// Адрес стриминг-сервера ведущего сервера. Если адрес задан, сервер
+	// становится ведомым: применяет записи журнала ведущего сервера,
+	// обслуживает чтение и отклоняет изменения до повышения.
+	ReplicaOf string `env:"REPLICA_OF" json:"replica_of"`
+
+	// Ключ, который ведомый сервер передаёт ведущему в запросах репликации.
+	// Без ключа сервер отклоняет запросы репликации и повышения;
+	// обязателен, если задан ReplicaOf.
+	ReplicationKey string `env:"REPLICATION_KEY" json:"replication_key"`
+
+	// Количество последних записей журнала, которые хранятся в памяти
+	// для передачи ведомым серверам. Ведомый сервер, отставший больше,
+	// догоняет ведущий по снимку. Нулевое значение отключает репликацию.
+	//
+	// По умолчанию 65536.
+	ReplicationBacklog int `env:"REPLICATION_BACKLOG" json:"replication_backlog"`
+
+	storeInterval       *int64
+	snapshotInterval    *int64
+	retentionInterval   *int64
+	metricTTL           *int64
+	expireInterval      *int64
+	statsdFlushInterval *int64
 }
 
 func (s *Server) CIDR() *net.IPNet {
@@ -86,6 +243,14 @@ func (s *Server) CIDR() *net.IPNet {
 	return subnet
 }
 
+// Node возвращает адрес текущего узла кластера.
+func (s *Server) Node() string {
+	if s.ClusterNode != "" {
+		return s.ClusterNode
+	}
+	return s.Address
+}
+
 func (s *Server) ReadFrom(r io.Reader) (int64, error) {
 	dec := json.NewDecoder(r)
 	err := dec.Decode(s)
@@ -99,21 +264,102 @@ func (s *Server) Validate() error {
 	if s.storeInterval != nil {
 		s.StoreInterval = duration(*s.storeInterval)
 	}
+	if s.snapshotInterval != nil {
+		s.SnapshotInterval = duration(*s.snapshotInterval)
+	}
+	if s.retentionInterval != nil {
+		s.RetentionInterval = duration(*s.retentionInterval)
+	}
+	if s.metricTTL != nil {
+		s.MetricTTL = duration(*s.metricTTL)
+	}
+	if s.expireInterval != nil {
+		s.ExpireInterval = duration(*s.expireInterval)
+	}
+	if s.statsdFlushInterval != nil {
+		s.StatsDFlushInterval = duration(*s.statsdFlushInterval)
+	}
 	if s.Address == "" {
 		return errors.New("address must be not empty")
 	}
 	if s.StreamAddress == "" {
 		return errors.New("stream address must be not empty")
 	}
+	if s.StatsDAddress != "" && s.StatsDFlushInterval <= 0 {
+		return errors.New("statsd flush interval must be is greater than zero")
+	}
 	if s.StoreInterval < 0 {
 		return errors.New("store interval must be is greater than or equal to zero")
 	}
+	if s.SnapshotInterval < 0 {
+		return errors.New("snapshot interval must be is greater than or equal to zero")
+	}
+	if s.SegmentSize < 0 {
+		return errors.New("segment size must be is greater than or equal to zero")
+	}
 	if s.TrustedSubnet != "" {
 		_, _, err := net.ParseCIDR(s.TrustedSubnet)
 		if err != nil {
 			return fmt.Errorf("trusted subnet must have the CIDR format: %w", err)
 		}
 	}
+	if err := s.Retention.Validate(); err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	if s.Retention.IsEmpty() {
+		return errors.New("retention must be not empty, otherwise the metric history grows without bound")
+	}
+	if s.RetentionInterval <= 0 {
+		return errors.New("retention interval must be is greater than zero")
+	}
+	if s.MetricTTL < 0 {
+		return errors.New("metric ttl must be is greater than or equal to zero")
+	}
+	if s.MetricTTL > 0 && s.ExpireInterval <= 0 {
+		return errors.New("expire interval must be is greater than zero")
+	}
+	if err := s.APIKeys.Validate(); err != nil {
+		return fmt.Errorf("api keys: %w", err)
+	}
+	if s.TenantMaxSeries < 0 {
+		return errors.New("tenant max series must be is greater than or equal to zero")
+	}
+	if s.TenantWriteRate < 0 {
+		return errors.New("tenant write rate must be is greater than or equal to zero")
+	}
+	if (s.TenantMaxSeries > 0 || s.TenantWriteRate > 0) && len(s.APIKeys) == 0 {
+		return errors.New("tenant limits require api keys")
+	}
+	if s.MaxSeries < 0 {
+		return errors.New("max series must be is greater than or equal to zero")
+	}
+	if s.MaxNameLength < 0 {
+		return errors.New("max name length must be is greater than or equal to zero")
+	}
+	if s.DatabaseDSN != "" && (s.MaxNameLength == 0 || s.MaxNameLength > DatabaseNameLength) {
+		return fmt.Errorf("max name length must be in the range [1, %d] for the database", DatabaseNameLength)
+	}
+	if err := s.ClusterNodes.Validate(); err != nil {
+		return fmt.Errorf("cluster nodes: %w", err)
+	}
+	if len(s.ClusterNodes) > 0 && !s.ClusterNodes.Contains(s.Node()) {
+		return fmt.Errorf("cluster nodes must contain the node %q", s.Node())
+	}
+	if len(s.ClusterNodes) > 0 && s.ClusterKey == "" {
+		return errors.New("cluster nodes require the cluster key")
+	}
+	if s.ReplicationBacklog < 0 {
+		return errors.New("replication backlog must be is greater than or equal to zero")
+	}
+	if s.ReplicaOf != "" && (s.DatabaseDSN != "" || s.SQLitePath != "") {
+		return errors.New("replica of requires the file storage")
+	}
+	if s.ReplicaOf != "" && s.ReplicationKey == "" {
+		return errors.New("replica of requires the replication key")
+	}
+	if s.ReplicaOf != "" && len(s.ClusterNodes) > 0 {
+		return errors.New("replica of is incompatible with cluster nodes")
+	}
 	return nil
 }
 
@@ -122,6 +368,14 @@ func (s *Server) SetFlags(fs *flag.FlagSet) {
 	fs.TextVar(&s.Level, "v", DefaultServer.Level, "logging level")
 	fs.StringVar(&s.Address, "a", DefaultServer.Address, "server address")
 	fs.StringVar(&s.StreamAddress, "s", DefaultServer.StreamAddress, "stream server address")
+	fs.StringVar(&s.StatsDAddress, "statsd", DefaultServer.StatsDAddress, "statsd server address")
+	s.statsdFlushInterval = fs.Int64(
+		"statsd-flush-interval",
+		second(DefaultServer.StatsDFlushInterval),
+		"statsd flush interval in seconds",
+	)
+	fs.StringVar(&s.GraphiteAddress, "graphite", DefaultServer.GraphiteAddress, "graphite server address")
+	fs.TextVar(&s.GraphiteRules, "graphite-rules", DefaultServer.GraphiteRules, "graphite path rewrite rules")
 	fs.StringVar(&s.SHA256Key, "k", DefaultServer.SHA256Key, "secret sha256 key")
 	fs.StringVar(
 		&s.PrivateKeyPath,
@@ -130,6 +384,8 @@ func (s *Server) SetFlags(fs *flag.FlagSet) {
 		"path to private key",
 	)
 	fs.StringVar(&s.DatabaseDSN, "d", DefaultServer.DatabaseDSN, "database dsn")
+	fs.BoolVar(&s.DatabaseCache, "database-cache", DefaultServer.DatabaseCache, "cache database values")
+	fs.StringVar(&s.SQLitePath, "sqlite", DefaultServer.SQLitePath, "sqlite database path")
 	fs.StringVar(
 		&s.FileStoragePath,
 		"f",
@@ -143,4 +399,58 @@ func (s *Server) SetFlags(fs *flag.FlagSet) {
 		second(DefaultServer.StoreInterval),
 		"store interval in seconds",
 	)
+	s.snapshotInterval = fs.Int64(
+		"snapshot-interval",
+		second(DefaultServer.SnapshotInterval),
+		"snapshot interval in seconds",
+	)
+	fs.Int64Var(&s.SegmentSize, "segment-size", DefaultServer.SegmentSize, "wal segment size in bytes")
+	fs.TextVar(&s.Retention, "retention", DefaultServer.Retention, "retention policy")
+	s.retentionInterval = fs.Int64(
+		"retention-interval",
+		second(DefaultServer.RetentionInterval),
+		"retention interval in seconds",
+	)
+	s.metricTTL = fs.Int64(
+		"metric-ttl",
+		second(DefaultServer.MetricTTL),
+		"metric ttl in seconds",
+	)
+	s.expireInterval = fs.Int64(
+		"expire-interval",
+		second(DefaultServer.ExpireInterval),
+		"expire interval in seconds",
+	)
+	fs.TextVar(&s.APIKeys, "api-keys", DefaultServer.APIKeys, "tenant api keys")
+	fs.IntVar(
+		&s.TenantMaxSeries,
+		"tenant-max-series",
+		DefaultServer.TenantMaxSeries,
+		"max series per tenant",
+	)
+	fs.Float64Var(
+		&s.TenantWriteRate,
+		"tenant-write-rate",
+		DefaultServer.TenantWriteRate,
+		"max written values per second per tenant",
+	)
+	fs.IntVar(&s.MaxSeries, "max-series", DefaultServer.MaxSeries, "max series")
+	fs.IntVar(
+		&s.MaxNameLength,
+		"max-name-length",
+		DefaultServer.MaxNameLength,
+		"max metric name length",
+	)
+	fs.TextVar(&s.NamePattern, "name-pattern", DefaultServer.NamePattern, "metric name pattern")
+	fs.TextVar(&s.ClusterNodes, "cluster-nodes", DefaultServer.ClusterNodes, "cluster node addresses")
+	fs.StringVar(&s.ClusterNode, "cluster-node", DefaultServer.ClusterNode, "cluster node address")
+	fs.StringVar(&s.ClusterKey, "cluster-key", DefaultServer.ClusterKey, "cluster key")
+	fs.StringVar(&s.ReplicaOf, "replica-of", DefaultServer.ReplicaOf, "leader stream server address")
+	fs.StringVar(&s.ReplicationKey, "replication-key", DefaultServer.ReplicationKey, "replication key")
+	fs.IntVar(
+		&s.ReplicationBacklog,
+		"replication-backlog",
+		DefaultServer.ReplicationBacklog,
+		"replication backlog in records",
+	)
 }
@@ -0,0 +1,98 @@
+package configs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	_ encoding.TextMarshaler   = APIKeys{}
+	_ encoding.TextUnmarshaler = (*APIKeys)(nil)
+)
+
+// maxTenantLen определяет максимальную длину имени арендатора.
+const maxTenantLen = 64
+
+// ValidateTenant возвращает ошибку, если имя арендатора некорректно.
+// Имя арендатора состоит из латинских букв, цифр, символов "_" и "-";
+// пустое имя соответствует арендатору по умолчанию.
+func ValidateTenant(tenant string) error {
+	if len(tenant) > maxTenantLen {
+		return fmt.Errorf("tenant %q is longer than %d characters", tenant, maxTenantLen)
+	}
+	for _, r := range tenant {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return fmt.Errorf("tenant %q contains invalid character %q", tenant, r)
+		}
+	}
+	return nil
+}
+
+// APIKeys определяет соответствие ключей API арендаторам.
+//
+// Текстовое представление имеет вид "key1:tenant1,key2:tenant2".
+type APIKeys map[string]string
+
+// Validate возвращает ошибку, если ключи API некорректны.
+func (k APIKeys) Validate() error {
+	for key, tenant := range k {
+		if key == "" {
+			return errors.New("api key must be not empty")
+		}
+		if tenant == "" {
+			return errors.New("api key tenant must be not empty")
+		}
+		if err := ValidateTenant(tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String возвращает текстовое представление ключей API.
+func (k APIKeys) String() string {
+	items := make([]string, 0, len(k))
+	for key, tenant := range k {
+		items = append(items, key+":"+tenant)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (k APIKeys) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *APIKeys) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*k = nil
+		return nil
+	}
+
+	keys := make(APIKeys)
+
+	for _, item := range strings.Split(s, ",") {
+		key, tenant, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return fmt.Errorf("invalid api key item %q", item)
+		}
+		if _, ok := keys[key]; ok {
+			return fmt.Errorf("duplicate api key for tenant %q", tenant)
+		}
+		keys[key] = tenant
+	}
+
+	if err := keys.Validate(); err != nil {
+		return err
+	}
+
+	*k = keys
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package configs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+)
+
+func TestAPIKeys_UnmarshalText(t *testing.T) {
+	testCases := []struct {
+		name      string
+		text      string
+		want      configs.APIKeys
+		wantText  string
+		wantError bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "keys",
+			text: "secret2:team-b, secret1:team_a",
+			want: configs.APIKeys{
+				"secret1": "team_a",
+				"secret2": "team-b",
+			},
+			wantText: "secret1:team_a,secret2:team-b",
+		},
+		{
+			name:      "without tenant",
+			text:      "secret",
+			wantError: true,
+		},
+		{
+			name:      "empty tenant",
+			text:      "secret:",
+			wantError: true,
+		},
+		{
+			name:      "empty key",
+			text:      ":team",
+			wantError: true,
+		},
+		{
+			name:      "invalid tenant",
+			text:      "secret:team/a",
+			wantError: true,
+		},
+		{
+			name:      "duplicate key",
+			text:      "secret:a,secret:b",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var keys configs.APIKeys
+
+			err := keys.UnmarshalText([]byte(tc.text))
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, keys)
+			require.Equal(t, tc.wantText, keys.String())
+		})
+	}
+}
+
+func TestServer_Validate_tenantLimits(t *testing.T) {
+	testCases := []struct {
+		name      string
+		keys      configs.APIKeys
+		maxSeries int
+		writeRate float64
+		wantError bool
+	}{
+		{
+			name: "unlimited",
+		},
+		{
+			name:      "api keys",
+			keys:      configs.APIKeys{"secret": "team"},
+			maxSeries: 10,
+			writeRate: 100,
+		},
+		{
+			name:      "max series without api keys",
+			maxSeries: 10,
+			wantError: true,
+		},
+		{
+			name:      "write rate without api keys",
+			writeRate: 100,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := *configs.DefaultServer
+			cfg.APIKeys = tc.keys
+			cfg.TenantMaxSeries = tc.maxSeries
+			cfg.TenantWriteRate = tc.writeRate
+
+			err := cfg.Validate()
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
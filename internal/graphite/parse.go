@@ -0,0 +1,75 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var (
+	errLineInvalid      = errors.New("line must have the format <path> <value> [<timestamp>]")
+	errPathEmpty        = errors.New("metric path is empty")
+	errTagInvalid       = errors.New("tag must have the format <name>=<value>")
+	errValueInvalid     = errors.New("metric value is invalid")
+	errTimestampInvalid = errors.New("timestamp is invalid")
+)
+
+// Line определяет строку протокола Graphite.
+type Line struct {
+	Path   string
+	Labels metrics.Labels
+	Value  float64
+}
+
+// Parse разбирает строку протокола Graphite вида
+//
+//	<path>[;<tag>=<value>...] <value> [<timestamp>]
+//
+// где timestamp — время в секундах с начала эпохи Unix. Теги пути
+// становятся метками метрики. Временная метка проверяется, но не
+// возвращается (см. Server).
+func Parse(line string) (Line, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Line{}, errLineInvalid
+	}
+
+	path, tags, _ := strings.Cut(fields[0], ";")
+	if path == "" {
+		return Line{}, errPathEmpty
+	}
+
+	l := Line{Path: path}
+
+	if tags != "" {
+		var labels []metrics.Label
+		for _, tag := range strings.Split(tags, ";") {
+			name, value, ok := strings.Cut(tag, "=")
+			if !ok || name == "" || value == "" {
+				return Line{}, fmt.Errorf("%w: %q", errTagInvalid, tag)
+			}
+			labels = append(labels, metrics.Label{Name: name, Value: value})
+		}
+		l.Labels = metrics.NewLabels(labels...)
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Line{}, fmt.Errorf("%w: %q", errValueInvalid, fields[1])
+	}
+	l.Value = v
+
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || !(ts >= 0 && ts < math.MaxInt64/float64(time.Second)) {
+			return Line{}, fmt.Errorf("%w: %q", errTimestampInvalid, fields[2])
+		}
+	}
+
+	return l, nil
+}
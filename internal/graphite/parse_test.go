@@ -0,0 +1,144 @@
+package graphite_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/graphite"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		line    string
+		want    graphite.Line
+		wantErr bool
+	}{
+		{
+			name: "with timestamp",
+			line: "servers.a.cpu.load 1.5 1700000000",
+			want: graphite.Line{Path: "servers.a.cpu.load", Value: 1.5},
+		},
+		{
+			name: "without timestamp",
+			line: "servers.a.cpu.load -2",
+			want: graphite.Line{Path: "servers.a.cpu.load", Value: -2},
+		},
+		{
+			name: "now",
+			line: "servers.a.cpu.load 3 -1",
+			want: graphite.Line{Path: "servers.a.cpu.load", Value: 3},
+		},
+		{
+			name: "tags",
+			line: "cpu.load;host=a;dc=eu 1 1700000000",
+			want: graphite.Line{
+				Path: "cpu.load",
+				Labels: metrics.NewLabels(
+					metrics.Label{Name: "host", Value: "a"},
+					metrics.Label{Name: "dc", Value: "eu"},
+				),
+				Value: 1,
+			},
+		},
+		{
+			name:    "without value",
+			line:    "servers.a.cpu.load",
+			wantErr: true,
+		},
+		{
+			name:    "extra fields",
+			line:    "servers.a.cpu.load 1 1700000000 1",
+			wantErr: true,
+		},
+		{
+			name:    "empty path",
+			line:    ";host=a 1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid tag",
+			line:    "cpu.load;host 1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			line:    "cpu.load nan",
+			wantErr: true,
+		},
+		{
+			name:    "invalid timestamp",
+			line:    "cpu.load 1 now",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := graphite.Parse(tc.line)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rules := []graphite.Rule{
+		{
+			Pattern:     regexp.MustCompile(`^servers\.(?P<host>[^.]+)\.(.+)$`),
+			Replacement: "$2",
+		},
+		{
+			Pattern:     regexp.MustCompile(`\.`),
+			Replacement: "_",
+		},
+	}
+
+	host := func(v string) metrics.Label { return metrics.Label{Name: "host", Value: v} }
+
+	testCases := []struct {
+		name       string
+		path       string
+		labels     metrics.Labels
+		wantName   string
+		wantLabels metrics.Labels
+	}{
+		{
+			name:       "named group",
+			path:       "servers.a.cpu.load",
+			wantName:   "cpu_load",
+			wantLabels: metrics.NewLabels(host("a")),
+		},
+		{
+			name:       "tags take precedence",
+			path:       "servers.a.cpu.load",
+			labels:     metrics.NewLabels(host("b")),
+			wantName:   "cpu_load",
+			wantLabels: metrics.NewLabels(host("b")),
+		},
+		{
+			name:     "partial match",
+			path:     "jobs.queue.size",
+			wantName: "jobs_queue_size",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, labels := graphite.Rewrite(rules, tc.path, tc.labels)
+			require.Equal(t, tc.wantName, name)
+			require.Equal(t, tc.wantLabels, labels)
+		})
+	}
+
+	name, labels := graphite.Rewrite(nil, "servers.a.cpu.load", nil)
+	require.Equal(t, "servers.a.cpu.load", name)
+	require.Empty(t, labels)
+}
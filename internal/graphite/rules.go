@@ -0,0 +1,49 @@
+package graphite
+
+import (
+	"regexp"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// Rule определяет правило переименования пути Graphite.
+type Rule struct {
+	// Шаблон пути.
+	Pattern *regexp.Regexp
+
+	// Замена совпадений шаблона в формате regexp.Regexp.Expand: $1
+	// и ${name} заменяются группами шаблона.
+	Replacement string
+}
+
+// Rewrite возвращает имя и метки метрики для пути path.
+//
+// Правила применяются последовательно: каждое правило заменяет все
+// совпадения своего шаблона в результате предыдущего. Значения именованных
+// групп первого совпадения становятся метками метрики; метки из тегов пути
+// labels имеют приоритет. Путь, не совпавший ни с одним правилом,
+// сохраняется как есть.
+func Rewrite(rules []Rule, path string, labels metrics.Labels) (string, metrics.Labels) {
+	var extra []metrics.Label
+
+	for _, rule := range rules {
+		match := rule.Pattern.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+
+		for i, name := range rule.Pattern.SubexpNames() {
+			if name != "" {
+				extra = append(extra, metrics.Label{Name: name, Value: match[i]})
+			}
+		}
+
+		path = rule.Pattern.ReplaceAllString(path, rule.Replacement)
+	}
+
+	if len(extra) == 0 {
+		return path, labels
+	}
+
+	return path, metrics.NewLabels(append(extra, labels...)...)
+}
@@ -0,0 +1,138 @@
+// Package graphite реализует приём метрик по текстовому протоколу
+// Graphite через TCP.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/sergeizaitcev/metrics/internal/ingest"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+)
+
+const (
+	// maxBatchSize определяет максимальное количество значений,
+	// сохраняемых одним вызовом storage.Storage.Save.
+	maxBatchSize = 1024
+
+	// maxLineSize определяет максимальную длину строки.
+	maxLineSize = 64 << 10
+)
+
+var defaultOpts = &Opts{
+	Logger: logging.Discard(),
+}
+
+// Opts определяет не обязательные параметры для Server.
+type Opts struct {
+	// Правила переименования путей в имена метрик.
+	Rules []Rule
+
+	Logger *logging.Logger
+}
+
+// Server определяет сервер Graphite, сохраняющий значения как датчики.
+//
+// NOTE: временные метки строк игнорируются: значения сохраняются
+// со временем получения.
+type Server struct {
+	*ingest.Listener
+
+	addr    string
+	storage storage.Storage
+	opts    *Opts
+}
+
+// New возвращает сервер Graphite, сохраняющий метрики в s.
+func New(addr string, s storage.Storage, opts *Opts) *Server {
+	if opts == nil {
+		opts = defaultOpts
+	}
+	if opts.Logger == nil {
+		opts.Logger = defaultOpts.Logger
+	}
+
+	return &Server{
+		Listener: ingest.NewListener(opts.Logger),
+		addr:     addr,
+		storage:  s,
+		opts:     opts,
+	}
+}
+
+// ListenAndServe принимает TCP-соединения и блокируется до тех пор, пока
+// не сработает контекст, не сработает метод Close или функция не вернёт
+// ошибку.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	return s.Run(func() error {
+		lis, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return err
+		}
+
+		s.Serve(ctx, lis, s.serveConn)
+
+		return nil
+	})
+}
+
+// serveConn читает строки из соединения до его закрытия и сохраняет
+// значения пакетами: пакет сохраняется, когда в нём maxBatchSize значений
+// или когда прочитаны все поступившие данные. Строка длиннее maxLineSize
+// завершает чтение.
+func (s *Server) serveConn(conn net.Conn) {
+	// NOTE: все поступившие данные прочитаны, если последняя строка
+	// занимает остаток буфера сканера.
+	var drained bool
+
+	scanner := ingest.Scanner(conn, maxLineSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		drained = advance == len(data)
+		return advance, token, err
+	})
+
+	batch := make([]metrics.Metric, 0, maxBatchSize)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			value, ok := s.parse(line)
+			if ok {
+				batch = append(batch, value)
+			}
+		}
+
+		if len(batch) == maxBatchSize || len(batch) > 0 && drained {
+			ingest.Save(context.Background(), s.storage, s.opts.Logger, batch)
+			batch = batch[:0]
+		}
+	}
+
+	ingest.Save(context.Background(), s.storage, s.opts.Logger, batch)
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.opts.Logger.Log(logging.LevelError, err.Error(), "remote_addr", conn.RemoteAddr().String())
+	}
+}
+
+// parse возвращает значение метрики из строки протокола.
+func (s *Server) parse(line string) (metrics.Metric, bool) {
+	l, err := Parse(line)
+	if err != nil {
+		s.opts.Logger.Log(logging.LevelDebug, err.Error(), "line", line)
+		return metrics.Metric{}, false
+	}
+
+	name, labels := Rewrite(s.opts.Rules, l.Path, l.Labels)
+	if name == "" {
+		s.opts.Logger.Log(logging.LevelDebug, errPathEmpty.Error(), "line", line)
+		return metrics.Metric{}, false
+	}
+
+	return metrics.Gauge(name, l.Value, labels...), true
+}
@@ -0,0 +1,103 @@
+package graphite_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/graphite"
+	"github.com/sergeizaitcev/metrics/internal/ingest/ingesttest"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestServer(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	port, err := tcputil.FreePort()
+	require.NoError(t, err)
+	addr := "127.0.0.1:" + port
+
+	s := ingesttest.NewStorage(t)
+
+	srv := graphite.New(addr, s, &graphite.Opts{
+		Rules: []graphite.Rule{
+			{
+				Pattern:     regexp.MustCompile(`^servers\.(?P<host>[^.]+)\.(.+)$`),
+				Replacement: "$2",
+			},
+		},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(context.Background()) }()
+
+	conn := ingesttest.Dial(t, addr)
+
+	_, err = conn.Write([]byte(
+		"servers.a.cpu.load 1.5 1700000000\n" +
+			"invalid\n" +
+			"servers.b.cpu.load 2 -1\n" +
+			"jobs.queue;env=prod 7\n",
+	))
+	require.NoError(t, err)
+
+	want := []metrics.Metric{
+		metrics.Gauge("cpu.load", 1.5, metrics.Label{Name: "host", Value: "a"}),
+		metrics.Gauge("cpu.load", 2, metrics.Label{Name: "host", Value: "b"}),
+		metrics.Gauge("jobs.queue", 7, metrics.Label{Name: "env", Value: "prod"}),
+	}
+
+	require.Eventually(t, func() bool {
+		for _, w := range want {
+			got, err := s.Get(ctx, w.Name(), w.Labels())
+			if err != nil || got.String() != w.String() {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, srv.Close())
+	require.NoError(t, <-done)
+
+	// NOTE: сервер закрывает открытые соединения при завершении.
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+}
+
+func TestServer_longLine(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	port, err := tcputil.FreePort()
+	require.NoError(t, err)
+	addr := "127.0.0.1:" + port
+
+	s := ingesttest.NewStorage(t)
+	srv := graphite.New(addr, s, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(context.Background()) }()
+	t.Cleanup(func() {
+		srv.Close()
+		<-done
+	})
+
+	conn := ingesttest.Dial(t, addr)
+
+	// NOTE: сервер закрывает соединение на строке длиннее допустимой,
+	// поэтому запись может завершиться ошибкой.
+	conn.Write([]byte("queue 1\n" + strings.Repeat("a", 1<<20) + " 2\nqueue 3\n"))
+
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+
+	got, err := s.Get(ctx, "queue", nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, got.Float64())
+}
@@ -0,0 +1,250 @@
+// Package influx реализует разбор строк протокола InfluxDB line protocol.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var (
+	errMeasurementEmpty = errors.New("measurement is empty")
+	errTagInvalid       = errors.New("tag must have the format <key>=<value>")
+	errFieldsMissing    = errors.New("line has no fields")
+	errFieldInvalid     = errors.New("field must have the format <key>=<value>")
+	errValueInvalid     = errors.New("field value is invalid")
+	errTimestampInvalid = errors.New("timestamp must be an integer")
+	errQuoteUnclosed    = errors.New("string field value is not closed")
+	errPrecisionUnknown = errors.New("precision is unknown")
+)
+
+var precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// ParsePrecision возвращает единицу измерения временных меток по значению
+// параметра precision InfluxDB v1 или v2. Пустое значение соответствует
+// наносекундам.
+func ParsePrecision(s string) (time.Duration, error) {
+	precision, ok := precisions[s]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", errPrecisionUnknown, s)
+	}
+	return precision, nil
+}
+
+// Field определяет числовое поле точки.
+type Field struct {
+	Key   string
+	Value float64
+}
+
+// Point определяет точку протокола InfluxDB.
+type Point struct {
+	Measurement string
+	Tags        metrics.Labels
+	Fields      []Field
+
+	// Временная метка точки; нулевое значение, если метка не передана.
+	Time time.Time
+}
+
+// Parse разбирает строку протокола InfluxDB вида
+//
+//	<measurement>[,<tag>=<value>...] <field>=<value>[,<field>=<value>...] [<timestamp>]
+//
+// где timestamp измеряется в единицах precision.
+//
+// Целые (1i), беззнаковые (1u) и логические поля приводятся к float64;
+// строковые поля проверяются и отбрасываются, поэтому в точке может
+// не оказаться полей.
+func Parse(line string, precision time.Duration) (Point, error) {
+	key, rest, ok := cut(line, ' ', false)
+	if !ok {
+		return Point{}, errFieldsMissing
+	}
+
+	measurement, tags, _ := cut(key, ',', false)
+	if measurement == "" {
+		return Point{}, errMeasurementEmpty
+	}
+
+	p := Point{Measurement: unescape(measurement)}
+
+	var err error
+
+	p.Tags, err = parseTags(tags)
+	if err != nil {
+		return Point{}, err
+	}
+
+	fields, timestamp, _ := cut(rest, ' ', true)
+	if fields == "" {
+		return Point{}, errFieldsMissing
+	}
+
+	p.Fields, err = parseFields(fields)
+	if err != nil {
+		return Point{}, err
+	}
+
+	timestamp = strings.TrimSpace(timestamp)
+	if timestamp != "" {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("%w: %q", errTimestampInvalid, timestamp)
+		}
+		if ts > math.MaxInt64/int64(precision) || ts < math.MinInt64/int64(precision) {
+			return Point{}, fmt.Errorf("%w: %q", errTimestampInvalid, timestamp)
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+
+	return p, nil
+}
+
+// parseTags возвращает метки из тегов вида key=value,...
+func parseTags(s string) (metrics.Labels, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var labels []metrics.Label
+
+	for s != "" {
+		var tag string
+		tag, s, _ = cut(s, ',', false)
+
+		name, value, ok := cut(tag, '=', false)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("%w: %q", errTagInvalid, tag)
+		}
+
+		labels = append(labels, metrics.Label{Name: unescape(name), Value: unescape(value)})
+	}
+
+	return metrics.NewLabels(labels...), nil
+}
+
+// parseFields возвращает числовые поля из полей вида key=value,...
+func parseFields(s string) ([]Field, error) {
+	var fields []Field
+
+	for s != "" {
+		var field string
+		field, s, _ = cut(s, ',', true)
+
+		key, value, ok := cut(field, '=', false)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("%w: %q", errFieldInvalid, field)
+		}
+
+		v, ok, err := parseValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", unescape(key), err)
+		}
+		if ok {
+			fields = append(fields, Field{Key: unescape(key), Value: v})
+		}
+	}
+
+	return fields, nil
+}
+
+// parseValue возвращает значение поля; ok равен false для строковых полей.
+func parseValue(s string) (v float64, ok bool, err error) {
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	if s[0] == '"' {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				if i != len(s)-1 {
+					return 0, false, fmt.Errorf("%w: %q", errValueInvalid, s)
+				}
+				return 0, false, nil
+			}
+		}
+		return 0, false, errQuoteUnclosed
+	}
+
+	switch s[len(s)-1] {
+	case 'i':
+		n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %q", errValueInvalid, s)
+		}
+		return float64(n), true, nil
+	case 'u':
+		n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %q", errValueInvalid, s)
+		}
+		return float64(n), true, nil
+	}
+
+	v, err = strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false, fmt.Errorf("%w: %q", errValueInvalid, s)
+	}
+
+	return v, true, nil
+}
+
+// cut разделяет s по первому неэкранированному символу sep; если quoted
+// равен true, то символы внутри двойных кавычек не учитываются.
+func cut(s string, sep byte, quoted bool) (before, after string, found bool) {
+	var inQuotes bool
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quoted:
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+// unescape удаляет экранирование запятых, знаков равенства и пробелов.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`,= `, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package influx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/influx"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name      string
+		line      string
+		precision time.Duration
+		want      influx.Point
+		wantErr   bool
+	}{
+		{
+			name: "float field",
+			line: "cpu usage_idle=92.5",
+			want: influx.Point{
+				Measurement: "cpu",
+				Fields:      []influx.Field{{Key: "usage_idle", Value: 92.5}},
+			},
+		},
+		{
+			name:      "tags and timestamp",
+			line:      "cpu,host=a,cpu=cpu0 usage_idle=92.5,usage_user=1 1700000000",
+			precision: time.Second,
+			want: influx.Point{
+				Measurement: "cpu",
+				Tags: metrics.NewLabels(
+					metrics.Label{Name: "host", Value: "a"},
+					metrics.Label{Name: "cpu", Value: "cpu0"},
+				),
+				Fields: []influx.Field{
+					{Key: "usage_idle", Value: 92.5},
+					{Key: "usage_user", Value: 1},
+				},
+				Time: time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "field types",
+			line: `mem used=10i,free=20u,swap=t,state="ok, fine",total=-1e3`,
+			want: influx.Point{
+				Measurement: "mem",
+				Fields: []influx.Field{
+					{Key: "used", Value: 10},
+					{Key: "free", Value: 20},
+					{Key: "swap", Value: 1},
+					{Key: "total", Value: -1000},
+				},
+			},
+		},
+		{
+			name: "escaping",
+			line: `disk\ io,path=/mnt\,a used\=percent=5,note="say \"hi\""`,
+			want: influx.Point{
+				Measurement: "disk io",
+				Tags:        metrics.NewLabels(metrics.Label{Name: "path", Value: "/mnt,a"}),
+				Fields:      []influx.Field{{Key: "used=percent", Value: 5}},
+			},
+		},
+		{
+			name: "string field only",
+			line: `syslog message="started"`,
+			want: influx.Point{Measurement: "syslog"},
+		},
+		{
+			name:    "without fields",
+			line:    "cpu,host=a",
+			wantErr: true,
+		},
+		{
+			name:    "empty measurement",
+			line:    ",host=a value=1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid tag",
+			line:    "cpu,host value=1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid field",
+			line:    "cpu value",
+			wantErr: true,
+		},
+		{
+			name:    "invalid integer",
+			line:    "cpu value=1.5i",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed string",
+			line:    `cpu value="1`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid timestamp",
+			line:    "cpu value=1 now",
+			wantErr: true,
+		},
+		{
+			name:      "timestamp overflow",
+			line:      "cpu value=1 9223372036854775807",
+			precision: time.Hour,
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			precision := tc.precision
+			if precision == 0 {
+				precision = time.Nanosecond
+			}
+
+			got, err := influx.Parse(tc.line, precision)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"":   time.Nanosecond,
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"u":  time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"h":  time.Hour,
+	} {
+		got, err := influx.ParsePrecision(s)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+
+	_, err := influx.ParsePrecision("d")
+	require.Error(t, err)
+}
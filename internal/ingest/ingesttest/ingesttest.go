@@ -0,0 +1,42 @@
+// Package ingesttest содержит вспомогательные функции для тестов серверов
+// приёма метрик.
+package ingesttest
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+// NewStorage возвращает локальное хранилище во временном файле.
+func NewStorage(t *testing.T) *storage.Local {
+	f, err := os.CreateTemp(t.TempDir(), "test-*.wal")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err := storage.NewLocal(f.Name(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// Dial возвращает TCP-соединение с адресом addr, ожидая запуска сервера.
+func Dial(t *testing.T, addr string) net.Conn {
+	var conn net.Conn
+
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
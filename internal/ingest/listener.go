@@ -0,0 +1,130 @@
+// Package ingest содержит общую часть серверов приёма метрик по текстовым
+// протоколам: учёт TCP-соединений, завершение работы и сохранение значений
+// в хранилище.
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+)
+
+// Listener определяет общую часть сервера, принимающего TCP-соединения:
+// учёт открытых соединений и завершение работы методом Close.
+type Listener struct {
+	logger *logging.Logger
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	term      chan struct{}
+	closeOnce sync.Once
+	done      chan struct{} // Закрывается после завершения Run.
+	started   bool
+}
+
+// NewListener возвращает Listener, логирующий ошибки в logger.
+func NewListener(logger *logging.Logger) *Listener {
+	return &Listener{
+		logger: logger,
+		conns:  make(map[net.Conn]struct{}),
+		term:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run выполняет работу сервера fn; метод Close дожидается её завершения.
+func (l *Listener) Run(fn func() error) error {
+	l.mu.Lock()
+	l.started = true
+	l.mu.Unlock()
+	defer close(l.done)
+
+	return fn()
+}
+
+// Serve принимает соединения lis и обрабатывает каждое функцией handle
+// в отдельной горутине до тех пор, пока не сработает контекст или метод
+// Close. Перед возвратом lis и открытые соединения закрываются, а их
+// обработчики завершаются.
+func (l *Listener) Serve(ctx context.Context, lis net.Listener, handle func(net.Conn)) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.accept(lis, handle, &wg)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-l.term:
+	}
+
+	lis.Close()
+
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	wg.Wait()
+}
+
+// Close завершает работу сервера и дожидается завершения Run.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.term) })
+
+	l.mu.Lock()
+	started := l.started
+	l.mu.Unlock()
+
+	if started {
+		<-l.done
+	}
+
+	return nil
+}
+
+// accept принимает соединения до закрытия lis; обработчики соединений
+// добавляются в wg.
+func (l *Listener) accept(lis net.Listener, handle func(net.Conn), wg *sync.WaitGroup) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logger.Log(logging.LevelError, err.Error(), "proto", "tcp")
+			}
+			return
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				l.mu.Lock()
+				delete(l.conns, conn)
+				l.mu.Unlock()
+				conn.Close()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+// Scanner возвращает сканер строк соединения conn, длина которых
+// не превышает maxLineSize.
+func Scanner(conn net.Conn, maxLineSize int) *bufio.Scanner {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	return scanner
+}
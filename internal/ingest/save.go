@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+)
+
+// Save сохраняет значения в хранилище s и логирует ошибки в logger.
+//
+// Протоколы не предусматривают ответа клиенту, поэтому ошибки сохранения
+// только логируются. Одна некорректная метрика не должна препятствовать
+// сохранению остальных, поэтому при ошибке значения сохраняются по одному.
+func Save(ctx context.Context, s storage.Storage, logger *logging.Logger, values []metrics.Metric) {
+	if len(values) == 0 {
+		return
+	}
+
+	_, err := s.Save(ctx, values...)
+	if err == nil {
+		return
+	}
+
+	for _, value := range values {
+		_, err = s.Save(ctx, value)
+		if err != nil {
+			LogError(logger, err, "name", value.Name())
+		}
+	}
+}
+
+// LogError логирует ошибку хранилища err, если оно не закрыто.
+//
+// NOTE: значения, сохраняемые после закрытия хранилища, теряются без
+// записи в лог, поэтому хранилище должно закрываться после серверов.
+func LogError(logger *logging.Logger, err error, kv ...any) {
+	if errors.Is(err, storage.ErrStorageClosed) {
+		return
+	}
+	logger.Log(logging.LevelError, err.Error(), kv...)
+}
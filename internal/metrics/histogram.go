@@ -0,0 +1,258 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultBounds определяет границы бакетов гистограммы по умолчанию.
+var DefaultBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramValue определяет значение метрики типа гистограмма.
+type HistogramValue struct {
+	// Верхние границы бакетов в порядке возрастания.
+	Bounds []float64
+
+	// Количество наблюдений в каждом бакете; последний бакет содержит
+	// наблюдения, превышающие последнюю границу.
+	Counts []uint64
+
+	// Сумма наблюдений.
+	Sum float64
+
+	// Количество наблюдений.
+	Count uint64
+}
+
+// NewHistogramValue возвращает пустую гистограмму с границами бакетов bounds.
+func NewHistogramValue(bounds []float64) (*HistogramValue, error) {
+	h := &HistogramValue{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Validate возвращает ошибку, если гистограмма некорректна.
+func (h *HistogramValue) Validate() error {
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return errors.New("metrics: histogram bounds must be finite")
+		}
+		if i > 0 && h.Bounds[i-1] >= bound {
+			return errors.New("metrics: histogram bounds must be in increasing order")
+		}
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return errors.New("metrics: histogram counts do not match the bounds")
+	}
+
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return errors.New("metrics: histogram count does not match the buckets")
+	}
+
+	return nil
+}
+
+// Observe добавляет наблюдение v в гистограмму.
+func (h *HistogramValue) Observe(v float64) {
+	h.ObserveN(v, 1)
+}
+
+// ObserveN добавляет в гистограмму n наблюдений v.
+func (h *HistogramValue) ObserveN(v float64, n uint64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i] += n
+	h.Sum += v * float64(n)
+	h.Count += n
+}
+
+// Compatible возвращает ошибку, если гистограмму x нельзя объединить с h.
+func (h *HistogramValue) Compatible(x *HistogramValue) error {
+	if x.Count == 0 || h.Count == 0 && len(h.Bounds) == 0 {
+		return nil
+	}
+	if len(h.Bounds) != len(x.Bounds) {
+		return errors.New("metrics: histogram bounds mismatch")
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != x.Bounds[i] {
+			return errors.New("metrics: histogram bounds mismatch")
+		}
+	}
+	return nil
+}
+
+// Merge объединяет гистограмму x с h.
+func (h *HistogramValue) Merge(x *HistogramValue) error {
+	if err := h.Compatible(x); err != nil {
+		return err
+	}
+	if x.Count == 0 {
+		return nil
+	}
+	if h.Count == 0 && len(h.Bounds) == 0 {
+		*h = *x.Clone()
+		return nil
+	}
+	if len(h.Counts) != len(x.Counts) {
+		return errors.New("metrics: histogram counts mismatch")
+	}
+	for i := range h.Counts {
+		h.Counts[i] += x.Counts[i]
+	}
+	h.Sum += x.Sum
+	h.Count += x.Count
+	return nil
+}
+
+// Quantile возвращает оценку квантиля q (0 <= q <= 1) с линейной
+// интерполяцией внутри бакета; для пустой гистограммы возвращается NaN.
+func (h *HistogramValue) Quantile(q float64) float64 {
+	if h.Count == 0 || q < 0 || q > 1 || math.IsNaN(q) {
+		return math.NaN()
+	}
+
+	rank := q * float64(h.Count)
+
+	var cum float64
+	for i, c := range h.Counts {
+		prev := cum
+		cum += float64(c)
+		if cum < rank || c == 0 {
+			continue
+		}
+		if i == len(h.Bounds) {
+			// NOTE: верхняя граница последнего бакета неизвестна,
+			// поэтому возвращается последняя известная граница.
+			if len(h.Bounds) == 0 {
+				return h.Sum / float64(h.Count)
+			}
+			return h.Bounds[i-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		} else if h.Bounds[0] <= 0 {
+			return h.Bounds[0]
+		}
+		upper := h.Bounds[i]
+		return lower + (upper-lower)*(rank-prev)/float64(c)
+	}
+
+	return math.NaN()
+}
+
+// Clone возвращает копию гистограммы.
+func (h *HistogramValue) Clone() *HistogramValue {
+	return &HistogramValue{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Equal возвращает true, если гистограммы равны.
+func (h *HistogramValue) Equal(x *HistogramValue) bool {
+	if h == nil || x == nil {
+		return h == x
+	}
+	if len(h.Bounds) != len(x.Bounds) || len(h.Counts) != len(x.Counts) {
+		return false
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != x.Bounds[i] {
+			return false
+		}
+	}
+	for i := range h.Counts {
+		if h.Counts[i] != x.Counts[i] {
+			return false
+		}
+	}
+	return h.Sum == x.Sum && h.Count == x.Count
+}
+
+func (h *HistogramValue) MarshalBinary() ([]byte, error) {
+	return h.appendBinary(nil), nil
+}
+
+func (h *HistogramValue) UnmarshalBinary(data []byte) error {
+	rest, err := h.readBinary(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("metrics: histogram is corrupted")
+	}
+	return nil
+}
+
+// appendBinary добавляет гистограмму в конец data.
+func (h *HistogramValue) appendBinary(data []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(h.Bounds)))
+	for _, bound := range h.Bounds {
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(bound))
+	}
+	for _, c := range h.Counts {
+		data = binary.AppendUvarint(data, c)
+	}
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(h.Sum))
+	return data
+}
+
+// readBinary считывает гистограмму из data и возвращает оставшиеся данные.
+func (h *HistogramValue) readBinary(data []byte) ([]byte, error) {
+	errCorrupted := errors.New("metrics: histogram is corrupted")
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n)/8 {
+		return nil, errCorrupted
+	}
+	data = data[n:]
+
+	value := HistogramValue{
+		Bounds: make([]float64, size),
+		Counts: make([]uint64, size+1),
+	}
+
+	for i := range value.Bounds {
+		value.Bounds[i] = math.Float64frombits(binary.BigEndian.Uint64(data))
+		data = data[8:]
+	}
+
+	for i := range value.Counts {
+		c, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errCorrupted
+		}
+		data = data[n:]
+		value.Counts[i] = c
+		value.Count += c
+	}
+
+	if len(data) < 8 {
+		return nil, errCorrupted
+	}
+	value.Sum = math.Float64frombits(binary.BigEndian.Uint64(data))
+	data = data[8:]
+
+	if err := value.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", errCorrupted, err)
+	}
+
+	*h = value
+
+	return data, nil
+}
@@ -0,0 +1,137 @@
+package metrics_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+func histogram(t testing.TB, bounds []float64, values ...float64) *metrics.HistogramValue {
+	h, err := metrics.NewHistogramValue(bounds)
+	require.NoError(t, err)
+	for _, v := range values {
+		h.Observe(v)
+	}
+	return h
+}
+
+func TestNewHistogramValue(t *testing.T) {
+	testCases := []struct {
+		name      string
+		bounds    []float64
+		wantError bool
+	}{
+		{name: "empty"},
+		{name: "default", bounds: metrics.DefaultBounds},
+		{name: "unordered", bounds: []float64{2, 1}, wantError: true},
+		{name: "duplicate", bounds: []float64{1, 1}, wantError: true},
+		{name: "infinite", bounds: []float64{1, math.Inf(1)}, wantError: true},
+		{name: "nan", bounds: []float64{math.NaN()}, wantError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := metrics.NewHistogramValue(tc.bounds)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, h.Counts, len(tc.bounds)+1)
+			}
+		})
+	}
+}
+
+func TestHistogramValue_Observe(t *testing.T) {
+	h := histogram(t, []float64{1, 2, 5}, 0.5, 1, 1.5, 5, 10)
+
+	require.Equal(t, []uint64{2, 1, 1, 1}, h.Counts)
+	require.EqualValues(t, 5, h.Count)
+	require.Equal(t, 18.0, h.Sum)
+	require.NoError(t, h.Validate())
+}
+
+func TestHistogramValue_ObserveN(t *testing.T) {
+	h := histogram(t, []float64{1, 2, 5})
+	h.ObserveN(1.5, 3)
+	h.ObserveN(10, 0)
+
+	require.Equal(t, []uint64{0, 3, 0, 0}, h.Counts)
+	require.EqualValues(t, 3, h.Count)
+	require.Equal(t, 4.5, h.Sum)
+	require.NoError(t, h.Validate())
+}
+
+func TestHistogramValue_Merge(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		h := histogram(t, []float64{1, 2}, 0.5, 1.5)
+		require.NoError(t, h.Merge(histogram(t, []float64{1, 2}, 3)))
+		require.Equal(t, []uint64{1, 1, 1}, h.Counts)
+		require.EqualValues(t, 3, h.Count)
+		require.Equal(t, 5.0, h.Sum)
+	})
+
+	t.Run("into empty", func(t *testing.T) {
+		h := histogram(t, nil)
+		x := histogram(t, []float64{1, 2}, 0.5)
+		require.NoError(t, h.Merge(x))
+		require.True(t, h.Equal(x))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		h := histogram(t, []float64{1, 2}, 0.5)
+		require.NoError(t, h.Merge(histogram(t, nil)))
+		require.EqualValues(t, 1, h.Count)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		h := histogram(t, []float64{1, 2}, 0.5)
+		require.Error(t, h.Merge(histogram(t, []float64{1, 3}, 0.5)))
+		require.Error(t, h.Merge(histogram(t, []float64{1}, 0.5)))
+	})
+
+	t.Run("counts mismatch", func(t *testing.T) {
+		h := histogram(t, []float64{1, 2}, 0.5)
+		x := &metrics.HistogramValue{Bounds: []float64{1, 2}, Counts: []uint64{1}, Count: 1}
+		require.Error(t, h.Merge(x))
+		require.Equal(t, []uint64{1, 0, 0}, h.Counts)
+	})
+}
+
+func TestHistogramValue_Quantile(t *testing.T) {
+	h := histogram(t, []float64{1, 2, 4})
+	require.True(t, math.IsNaN(h.Quantile(0.5)))
+
+	for i := 0; i < 50; i++ {
+		h.Observe(0.5)
+	}
+	for i := 0; i < 50; i++ {
+		h.Observe(3)
+	}
+
+	require.InDelta(t, 0.5, h.Quantile(0.25), 1e-9)
+	require.InDelta(t, 1.0, h.Quantile(0.5), 1e-9)
+	require.InDelta(t, 3.0, h.Quantile(0.75), 1e-9)
+	require.InDelta(t, 4.0, h.Quantile(1), 1e-9)
+	require.True(t, math.IsNaN(h.Quantile(1.5)))
+
+	h.Observe(100)
+	require.InDelta(t, 4.0, h.Quantile(1), 1e-9)
+}
+
+func TestHistogramValue_MarshalBinary(t *testing.T) {
+	want := histogram(t, metrics.DefaultBounds, 0.001, 0.3, 7, 100)
+
+	data, err := want.MarshalBinary()
+	require.NoError(t, err)
+
+	var got metrics.HistogramValue
+	require.NoError(t, got.UnmarshalBinary(data))
+	require.True(t, want.Equal(&got))
+
+	require.Error(t, got.UnmarshalBinary(data[:len(data)-1]))
+	require.Error(t, got.UnmarshalBinary(append(data, 0)))
+}
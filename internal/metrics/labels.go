@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Label определяет метку метрики.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Labels определяет набор меток метрики, отсортированный по имени.
+type Labels []Label
+
+// NewLabels возвращает набор меток, отсортированный по имени. Метки с пустым
+// значением отбрасываются; при повторении имени сохраняется последнее
+// значение.
+func NewLabels(labels ...Label) Labels {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	ls := make(Labels, 0, len(labels))
+	for _, label := range labels {
+		if label.Name == "" || label.Value == "" {
+			continue
+		}
+		ls = append(ls, label)
+	}
+
+	sort.SliceStable(ls, func(i, j int) bool {
+		return ls[i].Name < ls[j].Name
+	})
+
+	// NOTE: после стабильной сортировки последнее значение повторяющейся
+	// метки находится в конце группы.
+	n := 0
+	for i := 0; i < len(ls); i++ {
+		if i+1 < len(ls) && ls[i].Name == ls[i+1].Name {
+			continue
+		}
+		ls[n] = ls[i]
+		n++
+	}
+	ls = ls[:n]
+
+	if len(ls) == 0 {
+		return nil
+	}
+
+	return ls
+}
+
+// LabelsFromMap возвращает набор меток из отображения имя-значение.
+func LabelsFromMap(m map[string]string) Labels {
+	if len(m) == 0 {
+		return nil
+	}
+	ls := make(Labels, 0, len(m))
+	for name, value := range m {
+		ls = append(ls, Label{Name: name, Value: value})
+	}
+	return NewLabels(ls...)
+}
+
+// ParseLabels парсит метки в формате "name=value" и возвращает их набор.
+func ParseLabels(values []string) (Labels, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	ls := make(Labels, 0, len(values))
+
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("metrics: invalid label %q", value)
+		}
+		ls = append(ls, Label{Name: name, Value: v})
+	}
+
+	return NewLabels(ls...), nil
+}
+
+// Map возвращает метки как отображение имя-значение.
+func (ls Labels) Map() map[string]string {
+	if len(ls) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(ls))
+	for _, label := range ls {
+		m[label.Name] = label.Value
+	}
+	return m
+}
+
+// Get возвращает значение метки name или пустую строку, если метки нет.
+func (ls Labels) Get(name string) string {
+	i := sort.Search(len(ls), func(i int) bool { return ls[i].Name >= name })
+	if i < len(ls) && ls[i].Name == name {
+		return ls[i].Value
+	}
+	return ""
+}
+
+// Equal возвращает true, если наборы меток равны.
+func (ls Labels) Equal(x Labels) bool {
+	if len(ls) != len(x) {
+		return false
+	}
+	for i := range ls {
+		if ls[i] != x[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Match возвращает true, если набор содержит все метки selector.
+func (ls Labels) Match(selector Labels) bool {
+	for _, label := range selector {
+		if ls.Get(label.Name) != label.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// String возвращает строковое представление меток вида {name="value",...};
+// для пустого набора возвращается пустая строка. Имена меток, содержащие
+// разделители, заключаются в кавычки.
+func (ls Labels) String() string {
+	if len(ls) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteByte('{')
+	for i, label := range ls {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(quoteName(label.Name, labelNameSpecial))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(label.Value))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// Key возвращает ключ метрики, однозначно определяющий её по имени и меткам.
+func Key(name string, labels Labels) string {
+	return quoteName(name, metricNameSpecial) + labels.String()
+}
+
+const (
+	// labelNameSpecial определяет символы, при наличии которых имя метки
+	// заключается в кавычки.
+	labelNameSpecial = "{}=,\"\\"
+
+	// metricNameSpecial определяет символы, при наличии которых имя
+	// метрики в ключе заключается в кавычки.
+	metricNameSpecial = "{\"\\"
+)
+
+// quoteName возвращает имя s как есть или в кавычках, если оно содержит
+// один из символов special и иначе сделало бы представление неоднозначным.
+func quoteName(s, special string) string {
+	if strings.ContainsAny(s, special) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var errLabelsCorrupted = errors.New("metrics: labels is corrupted")
@@ -0,0 +1,158 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+func TestNewLabels(t *testing.T) {
+	testCases := []struct {
+		name   string
+		labels []metrics.Label
+		want   metrics.Labels
+	}{
+		{
+			name: "empty",
+			want: nil,
+		},
+		{
+			name: "sorted",
+			labels: []metrics.Label{
+				{Name: "service", Value: "api"},
+				{Name: "host", Value: "a"},
+			},
+			want: metrics.Labels{
+				{Name: "host", Value: "a"},
+				{Name: "service", Value: "api"},
+			},
+		},
+		{
+			name: "duplicate",
+			labels: []metrics.Label{
+				{Name: "host", Value: "a"},
+				{Name: "host", Value: "b"},
+			},
+			want: metrics.Labels{{Name: "host", Value: "b"}},
+		},
+		{
+			name: "empty value",
+			labels: []metrics.Label{
+				{Name: "host", Value: ""},
+				{Name: "", Value: "a"},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := metrics.NewLabels(tc.labels...)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	testCases := []struct {
+		name      string
+		values    []string
+		want      metrics.Labels
+		wantError bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "ok",
+			values: []string{"region=eu", "host=a=b"},
+			want: metrics.Labels{
+				{Name: "host", Value: "a=b"},
+				{Name: "region", Value: "eu"},
+			},
+		},
+		{
+			name:      "no separator",
+			values:    []string{"host"},
+			wantError: true,
+		},
+		{
+			name:      "no name",
+			values:    []string{"=a"},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := metrics.ParseLabels(tc.values)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLabels(t *testing.T) {
+	labels := metrics.NewLabels(
+		metrics.Label{Name: "service", Value: "api"},
+		metrics.Label{Name: "host", Value: "a"},
+	)
+
+	require.Equal(t, `{host="a",service="api"}`, labels.String())
+	require.Equal(t, "", metrics.Labels(nil).String())
+
+	require.Equal(t, "a", labels.Get("host"))
+	require.Equal(t, "", labels.Get("region"))
+
+	require.True(t, labels.Match(nil))
+	require.True(t, labels.Match(metrics.NewLabels(metrics.Label{Name: "host", Value: "a"})))
+	require.False(t, labels.Match(metrics.NewLabels(metrics.Label{Name: "host", Value: "b"})))
+
+	require.True(t, labels.Equal(metrics.LabelsFromMap(labels.Map())))
+	require.Equal(t, `test{host="a",service="api"}`, metrics.Key("test", labels))
+}
+
+func TestKey_collisions(t *testing.T) {
+	testCases := []struct {
+		name string
+		a, b string
+	}{
+		{
+			name: "label name with separators",
+			a: metrics.Key("test", metrics.NewLabels(
+				metrics.Label{Name: "a", Value: "1"},
+				metrics.Label{Name: "b", Value: "2"},
+			)),
+			b: metrics.Key("test", metrics.NewLabels(
+				metrics.Label{Name: `a="1",b`, Value: "2"},
+			)),
+		},
+		{
+			name: "label value with separators",
+			a: metrics.Key("test", metrics.NewLabels(
+				metrics.Label{Name: "a", Value: "1"},
+				metrics.Label{Name: "b", Value: "2"},
+			)),
+			b: metrics.Key("test", metrics.NewLabels(
+				metrics.Label{Name: "a", Value: `1",b="2`},
+			)),
+		},
+		{
+			name: "metric name with labels",
+			a:    metrics.Key("test", metrics.NewLabels(metrics.Label{Name: "a", Value: "1"})),
+			b:    metrics.Key(`test{a="1"}`, nil),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NotEqual(t, tc.a, tc.b)
+		})
+	}
+}
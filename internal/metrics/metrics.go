@@ -9,8 +9,11 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
 	"unsafe"
 
+	"google.golang.org/protobuf/types/known/timestamppb"
+
 	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
 )
 
@@ -22,12 +25,16 @@ const (
 
 	KindCounter
 	KindGauge
+	KindHistogram
+	KindSummary
 )
 
 var kindValues = []string{
 	"unknown",
 	"counter",
 	"gauge",
+	"histogram",
+	"summary",
 }
 
 func (k Kind) String() string {
@@ -82,41 +89,119 @@ var (
 
 // Metric определяет метрику.
 type Metric struct {
-	kind  Kind
-	name  string
-	value value
+	kind      Kind
+	name      string
+	labels    Labels
+	value     value
+	histogram *HistogramValue
+	summary   *Sketch
+	updated   time.Time
+}
+
+// Counter возвращает метрику типа счётчик с именем name, значением value
+// и метками labels.
+func Counter(name string, value int64, labels ...Label) Metric {
+	return Metric{
+		kind:   KindCounter,
+		name:   name,
+		labels: NewLabels(labels...),
+		value:  counterValue(value),
+	}
+}
+
+// Gauge возвращает метрику типа датчик с именем name, значением value
+// и метками labels.
+func Gauge(name string, value float64, labels ...Label) Metric {
+	return Metric{
+		kind:   KindGauge,
+		name:   name,
+		labels: NewLabels(labels...),
+		value:  gaugeValue(value),
+	}
 }
 
-// Counter возвращает метрику типа счётчик с именем name и значением value.
-func Counter(name string, value int64) Metric {
+// Histogram возвращает метрику типа гистограмма с именем name, значением
+// value и метками labels; при value == nil возвращается пустая гистограмма.
+func Histogram(name string, value *HistogramValue, labels ...Label) Metric {
+	if value == nil {
+		value = &HistogramValue{Counts: make([]uint64, 1)}
+	} else {
+		value = value.Clone()
+	}
 	return Metric{
-		kind:  KindCounter,
-		name:  name,
-		value: counterValue(value),
+		kind:      KindHistogram,
+		name:      name,
+		labels:    NewLabels(labels...),
+		histogram: value,
 	}
 }
 
-// Gauge возвращает метрику типа датчик с именем name и значением value.
-func Gauge(name string, value float64) Metric {
+// Summary возвращает метрику типа сводка с именем name, значением value
+// и метками labels; при value == nil возвращается пустой скетч с точностью
+// по умолчанию.
+func Summary(name string, value *Sketch, labels ...Label) Metric {
+	if value == nil {
+		value, _ = NewSketch(DefaultAccuracy)
+	} else {
+		value = value.Clone()
+	}
 	return Metric{
-		kind:  KindGauge,
-		name:  name,
-		value: gaugeValue(value),
+		kind:    KindSummary,
+		name:    name,
+		labels:  NewLabels(labels...),
+		summary: value,
 	}
 }
 
-// FromProto конвертирует *pb.UpdateRequest_Metrics в метрику и возвращает её.
+// FromProto конвертирует *pb.UpdateRequest_Metrics в метрику и возвращает её;
+// для некорректной гистограммы или скетча возвращается пустая метрика.
 func FromProto(value *pb.Metric) Metric {
+	m, _ := ParseProto(value)
+	return m
+}
+
+// ParseProto конвертирует *pb.UpdateRequest_Metrics в метрику и возвращает
+// её или ошибку, если гистограмма или скетч некорректны.
+func ParseProto(value *pb.Metric) (Metric, error) {
 	var m Metric
 
+	labels := LabelsFromMap(value.GetLabels())
+
 	switch value.GetType() {
 	case pb.MetricType_COUNTER:
-		m = Counter(value.GetName(), int64(value.GetValue()))
+		m = Counter(value.GetName(), int64(value.GetValue()), labels...)
 	case pb.MetricType_GAUGE:
-		m = Gauge(value.GetName(), value.GetValue())
+		m = Gauge(value.GetName(), value.GetValue(), labels...)
+	case pb.MetricType_HISTOGRAM:
+		var h *HistogramValue
+		if v := value.GetHistogram(); v != nil {
+			h = &HistogramValue{
+				Bounds: v.GetBounds(),
+				Counts: v.GetCounts(),
+				Sum:    v.GetSum(),
+				Count:  v.GetCount(),
+			}
+			if err := h.Validate(); err != nil {
+				return Metric{}, err
+			}
+		}
+		m = Histogram(value.GetName(), h, labels...)
+	case pb.MetricType_SUMMARY:
+		var s *Sketch
+		if v := value.GetSummary(); v != nil {
+			var err error
+			if s, err = sketchFromProto(v); err != nil {
+				return Metric{}, err
+			}
+		}
+		m = Summary(value.GetName(), s, labels...)
 	}
 
-	return m
+	if value.GetUpdated() != nil {
+		m.updated = value.GetUpdated().AsTime()
+	}
+
+	return m, nil
 }
 
 // Proto конвертирует метрику в *pb.UpdateRequest_Metrics.
@@ -132,6 +217,25 @@ func (m *Metric) Proto() *pb.Metric {
 		value.Type = pb.MetricType_GAUGE
 		value.Name = m.Name()
 		value.Value = m.Float64()
+	case KindHistogram:
+		value.Type = pb.MetricType_HISTOGRAM
+		value.Name = m.Name()
+		value.Histogram = &pb.Histogram{
+			Bounds: append([]float64(nil), m.histogram.Bounds...),
+			Counts: append([]uint64(nil), m.histogram.Counts...),
+			Sum:    m.histogram.Sum,
+			Count:  m.histogram.Count,
+		}
+	case KindSummary:
+		value.Type = pb.MetricType_SUMMARY
+		value.Name = m.Name()
+		value.Summary = m.summary.proto()
+	}
+
+	value.Labels = m.labels.Map()
+
+	if !m.updated.IsZero() {
+		value.Updated = timestamppb.New(m.updated)
 	}
 
 	return value
@@ -147,12 +251,43 @@ func (m *Metric) Name() string {
 	return m.name
 }
 
+// Labels возвращает метки метрики.
+func (m *Metric) Labels() Labels {
+	return m.labels
+}
+
+// Updated возвращает время последнего обновления метрики в хранилище;
+// нулевое значение, если время неизвестно.
+func (m *Metric) Updated() time.Time {
+	return m.updated
+}
+
+// WithUpdated возвращает копию метрики со временем последнего обновления t.
+func (m *Metric) WithUpdated(t time.Time) Metric {
+	x := *m
+	x.updated = t
+	return x
+}
+
+// WithLabels возвращает копию метрики с метками labels.
+func (m *Metric) WithLabels(labels ...Label) Metric {
+	x := *m
+	x.labels = NewLabels(labels...)
+	return x
+}
+
+// Key возвращает ключ метрики, однозначно определяющий её по имени и меткам.
+func (m *Metric) Key() string {
+	return Key(m.name, m.labels)
+}
+
 // GoString возвращает строковое представление метрики.
 func (m *Metric) GoString() string {
 	return fmt.Sprintf(
-		"metric{kind=%s name=%s value=%s}",
+		"metric{kind=%s name=%s labels=%s value=%s}",
 		m.kind.String(),
 		m.name,
+		m.labels.String(),
 		m.String(),
 	)
 }
@@ -164,6 +299,18 @@ func (m *Metric) String() string {
 		return strconv.FormatInt(m.value.Int64(), 10)
 	case KindGauge:
 		return strconv.FormatFloat(m.value.Float64(), 'f', -1, 64)
+	case KindHistogram:
+		return fmt.Sprintf(
+			"count=%d sum=%s",
+			m.histogram.Count,
+			strconv.FormatFloat(m.histogram.Sum, 'f', -1, 64),
+		)
+	case KindSummary:
+		return fmt.Sprintf(
+			"count=%d sum=%s",
+			m.summary.Count(),
+			strconv.FormatFloat(m.summary.Sum(), 'f', -1, 64),
+		)
 	}
 	return "<unknown>"
 }
@@ -178,9 +325,48 @@ func (m *Metric) Float64() float64 {
 	return m.value.Float64()
 }
 
-// Equal возвращает true, если метрика равна x.
+// Histogram возвращает значение метрики типа гистограмма; возвращаемое
+// значение не должно изменяться.
+func (m *Metric) Histogram() *HistogramValue {
+	return m.histogram
+}
+
+// Summary возвращает значение метрики типа сводка; возвращаемое значение
+// не должно изменяться.
+func (m *Metric) Summary() *Sketch {
+	return m.summary
+}
+
+// Equal возвращает true, если метрика равна x; время обновления
+// не сравнивается.
 func (m *Metric) Equal(x Metric) bool {
-	return m.kind == x.kind && m.name == x.name && m.value == x.value
+	return m.kind == x.kind &&
+		m.name == x.name &&
+		m.value == x.value &&
+		m.labels.Equal(x.labels) &&
+		m.histogram.Equal(x.histogram) &&
+		m.summary.Equal(x.summary)
+}
+
+// Zero возвращает метрику того же типа с тем же именем и метками и нулевым
+// значением; границы бакетов гистограммы и точность скетча сохраняются.
+func (m *Metric) Zero() Metric {
+	switch m.kind {
+	case KindCounter:
+		return Counter(m.name, 0, m.labels...)
+	case KindGauge:
+		return Gauge(m.name, 0, m.labels...)
+	case KindHistogram:
+		h := &HistogramValue{
+			Bounds: append([]float64(nil), m.histogram.Bounds...),
+			Counts: make([]uint64, len(m.histogram.Counts)),
+		}
+		return Histogram(m.name, h, m.labels...)
+	case KindSummary:
+		s, _ := NewSketch(m.summary.Accuracy())
+		return Summary(m.name, s, m.labels...)
+	}
+	return Metric{}
 }
 
 // IsEmpty возвращает true, если метрика пуста.
@@ -189,10 +375,21 @@ func (m *Metric) IsEmpty() bool {
 }
 
 type metric struct {
-	Kind  string   `json:"type"`            // тип метрики.
-	ID    string   `json:"id"`              // имя метрики.
-	Delta *int64   `json:"delta,omitempty"` // значение метрики counter.
-	Value *float64 `json:"value,omitempty"` // значение метрики gauge.
+	Kind      string            `json:"type"`                // тип метрики.
+	ID        string            `json:"id"`                  // имя метрики.
+	Labels    map[string]string `json:"labels,omitempty"`    // метки метрики.
+	Delta     *int64            `json:"delta,omitempty"`     // значение метрики counter.
+	Value     *float64          `json:"value,omitempty"`     // значение метрики gauge.
+	Histogram *histogram        `json:"histogram,omitempty"` // значение метрики histogram.
+	Summary   *Sketch           `json:"summary,omitempty"`   // значение метрики summary.
+	Updated   *time.Time        `json:"updated,omitempty"`   // время последнего обновления.
+}
+
+type histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы бакетов.
+	Counts []uint64  `json:"counts"` // количество наблюдений в бакетах.
+	Sum    float64   `json:"sum"`    // сумма наблюдений.
+	Count  uint64    `json:"count"`  // количество наблюдений.
 }
 
 func (m *Metric) MarshalJSON() ([]byte, error) {
@@ -201,8 +398,9 @@ func (m *Metric) MarshalJSON() ([]byte, error) {
 	}
 
 	obj := metric{
-		Kind: m.kind.String(),
-		ID:   m.name,
+		Kind:   m.kind.String(),
+		ID:     m.name,
+		Labels: m.labels.Map(),
 	}
 
 	switch m.kind {
@@ -212,6 +410,19 @@ func (m *Metric) MarshalJSON() ([]byte, error) {
 	case KindGauge:
 		v := m.Float64()
 		obj.Value = &v
+	case KindHistogram:
+		obj.Histogram = &histogram{
+			Bounds: append([]float64(nil), m.histogram.Bounds...),
+			Counts: append([]uint64(nil), m.histogram.Counts...),
+			Sum:    m.histogram.Sum,
+			Count:  m.histogram.Count,
+		}
+	case KindSummary:
+		obj.Summary = m.summary
+	}
+
+	if !m.updated.IsZero() {
+		obj.Updated = &m.updated
 	}
 
 	return json.Marshal(&obj)
@@ -237,42 +448,81 @@ func (m *Metric) UnmarshalJSON(data []byte) error {
 		return errors.New("metrics: the metric id should not be empty")
 	}
 
+	labels := LabelsFromMap(obj.Labels)
+
 	switch ParseKind(obj.Kind) {
 	case KindCounter:
 		var v int64
 		if obj.Delta != nil {
 			v = *obj.Delta
 		}
-		*m = Counter(obj.ID, v)
+		*m = Counter(obj.ID, v, labels...)
 	case KindGauge:
 		var v float64
 		if obj.Value != nil {
 			v = *obj.Value
 		}
-		*m = Gauge(obj.ID, v)
+		*m = Gauge(obj.ID, v, labels...)
+	case KindHistogram:
+		var v *HistogramValue
+		if obj.Histogram != nil {
+			v = &HistogramValue{
+				Bounds: obj.Histogram.Bounds,
+				Counts: obj.Histogram.Counts,
+				Sum:    obj.Histogram.Sum,
+				Count:  obj.Histogram.Count,
+			}
+			if err = v.Validate(); err != nil {
+				return err
+			}
+		}
+		*m = Histogram(obj.ID, v, labels...)
+	case KindSummary:
+		*m = Summary(obj.ID, obj.Summary, labels...)
 	case KindUnknown:
 		return errors.New("metrics: the metric type is unknown")
 	}
 
+	if obj.Updated != nil {
+		m.updated = *obj.Updated
+	}
+
 	return nil
 }
 
 func (m *Metric) MarshalBinary() ([]byte, error) {
-	enc := base64.RawStdEncoding
-	encodedLen := enc.EncodedLen(len(m.name))
-
-	var buf [binary.MaxVarintLen64]byte
-	n := binary.PutUvarint(buf[:], uint64(encodedLen))
+	size := 9 + stringLen(m.name)
+	if len(m.labels) > 0 || m.histogram != nil || m.summary != nil {
+		size += binary.MaxVarintLen64
+		for _, label := range m.labels {
+			size += stringLen(label.Name) + stringLen(label.Value)
+		}
+	}
 
-	data := make([]byte, 9+n+encodedLen)
+	data := make([]byte, 9, size)
 
 	data[0] = byte(m.kind)
 	binary.BigEndian.PutUint64(data[1:9], uint64(m.value))
 
-	copy(data[9:], buf[:n])
+	data = appendString(data, m.name)
+
+	// NOTE: метки записываются только при их наличии или при наличии
+	// дополнительных данных для совместимости с ранее записанными данными.
+	if len(m.labels) > 0 || m.histogram != nil || m.summary != nil {
+		data = binary.AppendUvarint(data, uint64(len(m.labels)))
+		for _, label := range m.labels {
+			data = appendString(data, label.Name)
+			data = appendString(data, label.Value)
+		}
+	}
+
+	if m.histogram != nil {
+		data = m.histogram.appendBinary(data)
+	}
 
-	src := unsafe.Slice(unsafe.StringData(m.name), len(m.name))
-	enc.Encode(data[9+n:], src)
+	if m.summary != nil {
+		data = m.summary.appendBinary(data)
+	}
 
 	return data, nil
 }
@@ -288,27 +538,114 @@ func (m *Metric) UnmarshalBinary(data []byte) error {
 	value := value(binary.BigEndian.Uint64(data[:8]))
 	data = data[8:]
 
+	name, data, err := readString(data)
+	if err != nil {
+		return err
+	}
+
+	var labels Labels
+
+	if len(data) > 0 {
+		count, n := binary.Uvarint(data)
+		if n <= 0 || count > uint64(len(data)) {
+			return errLabelsCorrupted
+		}
+		data = data[n:]
+
+		labels = make(Labels, 0, count)
+
+		for i := uint64(0); i < count; i++ {
+			var label Label
+
+			label.Name, data, err = readString(data)
+			if err != nil {
+				return err
+			}
+
+			label.Value, data, err = readString(data)
+			if err != nil {
+				return err
+			}
+
+			labels = append(labels, label)
+		}
+	}
+
+	var histogram *HistogramValue
+
+	if kind == KindHistogram {
+		histogram = new(HistogramValue)
+		data, err = histogram.readBinary(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	var summary *Sketch
+
+	if kind == KindSummary {
+		summary = new(Sketch)
+		data, err = summary.readBinary(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(data) > 0 {
+		return errors.New("metrics: data is corrupted")
+	}
+
+	*m = Metric{
+		kind:      kind,
+		name:      name,
+		labels:    NewLabels(labels...),
+		value:     value,
+		histogram: histogram,
+		summary:   summary,
+	}
+
+	return nil
+}
+
+// stringLen возвращает размер закодированной строки s.
+func stringLen(s string) int {
+	return binary.MaxVarintLen64 + base64.RawStdEncoding.EncodedLen(len(s))
+}
+
+// appendString добавляет в конец data длину и закодированную в base64
+// строку s.
+func appendString(data []byte, s string) []byte {
+	enc := base64.RawStdEncoding
+	encodedLen := enc.EncodedLen(len(s))
+
+	data = binary.AppendUvarint(data, uint64(encodedLen))
+
+	n := len(data)
+	data = append(data, make([]byte, encodedLen)...)
+
+	src := unsafe.Slice(unsafe.StringData(s), len(s))
+	enc.Encode(data[n:], src)
+
+	return data
+}
+
+// readString считывает из data закодированную строку и возвращает её
+// вместе с оставшимися данными.
+func readString(data []byte) (string, []byte, error) {
 	size, n := binary.Uvarint(data)
 	if n <= 0 || uint64(len(data)-n) < size {
-		return errors.New("metrics: data is corrupted")
+		return "", nil, errors.New("metrics: data is corrupted")
 	}
 
 	data = data[n:]
-	data = data[:size]
 
 	enc := base64.RawStdEncoding
-	name := make([]byte, enc.DecodedLen(int(size)))
+	s := make([]byte, enc.DecodedLen(int(size)))
 
-	_, err := enc.Decode(name, data)
+	_, err := enc.Decode(s, data[:size])
 	if err != nil {
-		return fmt.Errorf("metrics: base64 decoding: %w", err)
-	}
-
-	*m = Metric{
-		kind:  kind,
-		name:  unsafe.String(unsafe.SliceData(name), len(name)),
-		value: value,
+		return "", nil, fmt.Errorf("metrics: base64 decoding: %w", err)
 	}
 
-	return nil
+	return unsafe.String(unsafe.SliceData(s), len(s)), data[size:], nil
 }
@@ -3,9 +3,11 @@ package metrics_test
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
 	"github.com/sergeizaitcev/metrics/internal/metrics"
 )
 
@@ -20,6 +22,10 @@ func TestParseKind(t *testing.T) {
 		{"Gauge", metrics.KindGauge},
 		{"gauge", metrics.KindGauge},
 		{"GAUGE", metrics.KindGauge},
+		{"histogram", metrics.KindHistogram},
+		{"Histogram", metrics.KindHistogram},
+		{"summary", metrics.KindSummary},
+		{"SUMMARY", metrics.KindSummary},
 		{"", metrics.KindUnknown},
 		{"invalid", metrics.KindUnknown},
 		{"unknown", metrics.KindUnknown},
@@ -62,6 +68,41 @@ func TestMetric(t *testing.T) {
 		require.NotPanics(t, func() { gauge.Float64() })
 		require.EqualValues(t, 1, gauge.Float64())
 	})
+
+	t.Run("histogram", func(t *testing.T) {
+		h := histogram(t, []float64{1, 2}, 0.5, 1.5)
+		metric := metrics.Histogram("test", h)
+
+		require.Equal(t, "histogram", metric.Kind().String())
+		require.Equal(t, "test", metric.Name())
+		require.Equal(t, "count=2 sum=2", metric.String())
+		require.True(t, h.Equal(metric.Histogram()))
+
+		h.Observe(1)
+		require.EqualValues(t, 2, metric.Histogram().Count)
+
+		empty := metrics.Histogram("test", nil)
+		require.NotNil(t, empty.Histogram())
+		require.False(t, empty.IsEmpty())
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		s := sketch(t, metrics.DefaultAccuracy, 0.5, 1.5)
+		metric := metrics.Summary("test", s)
+
+		require.Equal(t, "summary", metric.Kind().String())
+		require.Equal(t, "test", metric.Name())
+		require.Equal(t, "count=2 sum=2", metric.String())
+		require.True(t, s.Equal(metric.Summary()))
+
+		s.Add(1)
+		require.EqualValues(t, 2, metric.Summary().Count())
+
+		empty := metrics.Summary("test", nil)
+		require.NotNil(t, empty.Summary())
+		require.Equal(t, metrics.DefaultAccuracy, empty.Summary().Accuracy())
+		require.False(t, empty.IsEmpty())
+	})
 }
 
 func TestMetric_Equal(t *testing.T) {
@@ -109,6 +150,41 @@ func TestMetric_Equal(t *testing.T) {
 			b:        metrics.Metric{},
 			wantBool: false,
 		},
+		{
+			a:        metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "a"}),
+			b:        metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "a"}),
+			wantBool: true,
+		},
+		{
+			a:        metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "a"}),
+			b:        metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "b"}),
+			wantBool: false,
+		},
+		{
+			a:        metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "a"}),
+			b:        metrics.Gauge("gauge", 1),
+			wantBool: false,
+		},
+		{
+			a:        metrics.Histogram("histogram", histogram(t, []float64{1}, 1)),
+			b:        metrics.Histogram("histogram", histogram(t, []float64{1}, 1)),
+			wantBool: true,
+		},
+		{
+			a:        metrics.Histogram("histogram", histogram(t, []float64{1}, 1)),
+			b:        metrics.Histogram("histogram", histogram(t, []float64{1}, 2)),
+			wantBool: false,
+		},
+		{
+			a:        metrics.Summary("summary", sketch(t, metrics.DefaultAccuracy, 1)),
+			b:        metrics.Summary("summary", sketch(t, metrics.DefaultAccuracy, 1)),
+			wantBool: true,
+		},
+		{
+			a:        metrics.Summary("summary", sketch(t, metrics.DefaultAccuracy, 1)),
+			b:        metrics.Summary("summary", sketch(t, metrics.DefaultAccuracy, 2)),
+			wantBool: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -148,6 +224,57 @@ func TestMetric_IsEmpty(t *testing.T) {
 	}
 }
 
+func TestMetric_Zero(t *testing.T) {
+	label := metrics.Label{Name: "host", Value: "a"}
+
+	h, _ := metrics.NewHistogramValue([]float64{1, 2})
+	emptyHistogram, _ := metrics.NewHistogramValue([]float64{1, 2})
+	h.Observe(1.5)
+
+	s, _ := metrics.NewSketch(0.05)
+	emptySketch, _ := metrics.NewSketch(0.05)
+	s.Add(1)
+
+	testCases := []struct {
+		name   string
+		metric metrics.Metric
+		want   metrics.Metric
+	}{
+		{
+			name:   "unknown",
+			metric: metrics.Metric{},
+			want:   metrics.Metric{},
+		},
+		{
+			name:   "counter",
+			metric: metrics.Counter("counter", 10, label),
+			want:   metrics.Counter("counter", 0, label),
+		},
+		{
+			name:   "gauge",
+			metric: metrics.Gauge("gauge", 1.5, label),
+			want:   metrics.Gauge("gauge", 0, label),
+		},
+		{
+			name:   "histogram",
+			metric: metrics.Histogram("histogram", h, label),
+			want:   metrics.Histogram("histogram", emptyHistogram, label),
+		},
+		{
+			name:   "summary",
+			metric: metrics.Summary("summary", s, label),
+			want:   metrics.Summary("summary", emptySketch, label),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.metric.Zero()
+			require.True(t, tc.want.Equal(got), got.GoString())
+		})
+	}
+}
+
 func TestMetric_MarshalJSON(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -170,6 +297,29 @@ func TestMetric_MarshalJSON(t *testing.T) {
 			metric:   metrics.Gauge("test", 0.00005),
 			wantData: `{"type":"gauge","id":"test","value":0.00005}`,
 		},
+		{
+			name: "labels",
+			metric: metrics.Counter("test", 1,
+				metrics.Label{Name: "service", Value: "api"},
+				metrics.Label{Name: "host", Value: "a"},
+			),
+			wantData: `{"type":"counter","id":"test","labels":{"host":"a","service":"api"},"delta":1}`,
+		},
+		{
+			name:     "histogram",
+			metric:   metrics.Histogram("test", histogram(t, []float64{1, 2}, 0.5, 3)),
+			wantData: `{"type":"histogram","id":"test","histogram":{"bounds":[1,2],"counts":[1,0,1],"sum":3.5,"count":2}}`,
+		},
+		{
+			name:     "summary",
+			metric:   metrics.Summary("test", sketch(t, 0.5, 0, 1)),
+			wantData: `{"type":"summary","id":"test","summary":{"accuracy":0.5,"positive":{"0":1},"zero":1,"sum":1,"min":0,"max":1,"count":2}}`,
+		},
+		{
+			name:     "updated",
+			metric:   updated(metrics.Gauge("test", 1), time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)),
+			wantData: `{"type":"gauge","id":"test","value":1,"updated":"2026-10-17T00:00:00Z"}`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -217,6 +367,41 @@ func TestMetric_UnmarshalJSON(t *testing.T) {
 			data:       []byte(`{"type":"gauge","id":"test"}`),
 			wantMetric: metrics.Gauge("test", 0),
 		},
+		{
+			name:       "labels",
+			data:       []byte(`{"type":"gauge","id":"test","labels":{"host":"a"},"value":1}`),
+			wantMetric: metrics.Gauge("test", 1, metrics.Label{Name: "host", Value: "a"}),
+		},
+		{
+			name:       "histogram1",
+			data:       []byte(`{"type":"histogram","id":"test","histogram":{"bounds":[1,2],"counts":[1,0,1],"sum":3.5,"count":2}}`),
+			wantMetric: metrics.Histogram("test", histogram(t, []float64{1, 2}, 0.5, 3)),
+		},
+		{
+			name:       "histogram2",
+			data:       []byte(`{"type":"histogram","id":"test"}`),
+			wantMetric: metrics.Histogram("test", nil),
+		},
+		{
+			name:       "summary1",
+			data:       []byte(`{"type":"summary","id":"test","summary":{"accuracy":0.5,"positive":{"0":1},"zero":1,"sum":1,"min":0,"max":1,"count":2}}`),
+			wantMetric: metrics.Summary("test", sketch(t, 0.5, 0, 1)),
+		},
+		{
+			name:       "summary2",
+			data:       []byte(`{"type":"summary","id":"test"}`),
+			wantMetric: metrics.Summary("test", nil),
+		},
+		{
+			name:      "summary invalid",
+			data:      []byte(`{"type":"summary","id":"test","summary":{"accuracy":2}}`),
+			wantError: true,
+		},
+		{
+			name:      "histogram invalid",
+			data:      []byte(`{"type":"histogram","id":"test","histogram":{"bounds":[1,2],"counts":[1],"sum":3.5,"count":2}}`),
+			wantError: true,
+		},
 		{
 			name:      "type is blank",
 			data:      []byte(`{"type":""}`),
@@ -266,6 +451,27 @@ func TestMetric_MarshalBinary(t *testing.T) {
 			name: "gauge",
 			want: metrics.Gauge("\n\t\x1btest", 1e-5),
 		},
+		{
+			name: "labels",
+			want: metrics.Gauge("test", 1e-5,
+				metrics.Label{Name: "host", Value: "\xb1a"},
+				metrics.Label{Name: "service", Value: "api"},
+			),
+		},
+		{
+			name: "histogram",
+			want: metrics.Histogram("test", histogram(t, metrics.DefaultBounds, 0.1, 5)),
+		},
+		{
+			name: "histogram with labels",
+			want: metrics.Histogram("test", histogram(t, metrics.DefaultBounds, 0.1),
+				metrics.Label{Name: "host", Value: "a"},
+			),
+		},
+		{
+			name: "summary",
+			want: metrics.Summary("test", sketch(t, metrics.DefaultAccuracy, -1, 0, 0.1, 5)),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -337,6 +543,14 @@ func TestMetric_UnmarshalBinary(t *testing.T) {
 			data:       marshal(t, metrics.Gauge("\xb1\b\t\ftest", 1e-5)),
 			wantMetric: metrics.Gauge("\xb1\b\t\ftest", 1e-5),
 		},
+		{
+			name: "labels corrupted",
+			data: func() []byte {
+				b := marshal(t, metrics.Gauge("test", 1, metrics.Label{Name: "host", Value: "a"}))
+				return b[:len(b)-1]
+			}(),
+			wantError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -396,3 +610,97 @@ func BenchmarkMetric_UnmarshalBinary(b *testing.B) {
 		}
 	}
 }
+
+func TestMetric_Proto(t *testing.T) {
+	testCases := []struct {
+		name string
+		want metrics.Metric
+	}{
+		{
+			name: "counter",
+			want: metrics.Counter("test", 1, metrics.Label{Name: "host", Value: "a"}),
+		},
+		{
+			name: "gauge",
+			want: metrics.Gauge("test", 1.5),
+		},
+		{
+			name: "histogram",
+			want: metrics.Histogram("test", histogram(t, metrics.DefaultBounds, 0.1, 5)),
+		},
+		{
+			name: "summary",
+			want: metrics.Summary("test", sketch(t, metrics.DefaultAccuracy, -1, 0, 0.1, 5)),
+		},
+		{
+			name: "updated",
+			want: updated(metrics.Counter("test", 1), time.Unix(1, 5)),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := metrics.FromProto(tc.want.Proto())
+			require.True(t, tc.want.Equal(got))
+			require.True(t, tc.want.Updated().Equal(got.Updated()))
+		})
+	}
+}
+
+func TestMetric_Proto_copy(t *testing.T) {
+	summary := metrics.Summary("test", sketch(t, metrics.DefaultAccuracy, -1, 0.1, 5))
+	want := summary.Summary().Clone()
+
+	value := summary.Proto()
+	for i := range value.Summary.Positive {
+		value.Summary.Positive[i] += 10
+	}
+	for i := range value.Summary.Negative {
+		delete(value.Summary.Negative, i)
+	}
+	require.True(t, want.Equal(summary.Summary()))
+
+	latency := metrics.Histogram("test", histogram(t, metrics.DefaultBounds, 0.1, 5))
+	wantLatency := latency.Histogram().Clone()
+
+	value = latency.Proto()
+	value.Histogram.Counts[0] += 10
+	value.Histogram.Bounds[0] = -1
+	require.True(t, wantLatency.Equal(latency.Histogram()))
+}
+
+func TestParseProto(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value *pb.Histogram
+	}{
+		{
+			name:  "short counts",
+			value: &pb.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1}, Count: 1},
+		},
+		{
+			name:  "count mismatch",
+			value: &pb.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 0}, Count: 2},
+		},
+		{
+			name:  "unsorted bounds",
+			value: &pb.Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value := &pb.Metric{Type: pb.MetricType_HISTOGRAM, Name: "test", Histogram: tc.value}
+
+			_, err := metrics.ParseProto(value)
+			require.Error(t, err)
+
+			got := metrics.FromProto(value)
+			require.True(t, got.IsEmpty())
+		})
+	}
+}
+
+func updated(m metrics.Metric, t time.Time) metrics.Metric {
+	return m.WithUpdated(t)
+}
@@ -0,0 +1,491 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
+)
+
+// DefaultAccuracy определяет относительную точность скетча по умолчанию.
+const DefaultAccuracy = 0.01
+
+// minIndexable определяет минимальное по модулю значение, которое попадает
+// в логарифмические бакеты; меньшие значения считаются нулём.
+const minIndexable = 1e-9
+
+// Sketch определяет скетч квантилей DDSketch с относительной точностью.
+//
+// Скетчи с одинаковой точностью объединяются без потери точности, что
+// позволяет накапливать наблюдения на агентах и объединять их на сервере.
+type Sketch struct {
+	accuracy float64
+	gamma    float64
+	logGamma float64
+
+	positive map[int32]uint64
+	negative map[int32]uint64
+	zero     uint64
+
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+// NewSketch возвращает пустой скетч с относительной точностью accuracy
+// (0 < accuracy < 1).
+func NewSketch(accuracy float64) (*Sketch, error) {
+	if !(accuracy > 0 && accuracy < 1) {
+		return nil, errors.New("metrics: sketch accuracy must be in range (0, 1)")
+	}
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &Sketch{
+		accuracy: accuracy,
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: make(map[int32]uint64),
+		negative: make(map[int32]uint64),
+		min:      math.Inf(1),
+		max:      math.Inf(-1),
+	}, nil
+}
+
+// Accuracy возвращает относительную точность скетча.
+func (s *Sketch) Accuracy() float64 { return s.accuracy }
+
+// Count возвращает количество наблюдений.
+func (s *Sketch) Count() uint64 { return s.count }
+
+// Sum возвращает сумму наблюдений.
+func (s *Sketch) Sum() float64 { return s.sum }
+
+// Min возвращает минимальное наблюдение или NaN для пустого скетча.
+func (s *Sketch) Min() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.min
+}
+
+// Max возвращает максимальное наблюдение или NaN для пустого скетча.
+func (s *Sketch) Max() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.max
+}
+
+// Add добавляет наблюдение v в скетч; значения NaN и ±Inf игнорируются.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+
+	switch {
+	case v > minIndexable:
+		s.positive[s.index(v)]++
+	case v < -minIndexable:
+		s.negative[s.index(-v)]++
+	default:
+		s.zero++
+	}
+
+	s.count++
+	s.sum += v
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+}
+
+// Compatible возвращает ошибку, если скетч x нельзя объединить с s.
+func (s *Sketch) Compatible(x *Sketch) error {
+	if x.count == 0 || s.count == 0 || s.accuracy == x.accuracy {
+		return nil
+	}
+	return errors.New("metrics: sketch accuracy mismatch")
+}
+
+// Merge объединяет скетч x с s.
+func (s *Sketch) Merge(x *Sketch) error {
+	if err := s.Compatible(x); err != nil {
+		return err
+	}
+	if x.count == 0 {
+		return nil
+	}
+	if s.count == 0 && s.accuracy != x.accuracy {
+		*s = *x.Clone()
+		return nil
+	}
+	for i, c := range x.positive {
+		s.positive[i] += c
+	}
+	for i, c := range x.negative {
+		s.negative[i] += c
+	}
+	s.zero += x.zero
+	s.count += x.count
+	s.sum += x.sum
+	s.min = math.Min(s.min, x.min)
+	s.max = math.Max(s.max, x.max)
+	return nil
+}
+
+// Quantile возвращает оценку квантиля q (0 <= q <= 1) с относительной
+// точностью скетча; для пустого скетча возвращается NaN.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 || q < 0 || q > 1 || math.IsNaN(q) {
+		return math.NaN()
+	}
+
+	rank := q * float64(s.count-1)
+
+	var (
+		n     float64
+		value float64
+		found bool
+	)
+
+	// NOTE: отрицательные значения обходятся от наибольших по модулю.
+	negative := sortedIndexes(s.negative)
+	for i := len(negative) - 1; i >= 0 && !found; i-- {
+		n += float64(s.negative[negative[i]])
+		if n > rank {
+			value, found = -s.value(negative[i]), true
+		}
+	}
+
+	if !found {
+		n += float64(s.zero)
+		if n > rank {
+			value, found = 0, true
+		}
+	}
+
+	if !found {
+		for _, i := range sortedIndexes(s.positive) {
+			n += float64(s.positive[i])
+			if n > rank {
+				value, found = s.value(i), true
+				break
+			}
+		}
+	}
+
+	if !found {
+		value = s.max
+	}
+
+	return math.Max(s.min, math.Min(s.max, value))
+}
+
+// Clone возвращает копию скетча.
+func (s *Sketch) Clone() *Sketch {
+	x := *s
+	x.positive = make(map[int32]uint64, len(s.positive))
+	for i, c := range s.positive {
+		x.positive[i] = c
+	}
+	x.negative = make(map[int32]uint64, len(s.negative))
+	for i, c := range s.negative {
+		x.negative[i] = c
+	}
+	return &x
+}
+
+// Equal возвращает true, если скетчи равны.
+func (s *Sketch) Equal(x *Sketch) bool {
+	if s == nil || x == nil {
+		return s == x
+	}
+	if s.accuracy != x.accuracy || s.zero != x.zero || s.count != x.count {
+		return false
+	}
+	if s.count > 0 && (s.sum != x.sum || s.min != x.min || s.max != x.max) {
+		return false
+	}
+	return equalBins(s.positive, x.positive) && equalBins(s.negative, x.negative)
+}
+
+// index возвращает индекс логарифмического бакета для v > 0.
+func (s *Sketch) index(v float64) int32 {
+	return int32(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value возвращает представителя логарифмического бакета i.
+func (s *Sketch) value(i int32) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+}
+
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	return s.appendBinary(nil), nil
+}
+
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	rest, err := s.readBinary(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("metrics: sketch is corrupted")
+	}
+	return nil
+}
+
+// appendBinary добавляет скетч в конец data.
+func (s *Sketch) appendBinary(data []byte) []byte {
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(s.accuracy))
+	data = appendBins(data, s.positive)
+	data = appendBins(data, s.negative)
+	data = binary.AppendUvarint(data, s.zero)
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(s.sum))
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(s.min))
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(s.max))
+	return data
+}
+
+// readBinary считывает скетч из data и возвращает оставшиеся данные.
+func (s *Sketch) readBinary(data []byte) ([]byte, error) {
+	errCorrupted := errors.New("metrics: sketch is corrupted")
+
+	if len(data) < 8 {
+		return nil, errCorrupted
+	}
+
+	x, err := NewSketch(math.Float64frombits(binary.BigEndian.Uint64(data)))
+	if err != nil {
+		return nil, errCorrupted
+	}
+	data = data[8:]
+
+	if x.positive, data, err = readBins(data); err != nil {
+		return nil, err
+	}
+	if x.negative, data, err = readBins(data); err != nil {
+		return nil, err
+	}
+
+	zero, n := binary.Uvarint(data)
+	if n <= 0 || len(data)-n < 24 {
+		return nil, errCorrupted
+	}
+	data = data[n:]
+
+	x.zero = zero
+	x.sum = math.Float64frombits(binary.BigEndian.Uint64(data))
+	x.min = math.Float64frombits(binary.BigEndian.Uint64(data[8:]))
+	x.max = math.Float64frombits(binary.BigEndian.Uint64(data[16:]))
+	data = data[24:]
+
+	x.count = x.zero
+	for _, c := range x.positive {
+		x.count += c
+	}
+	for _, c := range x.negative {
+		x.count += c
+	}
+
+	*s = *x
+
+	return data, nil
+}
+
+// sketchFromProto конвертирует *pb.Sketch в скетч и возвращает его.
+func sketchFromProto(value *pb.Sketch) (*Sketch, error) {
+	s, err := NewSketch(value.GetAccuracy())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range value.GetPositive() {
+		s.positive[i] = c
+		s.count += c
+	}
+	for i, c := range value.GetNegative() {
+		s.negative[i] = c
+		s.count += c
+	}
+
+	s.zero = value.GetZero()
+	s.count += s.zero
+	s.sum = value.GetSum()
+	if s.count > 0 {
+		s.min, s.max = value.GetMin(), value.GetMax()
+	}
+
+	return s, nil
+}
+
+// proto конвертирует скетч в *pb.Sketch. Бакеты копируются, поэтому
+// изменение сообщения не затрагивает скетч.
+func (s *Sketch) proto() *pb.Sketch {
+	x := s.Clone()
+	value := &pb.Sketch{
+		Accuracy: s.accuracy,
+		Positive: x.positive,
+		Negative: x.negative,
+		Zero:     s.zero,
+		Sum:      s.sum,
+	}
+	if s.count > 0 {
+		value.Min, value.Max = s.min, s.max
+	}
+	return value
+}
+
+type sketch struct {
+	Accuracy float64           `json:"accuracy"`           // относительная точность.
+	Positive map[string]uint64 `json:"positive,omitempty"` // бакеты положительных значений.
+	Negative map[string]uint64 `json:"negative,omitempty"` // бакеты отрицательных значений.
+	Zero     uint64            `json:"zero,omitempty"`     // количество нулевых значений.
+	Sum      float64           `json:"sum"`                // сумма наблюдений.
+	Min      *float64          `json:"min,omitempty"`      // минимальное наблюдение.
+	Max      *float64          `json:"max,omitempty"`      // максимальное наблюдение.
+	Count    uint64            `json:"count"`              // количество наблюдений.
+}
+
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	obj := sketch{
+		Accuracy: s.accuracy,
+		Positive: binsToJSON(s.positive),
+		Negative: binsToJSON(s.negative),
+		Zero:     s.zero,
+		Sum:      s.sum,
+		Count:    s.count,
+	}
+	if s.count > 0 {
+		obj.Min, obj.Max = &s.min, &s.max
+	}
+	return json.Marshal(&obj)
+}
+
+func (s *Sketch) UnmarshalJSON(data []byte) error {
+	var obj sketch
+
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	x, err := NewSketch(obj.Accuracy)
+	if err != nil {
+		return err
+	}
+
+	if x.positive, err = binsFromJSON(obj.Positive); err != nil {
+		return err
+	}
+	if x.negative, err = binsFromJSON(obj.Negative); err != nil {
+		return err
+	}
+
+	x.zero = obj.Zero
+	x.sum = obj.Sum
+	x.count = x.zero
+	for _, c := range x.positive {
+		x.count += c
+	}
+	for _, c := range x.negative {
+		x.count += c
+	}
+
+	if x.count != obj.Count {
+		return errors.New("metrics: sketch count does not match the buckets")
+	}
+	if x.count > 0 {
+		if obj.Min == nil || obj.Max == nil {
+			return errors.New("metrics: sketch min and max should not be empty")
+		}
+		x.min, x.max = *obj.Min, *obj.Max
+	}
+
+	*s = *x
+
+	return nil
+}
+
+func sortedIndexes(bins map[int32]uint64) []int32 {
+	indexes := make([]int32, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes
+}
+
+func equalBins(a, b map[int32]uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, c := range a {
+		if b[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+func appendBins(data []byte, bins map[int32]uint64) []byte {
+	data = binary.AppendUvarint(data, uint64(len(bins)))
+	for _, i := range sortedIndexes(bins) {
+		data = binary.AppendVarint(data, int64(i))
+		data = binary.AppendUvarint(data, bins[i])
+	}
+	return data
+}
+
+func readBins(data []byte) (map[int32]uint64, []byte, error) {
+	errCorrupted := errors.New("metrics: sketch is corrupted")
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)) {
+		return nil, nil, errCorrupted
+	}
+	data = data[n:]
+
+	bins := make(map[int32]uint64, size)
+
+	for j := uint64(0); j < size; j++ {
+		i, n := binary.Varint(data)
+		if n <= 0 || i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, nil, errCorrupted
+		}
+		data = data[n:]
+
+		c, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, nil, errCorrupted
+		}
+		data = data[n:]
+
+		bins[int32(i)] = c
+	}
+
+	return bins, data, nil
+}
+
+func binsToJSON(bins map[int32]uint64) map[string]uint64 {
+	if len(bins) == 0 {
+		return nil
+	}
+	m := make(map[string]uint64, len(bins))
+	for i, c := range bins {
+		m[strconv.FormatInt(int64(i), 10)] = c
+	}
+	return m
+}
+
+func binsFromJSON(m map[string]uint64) (map[int32]uint64, error) {
+	bins := make(map[int32]uint64, len(m))
+	for k, c := range m {
+		i, err := strconv.ParseInt(k, 10, 32)
+		if err != nil {
+			return nil, errors.New("metrics: sketch bucket index is invalid")
+		}
+		bins[int32(i)] = c
+	}
+	return bins, nil
+}
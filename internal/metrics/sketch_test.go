@@ -0,0 +1,143 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+func sketch(t testing.TB, accuracy float64, values ...float64) *metrics.Sketch {
+	s, err := metrics.NewSketch(accuracy)
+	require.NoError(t, err)
+	for _, v := range values {
+		s.Add(v)
+	}
+	return s
+}
+
+func TestNewSketch(t *testing.T) {
+	testCases := []struct {
+		name      string
+		accuracy  float64
+		wantError bool
+	}{
+		{name: "default", accuracy: metrics.DefaultAccuracy},
+		{name: "zero", accuracy: 0, wantError: true},
+		{name: "one", accuracy: 1, wantError: true},
+		{name: "negative", accuracy: -0.1, wantError: true},
+		{name: "nan", accuracy: math.NaN(), wantError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := metrics.NewSketch(tc.accuracy)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Zero(t, s.Count())
+				require.True(t, math.IsNaN(s.Quantile(0.5)))
+			}
+		})
+	}
+}
+
+func TestSketch_Quantile(t *testing.T) {
+	values := make([]float64, 0, 2001)
+	for i := -1000; i <= 1000; i++ {
+		values = append(values, float64(i)*1.5)
+	}
+
+	s := sketch(t, metrics.DefaultAccuracy, values...)
+	sort.Float64s(values)
+
+	require.EqualValues(t, len(values), s.Count())
+	require.Equal(t, values[0], s.Min())
+	require.Equal(t, values[len(values)-1], s.Max())
+
+	for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.75, 0.95, 0.99, 1} {
+		want := values[int(q*float64(len(values)-1))]
+		got := s.Quantile(q)
+		require.InDelta(t, want, got, math.Abs(want)*metrics.DefaultAccuracy+1e-9, "q=%v", q)
+	}
+
+	require.True(t, math.IsNaN(s.Quantile(-0.1)))
+	require.True(t, math.IsNaN(s.Quantile(1.1)))
+}
+
+func TestSketch_Add(t *testing.T) {
+	s := sketch(t, metrics.DefaultAccuracy, 1, 0, math.NaN(), math.Inf(1), -2)
+
+	require.EqualValues(t, 3, s.Count())
+	require.Equal(t, -1.0, s.Sum())
+	require.Equal(t, -2.0, s.Min())
+	require.Equal(t, 1.0, s.Max())
+	require.Equal(t, 0.0, s.Quantile(0.5))
+}
+
+func TestSketch_Merge(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		s := sketch(t, metrics.DefaultAccuracy, 1, 2, 3)
+		require.NoError(t, s.Merge(sketch(t, metrics.DefaultAccuracy, 4, 5)))
+		require.True(t, s.Equal(sketch(t, metrics.DefaultAccuracy, 1, 2, 3, 4, 5)))
+	})
+
+	t.Run("into empty", func(t *testing.T) {
+		s := sketch(t, metrics.DefaultAccuracy)
+		x := sketch(t, 0.05, 1, 2)
+		require.NoError(t, s.Merge(x))
+		require.True(t, s.Equal(x))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		s := sketch(t, metrics.DefaultAccuracy, 1)
+		require.NoError(t, s.Merge(sketch(t, 0.05)))
+		require.EqualValues(t, 1, s.Count())
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		s := sketch(t, metrics.DefaultAccuracy, 1)
+		require.Error(t, s.Merge(sketch(t, 0.05, 1)))
+	})
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	want := sketch(t, metrics.DefaultAccuracy, -10, -0.5, 0, 0.001, 3, 3, 1e6)
+
+	data, err := want.MarshalBinary()
+	require.NoError(t, err)
+
+	var got metrics.Sketch
+	require.NoError(t, got.UnmarshalBinary(data))
+	require.True(t, want.Equal(&got))
+	require.Equal(t, want.Quantile(0.9), got.Quantile(0.9))
+
+	require.Error(t, got.UnmarshalBinary(data[:len(data)-1]))
+	require.Error(t, got.UnmarshalBinary(append(data, 0)))
+}
+
+func TestSketch_MarshalJSON(t *testing.T) {
+	want := sketch(t, metrics.DefaultAccuracy, -1, 0, 2)
+
+	data, err := json.Marshal(want)
+	require.NoError(t, err)
+
+	var got metrics.Sketch
+	require.NoError(t, json.Unmarshal(data, &got))
+	require.True(t, want.Equal(&got))
+
+	invalid := []string{
+		`{"accuracy":0}`,
+		`{"accuracy":0.01,"positive":{"1":1},"sum":1,"count":2,"min":1,"max":1}`,
+		`{"accuracy":0.01,"positive":{"x":1},"sum":1,"count":1,"min":1,"max":1}`,
+		`{"accuracy":0.01,"positive":{"1":1},"sum":1,"count":1}`,
+	}
+	for _, data := range invalid {
+		require.Error(t, json.Unmarshal([]byte(data), &got), data)
+	}
+}
@@ -0,0 +1,154 @@
+// Package migrate копирует метрики из одного хранилища в другое.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+)
+
+// Run копирует метрики из хранилища c.From в хранилище c.To и, если
+// включена сверка, сравнивает их значения после копирования.
+func Run(ctx context.Context, c *configs.Migrate) (err error) {
+	logger := logging.New(os.Stdout, c.Level)
+
+	src, err := open(c.From, true)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer closeStorage(src, &err)
+
+	// NOTE: при пробном запуске хранилище назначения только читается.
+	dst, err := open(c.To, c.DryRun)
+	if err != nil {
+		return fmt.Errorf("open destination: %w", err)
+	}
+	defer closeStorage(dst, &err)
+
+	opts := &storage.CopyOpts{
+		BatchSize: c.BatchSize,
+		DryRun:    c.DryRun,
+	}
+
+	report, err := storage.Copy(ctx, dst, src, opts)
+	if err != nil {
+		return err
+	}
+	logger.Log(logging.LevelInfo, "metrics copied",
+		"total", report.Total,
+		"copied", report.Copied,
+		"skipped", report.Skipped,
+		"dry_run", c.DryRun,
+	)
+
+	if !c.Verify {
+		return nil
+	}
+
+	mismatches, err := storage.Verify(ctx, dst, src)
+	if err != nil {
+		return err
+	}
+	for _, m := range mismatches {
+		logger.Log(logging.LevelDebug, "metric mismatch",
+			"key", m.Want.Key(),
+			"want", m.Want.String(),
+			"got", m.Got.String(),
+		)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("verify: %d of %d metrics mismatch", len(mismatches), report.Total)
+	}
+	logger.Log(logging.LevelInfo, "metrics verified", "total", report.Total)
+
+	return nil
+}
+
+// open открывает хранилище по строке подключения dsn. Если readOnly равен
+// true, то хранилище при открытии не изменяется: локальное хранилище
+// и файл SQLite должны существовать, журнал читается без восстановления
+// файлов, а миграции БД не запускаются, но должны быть применены.
+func open(dsn string, readOnly bool) (storage.Storage, error) {
+	config := &configs.Server{
+		Restore:     true,
+		SegmentSize: configs.DefaultServer.SegmentSize,
+	}
+
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		config.DatabaseDSN = dsn
+	case strings.HasPrefix(dsn, "sqlite://"):
+		config.SQLitePath = strings.TrimPrefix(dsn, "sqlite://")
+	default:
+		config.FileStoragePath = strings.TrimPrefix(dsn, "file://")
+	}
+
+	if !readOnly {
+		return storage.NewStorage(config)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case config.DatabaseDSN != "":
+		s, err := storage.NewPostgres(config.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		if err = check(ctx, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case config.SQLitePath != "":
+		if _, err := os.Stat(config.SQLitePath); err != nil {
+			return nil, err
+		}
+		s, err := storage.NewSQLite(config.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+		if err = check(ctx, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		if _, err := os.Stat(config.FileStoragePath); err != nil {
+			return nil, err
+		}
+		return storage.NewLocal(config.FileStoragePath, &storage.LocalOpts{ReadOnly: true})
+	}
+}
+
+// migrated определяет БД, миграции которой проверяются.
+type migrated interface {
+	storage.Storage
+	MigrateCheck(ctx context.Context) error
+}
+
+// check проверяет доступность БД s и применение её миграций и закрывает
+// её при ошибке.
+func check(ctx context.Context, s migrated) error {
+	err := s.Ping(ctx)
+	if err == nil {
+		err = s.MigrateCheck(ctx)
+	}
+	if err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+func closeStorage(s storage.Storage, err *error) {
+	closeErr := s.Close()
+	if closeErr != nil && *err == nil {
+		*err = closeErr
+	}
+}
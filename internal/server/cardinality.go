@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+)
+
+// CardinalityPath определяет путь получения кардинальности метрик.
+const CardinalityPath = "/cardinality"
+
+var errCardinalityTenant = errors.New("cardinality is not available to tenants")
+
+// NewCardinalityHandler возвращает обработчик запросов кардинальности
+// метрик хранилища l с ограничением количества метрик maxSeries.
+//
+// NOTE: в кластере обработчик возвращает кардинальность метрик текущего
+// узла; кардинальность учитывает метрики всех арендаторов, поэтому
+// запросы от имени арендатора отклоняются.
+func NewCardinalityHandler(
+	l *storage.Limited,
+	maxSeries int,
+	middlewares ...middleware.Middleware,
+) http.Handler {
+	router := &httprouter.Router{
+		HandleMethodNotAllowed: true,
+	}
+	router.Handle(http.MethodGet, CardinalityPath, middleware.Use(getCardinality(l, maxSeries), middlewares...))
+	return router
+}
+
+// getCardinality возвращает в формате JSON количество метрик в хранилище,
+// ограничение их количества и количество отклонённых значений.
+func getCardinality(l *storage.Limited, maxSeries int) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := r.Context()
+
+		if storage.TenantFromContext(ctx) != "" {
+			sendError(w, http.StatusForbidden, errCardinalityTenant)
+			return
+		}
+
+		c, err := l.Cardinality(ctx)
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		resp := struct {
+			Series    int    `json:"series"`
+			MaxSeries int    `json:"max_series"`
+			Rejected  uint64 `json:"rejected"`
+		}{c.Series, maxSeries, c.Rejected}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
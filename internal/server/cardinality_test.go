@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/internal/storage/mocks"
+)
+
+func TestHandlers_cardinality(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tenant   string
+		values   []metrics.Metric
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "ok",
+			values:   []metrics.Metric{metrics.Counter("a", 1), metrics.Gauge("b", 1)},
+			wantCode: http.StatusOK,
+			wantBody: `{"series":2,"max_series":10,"rejected":0}`,
+		},
+		{
+			name:     "empty",
+			err:      storage.ErrNotFound,
+			wantCode: http.StatusOK,
+			wantBody: `{"series":0,"max_series":10,"rejected":0}`,
+		},
+		{
+			name:     "tenant",
+			tenant:   "a",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "internal error",
+			err:      errors.New("error"),
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := mocks.NewMockStorage()
+			if tc.tenant == "" {
+				store.On("GetAll", mock.Anything).Return(tc.values, tc.err).Once()
+			}
+
+			limited := storage.NewLimited(store, storage.Limits{MaxSeries: 10})
+			handler := server.NewCardinalityHandler(limited, 10)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, server.CardinalityPath, nil)
+			req = req.WithContext(storage.WithTenant(req.Context(), tc.tenant))
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			store.AssertExpectations(t)
+
+			if tc.wantBody != "" {
+				require.JSONEq(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
+	"github.com/sergeizaitcev/metrics/internal/cluster"
+	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+// testClusterConfigs возвращает конфиги n узлов кластера на loopback-адресах.
+func testClusterConfigs(t *testing.T, n int) []*configs.Server {
+	nodes := make(configs.Nodes, n)
+	streams := make([]string, n)
+	for i := range nodes {
+		port, err := tcputil.FreePort()
+		require.NoError(t, err)
+		nodes[i] = "127.0.0.1:" + port
+
+		port, err = tcputil.FreePort()
+		require.NoError(t, err)
+		streams[i] = "127.0.0.1:" + port
+	}
+
+	cfgs := make([]*configs.Server, n)
+	for i := range cfgs {
+		cfg := *configs.DefaultServer
+		cfg.Address = nodes[i]
+		cfg.StreamAddress = streams[i]
+		cfg.FileStoragePath = filepath.Join(t.TempDir(), "metrics.wal")
+		cfg.StoreInterval = 0
+		cfg.ClusterNodes = nodes
+		cfg.ClusterKey = "secret"
+		cfgs[i] = &cfg
+	}
+
+	return cfgs
+}
+
+func TestServer_cluster(t *testing.T) {
+	ctx := testutil.Context(t)
+	cfgs := testClusterConfigs(t, 3)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	done := make(chan error, len(cfgs))
+	for _, cfg := range cfgs {
+		cfg := cfg
+		go func() { done <- server.New(cfg, nil).Run(ctx) }()
+	}
+	t.Cleanup(func() {
+		cancel()
+		for range cfgs {
+			<-done
+		}
+	})
+
+	for _, cfg := range cfgs {
+		require.Eventually(t, func() bool {
+			res, err := http.Get("http://" + cfg.Address + "/ping")
+			if err != nil {
+				return false
+			}
+			res.Body.Close()
+			return res.StatusCode == http.StatusOK
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	values := []metrics.Metric{
+		metrics.Counter("PollCount", 1),
+		metrics.Gauge("Alloc", 2),
+		metrics.Gauge("HeapAlloc", 3),
+		metrics.Gauge("RandomValue", 4),
+	}
+
+	body, err := json.Marshal(values)
+	require.NoError(t, err)
+
+	res, err := http.Post("http://"+cfgs[0].Address+"/updates/", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	conn, err := grpc.Dial(cfgs[1].StreamAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	counter := metrics.Counter("PollCount", 2)
+
+	_, err = pb.NewMetricsClient(conn).Update(ctx, &pb.UpdateRequest{
+		Metrics: []*pb.Metric{counter.Proto()},
+	})
+	require.NoError(t, err)
+
+	for _, cfg := range cfgs {
+		res, err := http.Get("http://" + cfg.Address + "/")
+		require.NoError(t, err)
+
+		got, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+
+		require.Equal(t, "Alloc=2\nHeapAlloc=3\nPollCount=3\nRandomValue=4\n", string(got))
+	}
+}
+
+func TestServer_clusterPeers(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	cfg := testClusterConfigs(t, 1)[0]
+	cfg.TrustedSubnet = "192.0.2.0/24"
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- server.New(cfg, nil).Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.Eventually(t, func() bool {
+		res, err := http.Get("http://" + cfg.Address + "/ping")
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	testCases := []struct {
+		name       string
+		key        string
+		ip         string
+		wantStatus int
+	}{
+		{
+			name:       "ok",
+			key:        cfg.ClusterKey,
+			ip:         "192.0.2.1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "without key",
+			ip:         "192.0.2.1",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "invalid key",
+			key:        "invalid",
+			ip:         "192.0.2.1",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "without ip",
+			key:        cfg.ClusterKey,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "untrusted ip",
+			key:        cfg.ClusterKey,
+			ip:         "198.51.100.1",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+				"http://"+cfg.Address+cluster.PathPrefix+"select", strings.NewReader("{}"))
+			require.NoError(t, err)
+
+			if tc.key != "" {
+				req.Header.Set(cluster.KeyHeader, tc.key)
+			}
+			if tc.ip != "" {
+				req.Header.Set(middleware.IPHeader, tc.ip)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+
+			require.Equal(t, tc.wantStatus, res.StatusCode)
+		})
+	}
+}
@@ -40,7 +40,7 @@ func ExampleHandler_all() {
 	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
 
 	storage := mocks.NewMockStorage()
-	storage.On("GetAll", mock.Anything).Return(values, nil)
+	storage.On("Select", mock.Anything, mock.Anything).Return(values, nil)
 
 	h := server.NewHandler(storage)
 	h.ServeHTTP(rec, req)
@@ -68,7 +68,7 @@ func ExampleHandler_get() {
 	req.Header.Add("Content-Type", "application/json")
 
 	storage := mocks.NewMockStorage()
-	storage.On("Get", mock.Anything, value.Name()).Return(value, nil)
+	storage.On("Get", mock.Anything, value.Name(), value.Labels()).Return(value, nil)
 
 	h := server.NewHandler(storage)
 	h.ServeHTTP(rec, req)
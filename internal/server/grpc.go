@@ -2,11 +2,14 @@ package server
 
 import (
 	"context"
-	"net"
+	"crypto/subtle"
+	"errors"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
 	"github.com/sergeizaitcev/metrics/internal/configs"
@@ -17,23 +20,28 @@ import (
 
 type updateServer struct {
 	pb.UnimplementedMetricsServer
-	subnet    *net.IPNet
-	sha256key string
-	storage   storage.Storage
+	sha256key      string
+	replicationKey string
+	storage        storage.Storage
+	replica        *replica // nil, если хранилище не локальное.
 }
 
 func newUpdateServer(config *configs.Server, storage storage.Storage) *updateServer {
 	return &updateServer{
-		subnet:    config.CIDR(),
-		sha256key: config.SHA256Key,
-		storage:   storage,
+		sha256key:      config.SHA256Key,
+		replicationKey: config.ReplicationKey,
+		storage:        storage,
 	}
 }
 
 func (s *updateServer) Update(ctx context.Context, req *pb.UpdateRequest) (*emptypb.Empty, error) {
 	values := make([]metrics.Metric, 0, len(req.Metrics))
 	for _, metric := range req.Metrics {
-		values = append(values, metrics.FromProto(metric))
+		value, err := metrics.ParseProto(metric)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		values = append(values, value)
 	}
 
 	if s.sha256key != "" {
@@ -45,9 +53,243 @@ func (s *updateServer) Update(ctx context.Context, req *pb.UpdateRequest) (*empt
 	}
 
 	_, err := s.storage.Save(ctx, values...)
+	var limitErr *storage.LimitError
+	if errors.As(err, &limitErr) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if errors.Is(err, storage.ErrReadOnly) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
 	return &emptypb.Empty{}, nil
 }
+
+func (s *updateServer) Range(ctx context.Context, req *pb.RangeRequest) (*pb.RangeResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "metric name is empty")
+	}
+
+	to := time.Now()
+	if req.GetTo() != nil {
+		to = req.GetTo().AsTime()
+	}
+
+	from := to.Add(-defaultRange)
+	if req.GetFrom() != nil {
+		from = req.GetFrom().AsTime()
+	}
+
+	if !from.Before(to) {
+		return nil, status.Error(codes.InvalidArgument, errRangeInvalid.Error())
+	}
+
+	labels := metrics.LabelsFromMap(req.GetLabels())
+
+	values, err := s.storage.Range(ctx, req.GetName(), labels, from, to)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.RangeResponse{
+		Samples: make([]*pb.Sample, 0, len(values)),
+	}
+
+	for _, value := range values {
+		metric := value.Value.Proto()
+		if req.GetType() != pb.MetricType_UNSPECIFIED && req.GetType() != metric.GetType() {
+			continue
+		}
+		resp.Samples = append(resp.Samples, &pb.Sample{
+			Time:   timestamppb.New(value.Time),
+			Metric: metric,
+		})
+	}
+
+	return resp, nil
+}
+
+// Delete удаляет метрику вместе с её историей или, если передан флаг
+// reset_value, сбрасывает её значение в ноль и возвращает предыдущее.
+//
+// Подпись вычисляется по метрике с нулевым значением, типом, именем
+// и метками из запроса.
+func (s *updateServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "metric name is empty")
+	}
+	if req.GetType() == pb.MetricType_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, errMetricUnknown.Error())
+	}
+
+	target := metrics.FromProto(&pb.Metric{
+		Type:   req.GetType(),
+		Name:   req.GetName(),
+		Labels: req.GetLabels(),
+	})
+
+	if s.sha256key != "" {
+		hash := md.GetHash256(ctx)
+		currentHash := metrics.Sign(s.sha256key, []metrics.Metric{target})
+		if hash != currentHash {
+			return nil, status.Error(codes.DataLoss, "metrics is corrupted")
+		}
+	}
+
+	actual, err := s.storage.Get(ctx, target.Name(), target.Labels())
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if actual.Kind() != target.Kind() {
+		return nil, status.Error(codes.NotFound, storage.ErrNotFound.Error())
+	}
+
+	if !req.GetResetValue() {
+		err = s.storage.Delete(ctx, target.Name(), target.Labels())
+	} else {
+		actual, err = s.storage.Reset(ctx, target.Name(), target.Labels())
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, storage.ErrReadOnly) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.DeleteResponse{}
+	if req.GetResetValue() {
+		resp.Metric = actual.Proto()
+	}
+
+	return resp, nil
+}
+
+// Watch отправляет клиенту значения метрик, удовлетворяющих условиям
+// выборки из запроса, по мере их сохранения.
+func (s *updateServer) Watch(req *pb.WatchRequest, stream pb.Metrics_WatchServer) error {
+	ctx := stream.Context()
+
+	kind := metrics.FromProto(&pb.Metric{Type: req.GetType()})
+
+	m := storage.Matcher{
+		Prefix: req.GetPrefix(),
+		Glob:   req.GetGlob(),
+		Regex:  req.GetRegex(),
+		Kind:   kind.Kind(),
+		Labels: metrics.LabelsFromMap(req.GetLabels()),
+	}
+
+	err := m.Validate()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	samples, err := s.storage.Watch(ctx, m)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for sample := range samples {
+		err = stream.Send(&pb.Sample{
+			Time:   timestamppb.New(sample.Time),
+			Metric: sample.Value.Proto(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() == nil {
+		return status.Error(codes.Unavailable, "subscription is closed")
+	}
+
+	return nil
+}
+
+// Replicate передаёт ведомому серверу записи журнала локального хранилища,
+// следующие за записью из запроса, а при необходимости — снимок хранилища.
+//
+// NOTE: журнал содержит метрики всех арендаторов, поэтому запросы
+// от имени арендатора отклоняются.
+func (s *updateServer) Replicate(req *pb.ReplicateRequest, stream pb.Metrics_ReplicateServer) error {
+	ctx := stream.Context()
+
+	err := s.authorizeReplica(ctx)
+	if err != nil {
+		return err
+	}
+	if s.replica == nil {
+		return status.Error(codes.FailedPrecondition, storage.ErrReplicationDisabled.Error())
+	}
+
+	err = s.replica.local.Replicate(ctx, req.GetEpoch(), req.GetLsn(), func(batch storage.ReplicationBatch) error {
+		return stream.Send(&pb.ReplicateResponse{
+			Epoch:    batch.Epoch,
+			Lsn:      batch.LSN,
+			Head:     batch.Head,
+			Records:  batch.Records,
+			Snapshot: batch.Snapshot,
+			Last:     batch.Last,
+		})
+	})
+	if errors.Is(err, storage.ErrReplicationDisabled) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil && ctx.Err() == nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	return nil
+}
+
+// Promote повышает ведомый сервер до ведущего.
+func (s *updateServer) Promote(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	err := s.authorizeReplica(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.replica == nil {
+		return nil, status.Error(codes.FailedPrecondition, storage.ErrReplicationDisabled.Error())
+	}
+
+	err = s.replica.promote(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// authorizeReplica возвращает ошибку, если ключ репликации не задан или
+// не передан в запросе, а также если запрос выполняется от имени
+// арендатора.
+func (s *updateServer) authorizeReplica(ctx context.Context) error {
+	if s.replicationKey == "" {
+		return status.Error(codes.PermissionDenied, "replication key is not configured")
+	}
+	key := md.GetReplicationKey(ctx)
+	if subtle.ConstantTimeCompare([]byte(key), []byte(s.replicationKey)) != 1 {
+		return status.Error(codes.Unauthenticated, "replication key is invalid")
+	}
+	if storage.TenantFromContext(ctx) != "" {
+		return status.Error(codes.PermissionDenied, "replication is not available to tenants")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestServer_updateMalformedHistogram(t *testing.T) {
+	ctx := testutil.Context(t)
+	cfg := testReplicaConfig(t, "")
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- server.New(cfg, nil).Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.Eventually(t, func() bool {
+		res, err := http.Get("http://" + cfg.Address + "/ping")
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.Dial(cfg.StreamAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	client := pb.NewMetricsClient(conn)
+
+	h, err := metrics.NewHistogramValue(metrics.DefaultBounds)
+	require.NoError(t, err)
+	h.Observe(0.1)
+
+	valid := metrics.Histogram("latency", h)
+
+	_, err = client.Update(ctx, &pb.UpdateRequest{Metrics: []*pb.Metric{valid.Proto()}})
+	require.NoError(t, err)
+
+	// NOTE: границы совпадают с сохранённой гистограммой, а бакетов
+	// меньше, чем требуется.
+	malformed := valid.Proto()
+	malformed.Histogram.Counts = []uint64{1}
+	malformed.Histogram.Count = 1
+
+	_, err = client.Update(ctx, &pb.UpdateRequest{Metrics: []*pb.Metric{malformed}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Update(ctx, &pb.UpdateRequest{Metrics: []*pb.Metric{valid.Proto()}})
+	require.NoError(t, err)
+}
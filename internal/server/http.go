@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -19,8 +21,14 @@ var (
 	errMetricEmpty            = errors.New("metric is empty")
 	errMetricUnknown          = errors.New("metric kind is unknown")
 	errContentTypeUnsupported = errors.New("content type is unsupported")
+	errQuantileUnsupported    = errors.New("metric kind does not support quantiles")
+	errQuantileEmpty          = errors.New("quantiles is empty")
+	errRangeInvalid           = errors.New("range is invalid")
 )
 
+// defaultRange определяет интервал истории метрики по умолчанию.
+const defaultRange = time.Hour
+
 // New возвращает новый обработчик HTTP-запросов.
 func NewHandler(s storage.Storage, middlewares ...middleware.Middleware) http.Handler {
 	router := &httprouter.Router{
@@ -40,11 +48,41 @@ func NewHandler(s storage.Storage, middlewares ...middleware.Middleware) http.Ha
 			path:   "/",
 			handle: all,
 		},
+		{
+			method: http.MethodGet,
+			path:   "/metrics",
+			handle: exposition,
+		},
+		{
+			method: http.MethodGet,
+			path:   "/values",
+			handle: list,
+		},
+		{
+			method: http.MethodGet,
+			path:   "/watch",
+			handle: watch,
+		},
 		{
 			method: http.MethodGet,
 			path:   "/value/:metric/:name",
 			handle: get,
 		},
+		{
+			method: http.MethodDelete,
+			path:   "/value/:metric/:name",
+			handle: remove,
+		},
+		{
+			method: http.MethodGet,
+			path:   "/quantile/:metric/:name",
+			handle: quantile,
+		},
+		{
+			method: http.MethodGet,
+			path:   "/range/:metric/:name",
+			handle: history,
+		},
 		{
 			method: http.MethodPost,
 			path:   "/value",
@@ -93,11 +131,19 @@ func ping(s storage.Storage) httprouter.Handle {
 	}
 }
 
+// all возвращает метрики, удовлетворяющие условиям выборки, переданным
+// в параметрах запроса.
 func all(s storage.Storage) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		matcher, err := parseMatcher(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
 		ctx := r.Context()
 
-		values, err := s.GetAll(ctx)
+		values, err := s.Select(ctx, matcher)
 		if err != nil {
 			sendError(w, http.StatusInternalServerError, err)
 			return
@@ -108,7 +154,86 @@ func all(s storage.Storage) httprouter.Handle {
 		w.WriteHeader(http.StatusOK)
 
 		for _, value := range values {
-			fmt.Fprintf(w, "%s=%s\n", value.Name(), value.String())
+			fmt.Fprintf(w, "%s%s=%s\n", value.Name(), value.Labels(), value.String())
+		}
+	}
+}
+
+// list возвращает в формате JSON метрики, удовлетворяющие условиям
+// выборки, переданным в параметрах запроса.
+func list(s storage.Storage) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		matcher, err := parseMatcher(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		values, err := s.Select(ctx, matcher)
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if values == nil {
+			values = []metrics.Metric{}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(values)
+	}
+}
+
+// watch отправляет в формате Server-Sent Events значения метрик,
+// удовлетворяющих условиям выборки из параметров запроса, по мере их
+// сохранения. Каждое событие содержит значение в формате JSON.
+func watch(s storage.Storage) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		matcher, err := parseMatcher(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		samples, err := s.Watch(ctx, matcher)
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		if err = rc.Flush(); err != nil {
+			return
+		}
+
+		for value := range samples {
+			data, err := json.Marshal(sample{
+				Time:   value.Time,
+				Metric: &value.Value,
+			})
+			if err != nil {
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			if err != nil {
+				return
+			}
+			if err = rc.Flush(); err != nil {
+				return
+			}
 		}
 	}
 }
@@ -122,9 +247,15 @@ func get(s storage.Storage) httprouter.Handle {
 			return
 		}
 
+		labels, err := parseLabels(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
 		ctx := r.Context()
 
-		metric, err := s.Get(ctx, p.ByName("name"))
+		metric, err := s.Get(ctx, p.ByName("name"), labels)
 		if errors.Is(err, storage.ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -142,6 +273,303 @@ func get(s storage.Storage) httprouter.Handle {
 	}
 }
 
+// remove удаляет метрику вместе с её историей; если в параметрах запроса
+// передано reset=true, то значение метрики сбрасывается в ноль, а в ответе
+// возвращается предыдущее значение.
+func remove(s storage.Storage) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		kind := metrics.ParseKind(p.ByName("metric"))
+		if kind == metrics.KindUnknown {
+			sendError(w, http.StatusBadRequest, errMetricUnknown)
+			return
+		}
+
+		labels, err := parseLabels(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var reset bool
+		if query := r.URL.Query(); query.Has("reset") {
+			reset, err = strconv.ParseBool(query.Get("reset"))
+			if err != nil {
+				sendError(w, http.StatusBadRequest, fmt.Errorf("parse bool: %s", err))
+				return
+			}
+		}
+
+		ctx := r.Context()
+		name := p.ByName("name")
+
+		metric, err := s.Get(ctx, name, labels)
+		if errors.Is(err, storage.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if metric.Kind() != kind {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if !reset {
+			err = s.Delete(ctx, name, labels)
+		} else {
+			metric, err = s.Reset(ctx, name, labels)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			sendError(w, saveStatus(err), err)
+			return
+		}
+
+		if !reset {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintln(w, metric.String())
+	}
+}
+
+// quantile возвращает оценки квантилей, переданных в параметрах запроса
+// в формате q=0.99, для метрик типа гистограмма и сводка.
+func quantile(s storage.Storage) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		kind := metrics.ParseKind(p.ByName("metric"))
+		if kind == metrics.KindUnknown {
+			sendError(w, http.StatusBadRequest, errMetricUnknown)
+			return
+		}
+		if kind != metrics.KindHistogram && kind != metrics.KindSummary {
+			sendError(w, http.StatusBadRequest, errQuantileUnsupported)
+			return
+		}
+
+		labels, err := parseLabels(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		qs := r.URL.Query()["q"]
+		if len(qs) == 0 {
+			sendError(w, http.StatusBadRequest, errQuantileEmpty)
+			return
+		}
+
+		quantiles := make([]float64, len(qs))
+		for i, q := range qs {
+			quantiles[i], err = strconv.ParseFloat(q, 64)
+			if err != nil || quantiles[i] < 0 || quantiles[i] > 1 {
+				sendError(w, http.StatusBadRequest, fmt.Errorf("invalid quantile %q", q))
+				return
+			}
+		}
+
+		ctx := r.Context()
+
+		metric, err := s.Get(ctx, p.ByName("name"), labels)
+		if errors.Is(err, storage.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if metric.Kind() != kind {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// NOTE: для пустых метрик квантиль не определён и кодируется как null.
+		result := make(map[string]*float64, len(qs))
+		for i, q := range quantiles {
+			var v float64
+			if kind == metrics.KindHistogram {
+				v = metric.Histogram().Quantile(q)
+			} else {
+				v = metric.Summary().Quantile(q)
+			}
+			result[qs[i]] = nil
+			if !math.IsNaN(v) {
+				result[qs[i]] = &v
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// sample определяет значение метрики в момент времени.
+type sample struct {
+	Time   time.Time       `json:"time"`   // время сохранения значения.
+	Metric *metrics.Metric `json:"metric"` // значение метрики.
+}
+
+// rollup определяет агрегированные значения метрики за интервал.
+type rollup struct {
+	Time   time.Time       `json:"time"`           // начало интервала.
+	Count  uint64          `json:"count"`          // количество исходных значений.
+	Sum    float64         `json:"sum"`            // прирост счётчика или сумма значений датчика.
+	Rate   *float64        `json:"rate,omitempty"` // скорость прироста счётчика в секунду.
+	Min    *float64        `json:"min,omitempty"`  // минимальное значение датчика.
+	Max    *float64        `json:"max,omitempty"`  // максимальное значение датчика.
+	Avg    *float64        `json:"avg,omitempty"`  // среднее значение датчика.
+	Metric *metrics.Metric `json:"metric"`         // последнее значение метрики.
+}
+
+// history возвращает историю значений метрики в интервале, переданном
+// в параметрах запроса from и to в формате RFC 3339 или unix time; по
+// умолчанию возвращается история за последний час. Если в параметре запроса
+// resolution передано разрешение уровня хранения, то возвращаются
+// агрегированные значения.
+func history(s storage.Storage) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		kind := metrics.ParseKind(p.ByName("metric"))
+		if kind == metrics.KindUnknown {
+			sendError(w, http.StatusBadRequest, errMetricUnknown)
+			return
+		}
+
+		labels, err := parseLabels(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		query := r.URL.Query()
+
+		to, err := parseTime(query.Get("to"), time.Now())
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		from, err := parseTime(query.Get("from"), to.Add(-defaultRange))
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if !from.Before(to) {
+			sendError(w, http.StatusBadRequest, errRangeInvalid)
+			return
+		}
+
+		ctx := r.Context()
+
+		if query.Has("resolution") {
+			resolution, err := parseResolution(query.Get("resolution"))
+			if err != nil {
+				sendError(w, http.StatusBadRequest, err)
+				return
+			}
+			rollups(w, r, s, kind, p.ByName("name"), labels, resolution, from, to)
+			return
+		}
+
+		values, err := s.Range(ctx, p.ByName("name"), labels, from, to)
+		if errors.Is(err, storage.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		samples := make([]sample, 0, len(values))
+		for i := range values {
+			if values[i].Value.Kind() != kind {
+				continue
+			}
+			samples = append(samples, sample{
+				Time:   values[i].Time,
+				Metric: &values[i].Value,
+			})
+		}
+		if len(samples) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(samples)
+	}
+}
+
+// rollups отправляет агрегированные значения метрики.
+func rollups(
+	w http.ResponseWriter,
+	r *http.Request,
+	s storage.Storage,
+	kind metrics.Kind,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) {
+	values, err := s.Rollups(r.Context(), name, labels, resolution, from, to)
+	if errors.Is(err, storage.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := make([]rollup, 0, len(values))
+	for i := range values {
+		value := &values[i]
+		if value.Value.Kind() != kind {
+			continue
+		}
+		v := rollup{
+			Time:   value.Time,
+			Count:  value.Count,
+			Sum:    value.Sum,
+			Metric: &value.Value,
+		}
+		if kind == metrics.KindCounter {
+			v.Rate = &value.Rate
+		} else {
+			v.Min, v.Max, v.Avg = &value.Min, &value.Max, &value.Avg
+		}
+		result = append(result, v)
+	}
+	if len(result) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(result)
+}
+
 func getV2(s storage.Storage) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctype := r.Header.Get("Content-Type")
@@ -164,7 +592,7 @@ func getV2(s storage.Storage) httprouter.Handle {
 
 		ctx := r.Context()
 
-		actual, err := s.Get(ctx, metric.Name())
+		actual, err := s.Get(ctx, metric.Name(), metric.Labels())
 		if errors.Is(err, storage.ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -195,6 +623,12 @@ func update(s storage.Storage) httprouter.Handle {
 			return
 		}
 
+		labels, err := parseLabels(r)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
 		name := p.ByName("name")
 		value := p.ByName("value")
 
@@ -207,21 +641,43 @@ func update(s storage.Storage) httprouter.Handle {
 				sendError(w, http.StatusBadRequest, fmt.Errorf("parse int: %s", err))
 				return
 			}
-			metric = metrics.Counter(name, v)
+			metric = metrics.Counter(name, v, labels...)
 		case metrics.KindGauge:
 			v, err := strconv.ParseFloat(value, 64)
 			if err != nil {
 				sendError(w, http.StatusBadRequest, fmt.Errorf("parse float: %s", err))
 				return
 			}
-			metric = metrics.Gauge(name, v)
+			metric = metrics.Gauge(name, v, labels...)
+		case metrics.KindHistogram:
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				sendError(w, http.StatusBadRequest, fmt.Errorf("parse float: %s", err))
+				return
+			}
+			// NOTE: значение передаётся как единичное наблюдение
+			// в гистограмму с границами бакетов по умолчанию.
+			h, _ := metrics.NewHistogramValue(metrics.DefaultBounds)
+			h.Observe(v)
+			metric = metrics.Histogram(name, h, labels...)
+		case metrics.KindSummary:
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				sendError(w, http.StatusBadRequest, fmt.Errorf("parse float: %s", err))
+				return
+			}
+			// NOTE: значение передаётся как единичное наблюдение
+			// в скетч с точностью по умолчанию.
+			sketch, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+			sketch.Add(v)
+			metric = metrics.Summary(name, sketch, labels...)
 		}
 
 		ctx := r.Context()
 
-		_, err := s.Save(ctx, metric)
+		_, err = s.Save(ctx, metric)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, err)
+			sendError(w, saveStatus(err), err)
 		}
 	}
 }
@@ -251,7 +707,7 @@ func updateV2(s storage.Storage) httprouter.Handle {
 
 		actual, err := s.Save(ctx, metric)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, err)
+			sendError(w, saveStatus(err), err)
 			return
 		}
 
@@ -289,11 +745,93 @@ func updateV3(s storage.Storage) httprouter.Handle {
 
 		_, err = s.Save(ctx, values...)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, err)
+			sendError(w, saveStatus(err), err)
 		}
 	}
 }
 
+// parseLabels возвращает метки, переданные в параметрах запроса
+// в формате label=name=value.
+func parseLabels(r *http.Request) (metrics.Labels, error) {
+	return metrics.ParseLabels(r.URL.Query()["label"])
+}
+
+// parseMatcher возвращает условия выборки метрик, переданные в параметрах
+// запроса prefix, glob, regex, type и label.
+func parseMatcher(r *http.Request) (storage.Matcher, error) {
+	labels, err := parseLabels(r)
+	if err != nil {
+		return storage.Matcher{}, err
+	}
+
+	query := r.URL.Query()
+
+	matcher := storage.Matcher{
+		Prefix: query.Get("prefix"),
+		Glob:   query.Get("glob"),
+		Regex:  query.Get("regex"),
+		Labels: labels,
+	}
+
+	if query.Has("type") {
+		matcher.Kind = metrics.ParseKind(query.Get("type"))
+		if matcher.Kind == metrics.KindUnknown {
+			return storage.Matcher{}, errMetricUnknown
+		}
+	}
+
+	err = matcher.Validate()
+	if err != nil {
+		return storage.Matcher{}, err
+	}
+
+	return matcher, nil
+}
+
+// parseTime парсит время в формате RFC 3339 или unix time; для пустой
+// строки возвращается def.
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse time: %s", err)
+	}
+	return t, nil
+}
+
+// parseResolution парсит разрешение уровня хранения в формате
+// time.Duration или в секундах.
+func parseResolution(s string) (time.Duration, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid resolution %q", s)
+	}
+	return d, nil
+}
+
+// saveStatus возвращает код ответа для ошибки изменения метрик.
+func saveStatus(err error) int {
+	var limitErr *storage.LimitError
+	if errors.As(err, &limitErr) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, storage.ErrReadOnly) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 func sendError(w http.ResponseWriter, code int, err error) {
 	middleware.WriteError(w, err)
 	w.WriteHeader(code)
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -54,6 +55,8 @@ func TestHandlers_ping(t *testing.T) {
 func TestHandlers_all(t *testing.T) {
 	testCases := []struct {
 		name        string
+		query       string
+		matcher     storage.Matcher
 		mockMetrics []metrics.Metric
 		mockError   error
 		wantCode    int
@@ -68,6 +71,55 @@ func TestHandlers_all(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "counter=1\ngauge=1\n",
 		},
+		{
+			name: "labels",
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "a"}),
+				metrics.Gauge("gauge", 2, metrics.Label{Name: "host", Value: "b"}),
+			},
+			wantCode: http.StatusOK,
+			wantBody: "gauge{host=\"a\"}=1\ngauge{host=\"b\"}=2\n",
+		},
+		{
+			name:    "select by labels",
+			query:   "?label=host=b",
+			matcher: storage.Matcher{Labels: metrics.NewLabels(metrics.Label{Name: "host", Value: "b"})},
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("gauge", 2, metrics.Label{Name: "host", Value: "b"}),
+			},
+			wantCode: http.StatusOK,
+			wantBody: "gauge{host=\"b\"}=2\n",
+		},
+		{
+			name:  "select by name",
+			query: "?prefix=go_&glob=go_*_total&regex=^go&type=counter",
+			matcher: storage.Matcher{
+				Prefix: "go_",
+				Glob:   "go_*_total",
+				Regex:  "^go",
+				Kind:   metrics.KindCounter,
+			},
+			mockMetrics: []metrics.Metric{
+				metrics.Counter("go_gc_total", 1),
+			},
+			wantCode: http.StatusOK,
+			wantBody: "go_gc_total=1\n",
+		},
+		{
+			name:     "invalid labels",
+			query:    "?label=host",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid regex",
+			query:    "?regex=(",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unknown kind",
+			query:    "?type=unknown",
+			wantCode: http.StatusBadRequest,
+		},
 		{
 			name:      "internal error",
 			mockError: errors.New("error"),
@@ -78,12 +130,12 @@ func TestHandlers_all(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			storage := mocks.NewMockStorage()
-			storage.On("GetAll", mock.Anything).Return(tc.mockMetrics, tc.mockError)
+			storage.On("Select", mock.Anything, tc.matcher).Return(tc.mockMetrics, tc.mockError).Maybe()
 
 			handler := server.NewHandler(storage)
 
 			rec := httptest.NewRecorder()
-			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req := httptest.NewRequest(http.MethodGet, "/"+tc.query, nil)
 
 			handler.ServeHTTP(rec, req)
 
@@ -93,6 +145,131 @@ func TestHandlers_all(t *testing.T) {
 	}
 }
 
+func TestHandlers_list(t *testing.T) {
+	testCases := []struct {
+		name        string
+		query       string
+		matcher     storage.Matcher
+		mockMetrics []metrics.Metric
+		mockError   error
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:    "ok",
+			query:   "?prefix=c",
+			matcher: storage.Matcher{Prefix: "c"},
+			mockMetrics: []metrics.Metric{
+				metrics.Counter("counter", 1),
+			},
+			wantCode: http.StatusOK,
+			wantBody: `[{"type":"counter","id":"counter","delta":1}]` + "\n",
+		},
+		{
+			name:     "empty",
+			query:    "?glob=unknown*",
+			matcher:  storage.Matcher{Glob: "unknown*"},
+			wantCode: http.StatusOK,
+			wantBody: "[]\n",
+		},
+		{
+			name:     "invalid regex",
+			query:    "?regex=[",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "internal error",
+			mockError: errors.New("error"),
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := mocks.NewMockStorage()
+			storage.On("Select", mock.Anything, tc.matcher).Return(tc.mockMetrics, tc.mockError).Maybe()
+
+			handler := server.NewHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/values"+tc.query, nil)
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantBody != "" {
+				require.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlers_watch(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		query       string
+		matcher     storage.Matcher
+		mockSamples []storage.Sample
+		mockError   error
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:    "ok",
+			query:   "?prefix=c&type=counter",
+			matcher: storage.Matcher{Prefix: "c", Kind: metrics.KindCounter},
+			mockSamples: []storage.Sample{
+				{Time: now, Value: metrics.Counter("counter", 1)},
+				{Time: now, Value: metrics.Counter("counter", 2)},
+			},
+			wantCode: http.StatusOK,
+			wantBody: `data: {"time":"2026-01-02T03:04:05Z","metric":{"type":"counter","id":"counter","delta":1}}` + "\n\n" +
+				`data: {"time":"2026-01-02T03:04:05Z","metric":{"type":"counter","id":"counter","delta":2}}` + "\n\n",
+		},
+		{
+			name:     "unknown kind",
+			query:    "?type=unknown",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "internal error",
+			mockError: errors.New("error"),
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var samples chan storage.Sample
+			if tc.mockError == nil {
+				samples = make(chan storage.Sample, len(tc.mockSamples))
+				for _, sample := range tc.mockSamples {
+					samples <- sample
+				}
+				close(samples)
+			}
+
+			storage := mocks.NewMockStorage()
+			storage.On("Watch", mock.Anything, tc.matcher).Return(samples, tc.mockError).Maybe()
+
+			handler := server.NewHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/watch"+tc.query, nil)
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantBody != "" {
+				require.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+				require.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
 func TestHandlers_update(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -124,6 +301,23 @@ func TestHandlers_update(t *testing.T) {
 			path:      "/update/counter/counter/1",
 			wantCode:  http.StatusInternalServerError,
 		},
+		{
+			name:      "counter quota exceeded",
+			metric:    metrics.Counter("counter", 1),
+			mockError: storage.ErrQuotaExceeded,
+			path:      "/update/counter/counter/1",
+			wantCode:  http.StatusTooManyRequests,
+		},
+		{
+			name:   "counter name invalid",
+			metric: metrics.Counter("counter", 1),
+			mockError: &storage.LimitError{
+				Name: "counter",
+				Err:  storage.ErrNameInvalid,
+			},
+			path:     "/update/counter/counter/1",
+			wantCode: http.StatusBadRequest,
+		},
 		{
 			name:     "gauge",
 			metric:   metrics.Gauge("gauge", 1),
@@ -142,6 +336,37 @@ func TestHandlers_update(t *testing.T) {
 			path:      "/update/gauge/gauge/1",
 			wantCode:  http.StatusInternalServerError,
 		},
+		{
+			name: "histogram",
+			metric: func() metrics.Metric {
+				h, _ := metrics.NewHistogramValue(metrics.DefaultBounds)
+				h.Observe(0.3)
+				return metrics.Histogram("histogram", h)
+			}(),
+			path:     "/update/histogram/histogram/0.3",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "histogram not parse",
+			path:     "/update/histogram/histogram/none",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "summary",
+			metric: func() metrics.Metric {
+				s, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+				s.Add(0.3)
+				return metrics.Summary("summary", s)
+			}(),
+			path:     "/update/summary/summary/0.3",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "labels",
+			metric:   metrics.Counter("counter", 1, metrics.Label{Name: "host", Value: "a"}),
+			path:     "/update/counter/counter/1?label=host=a",
+			wantCode: http.StatusOK,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -316,6 +541,7 @@ func TestHandlers_get(t *testing.T) {
 	testCases := []struct {
 		name       string
 		metric     string
+		labels     metrics.Labels
 		mockMetric metrics.Metric
 		mockError  error
 		path       string
@@ -371,12 +597,26 @@ func TestHandlers_get(t *testing.T) {
 			path:      "/value/gauge/gauge",
 			wantCode:  http.StatusInternalServerError,
 		},
+		{
+			name:       "gauge with labels",
+			metric:     "gauge",
+			labels:     metrics.NewLabels(metrics.Label{Name: "host", Value: "a"}),
+			mockMetric: metrics.Gauge("gauge", 2, metrics.Label{Name: "host", Value: "a"}),
+			path:       "/value/gauge/gauge?label=host=a",
+			wantCode:   http.StatusOK,
+			wantBody:   "2\n",
+		},
+		{
+			name:     "invalid labels",
+			path:     "/value/gauge/gauge?label==a",
+			wantCode: http.StatusBadRequest,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			storage := mocks.NewMockStorage()
-			storage.On("Get", mock.Anything, tc.metric).Return(tc.mockMetric, tc.mockError).Maybe()
+			storage.On("Get", mock.Anything, tc.metric, tc.labels).Return(tc.mockMetric, tc.mockError).Maybe()
 
 			handler := server.NewHandler(storage)
 
@@ -391,10 +631,354 @@ func TestHandlers_get(t *testing.T) {
 	}
 }
 
+func TestHandlers_remove(t *testing.T) {
+	testCases := []struct {
+		name        string
+		metric      string
+		labels      metrics.Labels
+		mockMetric  metrics.Metric
+		mockError   error
+		deleteError error
+		path        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:     "unknown kind",
+			path:     "/value/unknown/counter",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "delete",
+			metric:     "counter",
+			mockMetric: metrics.Counter("counter", 1),
+			path:       "/value/counter/counter",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "delete with labels",
+			metric:     "gauge",
+			labels:     metrics.NewLabels(metrics.Label{Name: "host", Value: "a"}),
+			mockMetric: metrics.Gauge("gauge", 2, metrics.Label{Name: "host", Value: "a"}),
+			path:       "/value/gauge/gauge?label=host=a",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "reset",
+			metric:     "counter",
+			mockMetric: metrics.Counter("counter", 5),
+			path:       "/value/counter/counter?reset=true",
+			wantCode:   http.StatusOK,
+			wantBody:   "5\n",
+		},
+		{
+			name:     "invalid reset",
+			metric:   "counter",
+			path:     "/value/counter/counter?reset=maybe",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "not found",
+			metric:    "counter",
+			mockError: storage.ErrNotFound,
+			path:      "/value/counter/counter",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:       "kind mismatch",
+			metric:     "counter",
+			mockMetric: metrics.Gauge("counter", 1),
+			path:       "/value/counter/counter",
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:        "internal error",
+			metric:      "counter",
+			mockMetric:  metrics.Counter("counter", 1),
+			deleteError: errors.New("error"),
+			path:        "/value/counter/counter",
+			wantCode:    http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := mocks.NewMockStorage()
+			storage.On("Get", mock.Anything, tc.metric, tc.labels).Return(tc.mockMetric, tc.mockError).Maybe()
+			storage.On("Delete", mock.Anything, tc.metric, tc.labels).Return(tc.deleteError).Maybe()
+			storage.On("Reset", mock.Anything, tc.metric, tc.labels).Return(tc.mockMetric, tc.deleteError).Maybe()
+
+			handler := server.NewHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, tc.path, nil)
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantBody != "" {
+				require.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlers_quantile(t *testing.T) {
+	histogram := func() metrics.Metric {
+		h, _ := metrics.NewHistogramValue([]float64{1, 2, 4})
+		for i := 0; i < 50; i++ {
+			h.Observe(0.5)
+			h.Observe(3)
+		}
+		return metrics.Histogram("histogram", h)
+	}
+
+	summary := func(values ...float64) metrics.Metric {
+		s, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		for _, v := range values {
+			s.Add(v)
+		}
+		return metrics.Summary("summary", s)
+	}
+
+	testCases := []struct {
+		name       string
+		metric     string
+		labels     metrics.Labels
+		mockMetric metrics.Metric
+		mockError  error
+		path       string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:     "unknown kind",
+			path:     "/quantile/unknown/histogram?q=0.5",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unsupported kind",
+			path:     "/quantile/counter/counter?q=0.5",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "empty quantiles",
+			path:     "/quantile/histogram/histogram",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid quantile",
+			path:     "/quantile/histogram/histogram?q=1.5",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "histogram",
+			metric:     "histogram",
+			mockMetric: histogram(),
+			path:       "/quantile/histogram/histogram?q=0.5&q=0.75",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"0.5":1,"0.75":3}` + "\n",
+		},
+		{
+			name:       "summary",
+			metric:     "summary",
+			labels:     metrics.NewLabels(metrics.Label{Name: "host", Value: "a"}),
+			mockMetric: summary(2),
+			path:       "/quantile/summary/summary?q=0.99&label=host=a",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"0.99":2}` + "\n",
+		},
+		{
+			name:       "summary empty",
+			metric:     "summary",
+			mockMetric: summary(),
+			path:       "/quantile/summary/summary?q=0.5",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"0.5":null}` + "\n",
+		},
+		{
+			name:       "kind mismatch",
+			metric:     "summary",
+			mockMetric: histogram(),
+			path:       "/quantile/summary/summary?q=0.5",
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:      "not found",
+			metric:    "summary",
+			mockError: storage.ErrNotFound,
+			path:      "/quantile/summary/summary?q=0.5",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "internal error",
+			metric:    "summary",
+			mockError: errors.New("error"),
+			path:      "/quantile/summary/summary?q=0.5",
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := mocks.NewMockStorage()
+			storage.On("Get", mock.Anything, tc.metric, tc.labels).Return(tc.mockMetric, tc.mockError).Maybe()
+
+			handler := server.NewHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantBody != "" {
+				require.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlers_history(t *testing.T) {
+	from, to := time.Unix(1000, 0), time.Unix(2000, 0)
+
+	testCases := []struct {
+		name        string
+		metric      string
+		labels      metrics.Labels
+		mockSamples []storage.Sample
+		mockRollups []storage.Rollup
+		mockError   error
+		path        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:     "unknown kind",
+			path:     "/range/unknown/gauge?from=1000&to=2000",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid time",
+			path:     "/range/gauge/gauge?from=yesterday&to=2000",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid range",
+			path:     "/range/gauge/gauge?from=2000&to=1000",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "gauge",
+			metric: "gauge",
+			labels: metrics.NewLabels(metrics.Label{Name: "host", Value: "a"}),
+			mockSamples: []storage.Sample{
+				{Time: time.Unix(1500, 0).UTC(), Value: metrics.Gauge("gauge", 1, metrics.Label{Name: "host", Value: "a"})},
+				{Time: time.Unix(1600, 0).UTC(), Value: metrics.Gauge("gauge", 2, metrics.Label{Name: "host", Value: "a"})},
+			},
+			path:     "/range/gauge/gauge?from=1000&to=1970-01-01T00:33:20Z&label=host=a",
+			wantCode: http.StatusOK,
+			wantBody: `[{"time":"1970-01-01T00:25:00Z","metric":{"type":"gauge","id":"gauge","labels":{"host":"a"},"value":1}},` +
+				`{"time":"1970-01-01T00:26:40Z","metric":{"type":"gauge","id":"gauge","labels":{"host":"a"},"value":2}}]` + "\n",
+		},
+		{
+			name:   "counter rollups",
+			metric: "counter",
+			mockRollups: []storage.Rollup{
+				{
+					Time:       time.Unix(1200, 0).UTC(),
+					Resolution: time.Minute,
+					Value:      metrics.Counter("counter", 10),
+					Count:      2,
+					Sum:        6,
+					Rate:       0.1,
+				},
+			},
+			path:     "/range/counter/counter?from=1000&to=2000&resolution=1m",
+			wantCode: http.StatusOK,
+			wantBody: `[{"time":"1970-01-01T00:20:00Z","count":2,"sum":6,"rate":0.1,` +
+				`"metric":{"type":"counter","id":"counter","delta":10}}]` + "\n",
+		},
+		{
+			name:   "gauge rollups",
+			metric: "gauge",
+			mockRollups: []storage.Rollup{
+				{
+					Time:       time.Unix(1200, 0).UTC(),
+					Resolution: time.Minute,
+					Value:      metrics.Gauge("gauge", 3),
+					Count:      2,
+					Sum:        4,
+					Min:        1,
+					Max:        3,
+					Avg:        2,
+				},
+			},
+			path:     "/range/gauge/gauge?from=1000&to=2000&resolution=60",
+			wantCode: http.StatusOK,
+			wantBody: `[{"time":"1970-01-01T00:20:00Z","count":2,"sum":4,"min":1,"max":3,"avg":2,` +
+				`"metric":{"type":"gauge","id":"gauge","value":3}}]` + "\n",
+		},
+		{
+			name:     "invalid resolution",
+			path:     "/range/gauge/gauge?from=1000&to=2000&resolution=-1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "kind mismatch",
+			metric: "gauge",
+			mockSamples: []storage.Sample{
+				{Time: time.Unix(1500, 0), Value: metrics.Counter("gauge", 1)},
+			},
+			path:     "/range/gauge/gauge?from=1000&to=2000",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:      "not found",
+			metric:    "gauge",
+			mockError: storage.ErrNotFound,
+			path:      "/range/gauge/gauge?from=1000&to=2000",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "internal error",
+			metric:    "gauge",
+			mockError: errors.New("error"),
+			path:      "/range/gauge/gauge?from=1000&to=2000",
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := mocks.NewMockStorage()
+			storage.On("Range", mock.Anything, tc.metric, tc.labels,
+				mock.MatchedBy(from.Equal), mock.MatchedBy(to.Equal),
+			).Return(tc.mockSamples, tc.mockError).Maybe()
+			storage.On("Rollups", mock.Anything, tc.metric, tc.labels, time.Minute,
+				mock.MatchedBy(from.Equal), mock.MatchedBy(to.Equal),
+			).Return(tc.mockRollups, tc.mockError).Maybe()
+
+			handler := server.NewHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantBody != "" {
+				require.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
 func TestHandlers_getV2(t *testing.T) {
 	testCases := []struct {
 		name       string
 		metric     string
+		labels     metrics.Labels
 		mockMetric metrics.Metric
 		mockError  error
 		body       string
@@ -474,12 +1058,33 @@ func TestHandlers_getV2(t *testing.T) {
 			body:       `{"type":"gauge","id":"test"}`,
 			wantCode:   http.StatusNotFound,
 		},
+		{
+			name:       "gauge with labels",
+			metric:     "test",
+			labels:     metrics.NewLabels(metrics.Label{Name: "host", Value: "a"}),
+			mockMetric: metrics.Gauge("test", 1, metrics.Label{Name: "host", Value: "a"}),
+			body:       `{"type":"gauge","id":"test","labels":{"host":"a"}}`,
+			wantCode:   http.StatusOK,
+			wantBody:   `{"type":"gauge","id":"test","labels":{"host":"a"},"value":1}`,
+		},
+		{
+			name:   "histogram",
+			metric: "test",
+			mockMetric: func() metrics.Metric {
+				h, _ := metrics.NewHistogramValue([]float64{1})
+				h.Observe(0.5)
+				return metrics.Histogram("test", h)
+			}(),
+			body:     `{"type":"histogram","id":"test"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"type":"histogram","id":"test","histogram":{"bounds":[1],"counts":[1,0],"sum":0.5,"count":1}}`,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			storage := mocks.NewMockStorage()
-			storage.On("Get", mock.Anything, tc.metric).Return(tc.mockMetric, tc.mockError).Maybe()
+			storage.On("Get", mock.Anything, tc.metric, tc.labels).Return(tc.mockMetric, tc.mockError).Maybe()
 
 			handler := server.NewHandler(storage)
 
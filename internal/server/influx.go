@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/sergeizaitcev/metrics/internal/influx"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+)
+
+const (
+	// InfluxWritePath определяет путь приёма метрик по протоколу
+	// InfluxDB v1.
+	InfluxWritePath = "/write"
+
+	// InfluxWriteV2Path определяет путь приёма метрик по протоколу
+	// InfluxDB v2.
+	InfluxWriteV2Path = "/api/v2/write"
+)
+
+// maxInfluxWriteSize определяет максимальный размер запроса InfluxDB
+// после распаковки.
+const maxInfluxWriteSize = 32 << 20
+
+// NewInfluxHandler возвращает обработчик запросов записи InfluxDB v1 и v2
+// в формате line protocol, сохраняющий метрики в s.
+//
+// NOTE: тело запроса не шифруется, поэтому мидлварь rsa к обработчику
+// не применяется.
+func NewInfluxHandler(s storage.Storage, middlewares ...middleware.Middleware) http.Handler {
+	router := &httprouter.Router{
+		HandleMethodNotAllowed: true,
+	}
+	router.Handle(http.MethodPost, InfluxWritePath, middleware.Use(influxWrite(s, false), middlewares...))
+	router.Handle(http.MethodPost, InfluxWriteV2Path, middleware.Use(influxWrite(s, true), middlewares...))
+	return router
+}
+
+// lineError определяет ошибку строки запроса InfluxDB.
+type lineError struct {
+	Line  int    `json:"line"` // номер строки, начиная с 1.
+	Error string `json:"error"`
+}
+
+// influxWrite сохраняет значения полей точек из запроса InfluxDB как
+// датчики с именем <measurement>_<field> и метками из тегов точки.
+//
+// Корректные строки сохраняются, даже если в запросе есть некорректные;
+// в этом случае возвращается 400 с ошибками каждой отклонённой строки.
+// Временные метки точек проверяются, но не сохраняются: время обновления
+// метрик определяет хранилище.
+func influxWrite(s storage.Storage, v2 bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		precision, err := influx.ParsePrecision(r.URL.Query().Get("precision"))
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxInfluxWriteSize+1))
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(body) > maxInfluxWriteSize {
+			sendError(w, http.StatusRequestEntityTooLarge, errRequestTooLarge)
+			return
+		}
+
+		var (
+			values  []metrics.Metric
+			lines   []int // Номера строк значений values.
+			invalid []lineError
+		)
+
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 0, 4096), maxInfluxWriteSize)
+
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			p, err := influx.Parse(line, precision)
+			if err != nil {
+				invalid = append(invalid, lineError{Line: n, Error: err.Error()})
+				continue
+			}
+
+			for _, f := range p.Fields {
+				name := p.Measurement + "_" + f.Key
+				values = append(values, metrics.Gauge(name, f.Value, p.Tags...))
+				lines = append(lines, n)
+			}
+		}
+
+		ctx := r.Context()
+
+		if len(values) > 0 {
+			_, err = s.Save(ctx, values...)
+
+			// NOTE: ограничения хранилища отклоняют весь пакет, поэтому
+			// для определения отклонённых строк значения сохраняются
+			// по одному.
+			var limitErr *storage.LimitError
+			if errors.As(err, &limitErr) {
+				err = nil
+				for i, value := range values {
+					_, err = s.Save(ctx, value)
+					if errors.As(err, &limitErr) {
+						invalid = append(invalid, lineError{Line: lines[i], Error: err.Error()})
+						err = nil
+						continue
+					}
+					if err != nil {
+						break
+					}
+				}
+			}
+
+			if err != nil {
+				sendError(w, saveStatus(err), err)
+				return
+			}
+		}
+
+		if len(invalid) > 0 {
+			sendLineErrors(w, v2, invalid)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// sendLineErrors отправляет ошибки строк запроса InfluxDB в формате
+// ответа InfluxDB v1 или v2.
+func sendLineErrors(w http.ResponseWriter, v2 bool, invalid []lineError) {
+	messages := make([]string, 0, len(invalid))
+	for _, e := range invalid {
+		messages = append(messages, fmt.Sprintf("line %d: %s", e.Line, e.Error))
+	}
+
+	err := fmt.Errorf("partial write: %s", strings.Join(messages, "; "))
+	middleware.WriteError(w, err)
+
+	var resp any
+	if v2 {
+		resp = struct {
+			Code    string      `json:"code"`
+			Message string      `json:"message"`
+			Lines   []lineError `json:"lines"`
+		}{"invalid", err.Error(), invalid}
+	} else {
+		resp = struct {
+			Error string      `json:"error"`
+			Lines []lineError `json:"lines"`
+		}{err.Error(), invalid}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+
+	json.NewEncoder(w).Encode(resp)
+}
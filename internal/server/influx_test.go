@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/internal/storage/mocks"
+)
+
+func TestHandlers_influxWrite(t *testing.T) {
+	type save struct {
+		values []metrics.Metric
+		err    error
+	}
+
+	host := metrics.Label{Name: "host", Value: "a"}
+	limitErr := &storage.LimitError{Name: "bad!name_value", Err: storage.ErrNameInvalid}
+
+	testCases := []struct {
+		name      string
+		path      string
+		query     string
+		body      string
+		saves     []save
+		wantCode  int
+		wantLines []int
+	}{
+		{
+			name: "v1",
+			path: server.InfluxWritePath,
+			body: "cpu,host=a usage_idle=92.5,usage_user=3i 1700000000000000000\n" +
+				"# comment\n\n" +
+				"mem used=10u,state=\"ok\"\n",
+			saves: []save{
+				{values: []metrics.Metric{
+					metrics.Gauge("cpu_usage_idle", 92.5, host),
+					metrics.Gauge("cpu_usage_user", 3, host),
+					metrics.Gauge("mem_used", 10),
+				}},
+			},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:  "v2",
+			path:  server.InfluxWriteV2Path,
+			query: "?org=org&bucket=bucket&precision=s",
+			body:  "cpu value=1 1700000000",
+			saves: []save{
+				{values: []metrics.Metric{metrics.Gauge("cpu_value", 1)}},
+			},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "unknown precision",
+			path:     server.InfluxWriteV2Path,
+			query:    "?precision=d",
+			body:     "cpu value=1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "invalid lines",
+			path: server.InfluxWriteV2Path,
+			body: "cpu value=1\ncpu value\ncpu,host value=1\nmem value=2\n",
+			saves: []save{
+				{values: []metrics.Metric{
+					metrics.Gauge("cpu_value", 1),
+					metrics.Gauge("mem_value", 2),
+				}},
+			},
+			wantCode:  http.StatusBadRequest,
+			wantLines: []int{2, 3},
+		},
+		{
+			name: "rejected lines",
+			path: server.InfluxWritePath,
+			body: "cpu value=1\nbad!name value=2\n",
+			saves: []save{
+				{
+					values: []metrics.Metric{
+						metrics.Gauge("cpu_value", 1),
+						metrics.Gauge("bad!name_value", 2),
+					},
+					err: limitErr,
+				},
+				{values: []metrics.Metric{metrics.Gauge("cpu_value", 1)}},
+				{values: []metrics.Metric{metrics.Gauge("bad!name_value", 2)}, err: limitErr},
+			},
+			wantCode:  http.StatusBadRequest,
+			wantLines: []int{2},
+		},
+		{
+			name: "read-only",
+			path: server.InfluxWritePath,
+			body: "cpu value=1",
+			saves: []save{
+				{values: []metrics.Metric{metrics.Gauge("cpu_value", 1)}, err: storage.ErrReadOnly},
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "internal error",
+			path: server.InfluxWritePath,
+			body: "cpu value=1",
+			saves: []save{
+				{values: []metrics.Metric{metrics.Gauge("cpu_value", 1)}, err: errors.New("error")},
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := mocks.NewMockStorage()
+			for _, s := range tc.saves {
+				storage.On("Save", mock.Anything, s.values).Return(s.values, s.err).Once()
+			}
+
+			handler := server.NewInfluxHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tc.path+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			storage.AssertExpectations(t)
+
+			if tc.wantLines == nil {
+				return
+			}
+
+			var resp struct {
+				Lines []struct {
+					Line int `json:"line"`
+				} `json:"lines"`
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+			lines := make([]int, 0, len(resp.Lines))
+			for _, l := range resp.Lines {
+				lines = append(lines, l.Line)
+			}
+			require.Equal(t, tc.wantLines, lines)
+		})
+	}
+}
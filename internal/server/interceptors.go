@@ -29,5 +29,19 @@ func (s *Server) interceptors() []grpc.UnaryServerInterceptor {
 		values = append(values, interceptors.Subnet(subnet))
 	}
 
+	values = append(values, interceptors.Tenant(s.resolveTenant))
+
+	return values
+}
+
+func (s *Server) streamInterceptors() []grpc.StreamServerInterceptor {
+	var values []grpc.StreamServerInterceptor
+
+	if subnet := s.config.CIDR(); subnet != nil {
+		values = append(values, interceptors.SubnetStream(subnet))
+	}
+
+	values = append(values, interceptors.TenantStream(s.resolveTenant))
+
 	return values
 }
@@ -9,7 +9,7 @@ import (
 )
 
 // NOTE: необходимо соблюдать порядок мидлварей в следующей последовательности
-// rsa -> gzip -> sign -> trace -> subnet.
+// rsa -> gzip -> sign -> tenant -> trace -> subnet.
 func (s *Server) middlewares() []middleware.Middleware {
 	var middlewares []middleware.Middleware
 
@@ -17,16 +17,44 @@ func (s *Server) middlewares() []middleware.Middleware {
 		middlewares = append(middlewares, middleware.RSA(s.opts.Key))
 	}
 
-	middlewares = append(
-		middlewares,
-		middleware.Gzip(flate.BestCompression, "application/json", "text/html"),
-	)
+	return append(middlewares, s.unencryptedMiddlewares()...)
+}
+
+// unencryptedMiddlewares возвращает мидлвари для запросов, тело которых
+// может быть сжато gzip, но не зашифровано: gzip -> sign -> tenant ->
+// trace -> subnet.
+func (s *Server) unencryptedMiddlewares() []middleware.Middleware {
+	middlewares := []middleware.Middleware{
+		middleware.Gzip(
+			flate.BestCompression,
+			"application/json",
+			"text/html",
+			"text/plain; version=0.0.4",
+			"application/openmetrics-text",
+		),
+	}
+
+	return append(middlewares, s.plainMiddlewares()...)
+}
+
+// plainMiddlewares возвращает мидлвари для запросов, тело которых
+// не сжато gzip и не зашифровано: sign -> tenant -> trace -> subnet.
+func (s *Server) plainMiddlewares() []middleware.Middleware {
+	var middlewares []middleware.Middleware
 
 	if s.config.SHA256Key != "" {
 		signer := sign.Signer(s.config.SHA256Key)
 		middlewares = append(middlewares, middleware.Sign(signer))
 	}
 
+	middlewares = append(middlewares, middleware.Tenant(s.resolveTenant))
+
+	return append(middlewares, s.peerMiddlewares()...)
+}
+
+// peerMiddlewares возвращает мидлвари для запросов узлов кластера, которые
+// не подписываются и передают метки арендаторов как есть: trace -> subnet.
+func (s *Server) peerMiddlewares() []middleware.Middleware {
 	paramsFunc := func(p *middleware.Params) {
 		if p.Error != nil {
 			s.opts.Logger.Log(logging.LevelError, p.Error.Error(),
@@ -45,7 +73,7 @@ func (s *Server) middlewares() []middleware.Middleware {
 		}
 	}
 
-	middlewares = append(middlewares, middleware.Trace(paramsFunc))
+	middlewares := []middleware.Middleware{middleware.Trace(paramsFunc)}
 
 	if subnet := s.config.CIDR(); subnet != nil {
 		middlewares = append(middlewares, middleware.Subnet(subnet))
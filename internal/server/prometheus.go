@@ -0,0 +1,412 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+const (
+	// contentTypeText определяет тип контента текстового формата
+	// экспозиции Prometheus.
+	contentTypeText = "text/plain; version=0.0.4; charset=utf-8"
+
+	// contentTypeOpenMetrics определяет тип контента формата OpenMetrics.
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// summaryQuantiles определяет квантили, экспонируемые для сводок.
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// exposition возвращает все метрики в текстовом формате экспозиции
+// Prometheus или, если клиент принимает его, в формате OpenMetrics.
+//
+// Имена метрик и меток приводятся к допустимым в Prometheus: недопустимые
+// символы заменяются на "_". Метрики, которые после этого неотличимы
+// от других, не экспонируются (см. families).
+func exposition(s storage.Storage) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := r.Context()
+
+		values, err := s.GetAll(ctx)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			sendError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		openMetrics := acceptsOpenMetrics(r.Header.Get("Accept"))
+
+		ctype := contentTypeText
+		if openMetrics {
+			ctype = contentTypeOpenMetrics
+		}
+
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		writeExposition(w, values, openMetrics)
+	}
+}
+
+// acceptsOpenMetrics возвращает true, если заголовок Accept допускает
+// формат OpenMetrics.
+func acceptsOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/openmetrics-text" {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil || v <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// family определяет семейство метрик с одним именем в формате Prometheus.
+type family struct {
+	name   string
+	kind   metrics.Kind
+	series []series
+}
+
+// series определяет значение метрики семейства с приведёнными именами
+// меток.
+type series struct {
+	labels metrics.Labels
+	value  metrics.Metric
+}
+
+// families группирует метрики в семейства по приведённому имени
+// в порядке возрастания имени.
+//
+// Метрики, которые после приведения имён неотличимы от уже добавленных,
+// отбрасываются: метрики другого типа с тем же именем семейства, значения
+// с теми же метками, значения с совпадающими именами меток или с метками,
+// зарезервированными для типа метрики. Семейство отбрасывается целиком,
+// если имена его значений совпадают с именами значений предыдущего
+// семейства.
+func families(values []metrics.Metric, openMetrics bool) []*family {
+	byName := make(map[string]*family)
+	seen := make(map[string]struct{})
+
+	for _, value := range values {
+		name := familyName(value, openMetrics)
+
+		f, ok := byName[name]
+		if !ok {
+			f = &family{name: name, kind: value.Kind()}
+			byName[name] = f
+		}
+		if f.kind != value.Kind() {
+			continue
+		}
+
+		labels, ok := sanitizeLabels(value.Labels(), f.kind)
+		if !ok {
+			continue
+		}
+
+		key := seriesKey(name, labels)
+		if _, ok = seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		f.series = append(f.series, series{labels: labels, value: value})
+	}
+
+	result := make([]*family, 0, len(byName))
+	for _, f := range byName {
+		if len(f.series) > 0 {
+			result = append(result, f)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+
+	used := make(map[string]struct{}, len(result))
+	n := 0
+
+	for _, f := range result {
+		names := f.sampleNames(openMetrics)
+		if containsAny(used, names) {
+			continue
+		}
+		for _, name := range names {
+			used[name] = struct{}{}
+		}
+		result[n] = f
+		n++
+	}
+
+	return result[:n]
+}
+
+// familyName возвращает приведённое имя семейства метрики value.
+//
+// NOTE: в OpenMetrics имя семейства счётчиков не содержит суффикса
+// _total, который добавляется к имени значения.
+func familyName(value metrics.Metric, openMetrics bool) string {
+	name := sanitizeName(value.Name(), true)
+	if openMetrics && value.Kind() == metrics.KindCounter {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	return name
+}
+
+// sampleNames возвращает имя семейства и имена его значений.
+func (f *family) sampleNames(openMetrics bool) []string {
+	switch f.kind {
+	case metrics.KindCounter:
+		if openMetrics {
+			return []string{f.name, f.name + "_total"}
+		}
+	case metrics.KindHistogram:
+		return []string{f.name, f.name + "_bucket", f.name + "_sum", f.name + "_count"}
+	case metrics.KindSummary:
+		return []string{f.name, f.name + "_sum", f.name + "_count"}
+	}
+	return []string{f.name}
+}
+
+// containsAny возвращает true, если set содержит одно из имён names.
+func containsAny(set map[string]struct{}, names []string) bool {
+	for _, name := range names {
+		if _, ok := set[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeLabels возвращает метки с приведёнными именами, отсортированные
+// по имени, или false, если приведённые имена совпадают или одно из них
+// зарезервировано для метрик типа kind.
+func sanitizeLabels(labels metrics.Labels, kind metrics.Kind) (metrics.Labels, bool) {
+	if len(labels) == 0 {
+		return nil, true
+	}
+
+	result := make(metrics.Labels, len(labels))
+	for i, label := range labels {
+		result[i] = metrics.Label{Name: sanitizeName(label.Name, false), Value: label.Value}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	for i, label := range result {
+		if i > 0 && result[i-1].Name == label.Name {
+			return nil, false
+		}
+		if reservedLabel(kind, label.Name) {
+			return nil, false
+		}
+	}
+
+	return result, true
+}
+
+// reservedLabel возвращает true, если метка name добавляется к значениям
+// метрик типа kind при экспозиции.
+func reservedLabel(kind metrics.Kind, name string) bool {
+	switch kind {
+	case metrics.KindHistogram:
+		return name == "le"
+	case metrics.KindSummary:
+		return name == "quantile"
+	}
+	return false
+}
+
+// seriesKey возвращает ключ значения семейства name с метками labels.
+func seriesKey(name string, labels metrics.Labels) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, label := range labels {
+		b.WriteByte(0xff)
+		b.WriteString(label.Name)
+		b.WriteByte(0xff)
+		b.WriteString(label.Value)
+	}
+	return b.String()
+}
+
+// writeExposition записывает метрики в w в текстовом формате экспозиции
+// Prometheus или в формате OpenMetrics.
+func writeExposition(w io.Writer, values []metrics.Metric, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families(values, openMetrics) {
+		name := f.name
+
+		bw.WriteString("# TYPE " + name + " " + typeOf(f.kind) + "\n")
+
+		for _, s := range f.series {
+			labels, value := s.labels, s.value
+
+			switch f.kind {
+			case metrics.KindCounter:
+				sample := name
+				if openMetrics {
+					sample = name + "_total"
+				}
+				writeSample(bw, sample, labels, "", "", strconv.FormatInt(value.Int64(), 10))
+			case metrics.KindGauge:
+				writeSample(bw, name, labels, "", "", formatFloat(value.Float64()))
+			case metrics.KindHistogram:
+				writeHistogram(bw, name, labels, value.Histogram())
+			case metrics.KindSummary:
+				writeSummary(bw, name, labels, value.Summary())
+			}
+		}
+	}
+
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+
+	return bw.Flush()
+}
+
+// writeHistogram записывает значения гистограммы: накопительные бакеты,
+// сумму и количество наблюдений.
+func writeHistogram(w *bufio.Writer, name string, labels metrics.Labels, h *metrics.HistogramValue) {
+	var cum uint64
+	for i, bound := range h.Bounds {
+		cum += h.Counts[i]
+		writeSample(w, name+"_bucket", labels, "le", formatFloat(bound), strconv.FormatUint(cum, 10))
+	}
+	writeSample(w, name+"_bucket", labels, "le", "+Inf", strconv.FormatUint(h.Count, 10))
+	writeSample(w, name+"_sum", labels, "", "", formatFloat(h.Sum))
+	writeSample(w, name+"_count", labels, "", "", strconv.FormatUint(h.Count, 10))
+}
+
+// writeSummary записывает значения сводки: квантили summaryQuantiles,
+// сумму и количество наблюдений.
+func writeSummary(w *bufio.Writer, name string, labels metrics.Labels, s *metrics.Sketch) {
+	for _, q := range summaryQuantiles {
+		writeSample(w, name, labels, "quantile", formatFloat(q), formatFloat(s.Quantile(q)))
+	}
+	writeSample(w, name+"_sum", labels, "", "", formatFloat(s.Sum()))
+	writeSample(w, name+"_count", labels, "", "", strconv.FormatUint(s.Count(), 10))
+}
+
+// writeSample записывает строку значения метрики name с приведёнными
+// метками labels и, если extra не пусто, дополнительной меткой extra
+// со значением extraValue.
+func writeSample(
+	w *bufio.Writer,
+	name string,
+	labels metrics.Labels,
+	extra, extraValue string,
+	value string,
+) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, label.Name, label.Value)
+		}
+		if extra != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extra, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+// labelEscaper экранирует значения меток.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	labelEscaper.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+// typeOf возвращает тип метрики в формате Prometheus.
+func typeOf(kind metrics.Kind) string {
+	switch kind {
+	case metrics.KindCounter:
+		return "counter"
+	case metrics.KindGauge:
+		return "gauge"
+	case metrics.KindHistogram:
+		return "histogram"
+	case metrics.KindSummary:
+		return "summary"
+	}
+	return "unknown"
+}
+
+// sanitizeName приводит имя метрики или, если colons == false, имя метки
+// к допустимому в Prometheus, заменяя недопустимые символы на "_".
+func sanitizeName(name string, colons bool) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r == ':' && colons:
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// formatFloat возвращает число в формате Prometheus.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
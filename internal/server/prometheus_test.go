@@ -0,0 +1,199 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/internal/storage/mocks"
+)
+
+func TestHandlers_exposition(t *testing.T) {
+	histogram, err := metrics.NewHistogramValue([]float64{1, 2.5})
+	require.NoError(t, err)
+	for _, v := range []float64{0.5, 2, 3} {
+		histogram.Observe(v)
+	}
+
+	testCases := []struct {
+		name        string
+		accept      string
+		mockMetrics []metrics.Metric
+		mockError   error
+		wantCode    int
+		wantCType   string
+		wantBody    string
+	}{
+		{
+			name: "text",
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("Alloc", 1.5),
+				metrics.Counter("PollCount", 2, metrics.Label{Name: "host", Value: "a"}),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody: "# TYPE Alloc gauge\n" +
+				"Alloc 1.5\n" +
+				"# TYPE PollCount counter\n" +
+				"PollCount{host=\"a\"} 2\n",
+		},
+		{
+			name: "sanitize",
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("1st.gauge-value", 1, metrics.Label{Name: "host.name", Value: "a\"b\\c\nd"}),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody: "# TYPE _1st_gauge_value gauge\n" +
+				"_1st_gauge_value{host_name=\"a\\\"b\\\\c\\nd\"} 1\n",
+		},
+		{
+			name: "conflicting names",
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("a.b", 1),
+				metrics.Counter("a_b", 2),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody:  "# TYPE a_b gauge\na_b 1\n",
+		},
+		{
+			name: "conflicting series",
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("a.b", 1),
+				metrics.Gauge("a_b", 2),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody:  "# TYPE a_b gauge\na_b 1\n",
+		},
+		{
+			name: "conflicting labels",
+			mockMetrics: []metrics.Metric{
+				metrics.Gauge("a", 1, metrics.Label{Name: "a-b", Value: "1"}, metrics.Label{Name: "a_b", Value: "2"}),
+				metrics.Gauge("a", 2, metrics.Label{Name: "a-b", Value: "3"}),
+				metrics.Gauge("a", 3, metrics.Label{Name: "a_b", Value: "3"}),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody:  "# TYPE a gauge\na{a_b=\"3\"} 2\n",
+		},
+		{
+			name: "reserved labels",
+			mockMetrics: []metrics.Metric{
+				metrics.Histogram("latency", histogram, metrics.Label{Name: "le", Value: "1"}),
+				metrics.Summary("size", nil, metrics.Label{Name: "quantile", Value: "1"}),
+				metrics.Gauge("temperature", 1, metrics.Label{Name: "le", Value: "1"}),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody:  "# TYPE temperature gauge\ntemperature{le=\"1\"} 1\n",
+		},
+		{
+			name: "conflicting samples",
+			mockMetrics: []metrics.Metric{
+				metrics.Histogram("latency", histogram),
+				metrics.Gauge("latency_sum", 1),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody: "# TYPE latency histogram\n" +
+				"latency_bucket{le=\"1\"} 1\n" +
+				"latency_bucket{le=\"2.5\"} 2\n" +
+				"latency_bucket{le=\"+Inf\"} 3\n" +
+				"latency_sum 5.5\n" +
+				"latency_count 3\n",
+		},
+		{
+			name:   "openmetrics conflicting counters",
+			accept: "application/openmetrics-text",
+			mockMetrics: []metrics.Metric{
+				metrics.Counter("requests", 1),
+				metrics.Counter("requests_total", 2),
+				metrics.Gauge("requests_total", 3, metrics.Label{Name: "host", Value: "a"}),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			wantBody: "# TYPE requests counter\n" +
+				"requests_total 1\n" +
+				"# EOF\n",
+		},
+		{
+			name: "histogram",
+			mockMetrics: []metrics.Metric{
+				metrics.Histogram("latency", histogram),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody: "# TYPE latency histogram\n" +
+				"latency_bucket{le=\"1\"} 1\n" +
+				"latency_bucket{le=\"2.5\"} 2\n" +
+				"latency_bucket{le=\"+Inf\"} 3\n" +
+				"latency_sum 5.5\n" +
+				"latency_count 3\n",
+		},
+		{
+			name: "openmetrics",
+			accept: "application/openmetrics-text;version=1.0.0," +
+				"text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+			mockMetrics: []metrics.Metric{
+				metrics.Counter("requests_total", 3),
+				metrics.Gauge("temperature", -2),
+			},
+			wantCode:  http.StatusOK,
+			wantCType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			wantBody: "# TYPE requests counter\n" +
+				"requests_total 3\n" +
+				"# TYPE temperature gauge\n" +
+				"temperature -2\n" +
+				"# EOF\n",
+		},
+		{
+			name:      "openmetrics not acceptable",
+			accept:    "application/openmetrics-text;q=0,text/plain",
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+		},
+		{
+			name:      "not found",
+			mockError: storage.ErrNotFound,
+			wantCode:  http.StatusOK,
+			wantCType: "text/plain; version=0.0.4; charset=utf-8",
+		},
+		{
+			name:      "internal error",
+			mockError: errors.New("error"),
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := mocks.NewMockStorage()
+			storage.On("GetAll", mock.Anything).Return(tc.mockMetrics, tc.mockError)
+
+			handler := server.NewHandler(storage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantCType != "" {
+				require.Equal(t, tc.wantCType, rec.Header().Get("Content-Type"))
+			}
+			require.Equal(t, tc.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/prometheus"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+	"github.com/sergeizaitcev/metrics/pkg/snappy"
+)
+
+// RemoteWritePath определяет путь приёма метрик по протоколу Prometheus
+// remote-write.
+const RemoteWritePath = "/api/v1/write"
+
+// maxRemoteWriteSize определяет максимальный размер запроса remote-write
+// после распаковки.
+const maxRemoteWriteSize = 32 << 20
+
+var (
+	errEncodingUnsupported = errors.New("content encoding must be snappy")
+	errRequestTooLarge     = errors.New("request is too large")
+)
+
+// NewRemoteWriteHandler возвращает обработчик запросов Prometheus
+// remote-write, сохраняющий метрики в c.
+//
+// NOTE: тело запроса сжато snappy и не шифруется, поэтому мидлвари
+// gzip и rsa к обработчику не применяются.
+func NewRemoteWriteHandler(c *storage.Cumulative, middlewares ...middleware.Middleware) http.Handler {
+	router := &httprouter.Router{
+		HandleMethodNotAllowed: true,
+	}
+	write := remoteWrite(c)
+	router.Handle(http.MethodPost, RemoteWritePath, middleware.Use(write, middlewares...))
+	return router
+}
+
+// remoteWrite сохраняет последние значения временных рядов из запроса
+// Prometheus remote-write.
+//
+// Prometheus передаёт накопленные значения счётчиков, поэтому счётчики
+// сохраняются приращениями через c.
+func remoteWrite(c *storage.Cumulative) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !strings.EqualFold(r.Header.Get("Content-Encoding"), "snappy") {
+			sendError(w, http.StatusUnsupportedMediaType, errEncodingUnsupported)
+			return
+		}
+
+		compressed, err := io.ReadAll(io.LimitReader(r.Body, maxRemoteWriteSize+1))
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(compressed) > maxRemoteWriteSize {
+			sendError(w, http.StatusRequestEntityTooLarge, errRequestTooLarge)
+			return
+		}
+
+		n, err := snappy.DecodedLen(compressed)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+		if n > maxRemoteWriteSize {
+			sendError(w, http.StatusRequestEntityTooLarge, errRequestTooLarge)
+			return
+		}
+
+		data, err := snappy.Decode(compressed)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var req pb.WriteRequest
+
+		err = proto.Unmarshal(data, &req)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		samples := remoteSamples(&req)
+
+		if len(samples) > 0 {
+			_, err = c.SaveCumulative(r.Context(), samples...)
+			if err != nil {
+				sendError(w, saveStatus(err), err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// remoteSamples возвращает последние значения временных рядов запроса
+// и время их измерения. Значения счётчиков округляются до целого.
+func remoteSamples(req *pb.WriteRequest) []storage.Sample {
+	types := make(map[string]pb.MetricMetadata_MetricType, len(req.GetMetadata()))
+	for _, md := range req.GetMetadata() {
+		types[md.GetMetricFamilyName()] = md.GetType()
+	}
+
+	// NOTE: для каждого ряда сохраняется только последнее значение,
+	// в том числе, если ряд повторяется в запросе.
+	var (
+		samples []storage.Sample
+		indexes = make(map[string]int)
+	)
+
+	for _, ts := range req.GetTimeseries() {
+		name, labels := remoteLabels(ts.GetLabels())
+		if name == "" {
+			continue
+		}
+
+		var sample *pb.Sample
+		for _, v := range ts.GetSamples() {
+			if math.IsNaN(v.GetValue()) || math.IsInf(v.GetValue(), 0) {
+				continue
+			}
+			if sample == nil || v.GetTimestamp() >= sample.GetTimestamp() {
+				sample = v
+			}
+		}
+		if sample == nil {
+			continue
+		}
+
+		var value metrics.Metric
+		if remoteKind(name, types) == metrics.KindCounter {
+			value = metrics.Counter(name, int64(math.Round(sample.GetValue())), labels...)
+		} else {
+			value = metrics.Gauge(name, sample.GetValue(), labels...)
+		}
+
+		s := storage.Sample{Time: time.UnixMilli(sample.GetTimestamp()), Value: value}
+		key := value.Key()
+
+		i, ok := indexes[key]
+		if !ok {
+			indexes[key] = len(samples)
+			samples = append(samples, s)
+			continue
+		}
+		if !s.Time.Before(samples[i].Time) {
+			samples[i] = s
+		}
+	}
+
+	return samples
+}
+
+// remoteLabels возвращает имя метрики и метки временного ряда.
+// Служебные метки, начинающиеся с "__", отбрасываются.
+func remoteLabels(values []*pb.Label) (string, metrics.Labels) {
+	var (
+		name   string
+		labels = make([]metrics.Label, 0, len(values))
+	)
+
+	for _, label := range values {
+		if label.GetName() == "__name__" {
+			name = label.GetValue()
+			continue
+		}
+		if strings.HasPrefix(label.GetName(), "__") {
+			continue
+		}
+		labels = append(labels, metrics.Label{Name: label.GetName(), Value: label.GetValue()})
+	}
+
+	return name, metrics.NewLabels(labels...)
+}
+
+// remoteKind возвращает тип метрики временного ряда name по метаданным
+// types или, если метаданных нет, по соглашению об именовании Prometheus.
+//
+// Бакеты и количество наблюдений гистограмм и сводок являются счётчиками,
+// а сумма наблюдений сохраняется датчиком, чтобы не терять дробную часть.
+func remoteKind(name string, types map[string]pb.MetricMetadata_MetricType) metrics.Kind {
+	family, suffix := name, ""
+	for _, s := range []string{"_total", "_bucket", "_count", "_sum"} {
+		if strings.HasSuffix(name, s) {
+			family, suffix = strings.TrimSuffix(name, s), s
+			break
+		}
+	}
+
+	t, ok := types[name]
+	if !ok {
+		t, ok = types[family]
+	}
+
+	if ok {
+		switch t {
+		case pb.MetricMetadata_COUNTER:
+			return metrics.KindCounter
+		case pb.MetricMetadata_GAUGE, pb.MetricMetadata_GAUGEHISTOGRAM:
+			return metrics.KindGauge
+		case pb.MetricMetadata_HISTOGRAM, pb.MetricMetadata_SUMMARY:
+			if suffix == "_bucket" || suffix == "_count" {
+				return metrics.KindCounter
+			}
+			return metrics.KindGauge
+		}
+	}
+
+	if suffix == "_total" || suffix == "_bucket" || suffix == "_count" {
+		return metrics.KindCounter
+	}
+
+	return metrics.KindGauge
+}
@@ -0,0 +1,182 @@
+package server_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/prometheus"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/internal/storage/mocks"
+	"github.com/sergeizaitcev/metrics/pkg/snappy"
+)
+
+// series возвращает временной ряд метрики name с метками в формате
+// "имя", "значение" и значениями samples.
+func series(name string, samples []*pb.Sample, labels ...string) *pb.TimeSeries {
+	ts := &pb.TimeSeries{
+		Labels:  []*pb.Label{{Name: "__name__", Value: name}},
+		Samples: samples,
+	}
+	for i := 0; i+1 < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, &pb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return ts
+}
+
+func TestHandlers_remoteWrite(t *testing.T) {
+	type get struct {
+		name   string
+		labels metrics.Labels
+		value  metrics.Metric
+		err    error
+	}
+
+	host := metrics.Label{Name: "host", Value: "a"}
+
+	testCases := []struct {
+		name      string
+		req       *pb.WriteRequest
+		encoding  string
+		body      []byte
+		gets      []get
+		want      []metrics.Metric
+		mockError error
+		wantCode  int
+	}{
+		{
+			name: "naming convention",
+			req: &pb.WriteRequest{
+				Timeseries: []*pb.TimeSeries{
+					series("http_requests_total", []*pb.Sample{
+						{Value: 5, Timestamp: 1},
+						{Value: 7, Timestamp: 2},
+					}, "host", "a", "__tenant__", "b"),
+					series("temperature", []*pb.Sample{{Value: 21.5, Timestamp: 1}}),
+					series("latency_sum", []*pb.Sample{{Value: 0.25, Timestamp: 1}}),
+				},
+			},
+			gets: []get{
+				{name: "http_requests_total", labels: metrics.NewLabels(host), err: storage.ErrNotFound},
+			},
+			want: []metrics.Metric{
+				metrics.Counter("http_requests_total", 7, host),
+				metrics.Gauge("temperature", 21.5),
+				metrics.Gauge("latency_sum", 0.25),
+			},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name: "metadata",
+			req: &pb.WriteRequest{
+				Timeseries: []*pb.TimeSeries{
+					series("jobs", []*pb.Sample{{Value: 10, Timestamp: 1}}),
+					series("queue_total", []*pb.Sample{{Value: 3, Timestamp: 1}}),
+					series("latency_count", []*pb.Sample{{Value: 4, Timestamp: 1}}),
+				},
+				Metadata: []*pb.MetricMetadata{
+					{Type: pb.MetricMetadata_COUNTER, MetricFamilyName: "jobs"},
+					{Type: pb.MetricMetadata_GAUGE, MetricFamilyName: "queue_total"},
+					{Type: pb.MetricMetadata_HISTOGRAM, MetricFamilyName: "latency"},
+				},
+			},
+			gets: []get{
+				{name: "jobs", value: metrics.Counter("jobs", 4)},
+				{name: "latency_count", value: metrics.Counter("latency_count", 6)},
+			},
+			want: []metrics.Metric{
+				metrics.Counter("jobs", 6),
+				metrics.Gauge("queue_total", 3),
+				metrics.Counter("latency_count", 4),
+			},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name: "stale samples",
+			req: &pb.WriteRequest{
+				Timeseries: []*pb.TimeSeries{
+					series("temperature", []*pb.Sample{{Value: math.NaN(), Timestamp: 1}}),
+				},
+			},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "unsupported encoding",
+			body:     []byte("data"),
+			encoding: "gzip",
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "corrupted body",
+			body:     []byte{0x05, 0x00},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "read-only",
+			req: &pb.WriteRequest{
+				Timeseries: []*pb.TimeSeries{
+					series("temperature", []*pb.Sample{{Value: 1, Timestamp: 1}}),
+				},
+			},
+			want:      []metrics.Metric{metrics.Gauge("temperature", 1)},
+			mockError: storage.ErrReadOnly,
+			wantCode:  http.StatusServiceUnavailable,
+		},
+		{
+			name: "internal error",
+			req: &pb.WriteRequest{
+				Timeseries: []*pb.TimeSeries{
+					series("temperature", []*pb.Sample{{Value: 1, Timestamp: 1}}),
+				},
+			},
+			want:      []metrics.Metric{metrics.Gauge("temperature", 1)},
+			mockError: errors.New("error"),
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := mocks.NewMockStorage()
+			for _, g := range tc.gets {
+				store.On("Get", mock.Anything, g.name, g.labels).Return(g.value, g.err)
+			}
+			if tc.want != nil {
+				store.On("Save", mock.Anything, tc.want).Return(tc.want, tc.mockError)
+			}
+
+			body := tc.body
+			if tc.req != nil {
+				data, err := proto.Marshal(tc.req)
+				require.NoError(t, err)
+				body = snappy.Encode(data)
+			}
+
+			encoding := "snappy"
+			if tc.encoding != "" {
+				encoding = tc.encoding
+			}
+
+			handler := server.NewRemoteWriteHandler(storage.NewCumulative(store))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, server.RemoteWritePath, bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", encoding)
+			req.Header.Set("Content-Type", "application/x-protobuf")
+
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			store.AssertExpectations(t)
+		})
+	}
+}
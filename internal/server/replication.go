@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/interceptors/md"
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
+)
+
+const (
+	// followRetryInterval определяет интервал повторного подключения
+	// ведомого сервера к ведущему.
+	followRetryInterval = time.Second
+
+	// replicationStatsInterval определяет интервал логирования состояния
+	// репликации.
+	replicationStatsInterval = time.Minute
+)
+
+// replica определяет локальное хранилище сервера, участвующее
+// в репликации.
+type replica struct {
+	local   *storage.Local
+	limited *storage.Limited
+	logger  *logging.Logger
+}
+
+// promote повышает ведомое хранилище до ведущего.
+func (r *replica) promote(ctx context.Context) error {
+	err := r.local.Promote(ctx)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: метрики ведомого хранилища создавались ведущим, поэтому
+	// учтённые ключи метрик устарели.
+	r.limited.Invalidate()
+
+	status := r.local.Replication()
+	r.logger.Log(logging.LevelInfo, "storage promoted",
+		"epoch", status.Epoch,
+	)
+
+	return nil
+}
+
+var _ storage.ReplicationSource = (*replicationClient)(nil)
+
+// replicationClient определяет источник записей ведущего сервера.
+type replicationClient struct {
+	client pb.MetricsClient
+	ip     string
+	key    string
+}
+
+// Replicate реализует интерфейс storage.ReplicationSource.
+func (c *replicationClient) Replicate(
+	ctx context.Context,
+	epoch, lsn uint64,
+	send func(storage.ReplicationBatch) error,
+) error {
+	ctx = md.SetReplicationKey(md.SetRealIP(ctx, c.ip), c.key)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.Replicate(ctx, &pb.ReplicateRequest{
+		Epoch: epoch,
+		Lsn:   lsn,
+	})
+	if err != nil {
+		return fmt.Errorf("replication: %w", err)
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("replication: %w", err)
+		}
+
+		err = send(storage.ReplicationBatch{
+			Epoch:    resp.GetEpoch(),
+			LSN:      resp.GetLsn(),
+			Head:     resp.GetHead(),
+			Records:  resp.GetRecords(),
+			Snapshot: resp.GetSnapshot(),
+			Last:     resp.GetLast(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// follow применяет записи ведущего сервера ReplicaOf и переподключается
+// к нему при ошибках; блокируется до тех пор, пока не сработает контекст
+// или хранилище не будет повышено.
+func (s *Server) follow(ctx context.Context, local *storage.Local) {
+	conn, err := grpc.Dial(s.config.ReplicaOf, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		s.opts.Logger.Log(logging.LevelError, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	src := &replicationClient{
+		client: pb.NewMetricsClient(conn),
+		ip:     tcputil.Local().String(),
+		key:    s.config.ReplicationKey,
+	}
+
+	for {
+		err = local.Follow(ctx, src)
+		if err == nil || ctx.Err() != nil || errors.Is(err, storage.ErrStorageClosed) {
+			return
+		}
+
+		s.opts.Logger.Log(logging.LevelError, err.Error(),
+			"leader", s.config.ReplicaOf,
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(followRetryInterval):
+		}
+	}
+}
+
+// replication логирует состояние репликации с интервалом
+// replicationStatsInterval; блокируется до тех пор, пока не сработает
+// контекст.
+func (s *Server) replication(ctx context.Context, local *storage.Local) {
+	ticker := time.NewTicker(replicationStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			status := local.Replication()
+			if !status.Follower {
+				s.opts.Logger.Log(logging.LevelInfo, "replication",
+					"epoch", status.Epoch,
+					"lsn", status.LSN,
+				)
+				continue
+			}
+			s.opts.Logger.Log(logging.LevelInfo, "replication",
+				"leader", s.config.ReplicaOf,
+				"epoch", status.Epoch,
+				"lsn", status.LSN,
+				"head", status.Head,
+				"lag", status.Lag(),
+				"updated", status.Updated,
+				"snapshots", status.Snapshots,
+			)
+		}
+	}
+}
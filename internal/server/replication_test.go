@@ -0,0 +1,169 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
+	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/pkg/interceptors/md"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+// testReplicaConfig возвращает конфиг сервера на loopback-адресах,
+// который является ведомым для сервера leader, если leader не пуст.
+func testReplicaConfig(t *testing.T, leader string) *configs.Server {
+	cfg := *configs.DefaultServer
+
+	port, err := tcputil.FreePort()
+	require.NoError(t, err)
+	cfg.Address = "127.0.0.1:" + port
+
+	port, err = tcputil.FreePort()
+	require.NoError(t, err)
+	cfg.StreamAddress = "127.0.0.1:" + port
+
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "metrics.wal")
+	cfg.StoreInterval = 0
+	cfg.ReplicaOf = leader
+	cfg.ReplicationKey = "secret"
+
+	return &cfg
+}
+
+// update отправляет значение метрики серверу и возвращает код ответа.
+func update(t *testing.T, addr, path string) int {
+	res, err := http.Post("http://"+addr+path, "text/plain", http.NoBody)
+	require.NoError(t, err)
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// values возвращает текущие значения метрик сервера.
+func values(t *testing.T, addr string) string {
+	res, err := http.Get("http://" + addr + "/")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	got, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return string(got)
+}
+
+func TestServer_replication(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	leader := testReplicaConfig(t, "")
+	follower := testReplicaConfig(t, leader.StreamAddress)
+	cfgs := []*configs.Server{leader, follower}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	done := make(chan error, len(cfgs))
+	for _, cfg := range cfgs {
+		cfg := cfg
+		go func() { done <- server.New(cfg, nil).Run(ctx) }()
+	}
+	t.Cleanup(func() {
+		cancel()
+		for range cfgs {
+			<-done
+		}
+	})
+
+	for _, cfg := range cfgs {
+		require.Eventually(t, func() bool {
+			res, err := http.Get("http://" + cfg.Address + "/ping")
+			if err != nil {
+				return false
+			}
+			res.Body.Close()
+			return res.StatusCode == http.StatusOK
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	require.Equal(t, http.StatusOK, update(t, leader.Address, "/update/counter/PollCount/2"))
+	require.Equal(t, http.StatusOK, update(t, leader.Address, "/update/gauge/Alloc/1.5"))
+
+	want := "Alloc=1.5\nPollCount=2\n"
+
+	require.Eventually(t, func() bool {
+		return values(t, follower.Address) == want
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, http.StatusServiceUnavailable,
+		update(t, follower.Address, "/update/counter/PollCount/1"))
+
+	conn, err := grpc.Dial(follower.StreamAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	client := pb.NewMetricsClient(conn)
+
+	_, err = client.Promote(ctx, &emptypb.Empty{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Promote(md.SetReplicationKey(ctx, "invalid"), &emptypb.Empty{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Promote(md.SetReplicationKey(ctx, follower.ReplicationKey), &emptypb.Empty{})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, update(t, follower.Address, "/update/counter/PollCount/1"))
+	require.Contains(t, values(t, follower.Address), "PollCount=3\n")
+}
+
+func TestServer_replicationWithoutKey(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	cfg := testReplicaConfig(t, "")
+	cfg.ReplicationKey = ""
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- server.New(cfg, nil).Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.Eventually(t, func() bool {
+		res, err := http.Get("http://" + cfg.Address + "/ping")
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.Dial(cfg.StreamAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	client := pb.NewMetricsClient(conn)
+	ctx = md.SetReplicationKey(ctx, "")
+
+	_, err = client.Promote(ctx, &emptypb.Empty{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.Replicate(ctx, &pb.ReplicateRequest{})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
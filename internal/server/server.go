@@ -3,19 +3,28 @@ package server
 import (
 	"context"
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/julienschmidt/httprouter"
 	"google.golang.org/grpc"
 	_ "google.golang.org/grpc/encoding/gzip"
 
 	pb "github.com/sergeizaitcev/metrics/api/proto/metrics"
+	"github.com/sergeizaitcev/metrics/internal/cluster"
 	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/graphite"
+	"github.com/sergeizaitcev/metrics/internal/statsd"
 	"github.com/sergeizaitcev/metrics/internal/storage"
 	"github.com/sergeizaitcev/metrics/pkg/closer"
 	"github.com/sergeizaitcev/metrics/pkg/grpcserver"
 	"github.com/sergeizaitcev/metrics/pkg/httpserver"
 	"github.com/sergeizaitcev/metrics/pkg/logging"
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
 )
 
 var defaultOpts = &ServerOpts{
@@ -53,30 +62,121 @@ func New(config *configs.Server, opts *ServerOpts) *Server {
 // не сработает контекст или функция не вернёт ошибку.
 func (s *Server) Run(ctx context.Context) (err error) {
 	gracefulClose := closer.New()
+
+	// NOTE: хранилище закрывается после серверов, чтобы серверы StatsD
+	// и Graphite успели сохранить последние накопленные значения.
+	var closeStorage func() error
 	defer func() {
 		firstErr := gracefulClose.Close()
+		if closeStorage != nil {
+			if closeErr := closeStorage(); firstErr == nil {
+				firstErr = closeErr
+			}
+		}
 		if firstErr != nil && err == nil {
 			err = firstErr
 		}
 	}()
 
-	storage, err := storage.NewStorage(s.config)
+	store, err := storage.NewStorage(s.config)
 	if err != nil {
 		return fmt.Errorf("init storage: %w", err)
 	}
-	gracefulClose.Add(ctx, storage.Close)
 
-	httpSrv := s.httpServer(ctx, storage)
+	if s.config.DatabaseDSN != "" && s.config.DatabaseCache {
+		cache := storage.NewCache(store)
+		store = cache
+		go s.cacheStats(ctx, cache)
+	}
+
+	closeStorage = store.Close
+
+	local, _ := store.(*storage.Local)
+	if local != nil {
+		s.recovered(local.Recovery())
+	}
+
+	limited := storage.NewLimited(store, storage.Limits{
+		MaxSeries:     s.config.MaxSeries,
+		MaxNameLength: s.config.MaxNameLength,
+		NamePattern:   s.config.NamePattern.Regexp,
+	})
+	store = limited
+	go s.cardinality(ctx, limited)
+
+	var repl *replica
+	if local != nil {
+		repl = &replica{local: local, limited: limited, logger: s.opts.Logger}
+		go s.replication(ctx, local)
+	}
+	if s.config.ReplicaOf != "" {
+		go s.follow(ctx, local)
+	}
+
+	// NOTE: узлы кластера обращаются к метрикам текущего узла напрямую,
+	// поэтому метки арендаторов передаются между узлами как есть.
+	var shard storage.Storage
+	if len(s.config.ClusterNodes) > 0 {
+		shard = store
+		store, err = cluster.New(shard, s.config.Node(), s.config.ClusterNodes, &cluster.Opts{
+			Key: s.config.ClusterKey,
+			IP:  tcputil.Local().String(),
+		})
+		if err != nil {
+			return fmt.Errorf("init cluster: %w", err)
+		}
+	}
+
+	store = storage.NewTenants(store, storage.TenantLimits{
+		MaxSeries: s.config.TenantMaxSeries,
+		WriteRate: s.config.TenantWriteRate,
+	})
+
+	cumulative := storage.NewCumulative(store)
+	store = cumulative
+
+	if s.config.MetricTTL > 0 {
+		store = storage.NewExpiring(store, s.config.MetricTTL)
+		go s.expire(ctx, store)
+	}
+
+	httpSrv := s.httpServer(ctx, store, cumulative, shard, limited)
 	gracefulClose.Add(ctx, httpSrv.Close)
 
-	grpcSrv := s.grpcServer(ctx, storage)
+	grpcSrv := s.grpcServer(ctx, store, repl)
 	gracefulClose.Add(ctx, grpcSrv.Close)
 
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 4)
 
 	go func() { errChan <- httpSrv.ListenAndServe(ctx) }()
 	go func() { errChan <- grpcSrv.ListenAndServe(ctx) }()
 
+	if s.config.StatsDAddress != "" {
+		statsdSrv := statsd.New(s.config.StatsDAddress, store, &statsd.Opts{
+			FlushInterval: s.config.StatsDFlushInterval,
+			Logger:        s.opts.Logger,
+		})
+		gracefulClose.Add(ctx, statsdSrv.Close)
+		go func() { errChan <- statsdSrv.ListenAndServe(ctx) }()
+	}
+
+	if s.config.GraphiteAddress != "" {
+		rules := make([]graphite.Rule, 0, len(s.config.GraphiteRules))
+		for _, rule := range s.config.GraphiteRules {
+			rules = append(rules, graphite.Rule{Pattern: rule.Pattern, Replacement: rule.Replacement})
+		}
+		graphiteSrv := graphite.New(s.config.GraphiteAddress, store, &graphite.Opts{
+			Rules:  rules,
+			Logger: s.opts.Logger,
+		})
+		gracefulClose.Add(ctx, graphiteSrv.Close)
+		go func() { errChan <- graphiteSrv.ListenAndServe(ctx) }()
+	}
+
+	if !s.config.Retention.IsEmpty() {
+		go s.retain(ctx, store)
+	}
+
 	select {
 	case <-ctx.Done():
 	case err = <-errChan:
@@ -86,16 +186,190 @@ func (s *Server) Run(ctx context.Context) (err error) {
 	return nil
 }
 
-func (s *Server) httpServer(ctx context.Context, storage storage.Storage) *httpserver.Server {
+// httpServer возвращает HTTP-сервер хранилища store, принимающий также
+// запросы Prometheus remote-write и записи InfluxDB; если задано хранилище shard метрик
+// текущего узла кластера, то сервер также обслуживает запросы других
+// узлов.
+func (s *Server) httpServer(
+	ctx context.Context,
+	store storage.Storage,
+	cumulative *storage.Cumulative,
+	shard storage.Storage,
+	limited *storage.Limited,
+) *httpserver.Server {
+	handler := NewHandler(store, s.middlewares()...)
+
+	stats := NewCardinalityHandler(limited, s.config.MaxSeries, s.middlewares()...)
+	handler = prefixHandler(handler, CardinalityPath, stats)
+
+	remote := NewRemoteWriteHandler(cumulative, s.plainMiddlewares()...)
+	handler = prefixHandler(handler, RemoteWritePath, remote)
+
+	influx := NewInfluxHandler(store, s.unencryptedMiddlewares()...)
+	handler = prefixHandler(handler, InfluxWritePath, influx)
+	handler = prefixHandler(handler, InfluxWriteV2Path, influx)
+
+	if shard != nil {
+		peers := useHandler(cluster.Handler(shard, s.config.ClusterKey), s.peerMiddlewares()...)
+		handler = prefixHandler(handler, cluster.PathPrefix, peers)
+	}
+
 	srv := &http.Server{
 		Addr:    s.config.Address,
-		Handler: NewHandler(storage, s.middlewares()...),
+		Handler: handler,
 	}
 	return httpserver.New(srv)
 }
 
-func (s *Server) grpcServer(ctx context.Context, storage storage.Storage) *grpcserver.Server {
-	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(s.interceptors()...))
-	pb.RegisterMetricsServer(srv, newUpdateServer(s.config, storage))
+// prefixHandler возвращает обработчик, передающий запросы, путь которых
+// начинается с prefix, обработчику other, а остальные запросы —
+// обработчику h.
+func prefixHandler(h http.Handler, prefix string, other http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			other.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// useHandler возвращает обработчик h, обёрнутый мидлварями middlewares.
+func useHandler(h http.Handler, middlewares ...middleware.Middleware) http.Handler {
+	handle := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		h.ServeHTTP(w, r)
+	}
+	handle = middleware.Use(handle, middlewares...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, nil)
+	})
+}
+
+func (s *Server) grpcServer(
+	ctx context.Context,
+	storage storage.Storage,
+	repl *replica,
+) *grpcserver.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.interceptors()...),
+		grpc.ChainStreamInterceptor(s.streamInterceptors()...),
+	)
+	updateSrv := newUpdateServer(s.config, storage)
+	updateSrv.replica = repl
+	pb.RegisterMetricsServer(srv, updateSrv)
 	return grpcserver.New(s.config.StreamAddress, srv)
 }
+
+// cacheStatsInterval определяет интервал логирования статистики кеша.
+const cacheStatsInterval = time.Minute
+
+// cacheStats логирует статистику обращений к кешу с интервалом
+// cacheStatsInterval; блокируется до тех пор, пока не сработает контекст.
+func (s *Server) cacheStats(ctx context.Context, cache *storage.Cache) {
+	ticker := time.NewTicker(cacheStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := cache.Stats()
+			s.opts.Logger.Log(logging.LevelInfo, "cache stats",
+				"hits", stats.Hits,
+				"misses", stats.Misses,
+			)
+		}
+	}
+}
+
+// cardinalityInterval определяет интервал логирования кардинальности
+// метрик.
+const cardinalityInterval = time.Minute
+
+// cardinality логирует кардинальность метрик с интервалом
+// cardinalityInterval; блокируется до тех пор, пока не сработает контекст.
+func (s *Server) cardinality(ctx context.Context, limited *storage.Limited) {
+	ticker := time.NewTicker(cardinalityInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c, err := limited.Cardinality(ctx)
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, storage.ErrStorageClosed) {
+					s.opts.Logger.Log(logging.LevelError, err.Error())
+				}
+				continue
+			}
+			level := logging.LevelInfo
+			if s.config.MaxSeries > 0 && c.Series >= s.config.MaxSeries {
+				level = logging.LevelError
+			}
+			s.opts.Logger.Log(level, "cardinality",
+				"series", c.Series,
+				"max_series", s.config.MaxSeries,
+				"rejected", c.Rejected,
+			)
+		}
+	}
+}
+
+// recovered логирует результат восстановления локального хранилища.
+func (s *Server) recovered(recovery storage.Recovery) {
+	level := logging.LevelInfo
+	if recovery.Dropped > 0 {
+		level = logging.LevelError
+	}
+	s.opts.Logger.Log(level, "storage recovered",
+		"records", recovery.Records,
+		"dropped_bytes", recovery.Dropped,
+	)
+}
+
+// retain агрегирует и удаляет историю метрик согласно политике хранения
+// с интервалом RetentionInterval; блокируется до тех пор, пока не сработает
+// контекст.
+func (s *Server) retain(ctx context.Context, store storage.Storage) {
+	ticker := time.NewTicker(s.config.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := store.Retain(ctx, s.config.Retention, now)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, storage.ErrStorageClosed) {
+				s.opts.Logger.Log(logging.LevelError, err.Error())
+			}
+		}
+	}
+}
+
+// expire удаляет метрики, которые не обновлялись дольше MetricTTL,
+// с интервалом ExpireInterval; блокируется до тех пор, пока не сработает
+// контекст.
+func (s *Server) expire(ctx context.Context, store storage.Storage) {
+	ticker := time.NewTicker(s.config.ExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := store.Expire(ctx, now.Add(-s.config.MetricTTL))
+			if err != nil && ctx.Err() == nil && !errors.Is(err, storage.ErrStorageClosed) {
+				s.opts.Logger.Log(logging.LevelError, err.Error())
+			}
+			if n > 0 {
+				s.opts.Logger.Log(logging.LevelInfo, "metrics expired", "count", n)
+			}
+		}
+	}
+}
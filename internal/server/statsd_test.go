@@ -0,0 +1,53 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/ingest/ingesttest"
+	"github.com/sergeizaitcev/metrics/internal/server"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestServer_statsdShutdown(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	cfg := testReplicaConfig(t, "")
+
+	port, err := tcputil.FreePort()
+	require.NoError(t, err)
+	cfg.StatsDAddress = "127.0.0.1:" + port
+	cfg.StatsDFlushInterval = time.Hour
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- server.New(cfg, nil).Run(runCtx) }()
+
+	conn := ingesttest.Dial(t, cfg.StatsDAddress)
+
+	_, err = conn.Write([]byte("requests:3|c\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// NOTE: значение сохраняется только последним сбросом при завершении
+	// работы, поэтому серверу даётся время прочитать его.
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	local, err := storage.NewLocal(cfg.FileStoragePath, &storage.LocalOpts{Restore: true})
+	require.NoError(t, err)
+	defer local.Close()
+
+	got, err := local.Get(ctx, "requests", nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, got.Int64())
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+var (
+	errAPIKeyRequired = errors.New("api key is required")
+	errAPIKeyUnknown  = errors.New("api key is unknown")
+)
+
+// resolveTenant возвращает копию ctx с арендатором запроса.
+//
+// Если в конфиге заданы ключи API, арендатор определяется по ключу apiKey,
+// а запросы без ключа выполняются от имени арендатора по умолчанию; иначе
+// используется арендатор tenant, переданный в запросе.
+func (s *Server) resolveTenant(ctx context.Context, apiKey, tenant string) (context.Context, error) {
+	if len(s.config.APIKeys) > 0 {
+		if apiKey == "" {
+			if tenant != "" {
+				return nil, errAPIKeyRequired
+			}
+			return ctx, nil
+		}
+		tenant, ok := s.config.APIKeys[apiKey]
+		if !ok {
+			return nil, errAPIKeyUnknown
+		}
+		return storage.WithTenant(ctx, tenant), nil
+	}
+
+	err := configs.ValidateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.WithTenant(ctx, tenant), nil
+}
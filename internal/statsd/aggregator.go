@@ -0,0 +1,166 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+// aggregator агрегирует строки StatsD до сброса в хранилище.
+//
+// Значения счётчиков суммируются с учётом частоты выборки, датчики
+// сохраняют последнее значение, а таймеры и гистограммы накапливают
+// наблюдения в гистограмме с границами metrics.DefaultBounds. Значения
+// таймеров переводятся из миллисекунд в секунды.
+type aggregator struct {
+	mu         sync.Mutex
+	counters   map[string]*counter
+	gauges     map[string]*gauge
+	histograms map[string]*histogram
+}
+
+type series struct {
+	name   string
+	labels metrics.Labels
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value float64
+	set   bool // Индикатор установленного значения.
+}
+
+type histogram struct {
+	series
+	value *metrics.HistogramValue
+}
+
+func newAggregator() *aggregator {
+	a := &aggregator{}
+	a.reset()
+	return a
+}
+
+func (a *aggregator) reset() {
+	a.counters = make(map[string]*counter)
+	a.gauges = make(map[string]*gauge)
+	a.histograms = make(map[string]*histogram)
+}
+
+// add добавляет строку StatsD в агрегаты.
+func (a *aggregator) add(l Line) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := metrics.Key(l.Name, l.Labels)
+	s := series{name: l.Name, labels: l.Labels}
+
+	switch l.Type {
+	case TypeCounter:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{series: s}
+			a.counters[key] = c
+		}
+		c.value += l.Value / l.Rate
+	case TypeGauge:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{series: s}
+			a.gauges[key] = g
+		}
+		if l.Delta {
+			g.value += l.Value
+		} else {
+			g.value, g.set = l.Value, true
+		}
+	case TypeTimer, TypeHistogram:
+		h, ok := a.histograms[key]
+		if !ok {
+			// NOTE: границы по умолчанию корректны.
+			value, _ := metrics.NewHistogramValue(metrics.DefaultBounds)
+			h = &histogram{series: s, value: value}
+			a.histograms[key] = h
+		}
+		v := l.Value
+		if l.Type == TypeTimer {
+			v /= 1000
+		}
+		// NOTE: значение, отправленное с частотой выборки rate,
+		// соответствует 1/rate наблюдениям; частота ограничена снизу
+		// minRate, поэтому их количество не переполняется.
+		n := math.Max(1, math.Round(1/l.Rate))
+		h.value.ObserveN(v, uint64(n))
+	}
+}
+
+// flush возвращает значения метрик из агрегатов и сбрасывает их.
+// Изменения датчиков без установленного значения применяются к текущему
+// значению датчика в хранилище s; если его не удалось получить, то
+// изменение возвращается в агрегаты до следующего сброса, а ошибка
+// возвращается вместе с остальными значениями.
+//
+// NOTE: значение датчика читается и сохраняется не атомарно, поэтому
+// значение, сохранённое между ними другим источником, перезаписывается.
+func (a *aggregator) flush(ctx context.Context, s storage.Storage) ([]metrics.Metric, error) {
+	a.mu.Lock()
+	counters, gauges, histograms := a.counters, a.gauges, a.histograms
+	a.reset()
+	a.mu.Unlock()
+
+	values := make([]metrics.Metric, 0, len(counters)+len(gauges)+len(histograms))
+
+	for _, c := range counters {
+		values = append(values, metrics.Counter(c.name, int64(math.Round(c.value)), c.labels...))
+	}
+
+	var errs []error
+
+	for key, g := range gauges {
+		value := g.value
+		if !g.set {
+			actual, err := s.Get(ctx, g.name, g.labels)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				a.restore(key, g)
+				errs = append(errs, err)
+				continue
+			}
+			if err == nil && actual.Kind() == metrics.KindGauge {
+				value += actual.Float64()
+			}
+		}
+		values = append(values, metrics.Gauge(g.name, value, g.labels...))
+	}
+
+	for _, h := range histograms {
+		values = append(values, metrics.Histogram(h.name, h.value, h.labels...))
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// restore возвращает в агрегаты изменение датчика g с ключом key, которое
+// не удалось сбросить; значение, установленное после него, изменение
+// перекрывает.
+func (a *aggregator) restore(key string, g *gauge) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	actual, ok := a.gauges[key]
+	if !ok {
+		a.gauges[key] = g
+		return
+	}
+	if !actual.set {
+		actual.value += g.value
+	}
+}
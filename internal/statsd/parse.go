@@ -0,0 +1,138 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// Type определяет тип метрики StatsD.
+type Type uint8
+
+const (
+	TypeUnknown Type = iota
+	TypeCounter
+	TypeGauge
+	TypeTimer
+	TypeHistogram
+)
+
+var types = map[string]Type{
+	"c":  TypeCounter,
+	"g":  TypeGauge,
+	"ms": TypeTimer,
+	"h":  TypeHistogram,
+}
+
+// minRate определяет минимальную частоту выборки. Значение с меньшей
+// частотой соответствует слишком большому количеству наблюдений.
+const minRate = 1e-6
+
+var (
+	errLineInvalid   = errors.New("line must have the format <name>:<value>|<type>")
+	errTypeUnknown   = errors.New("metric type is unknown")
+	errRateInvalid   = fmt.Errorf("sample rate must be in the range [%g, 1]", minRate)
+	errValueInvalid  = errors.New("metric value is invalid")
+	errNameEmpty     = errors.New("metric name is empty")
+	errFieldUnknown  = errors.New("line field is unknown")
+	errTagsInvalid   = errors.New("tags must have the format #name:value,...")
+	errDeltaNotGauge = errors.New("only gauges can have a signed delta")
+)
+
+// Line определяет строку протокола StatsD.
+type Line struct {
+	Name   string
+	Labels metrics.Labels
+	Type   Type
+	Value  float64
+
+	// Частота выборки: значение было отправлено с вероятностью Rate.
+	Rate float64
+
+	// Индикатор изменения датчика на Value вместо установки значения.
+	Delta bool
+}
+
+// Parse разбирает строку протокола StatsD вида
+//
+//	<name>:<value>|<type>[|@<rate>][|#<tag>:<value>,...]
+//
+// где type — один из c, g, ms и h. Теги в формате DogStatsD становятся
+// метками метрики; значение датчика со знаком "+" или "-" изменяет его
+// текущее значение.
+func Parse(line string) (Line, error) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 2 {
+		return Line{}, errLineInvalid
+	}
+
+	name, value, ok := strings.Cut(fields[0], ":")
+	if !ok {
+		return Line{}, errLineInvalid
+	}
+	if name == "" {
+		return Line{}, errNameEmpty
+	}
+
+	t, ok := types[fields[1]]
+	if !ok {
+		return Line{}, fmt.Errorf("%w: %q", errTypeUnknown, fields[1])
+	}
+
+	l := Line{Name: name, Type: t, Rate: 1}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Line{}, fmt.Errorf("%w: %q", errValueInvalid, value)
+	}
+	l.Value = v
+
+	if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+		switch t {
+		case TypeGauge:
+			l.Delta = true
+		case TypeCounter:
+		default:
+			return Line{}, errDeltaNotGauge
+		}
+	}
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || !(rate >= minRate && rate <= 1) {
+				return Line{}, errRateInvalid
+			}
+			l.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			l.Labels, err = parseTags(field[1:])
+			if err != nil {
+				return Line{}, err
+			}
+		default:
+			return Line{}, fmt.Errorf("%w: %q", errFieldUnknown, field)
+		}
+	}
+
+	return l, nil
+}
+
+// parseTags возвращает метки из тегов DogStatsD вида name:value,...
+func parseTags(s string) (metrics.Labels, error) {
+	var labels []metrics.Label
+
+	for _, tag := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("%w: %q", errTagsInvalid, tag)
+		}
+		labels = append(labels, metrics.Label{Name: name, Value: value})
+	}
+
+	return metrics.NewLabels(labels...), nil
+}
@@ -0,0 +1,121 @@
+package statsd_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/statsd"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		line    string
+		want    statsd.Line
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "requests:3|c",
+			want: statsd.Line{Name: "requests", Type: statsd.TypeCounter, Value: 3, Rate: 1},
+		},
+		{
+			name: "sampled counter",
+			line: "requests:1|c|@0.1",
+			want: statsd.Line{Name: "requests", Type: statsd.TypeCounter, Value: 1, Rate: 0.1},
+		},
+		{
+			name: "gauge",
+			line: "temperature:21.5|g",
+			want: statsd.Line{Name: "temperature", Type: statsd.TypeGauge, Value: 21.5, Rate: 1},
+		},
+		{
+			name: "gauge delta",
+			line: "temperature:-1.5|g",
+			want: statsd.Line{Name: "temperature", Type: statsd.TypeGauge, Value: -1.5, Rate: 1, Delta: true},
+		},
+		{
+			name: "timer",
+			line: "latency:250|ms|@0.5",
+			want: statsd.Line{Name: "latency", Type: statsd.TypeTimer, Value: 250, Rate: 0.5},
+		},
+		{
+			name: "histogram with tags",
+			line: "size:1024|h|#host:a,region:eu",
+			want: statsd.Line{
+				Name: "size",
+				Labels: metrics.NewLabels(
+					metrics.Label{Name: "host", Value: "a"},
+					metrics.Label{Name: "region", Value: "eu"},
+				),
+				Type:  statsd.TypeHistogram,
+				Value: 1024,
+				Rate:  1,
+			},
+		},
+		{
+			name:    "without type",
+			line:    "requests:1",
+			wantErr: true,
+		},
+		{
+			name:    "without value",
+			line:    "requests|c",
+			wantErr: true,
+		},
+		{
+			name:    "empty name",
+			line:    ":1|c",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			line:    "requests:1|s",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			line:    "requests:NaN|c",
+			wantErr: true,
+		},
+		{
+			name:    "invalid rate",
+			line:    "requests:1|c|@2",
+			wantErr: true,
+		},
+		{
+			name:    "too small rate",
+			line:    "requests:1|c|@1e-300",
+			wantErr: true,
+		},
+		{
+			name:    "signed timer",
+			line:    "latency:+10|ms",
+			wantErr: true,
+		},
+		{
+			name:    "invalid tags",
+			line:    "requests:1|c|#host",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			line:    "requests:1|c|x",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := statsd.Parse(tc.line)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package statsd реализует приём метрик по протоколу StatsD через UDP
+// и TCP с агрегированием значений между сбросами в хранилище.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/ingest"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/logging"
+)
+
+const (
+	// DefaultFlushInterval определяет интервал сброса агрегатов
+	// в хранилище по умолчанию.
+	DefaultFlushInterval = 10 * time.Second
+
+	// maxPacketSize определяет максимальный размер UDP-пакета.
+	maxPacketSize = 64 << 10
+)
+
+var defaultOpts = &Opts{
+	FlushInterval: DefaultFlushInterval,
+	Logger:        logging.Discard(),
+}
+
+// Opts определяет не обязательные параметры для Server.
+type Opts struct {
+	// Интервал сброса агрегатов в хранилище.
+	FlushInterval time.Duration
+
+	Logger *logging.Logger
+}
+
+// Server определяет сервер StatsD, принимающий строки протокола через UDP
+// и TCP на одном адресе.
+type Server struct {
+	*ingest.Listener
+
+	addr    string
+	storage storage.Storage
+	opts    *Opts
+	agg     *aggregator
+}
+
+// New возвращает сервер StatsD, сохраняющий метрики в s.
+func New(addr string, s storage.Storage, opts *Opts) *Server {
+	if opts == nil {
+		opts = defaultOpts
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultOpts.FlushInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = defaultOpts.Logger
+	}
+
+	return &Server{
+		Listener: ingest.NewListener(opts.Logger),
+		addr:     addr,
+		storage:  s,
+		opts:     opts,
+		agg:      newAggregator(),
+	}
+}
+
+// ListenAndServe слушает входящие строки и блокируется до тех пор, пока
+// не сработает контекст, не сработает метод Close или функция не вернёт
+// ошибку. Перед возвратом накопленные значения сбрасываются в хранилище,
+// а метод Close дожидается этого сброса.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	return s.Run(func() error {
+		packets, err := net.ListenPacket("udp", s.addr)
+		if err != nil {
+			return err
+		}
+
+		lis, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			packets.Close()
+			return err
+		}
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.serveUDP(packets)
+		}()
+		go func() {
+			defer wg.Done()
+			s.flushEvery(ctx, stop)
+		}()
+
+		s.Serve(ctx, lis, s.serveConn)
+
+		close(stop)
+		packets.Close()
+		wg.Wait()
+
+		// NOTE: контекст уже мог сработать, поэтому последний сброс
+		// выполняется без него.
+		s.flush(context.Background())
+
+		return nil
+	})
+}
+
+// flushEvery сбрасывает накопленные значения в хранилище с интервалом
+// FlushInterval до закрытия stop.
+func (s *Server) flushEvery(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.flush(ctx)
+		}
+	}
+}
+
+// serveUDP читает строки из UDP-пакетов до закрытия packets.
+func (s *Server) serveUDP(packets net.PacketConn) {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, _, err := packets.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.opts.Logger.Log(logging.LevelError, err.Error(), "proto", "udp")
+			}
+			return
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			s.handle(line)
+		}
+	}
+}
+
+// serveConn читает строки из TCP-соединения до его закрытия.
+func (s *Server) serveConn(conn net.Conn) {
+	scanner := ingest.Scanner(conn, maxPacketSize)
+	for scanner.Scan() {
+		s.handle(scanner.Text())
+	}
+}
+
+// handle разбирает строку и добавляет её в агрегаты.
+func (s *Server) handle(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	l, err := Parse(line)
+	if err != nil {
+		s.opts.Logger.Log(logging.LevelDebug, err.Error(), "line", line)
+		return
+	}
+
+	s.agg.add(l)
+}
+
+// flush сохраняет накопленные значения в хранилище.
+func (s *Server) flush(ctx context.Context) {
+	values, err := s.agg.flush(ctx, s.storage)
+	if err != nil {
+		ingest.LogError(s.opts.Logger, err)
+	}
+	ingest.Save(ctx, s.storage, s.opts.Logger, values)
+}
@@ -0,0 +1,133 @@
+package statsd_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/ingest/ingesttest"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/statsd"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/tcputil"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+// send отправляет строки StatsD на адрес addr по протоколу network.
+func send(t *testing.T, network, addr, lines string) {
+	conn, err := net.Dial(network, addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(lines))
+	require.NoError(t, err)
+}
+
+func TestServer(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	port, err := tcputil.FreePort()
+	require.NoError(t, err)
+	addr := "127.0.0.1:" + port
+
+	s := ingesttest.NewStorage(t)
+
+	_, err = s.Save(ctx, metrics.Gauge("queue", 10))
+	require.NoError(t, err)
+
+	srv := statsd.New(addr, s, &statsd.Opts{FlushInterval: time.Hour})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(context.Background()) }()
+
+	// NOTE: сервер начинает слушать адрес в фоне.
+	ingesttest.Dial(t, addr)
+
+	send(t, "udp", addr, "requests:1|c|@0.5\nrequests:2|c|#host:a\nlatency:250|ms\ninvalid\n")
+	send(t, "tcp", addr, "requests:3|c\nqueue:-4|g\ntemperature:21.5|g\n")
+
+	// NOTE: доставка UDP-пакетов не подтверждается, поэтому сервер
+	// закрывается после небольшой паузы.
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, srv.Close())
+	require.NoError(t, <-done)
+
+	host := metrics.Label{Name: "host", Value: "a"}
+
+	latency, err := metrics.NewHistogramValue(metrics.DefaultBounds)
+	require.NoError(t, err)
+	latency.Observe(0.25)
+
+	want := []metrics.Metric{
+		metrics.Counter("requests", 5),
+		metrics.Counter("requests", 2, host),
+		metrics.Gauge("queue", 6),
+		metrics.Gauge("temperature", 21.5),
+		metrics.Histogram("latency", latency),
+	}
+
+	for _, w := range want {
+		got, err := s.Get(ctx, w.Name(), w.Labels())
+		require.NoError(t, err)
+		require.Equal(t, w.String(), got.String())
+	}
+}
+
+// failingGet определяет хранилище, чтение из которого завершается ошибкой,
+// пока установлен failing.
+type failingGet struct {
+	storage.Storage
+	failing atomic.Bool
+}
+
+func (s *failingGet) Get(ctx context.Context, name string, labels metrics.Labels) (metrics.Metric, error) {
+	if s.failing.Load() {
+		return metrics.Metric{}, errors.New("error")
+	}
+	return s.Storage.Get(ctx, name, labels)
+}
+
+func TestServer_gaugeError(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	port, err := tcputil.FreePort()
+	require.NoError(t, err)
+	addr := "127.0.0.1:" + port
+
+	s := &failingGet{Storage: ingesttest.NewStorage(t)}
+	s.failing.Store(true)
+
+	_, err = s.Save(ctx, metrics.Gauge("queue", 10))
+	require.NoError(t, err)
+
+	srv := statsd.New(addr, s, &statsd.Opts{FlushInterval: 10 * time.Millisecond})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(context.Background()) }()
+
+	ingesttest.Dial(t, addr)
+
+	send(t, "tcp", addr, "queue:-4|g\ntemperature:21.5|g\n")
+
+	// NOTE: датчик с установленным значением сохраняется, несмотря
+	// на ошибку чтения изменяемого датчика.
+	require.Eventually(t, func() bool {
+		_, err := s.Storage.Get(ctx, "temperature", nil)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.failing.Store(false)
+
+	require.NoError(t, srv.Close())
+	require.NoError(t, <-done)
+
+	got, err := s.Get(ctx, "queue", nil)
+	require.NoError(t, err)
+	require.Equal(t, 6.0, got.Float64())
+}
@@ -0,0 +1,404 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// Invalidator определяет хранилище, которое уведомляет об удалении
+// и сбросе метрик, в том числе выполненных другими экземплярами сервера.
+type Invalidator interface {
+	// Invalidations возвращает канал ключей удалённых и сброшенных метрик.
+	//
+	// Канал закрывается при отмене ctx, закрытии хранилища или если
+	// подписчик не успевает читать ключи.
+	Invalidations(ctx context.Context) (<-chan string, error)
+}
+
+// resubscribeInterval определяет интервал повторной подписки кеша
+// на изменения метрик.
+const resubscribeInterval = time.Second
+
+// CacheStats определяет статистику обращений к кешу.
+type CacheStats struct {
+	// Количество чтений, обслуженных кешем.
+	Hits uint64
+
+	// Количество чтений, переданных хранилищу.
+	Misses uint64
+}
+
+var _ Storage = (*Cache)(nil)
+
+// Cache определяет хранилище, кеширующее в памяти текущие значения метрик.
+//
+// Кеш обновляется при сохранении значений через него, а также значениями
+// из подписки Watch; если хранилище реализует Invalidator, удалённые
+// и сброшенные метрики вытесняются из кеша. Пока подписка не установлена,
+// чтение выполняется из хранилища.
+type Cache struct {
+	Storage
+	invalidator Invalidator
+
+	mu       sync.RWMutex
+	values   *memstorage
+	versions map[string]uint64 // Номера последних изменений метрик.
+	version  uint64            // Номер последнего изменения.
+	reset    uint64            // Номер последней очистки кеша.
+	live     bool              // Индикатор активной подписки.
+	complete bool              // Индикатор наличия в кеше всех метрик.
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewCache возвращает хранилище s, кеширующее текущие значения метрик.
+func NewCache(s Storage) *Cache {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &Cache{
+		Storage:  s,
+		values:   newMemstorage(),
+		versions: make(map[string]uint64),
+		cancel:   cancel,
+	}
+	c.invalidator, _ = s.(Invalidator)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(ctx)
+	}()
+
+	return c
+}
+
+// Stats возвращает статистику обращений к кешу.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// Close реализует интерфейс Storage.
+func (c *Cache) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	return c.Storage.Close()
+}
+
+// Save реализует интерфейс Storage.
+func (c *Cache) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.Metric, error) {
+	start := c.current()
+
+	actuals, err := c.Storage.Save(ctx, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, sample := range changes(time.Now(), values, actuals) {
+		key := sample.Value.Key()
+		if c.fillable(key, start) {
+			c.change(key, sample.Value.WithUpdated(sample.Time))
+		}
+	}
+
+	return actuals, nil
+}
+
+// Get реализует интерфейс Storage.
+func (c *Cache) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	key := metrics.Key(name, labels)
+
+	c.mu.RLock()
+	if c.live {
+		value, ok := c.values.values[key]
+		if ok || c.complete {
+			c.mu.RUnlock()
+			c.hits.Add(1)
+			if !ok {
+				return metrics.Metric{}, ErrNotFound
+			}
+			return value, nil
+		}
+	}
+	start := c.version
+	c.mu.RUnlock()
+
+	c.misses.Add(1)
+
+	value, err := c.Storage.Get(ctx, name, labels)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	c.mu.Lock()
+	if c.fillable(key, start) {
+		c.values.put(key, value)
+	}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// GetAll реализует интерфейс Storage.
+func (c *Cache) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	c.mu.RLock()
+	if c.live && c.complete {
+		values := c.values.getAll()
+		c.mu.RUnlock()
+		c.hits.Add(1)
+		if len(values) == 0 {
+			return nil, ErrNotFound
+		}
+		return values, nil
+	}
+	start := c.version
+	c.mu.RUnlock()
+
+	c.misses.Add(1)
+
+	values, err := c.Storage.GetAll(ctx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	c.fillAll(start, values)
+
+	return values, err
+}
+
+// Select реализует интерфейс Storage.
+func (c *Cache) Select(ctx context.Context, m Matcher) ([]metrics.Metric, error) {
+	compiled, err := m.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	if c.live && c.complete {
+		values := c.values.selectBy(compiled)
+		c.mu.RUnlock()
+		c.hits.Add(1)
+		return values, nil
+	}
+	start := c.version
+	c.mu.RUnlock()
+
+	c.misses.Add(1)
+
+	values, err := c.Storage.Select(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	for _, value := range values {
+		if key := value.Key(); c.fillable(key, start) {
+			c.values.put(key, value)
+		}
+	}
+	c.mu.Unlock()
+
+	return values, nil
+}
+
+// Delete реализует интерфейс Storage.
+func (c *Cache) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	defer c.invalidate(metrics.Key(name, labels))
+	return c.Storage.Delete(ctx, name, labels)
+}
+
+// Reset реализует интерфейс Storage.
+func (c *Cache) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	defer c.invalidate(metrics.Key(name, labels))
+	return c.Storage.Reset(ctx, name, labels)
+}
+
+// Expire реализует интерфейс Storage.
+func (c *Cache) Expire(ctx context.Context, before time.Time) (int, error) {
+	n, err := c.Storage.Expire(ctx, before)
+
+	// NOTE: хранилище, реализующее Invalidator, уведомляет об удалённых
+	// метриках само.
+	if n > 0 && c.invalidator == nil {
+		c.mu.Lock()
+		c.clear()
+		c.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// run поддерживает подписку кеша на изменения метрик до отмены ctx.
+func (c *Cache) run(ctx context.Context) {
+	for {
+		err := c.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrStorageClosed) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeInterval):
+		}
+	}
+}
+
+// subscribe подписывается на изменения метрик и применяет их к кешу
+// до разрыва подписки.
+//
+// NOTE: изменения, произошедшие до подписки или после её разрыва,
+// кешу неизвестны, поэтому кеш очищается в обоих случаях.
+func (c *Cache) subscribe(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	samples, err := c.Storage.Watch(ctx, Matcher{})
+	if err != nil {
+		return err
+	}
+
+	var invalidations <-chan string
+	if c.invalidator != nil {
+		invalidations, err = c.invalidator.Invalidations(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.clear()
+	c.live = true
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.clear()
+		c.live = false
+		c.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+			c.mu.Lock()
+			c.apply(sample)
+			c.mu.Unlock()
+		case key, ok := <-invalidations:
+			if !ok {
+				return nil
+			}
+			c.invalidate(key)
+		}
+	}
+}
+
+// current возвращает номер последнего изменения.
+func (c *Cache) current() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// fillable возвращает true, если значение метрики по ключу, прочитанное
+// из хранилища после изменения start, можно сохранить в кеш: подписка
+// активна, а кеш не очищался и метрика не изменялась после start.
+func (c *Cache) fillable(key string, start uint64) bool {
+	return c.live && c.reset <= start && c.versions[key] <= start
+}
+
+// fillAll заменяет содержимое кеша всеми метриками values, прочитанными
+// из хранилища после изменения start.
+func (c *Cache) fillAll(start uint64, values []metrics.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.live || c.reset > start {
+		return
+	}
+
+	fresh := newMemstorage()
+
+	for _, value := range values {
+		if key := value.Key(); c.versions[key] <= start {
+			fresh.put(key, value)
+		}
+	}
+	for key, value := range c.values.values {
+		if c.versions[key] > start {
+			fresh.put(key, value)
+		}
+	}
+
+	c.values = fresh
+	c.complete = true
+}
+
+// apply сохраняет в кеш значение метрики из подписки.
+//
+// NOTE: подписка доставляет значения в порядке фиксации изменений,
+// поэтому значение из подписки заменяет значение в кеше без сравнения
+// времени изменения: время, взятое до фиксации или другим экземпляром
+// сервера, не упорядочивает изменения. Если значение, сохранённое через
+// кеш, опередило более раннее значение из подписки, то кеш вернётся к нему,
+// когда придёт значение из подписки этого сохранения.
+func (c *Cache) apply(sample Sample) {
+	c.change(sample.Value.Key(), sample.Value.WithUpdated(sample.Time))
+}
+
+// change сохраняет в кеш новое значение метрики по ключу.
+func (c *Cache) change(key string, value metrics.Metric) {
+	c.version++
+	c.versions[key] = c.version
+	c.values.put(key, value)
+}
+
+// invalidate вытесняет из кеша метрику по ключу.
+func (c *Cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.versions[key] = c.version
+	c.values.remove(key)
+
+	// NOTE: метрика могла быть сброшена и остаться в хранилище.
+	c.complete = false
+}
+
+// clear очищает кеш.
+func (c *Cache) clear() {
+	c.version++
+	c.reset = c.version
+	c.values = newMemstorage()
+	c.versions = make(map[string]uint64)
+	c.complete = false
+}
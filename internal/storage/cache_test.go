@@ -0,0 +1,190 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+// invalidating определяет хранилище, уведомления об удалении метрик
+// которого отправляются тестом.
+type invalidating struct {
+	storage.Storage
+	keys chan string
+}
+
+func (s *invalidating) Invalidations(ctx context.Context) (<-chan string, error) {
+	return s.keys, nil
+}
+
+// watching определяет хранилище, значения подписки которого отправляются
+// тестом.
+type watching struct {
+	storage.Storage
+	samples chan storage.Sample
+}
+
+func (s *watching) Watch(ctx context.Context, m storage.Matcher) (<-chan storage.Sample, error) {
+	ch := make(chan storage.Sample)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sample := <-s.samples:
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- sample:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func testCache(t *testing.T, s storage.Storage) *storage.Cache {
+	cache := storage.NewCache(s)
+	t.Cleanup(func() { cache.Close() })
+
+	ctx := testutil.Context(t)
+
+	// NOTE: подписка кеша устанавливается асинхронно; пока она не
+	// установлена, чтение выполняется из хранилища.
+	_, err := cache.Save(ctx, metrics.Gauge("warmup", 1))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		hits := cache.Stats().Hits
+		_, err := cache.Get(ctx, "warmup", nil)
+		return err == nil && cache.Stats().Hits > hits
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return cache
+}
+
+func TestCache(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	t.Run("write-through", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		cache := testCache(t, local)
+
+		_, err := cache.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+		_, err = cache.Save(ctx, metrics.Counter("counter", 2))
+		require.NoError(t, err)
+
+		stats := cache.Stats()
+
+		got, err := cache.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, got.Int64())
+		require.False(t, got.Updated().IsZero())
+		require.Equal(t, stats.Hits+1, cache.Stats().Hits)
+		require.Equal(t, stats.Misses, cache.Stats().Misses)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		cache := testCache(t, local)
+
+		// NOTE: значение, сохранённое в обход кеша, приходит из подписки.
+		_, err := local.Save(ctx, metrics.Gauge("gauge", 2))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			got, err := cache.Get(ctx, "gauge", nil)
+			return err == nil && got.Float64() == 2
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("get_all", func(t *testing.T) {
+		local, _ := testLocal(t, true, metrics.Counter("counter", 1))
+		cache := testCache(t, local)
+
+		values, err := cache.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+
+		stats := cache.Stats()
+
+		values, err = cache.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+
+		values, err = cache.Select(ctx, storage.Matcher{Prefix: "count"})
+		require.NoError(t, err)
+		require.Len(t, values, 1)
+
+		_, err = cache.Get(ctx, "unknown", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		require.Equal(t, stats.Hits+3, cache.Stats().Hits)
+		require.Equal(t, stats.Misses, cache.Stats().Misses)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		cache := testCache(t, local)
+
+		require.NoError(t, cache.Delete(ctx, "warmup", nil))
+
+		_, err := cache.Get(ctx, "warmup", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("invalidation", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		keys := make(chan string)
+		cache := testCache(t, &invalidating{Storage: local, keys: keys})
+
+		// NOTE: метрика удалена другим экземпляром сервера.
+		require.NoError(t, local.Delete(ctx, "warmup", nil))
+
+		got, err := cache.Get(ctx, "warmup", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, got.Float64())
+
+		keys <- metrics.Key("warmup", nil)
+
+		require.Eventually(t, func() bool {
+			_, err := cache.Get(ctx, "warmup", nil)
+			return err != nil
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("commit_order", func(t *testing.T) {
+		local, _ := testLocal(t, true, metrics.Gauge("warmup", 1))
+		samples := make(chan storage.Sample)
+		cache := storage.NewCache(&watching{Storage: local, samples: samples})
+		t.Cleanup(func() { cache.Close() })
+
+		// NOTE: значение применено к кешу, когда подписка приняла ещё два
+		// следующих, поэтому вслед за значением отправляются ещё два.
+		warmup := storage.Sample{Time: time.Now(), Value: metrics.Gauge("warmup", 1)}
+		send := func(sample storage.Sample) {
+			for _, v := range []storage.Sample{sample, warmup, warmup} {
+				samples <- v
+			}
+		}
+
+		send(warmup)
+
+		_, err := cache.Save(ctx, metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		// NOTE: другое сохранение зафиксировано позже, но время его
+		// изменения взято раньше.
+		send(storage.Sample{Time: time.Now().Add(-time.Minute), Value: metrics.Gauge("gauge", 2)})
+
+		got, err := cache.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, got.Float64())
+	})
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var defaultCopyOpts = &CopyOpts{
+	BatchSize: 1000,
+}
+
+// CopyOpts определяет не обязательные параметры для Copy.
+type CopyOpts struct {
+	// Количество метрик, сохраняемых за один вызов Save.
+	//
+	// По умолчанию 1000.
+	BatchSize int
+
+	// Индикатор пробного запуска: метрики сравниваются, но не сохраняются.
+	DryRun bool
+}
+
+// CopyReport определяет результат копирования метрик.
+type CopyReport struct {
+	Total   int // Количество метрик в источнике.
+	Copied  int // Количество сохранённых в назначение метрик.
+	Skipped int // Количество метрик, значения которых уже совпадают.
+}
+
+// Mismatch определяет расхождение значения метрики в хранилищах.
+type Mismatch struct {
+	Want metrics.Metric // Значение в источнике.
+	Got  metrics.Metric // Значение в назначении; пусто, если метрики нет.
+}
+
+// Copy копирует текущие значения всех метрик из src в dst так, чтобы
+// после копирования они совпадали: в счётчик сохраняется разница между
+// значениями в источнике и назначении, датчик перезаписывается, а
+// гистограмма и сводка сохраняются, только если их нет в назначении.
+// Поэтому повторное копирование не удваивает накопленные значения.
+//
+// Если хотя бы одна метрика не может быть скопирована, то Copy возвращает
+// ErrConflict до сохранения первой метрики. История метрик не копируется.
+func Copy(ctx context.Context, dst, src Storage, opts *CopyOpts) (CopyReport, error) {
+	if opts == nil {
+		opts = defaultCopyOpts
+	}
+	size := opts.BatchSize
+	if size <= 0 {
+		size = defaultCopyOpts.BatchSize
+	}
+
+	values, err := getAll(ctx, src)
+	if err != nil {
+		return CopyReport{}, fmt.Errorf("copy: reading the source: %w", err)
+	}
+	actuals, err := getAll(ctx, dst)
+	if err != nil {
+		return CopyReport{}, fmt.Errorf("copy: reading the destination: %w", err)
+	}
+
+	report := CopyReport{Total: len(values)}
+	existing := index(actuals)
+	batch := make([]metrics.Metric, 0, len(values))
+
+	for _, value := range values {
+		delta, err := difference(value, existing[value.Key()])
+		if err != nil {
+			return CopyReport{}, fmt.Errorf("copy: %s: %w", value.Key(), err)
+		}
+		if delta.IsEmpty() {
+			report.Skipped++
+			continue
+		}
+		batch = append(batch, delta)
+	}
+
+	report.Copied = len(batch)
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for len(batch) > 0 {
+		n := size
+		if n > len(batch) {
+			n = len(batch)
+		}
+
+		_, err = dst.Save(ctx, batch[:n]...)
+		if err != nil {
+			report.Copied -= len(batch)
+			return report, fmt.Errorf("copy: writing to the destination: %w", err)
+		}
+
+		batch = batch[n:]
+	}
+
+	return report, nil
+}
+
+// Verify сравнивает текущие значения всех метрик src со значениями в dst
+// и возвращает найденные расхождения.
+func Verify(ctx context.Context, dst, src Storage) ([]Mismatch, error) {
+	values, err := getAll(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("verify: reading the source: %w", err)
+	}
+	actuals, err := getAll(ctx, dst)
+	if err != nil {
+		return nil, fmt.Errorf("verify: reading the destination: %w", err)
+	}
+
+	existing := index(actuals)
+	var mismatches []Mismatch
+
+	for _, want := range values {
+		got := existing[want.Key()]
+		if !want.Equal(got) {
+			mismatches = append(mismatches, Mismatch{Want: want, Got: got})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// getAll возвращает все метрики хранилища; отсутствие метрик не считается
+// ошибкой.
+func getAll(ctx context.Context, s Storage) ([]metrics.Metric, error) {
+	values, err := s.GetAll(ctx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return values, nil
+}
+
+func index(values []metrics.Metric) map[string]metrics.Metric {
+	m := make(map[string]metrics.Metric, len(values))
+	for _, value := range values {
+		m[value.Key()] = value
+	}
+	return m
+}
+
+// difference возвращает значение, сохранение которого приводит метрику
+// actual к значению want; пустое значение, если метрики уже совпадают.
+func difference(want, actual metrics.Metric) (metrics.Metric, error) {
+	if want.Equal(actual) {
+		return metrics.Metric{}, nil
+	}
+	if actual.IsEmpty() {
+		return want, nil
+	}
+	if want.Kind() != actual.Kind() {
+		return metrics.Metric{}, fmt.Errorf("%w: kind %s, want %s", ErrConflict, actual.Kind(), want.Kind())
+	}
+
+	switch want.Kind() {
+	case metrics.KindCounter:
+		return metrics.Counter(want.Name(), want.Int64()-actual.Int64(), want.Labels()...), nil
+	case metrics.KindGauge:
+		return want, nil
+	}
+
+	return metrics.Metric{}, fmt.Errorf("%w: %s, want %s", ErrConflict, actual.String(), want.String())
+}
@@ -0,0 +1,96 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+func TestCopy(t *testing.T) {
+	h, _ := metrics.NewHistogramValue([]float64{1, 2})
+	h.Observe(0.5)
+
+	values := []metrics.Metric{
+		metrics.Counter("counter", 10),
+		metrics.Counter("counter", 5),
+		metrics.Counter("counter", 3, metrics.Label{Name: "host", Value: "a"}),
+		metrics.Gauge("gauge", 1.5),
+		metrics.Histogram("histogram", h),
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		src, _ := testLocal(t, true, values...)
+		dst, ctx := testSQLite(t)
+
+		report, err := storage.Copy(ctx, dst, src, &storage.CopyOpts{BatchSize: 2})
+		require.NoError(t, err)
+		require.Equal(t, storage.CopyReport{Total: 4, Copied: 4}, report)
+
+		mismatches, err := storage.Verify(ctx, dst, src)
+		require.NoError(t, err)
+		require.Empty(t, mismatches)
+
+		got, err := dst.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 15, got.Int64())
+
+		report, err = storage.Copy(ctx, dst, src, nil)
+		require.NoError(t, err)
+		require.Equal(t, storage.CopyReport{Total: 4, Skipped: 4}, report)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		src, _ := testLocal(t, true, values...)
+		dst, ctx := testSQLite(t)
+
+		_, err := dst.Save(ctx, metrics.Counter("counter", 4), metrics.Gauge("gauge", 7))
+		require.NoError(t, err)
+
+		report, err := storage.Copy(ctx, dst, src, nil)
+		require.NoError(t, err)
+		require.Equal(t, storage.CopyReport{Total: 4, Copied: 4}, report)
+
+		got, err := dst.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 15, got.Int64())
+
+		got, err = dst.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.Equal(t, 1.5, got.Float64())
+	})
+
+	t.Run("dry_run", func(t *testing.T) {
+		src, _ := testLocal(t, true, values...)
+		dst, ctx := testSQLite(t)
+
+		report, err := storage.Copy(ctx, dst, src, &storage.CopyOpts{DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, storage.CopyReport{Total: 4, Copied: 4}, report)
+
+		_, err = dst.GetAll(ctx)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		mismatches, err := storage.Verify(ctx, dst, src)
+		require.NoError(t, err)
+		require.Len(t, mismatches, 4)
+		require.True(t, mismatches[0].Got.IsEmpty())
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		src, _ := testLocal(t, true, values...)
+		dst, ctx := testSQLite(t)
+
+		_, err := dst.Save(ctx, metrics.Gauge("counter", 1))
+		require.NoError(t, err)
+
+		_, err = storage.Copy(ctx, dst, src, nil)
+		require.ErrorIs(t, err, storage.ErrConflict)
+
+		got, err := dst.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+	})
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var _ Storage = (*Cumulative)(nil)
+
+// Cumulative определяет хранилище, принимающее также накопленные значения
+// счётчиков, которые сохраняются приращениями.
+//
+// Для каждого ряда арендатора запоминается последнее сохранённое
+// накопленное значение и время его измерения. Приращение вычисляется
+// относительно него под блокировкой вместе с сохранением, поэтому
+// одновременные запросы не учитывают его дважды, а значения, измеренные
+// не позже запомненного, например, при повторной отправке, отбрасываются.
+// Запомненное значение забывается при удалении, сбросе и истечении срока
+// хранения метрики.
+//
+// NOTE: запомненные значения не переживают перезапуск и не разделяются
+// между узлами кластера; при первом значении ряда приращение вычисляется
+// относительно текущего значения счётчика в хранилище.
+type Cumulative struct {
+	Storage
+
+	mu   sync.Mutex
+	last map[cumulativeKey]Sample
+}
+
+// cumulativeKey определяет ключ ряда арендатора.
+type cumulativeKey struct {
+	tenant string
+	series string
+}
+
+// NewCumulative возвращает хранилище s, принимающее также накопленные
+// значения счётчиков.
+func NewCumulative(s Storage) *Cumulative {
+	return &Cumulative{
+		Storage: s,
+		last:    make(map[cumulativeKey]Sample),
+	}
+}
+
+// SaveCumulative сохраняет приращения накопленных значений счётчиков
+// samples, измеренных в моменты Sample.Time, и возвращает актуальные
+// значения. Значения метрик других типов сохраняются как есть.
+//
+// При сбросе счётчика сохраняется накопленное значение целиком.
+func (c *Cumulative) SaveCumulative(ctx context.Context, samples ...Sample) ([]metrics.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tenant := TenantFromContext(ctx)
+	values := make([]metrics.Metric, 0, len(samples))
+	counters := make([]Sample, 0, len(samples))
+
+	for _, sample := range samples {
+		value := sample.Value
+		if value.Kind() != metrics.KindCounter {
+			values = append(values, value)
+			continue
+		}
+
+		base, ok, err := c.base(ctx, tenant, value, sample.Time)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		delta := value.Int64() - base
+		if delta < 0 {
+			delta = value.Int64()
+		}
+
+		values = append(values, metrics.Counter(value.Name(), delta, value.Labels()...))
+		counters = append(counters, sample)
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	actuals, err := c.Storage.Save(ctx, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sample := range counters {
+		c.last[cumulativeKey{tenant, sample.Value.Key()}] = sample
+	}
+
+	return actuals, nil
+}
+
+// base возвращает накопленное значение, относительно которого вычисляется
+// приращение счётчика value арендатора tenant, измеренного в момент t,
+// или false, если значение измерено не позже последнего сохранённого.
+func (c *Cumulative) base(
+	ctx context.Context,
+	tenant string,
+	value metrics.Metric,
+	t time.Time,
+) (int64, bool, error) {
+	last, ok := c.last[cumulativeKey{tenant, value.Key()}]
+	if ok {
+		if !t.After(last.Time) {
+			return 0, false, nil
+		}
+		return last.Value.Int64(), true, nil
+	}
+
+	actual, err := c.Storage.Get(ctx, value.Name(), value.Labels())
+	if errors.Is(err, ErrNotFound) || err == nil && actual.Kind() != metrics.KindCounter {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return actual.Int64(), true, nil
+}
+
+// Delete реализует интерфейс Storage.
+func (c *Cumulative) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.Storage.Delete(ctx, name, labels)
+	if err != nil {
+		return err
+	}
+
+	c.forget(ctx, name, labels)
+	return nil
+}
+
+// Reset реализует интерфейс Storage.
+func (c *Cumulative) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, err := c.Storage.Reset(ctx, name, labels)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	c.forget(ctx, name, labels)
+	return value, nil
+}
+
+// Expire реализует интерфейс Storage.
+//
+// Удалённые метрики не возвращаются хранилищем, поэтому при удалении
+// хотя бы одной метрики забываются все запомненные значения.
+func (c *Cumulative) Expire(ctx context.Context, before time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.Storage.Expire(ctx, before)
+	if n > 0 {
+		c.last = make(map[cumulativeKey]Sample)
+	}
+
+	return n, err
+}
+
+// forget забывает запомненное значение счётчика name с метками labels
+// арендатора из ctx.
+func (c *Cumulative) forget(ctx context.Context, name string, labels metrics.Labels) {
+	key := metrics.Key(name, metrics.NewLabels(labels...))
+	delete(c.last, cumulativeKey{TenantFromContext(ctx), key})
+}
@@ -0,0 +1,98 @@
+package storage_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestCumulative(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	// NOTE: счётчик уже содержит значения, накопленные до запуска.
+	local, _ := testLocal(t, true, metrics.Counter("requests", 3))
+	c := storage.NewCumulative(storage.NewTenants(local, storage.TenantLimits{}))
+
+	start := time.Now()
+	sample := func(value int64, d time.Duration) storage.Sample {
+		return storage.Sample{Time: start.Add(d), Value: metrics.Counter("requests", value)}
+	}
+
+	requireCounter := func(t *testing.T, want int64) {
+		t.Helper()
+		got, err := local.Get(ctx, "requests", nil)
+		require.NoError(t, err)
+		require.Equal(t, want, got.Int64())
+	}
+
+	_, err := c.SaveCumulative(ctx, sample(5, 0), storage.Sample{Value: metrics.Gauge("temperature", 1)})
+	require.NoError(t, err)
+	requireCounter(t, 5)
+
+	t.Run("concurrency", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.SaveCumulative(ctx, sample(10, time.Second))
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		requireCounter(t, 10)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		_, err := c.SaveCumulative(ctx, sample(7, 500*time.Millisecond))
+		require.NoError(t, err)
+		requireCounter(t, 10)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		_, err := c.SaveCumulative(ctx, sample(2, 2*time.Second))
+		require.NoError(t, err)
+		requireCounter(t, 12)
+
+		_, err = c.SaveCumulative(ctx, sample(6, 3*time.Second))
+		require.NoError(t, err)
+		requireCounter(t, 16)
+	})
+	t.Run("tenants", func(t *testing.T) {
+		tenantCtx := storage.WithTenant(ctx, "a")
+
+		_, err := c.SaveCumulative(tenantCtx, sample(4, 4*time.Second))
+		require.NoError(t, err)
+
+		got, err := local.Get(ctx, "requests", metrics.NewLabels(
+			metrics.Label{Name: storage.TenantLabel, Value: "a"},
+		))
+		require.NoError(t, err)
+		require.Equal(t, int64(4), got.Int64())
+		requireCounter(t, 16)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, c.Delete(ctx, "requests", nil))
+
+		_, err := c.SaveCumulative(ctx, sample(8, 5*time.Second))
+		require.NoError(t, err)
+		requireCounter(t, 8)
+	})
+
+	t.Run("reset series", func(t *testing.T) {
+		_, err := c.Reset(ctx, "requests", nil)
+		require.NoError(t, err)
+
+		_, err = c.SaveCumulative(ctx, sample(9, 6*time.Second))
+		require.NoError(t, err)
+		requireCounter(t, 9)
+	})
+}
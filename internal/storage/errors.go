@@ -8,4 +8,20 @@ var (
 
 	// ErrNotFound возвращается, когда метрика не найдена.
 	ErrNotFound = errors.New("metric not found")
+
+	// ErrConflict возвращается, если значение метрики в хранилище назначения
+	// не может быть приведено к значению в источнике.
+	ErrConflict = errors.New("conflicting metric")
+
+	// ErrQuotaExceeded возвращается, если сохранение значений превышает
+	// ограничения арендатора.
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+	// ErrReadOnly возвращается при попытке изменить метрики в ведомом
+	// хранилище или хранилище только для чтения.
+	ErrReadOnly = errors.New("storage is a read-only replica")
+
+	// ErrReplicationDisabled возвращается, если хранилище не может быть
+	// источником репликации.
+	ErrReplicationDisabled = errors.New("replication is disabled")
 )
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var _ Storage = (*Expiring)(nil)
+
+// Expiring определяет хранилище, скрывающее при чтении текущих значений
+// метрики, которые не обновлялись дольше ttl. История таких метрик
+// остаётся доступной до их удаления вызовом Expire.
+type Expiring struct {
+	Storage
+	ttl time.Duration
+}
+
+// NewExpiring возвращает хранилище s, скрывающее метрики, которые
+// не обновлялись дольше ttl.
+func NewExpiring(s Storage, ttl time.Duration) *Expiring {
+	return &Expiring{
+		Storage: s,
+		ttl:     ttl,
+	}
+}
+
+// Get реализует интерфейс Storage.
+func (e *Expiring) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	value, err := e.Storage.Get(ctx, name, labels)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+	if e.stale(value, time.Now()) {
+		return metrics.Metric{}, ErrNotFound
+	}
+	return value, nil
+}
+
+// GetAll реализует интерфейс Storage.
+func (e *Expiring) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	values, err := e.Storage.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e.fresh(values), nil
+}
+
+// Select реализует интерфейс Storage.
+func (e *Expiring) Select(ctx context.Context, m Matcher) ([]metrics.Metric, error) {
+	values, err := e.Storage.Select(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	return e.fresh(values), nil
+}
+
+// fresh возвращает метрики values, которые не устарели.
+func (e *Expiring) fresh(values []metrics.Metric) []metrics.Metric {
+	now := time.Now()
+	actuals := values[:0]
+
+	for _, value := range values {
+		if !e.stale(value, now) {
+			actuals = append(actuals, value)
+		}
+	}
+
+	return actuals
+}
+
+// stale возвращает true, если к моменту now метрика не обновлялась
+// дольше ttl; метрики с неизвестным временем обновления не устаревают.
+func (e *Expiring) stale(value metrics.Metric, now time.Time) bool {
+	updated := value.Updated()
+	return !updated.IsZero() && now.Sub(updated) > e.ttl
+}
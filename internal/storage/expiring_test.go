@@ -0,0 +1,50 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestExpiring(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+
+	ctx := testutil.Context(t)
+
+	local, _ := testLocal(t, true, metrics.Counter("counter", 1))
+	store := storage.NewExpiring(local, ttl)
+
+	time.Sleep(2 * ttl)
+
+	_, err := store.Save(ctx, metrics.Gauge("gauge", 1))
+	require.NoError(t, err)
+
+	_, err = store.Get(ctx, "counter", nil)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	got, err := store.Get(ctx, "gauge", nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, got.Float64())
+
+	values, err := store.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	require.Equal(t, "gauge", values[0].Name())
+
+	// NOTE: история устаревшей метрики доступна до её удаления.
+	samples, err := store.Range(ctx, "counter", nil, time.Time{}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+
+	_, err = store.Save(ctx, metrics.Counter("counter", 1))
+	require.NoError(t, err)
+
+	got, err = store.Get(ctx, "counter", nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, got.Int64())
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// feedBuffer определяет размер буфера событий подписчика.
+const feedBuffer = 256
+
+// feed определяет рассылку событий подписчикам внутри процесса.
+type feed[T any] struct {
+	mu     sync.Mutex
+	subs   map[*subscriber[T]]struct{}
+	closed bool
+	done   chan struct{}
+}
+
+// subscriber определяет подписчика на события.
+type subscriber[T any] struct {
+	match func(T) bool
+	ch    chan T
+}
+
+func newFeed[T any]() *feed[T] {
+	return &feed[T]{
+		subs: make(map[*subscriber[T]]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// subscribe возвращает канал событий, для которых match возвращает true;
+// при match == nil в канал отправляются все события. Канал закрывается
+// при отмене ctx или закрытии рассылки.
+func (f *feed[T]) subscribe(ctx context.Context, match func(T) bool) (<-chan T, error) {
+	sub := &subscriber[T]{
+		match: match,
+		ch:    make(chan T, feedBuffer),
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil, ErrStorageClosed
+	}
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.unsubscribe(sub)
+		case <-f.done:
+		}
+	}()
+
+	return sub.ch, nil
+}
+
+// unsubscribe удаляет подписчика и закрывает его канал.
+func (f *feed[T]) unsubscribe(sub *subscriber[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// publish рассылает события подписчикам.
+//
+// NOTE: publish не блокируется: подписчик, буфер которого переполнен,
+// отключается, а его канал закрывается.
+func (f *feed[T]) publish(events ...T) {
+	if len(events) == 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for sub := range f.subs {
+		for _, event := range events {
+			if sub.match != nil && !sub.match(event) {
+				continue
+			}
+			select {
+			case sub.ch <- event:
+				continue
+			default:
+			}
+			delete(f.subs, sub)
+			close(sub.ch)
+			break
+		}
+	}
+}
+
+// reset отключает всех подписчиков, не закрывая рассылку.
+func (f *feed[T]) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for sub := range f.subs {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// close отключает всех подписчиков и закрывает рассылку.
+func (f *feed[T]) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.done)
+
+	for sub := range f.subs {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// watch возвращает канал значений метрик из рассылки f, удовлетворяющих
+// условиям выборки m.
+func watch(ctx context.Context, f *feed[Sample], m Matcher) (<-chan Sample, error) {
+	c, err := m.compile()
+	if err != nil {
+		return nil, err
+	}
+	return f.subscribe(ctx, func(sample Sample) bool {
+		return c.match(sample.Value)
+	})
+}
+
+// changes возвращает сохранённые в момент now значения метрик values
+// по их актуальным значениям actuals, возвращённым Save.
+func changes(now time.Time, values, actuals []metrics.Metric) []Sample {
+	samples := make([]Sample, 0, len(values))
+
+	for i, value := range values {
+		if value.IsEmpty() {
+			continue
+		}
+		// NOTE: для датчиков Save возвращает предыдущее значение.
+		if value.Kind() != metrics.KindGauge {
+			value = actuals[i]
+		}
+		samples = append(samples, Sample{
+			Time:  now,
+			Value: value.WithUpdated(time.Time{}),
+		})
+	}
+
+	return samples
+}
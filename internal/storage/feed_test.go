@@ -0,0 +1,63 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+// testWatch проверяет подписку на сохранённые значения метрик в пустом
+// хранилище s.
+func testWatch(t *testing.T, ctx context.Context, s storage.Storage) {
+	t.Helper()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	samples, err := s.Watch(watchCtx, storage.Matcher{Prefix: "go_"})
+	require.NoError(t, err)
+
+	_, err = s.Save(ctx,
+		metrics.Counter("go_gc_total", 1),
+		metrics.Gauge("http_inflight", 1),
+		metrics.Counter("go_gc_total", 2),
+		metrics.Gauge("go_goroutines", 3),
+	)
+	require.NoError(t, err)
+
+	want := []metrics.Metric{
+		metrics.Counter("go_gc_total", 1),
+		metrics.Counter("go_gc_total", 3),
+		metrics.Gauge("go_goroutines", 3),
+	}
+
+	for _, value := range want {
+		select {
+		case sample, ok := <-samples:
+			require.True(t, ok)
+			require.True(t, value.Equal(sample.Value), sample.Value.GoString())
+			require.False(t, sample.Time.IsZero())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("waiting for %s", value.GoString())
+		}
+	}
+
+	_, err = s.Watch(ctx, storage.Matcher{Regex: "("})
+	require.Error(t, err)
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-samples:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
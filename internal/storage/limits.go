@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var (
+	// ErrNameTooLong возвращается, если имя метрики длиннее допустимого.
+	ErrNameTooLong = errors.New("metric name is too long")
+
+	// ErrNameInvalid возвращается, если имя метрики содержит недопустимые
+	// символы.
+	ErrNameInvalid = errors.New("metric name contains invalid characters")
+
+	// ErrSeriesLimit возвращается, если сохранение метрики превышает
+	// ограничение количества метрик.
+	ErrSeriesLimit = errors.New("series limit exceeded")
+)
+
+// LimitError определяет ошибку сохранения метрики, нарушающей ограничения
+// хранилища.
+type LimitError struct {
+	// Имя отклонённой метрики.
+	Name string
+
+	// Нарушенное ограничение: ErrNameTooLong, ErrNameInvalid
+	// или ErrSeriesLimit.
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("metric %q rejected: %s", e.Name, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// Limits определяет ограничения кардинальности метрик.
+type Limits struct {
+	// Максимальное количество метрик в хранилище.
+	//
+	// При MaxSeries == 0, количество метрик не ограничивается.
+	MaxSeries int
+
+	// Максимальная длина имени метрики в символах.
+	//
+	// При MaxNameLength == 0, длина имени не ограничивается.
+	MaxNameLength int
+
+	// Шаблон допустимого имени метрики.
+	//
+	// При NamePattern == nil, допустимо любое имя.
+	NamePattern *regexp.Regexp
+}
+
+// Cardinality определяет текущую кардинальность метрик.
+type Cardinality struct {
+	// Количество метрик в хранилище.
+	Series int
+
+	// Количество отклонённых значений метрик.
+	Rejected uint64
+}
+
+var _ Storage = (*Limited)(nil)
+
+// Limited определяет хранилище, ограничивающее кардинальность метрик.
+//
+// Save отклоняет значения целиком, если хотя бы одна метрика нарушает
+// ограничения; ошибка в этом случае имеет тип *LimitError.
+type Limited struct {
+	Storage
+	limits Limits
+
+	mu     sync.Mutex
+	series map[string]struct{} // Ключи метрик; nil, если не прочитаны.
+
+	rejected atomic.Uint64
+}
+
+// NewLimited возвращает хранилище s, ограничивающее кардинальность метрик
+// ограничениями limits.
+func NewLimited(s Storage, limits Limits) *Limited {
+	return &Limited{
+		Storage: s,
+		limits:  limits,
+	}
+}
+
+// Cardinality возвращает текущую кардинальность метрик.
+func (l *Limited) Cardinality(ctx context.Context) (Cardinality, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(ctx); err != nil {
+		return Cardinality{}, err
+	}
+
+	return Cardinality{
+		Series:   len(l.series),
+		Rejected: l.rejected.Load(),
+	}, nil
+}
+
+// Save реализует интерфейс Storage.
+func (l *Limited) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.Metric, error) {
+	for _, value := range values {
+		if value.IsEmpty() {
+			continue
+		}
+		if err := l.validate(value.Name()); err != nil {
+			l.reject(values)
+			return nil, err
+		}
+	}
+
+	added, err := l.reserve(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+
+	actuals, err := l.Storage.Save(ctx, values...)
+	if err != nil {
+		l.mu.Lock()
+		l.remove(added)
+		l.mu.Unlock()
+		return nil, err
+	}
+
+	return actuals, nil
+}
+
+// Delete реализует интерфейс Storage.
+func (l *Limited) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	err := l.Storage.Delete(ctx, name, labels)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.remove([]string{metrics.Key(name, labels)})
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Expire реализует интерфейс Storage.
+func (l *Limited) Expire(ctx context.Context, before time.Time) (int, error) {
+	n, err := l.Storage.Expire(ctx, before)
+
+	// NOTE: удалённые метрики неизвестны, поэтому ключи метрик будут
+	// прочитаны из хранилища заново.
+	if n > 0 {
+		l.mu.Lock()
+		l.series = nil
+		l.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// Invalidate сбрасывает учтённые ключи метрик; они будут прочитаны
+// из хранилища заново. Используется, если хранилище изменялось в обход
+// Limited, например, ведущим хранилищем при репликации.
+func (l *Limited) Invalidate() {
+	l.mu.Lock()
+	l.series = nil
+	l.mu.Unlock()
+}
+
+// validate возвращает ошибку, если имя метрики нарушает ограничения.
+func (l *Limited) validate(name string) error {
+	// NOTE: длина имени считается в символах, как в VARCHAR postgres.
+	if l.limits.MaxNameLength > 0 && utf8.RuneCountInString(name) > l.limits.MaxNameLength {
+		return &LimitError{
+			Name: name,
+			Err:  fmt.Errorf("%w: limit %d", ErrNameTooLong, l.limits.MaxNameLength),
+		}
+	}
+	if l.limits.NamePattern != nil && !l.limits.NamePattern.MatchString(name) {
+		return &LimitError{
+			Name: name,
+			Err:  fmt.Errorf("%w: must match %q", ErrNameInvalid, l.limits.NamePattern),
+		}
+	}
+	return nil
+}
+
+// reserve резервирует новые метрики из values и возвращает их ключи.
+//
+// NOTE: ключи метрик учитываются в памяти экземпляра сервера, поэтому
+// метрики, созданные другими экземплярами, учитываются только после
+// повторного чтения ключей из хранилища.
+func (l *Limited) reserve(ctx context.Context, values []metrics.Metric) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(ctx); err != nil {
+		return nil, err
+	}
+
+	var added []string
+
+	for _, value := range values {
+		if value.IsEmpty() {
+			continue
+		}
+		key := value.Key()
+		if _, ok := l.series[key]; ok {
+			continue
+		}
+		if l.limits.MaxSeries > 0 && len(l.series) >= l.limits.MaxSeries {
+			l.remove(added)
+			l.reject(values)
+			return nil, &LimitError{
+				Name: value.Name(),
+				Err:  fmt.Errorf("%w: limit %d", ErrSeriesLimit, l.limits.MaxSeries),
+			}
+		}
+		l.series[key] = struct{}{}
+		added = append(added, key)
+	}
+
+	return added, nil
+}
+
+// load читает ключи метрик из хранилища, если они ещё не прочитаны.
+func (l *Limited) load(ctx context.Context) error {
+	if l.series != nil {
+		return nil
+	}
+
+	values, err := l.Storage.GetAll(ctx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	series := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		series[value.Key()] = struct{}{}
+	}
+	l.series = series
+
+	return nil
+}
+
+// remove удаляет из учёта метрики по ключам.
+func (l *Limited) remove(keys []string) {
+	if l.series == nil {
+		return
+	}
+	for _, key := range keys {
+		delete(l.series, key)
+	}
+}
+
+// reject учитывает отклонённые значения метрик.
+func (l *Limited) reject(values []metrics.Metric) {
+	for _, value := range values {
+		if !value.IsEmpty() {
+			l.rejected.Add(1)
+		}
+	}
+}
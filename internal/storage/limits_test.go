@@ -0,0 +1,100 @@
+package storage_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestLimited(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	t.Run("name", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		store := storage.NewLimited(local, storage.Limits{
+			MaxNameLength: 8,
+			NamePattern:   regexp.MustCompile(`^[a-z_]+$`),
+		})
+
+		testCases := []struct {
+			name    string
+			metric  metrics.Metric
+			wantErr error
+		}{
+			{
+				name:   "valid",
+				metric: metrics.Counter("counter", 1),
+			},
+			{
+				name:    "too long",
+				metric:  metrics.Counter(strings.Repeat("a", 9), 1),
+				wantErr: storage.ErrNameTooLong,
+			},
+			{
+				name:    "invalid",
+				metric:  metrics.Counter("req-1f3a", 1),
+				wantErr: storage.ErrNameInvalid,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := store.Save(ctx, tc.metric)
+				if tc.wantErr == nil {
+					require.NoError(t, err)
+					return
+				}
+
+				var limitErr *storage.LimitError
+				require.ErrorAs(t, err, &limitErr)
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Equal(t, tc.metric.Name(), limitErr.Name)
+
+				_, err = local.Get(ctx, tc.metric.Name(), nil)
+				require.ErrorIs(t, err, storage.ErrNotFound)
+			})
+		}
+	})
+
+	t.Run("series", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+
+		_, err := local.Save(ctx, metrics.Gauge("a", 1))
+		require.NoError(t, err)
+
+		store := storage.NewLimited(local, storage.Limits{MaxSeries: 2})
+
+		_, err = store.Save(ctx, metrics.Gauge("b", 1), metrics.Gauge("a", 2))
+		require.NoError(t, err)
+
+		// NOTE: пакет с новой метрикой отклоняется целиком.
+		_, err = store.Save(ctx, metrics.Gauge("a", 3), metrics.Gauge("c", 1))
+		require.ErrorIs(t, err, storage.ErrSeriesLimit)
+
+		got, err := local.Get(ctx, "a", nil)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, got.Float64())
+
+		// NOTE: метки образуют новую метрику.
+		_, err = store.Save(ctx, metrics.Gauge("a", 1, metrics.Label{Name: "id", Value: "1"}))
+		require.ErrorIs(t, err, storage.ErrSeriesLimit)
+
+		_, err = store.Save(ctx, metrics.Gauge("a", 4))
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(ctx, "b", nil))
+
+		_, err = store.Save(ctx, metrics.Gauge("c", 1))
+		require.NoError(t, err)
+
+		c, err := store.Cardinality(ctx)
+		require.NoError(t, err)
+		require.Equal(t, storage.Cardinality{Series: 2, Rejected: 3}, c)
+	})
+}
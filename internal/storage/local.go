@@ -1,19 +1,15 @@
 package storage
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"hash/crc32"
-	"io"
-	"os"
 	"sort"
+	"strings"
+	"sync"
 	"time"
-	"unicode/utf8"
 
+	"github.com/sergeizaitcev/metrics/internal/configs"
 	"github.com/sergeizaitcev/metrics/internal/metrics"
 )
 
@@ -27,6 +23,45 @@ type LocalOpts struct {
 
 	// Восстановление данных из WAL.
 	Restore bool
+
+	// Индикатор хранилища только для чтения, которое восстанавливается
+	// из WAL без изменения его файлов и отклоняет изменения, снимки
+	// и повышение; Restore, StoreInterval и SnapshotInterval игнорируются.
+	ReadOnly bool
+
+	// Интервал записи снимка хранилища, после которой закрытые сегменты
+	// WAL удаляются.
+	//
+	// При SnapshotInterval == 0, снимки записываются только при вызове
+	// Snapshot.
+	SnapshotInterval time.Duration
+
+	// Размер сегмента WAL, при превышении которого сегмент закрывается
+	// и начинается новый.
+	//
+	// При SegmentSize == 0, WAL состоит из одного сегмента.
+	SegmentSize int64
+
+	// Индикатор ведомого хранилища, которое применяет записи ведущего
+	// хранилища вызовом Follow и не принимает изменений до вызова Promote.
+	Follower bool
+
+	// Количество последних записей WAL, которые хранятся в памяти для
+	// передачи ведомым хранилищам.
+	//
+	// При ReplicationBacklog == 0, хранилище не может быть ведущим.
+	ReplicationBacklog int
+}
+
+// Recovery определяет результат восстановления локального хранилища
+// из WAL.
+type Recovery struct {
+	// Количество прочитанных записей.
+	Records int
+
+	// Количество байт повреждённых или записанных не полностью записей,
+	// которые были отброшены.
+	Dropped int64
 }
 
 var _ Storage = (*Local)(nil)
@@ -34,50 +69,95 @@ var _ Storage = (*Local)(nil)
 // Local определяет локальное храналище метрик, записывающее метрики на диск
 // и хранящее кеш в памяти.
 type Local struct {
-	metrics memstorage
+	metrics *memstorage
+	samples samples
+	rollups rollups
 	wal     *wal
+	feed    *feed[Sample]
 	synced  bool // Индикатор синхронной записи.
 
-	sem chan struct{}
+	readOnly bool // Индикатор хранилища только для чтения.
+
+	// Количество значений истории каждой метрики, записанных в историю
+	// журнала.
+	saved map[string]int
+
+	// Индикатор перезаписи истории журнала при следующем снимке: история
+	// перезаписывается, если из неё удалены значения.
+	rewrite bool
 
-	term         chan struct{}
-	singleflight chan struct{}
+	// Время последнего значения истории каждой метрики, прочитанного
+	// из истории журнала; используется только при восстановлении.
+	restored map[string]time.Time
+
+	recovery Recovery
+
+	log  *replog // Журнал репликации; nil, если репликация отключена.
+	repl replication
+
+	mu *rwlock
+
+	term chan struct{}
+	stop sync.Once
+	wg   sync.WaitGroup
 }
 
 // NewLocal возвращает локальное хранилище метрик.
 func NewLocal(filename string, opts *LocalOpts) (*Local, error) {
-	flags := os.O_RDWR | os.O_CREATE
-	if opts == nil || !opts.Restore {
-		flags |= os.O_TRUNC
+	if opts == nil {
+		opts = &LocalOpts{}
 	}
 
-	fd, err := os.OpenFile(filename, flags, 0o644)
+	var w *wal
+	var err error
+
+	if opts.ReadOnly {
+		w, err = openWALReadOnly(filename)
+	} else {
+		w, err = openWAL(filename, opts.SegmentSize, opts.Restore)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("local: %w", err)
 	}
 
 	local := &Local{
-		metrics: make(memstorage),
-		wal:     &wal{fd: fd},
-		sem:     make(chan struct{}, 1),
+		metrics: newMemstorage(),
+		samples: make(samples),
+		rollups: make(rollups),
+		wal:     w,
+		feed:    newFeed[Sample](),
+		saved:   make(map[string]int),
+		mu:      newRWLock(),
+		term:    make(chan struct{}),
 	}
-	local.unlock()
 
-	if opts != nil && opts.Restore {
+	if opts.Restore || opts.ReadOnly {
 		if err = local.load(); err != nil {
 			local.Close()
 			return nil, err
 		}
 	}
 
-	var interval time.Duration
+	local.synced = opts.StoreInterval == 0
+	local.readOnly = opts.ReadOnly
+	local.repl.follower = opts.Follower || opts.ReadOnly
+	local.repl.backlog = opts.ReplicationBacklog
 
-	if opts != nil {
-		interval = opts.StoreInterval
-		local.synced = interval == 0
+	if opts.ReadOnly {
+		return local, nil
 	}
-	if interval > 0 {
-		go local.flushing(interval)
+
+	if !opts.Follower && opts.ReplicationBacklog > 0 {
+		local.log = newReplog(opts.ReplicationBacklog)
+	}
+
+	if opts.StoreInterval > 0 {
+		local.background(opts.StoreInterval, local.flush)
+	}
+	if opts.SnapshotInterval > 0 {
+		local.background(opts.SnapshotInterval, func() error {
+			return local.Snapshot(context.Background())
+		})
 	}
 
 	return local, nil
@@ -85,33 +165,83 @@ func NewLocal(filename string, opts *LocalOpts) (*Local, error) {
 
 // Ping реализует интерфейс Storage.
 func (l *Local) Ping(ctx context.Context) error {
-	err := l.lockContext(ctx)
+	err := l.mu.rlock(ctx)
 	if err != nil {
 		return err
 	}
-	l.unlock()
+	l.mu.runlock()
 	return nil
 }
 
 // Close реализует интерфейс Storage.
 func (l *Local) Close() error {
-	err := l.lock()
+	// NOTE: Close ждёт завершения фоновых задач до захвата блокировки,
+	// т.к. задачи захватывают её сами.
+	l.stop.Do(func() { close(l.term) })
+	l.wg.Wait()
+	l.feed.close()
+
+	err := l.mu.lock(context.Background())
 	if err != nil {
 		return err
 	}
+	defer l.mu.close()
+
+	err = l.wal.close()
+	if err != nil {
+		return fmt.Errorf("local: %w", err)
+	}
+
+	return nil
+}
+
+// Recovery возвращает результат восстановления хранилища из WAL.
+func (l *Local) Recovery() Recovery {
+	return l.recovery
+}
 
-	l.wal.close()
+// Snapshot записывает снимок хранилища и удаляет закрытые сегменты WAL,
+// которые он покрывает.
+//
+// Снимок содержит только текущие значения метрик и агрегированные значения;
+// история значений дописывается в отдельный файл, который перезаписывается
+// только после удаления из неё устаревших значений.
+func (l *Local) Snapshot(ctx context.Context) error {
+	if l.readOnly {
+		return fmt.Errorf("local: %w", ErrReadOnly)
+	}
 
-	// NOTE: если был запущен flushing в фоне, то Close будет ждать
-	// завершения flushing.
-	if l.term != nil {
-		close(l.term)
+	err := l.lockContext(ctx)
+	if err != nil {
+		return err
 	}
-	if l.singleflight != nil {
-		<-l.singleflight
+	defer l.unlock()
+
+	err = l.compact()
+	if err != nil {
+		return fmt.Errorf("local: writing a snapshot: %w", err)
 	}
 
-	close(l.sem)
+	return nil
+}
+
+// compact записывает снимок хранилища и историю значений, которые ещё
+// не записаны в историю журнала.
+func (l *Local) compact() error {
+	err := l.wal.compact(l.dumpState, l.dumpHistory, l.rewrite)
+	if err != nil {
+		// NOTE: история могла записаться частично, поэтому при следующем
+		// снимке она перезаписывается.
+		l.rewrite = true
+		return err
+	}
+
+	l.saved = make(map[string]int, len(l.samples))
+	for key, values := range l.samples {
+		l.saved[key] = len(values)
+	}
+	l.rewrite = false
+
 	return nil
 }
 
@@ -120,15 +250,42 @@ func (l *Local) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.M
 	if len(values) == 0 {
 		return nil, errors.New("metrics is empty")
 	}
+	if l.isFollower() {
+		return nil, fmt.Errorf("local: %w", ErrReadOnly)
+	}
+
+	actuals, err := l.save(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: синхронная запись выполняется после освобождения блокировки,
+	// чтобы чтение не ожидало синхронизации файла.
+	if l.synced {
+		err = l.wal.flush()
+		if err != nil {
+			return nil, fmt.Errorf("local: synchronous writing to a file: %w", err)
+		}
+	}
 
+	return actuals, nil
+}
+
+// save сохраняет значения метрик в кеш, добавляет операции в буфер WAL
+// и рассылает изменения подписчикам.
+//
+// NOTE: время изменения берётся и изменения рассылаются под блокировкой,
+// чтобы время значений в истории и порядок рассылки соответствовали
+// порядку изменений.
+func (l *Local) save(ctx context.Context, values []metrics.Metric) ([]metrics.Metric, error) {
 	err := l.lockContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer l.unlock()
 
+	now := time.Now()
 	actuals := make([]metrics.Metric, len(values))
-	var written bool
 
 	for i, value := range values {
 		if value.IsEmpty() {
@@ -141,44 +298,50 @@ func (l *Local) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.M
 		}
 
 		switch value.Kind() {
-		case metrics.KindCounter:
-			err = l.write(operationAdd, value)
+		case metrics.KindCounter, metrics.KindHistogram, metrics.KindSummary:
+			err = l.write(operationAdd, now, value)
 			if err != nil {
 				return nil, fmt.Errorf("local: writing an add operation: %w", err)
 			}
-			actuals[i] = l.metrics.add(value)
+			actuals[i] = l.metrics.add(value, now)
+			l.samples.append(now, actuals[i])
 		case metrics.KindGauge:
-			err = l.write(operationUpdate, value)
+			err = l.write(operationUpdate, now, value)
 			if err != nil {
 				return nil, fmt.Errorf("local: writing an update operation: %w", err)
 			}
-			actuals[i] = l.metrics.update(value)
+			actuals[i] = l.metrics.update(value, now)
+			l.samples.append(now, value)
 		}
-
-		written = true
 	}
 
-	if l.synced && written {
-		err = l.wal.flush()
-		if err != nil {
-			return nil, fmt.Errorf("local: synchronous writing to a file: %w", err)
-		}
-	}
+	l.feed.publish(changes(now, values, actuals)...)
 
 	return actuals, nil
 }
 
+// Watch реализует интерфейс Storage.
+func (l *Local) Watch(ctx context.Context, m Matcher) (<-chan Sample, error) {
+	ch, err := watch(ctx, l.feed, m)
+	if err != nil {
+		return nil, fmt.Errorf("local: %w", err)
+	}
+	return ch, nil
+}
+
 // Get реализует интерфейс Storage.
-func (l *Local) Get(ctx context.Context, name string) (metrics.Metric, error) {
-	// FIXME: при большом количестве чтения необходимо
-	// реализовать RLOCK.
-	err := l.lockContext(ctx)
+func (l *Local) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	err := l.mu.rlock(ctx)
 	if err != nil {
 		return metrics.Metric{}, err
 	}
 
-	actual := l.metrics.get(name)
-	l.unlock()
+	actual := l.metrics.get(metrics.Key(name, labels))
+	l.mu.runlock()
 
 	if actual.IsEmpty() {
 		return metrics.Metric{}, ErrNotFound
@@ -189,389 +352,814 @@ func (l *Local) Get(ctx context.Context, name string) (metrics.Metric, error) {
 
 // GetAll реализует интерфейс Storage.
 func (l *Local) GetAll(ctx context.Context) ([]metrics.Metric, error) {
-	// FIXME: при большом количестве чтения необходимо
-	// реализовать RLOCK.
-	err := l.lockContext(ctx)
+	err := l.mu.rlock(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	values := l.metrics.getAll()
-	l.unlock()
-
-	sort.SliceStable(values, func(i, j int) bool {
-		return values[i].Name() < values[j].Name()
-	})
+	l.mu.runlock()
 
 	return values, nil
 }
 
-func (l *Local) lockContext(ctx context.Context) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case _, ok := <-l.sem:
-		if !ok {
-			return ErrStorageClosed
-		}
+// Select реализует интерфейс Storage.
+func (l *Local) Select(ctx context.Context, m Matcher) ([]metrics.Metric, error) {
+	c, err := m.compile()
+	if err != nil {
+		return nil, fmt.Errorf("local: %w", err)
 	}
-	return nil
-}
 
-func (l *Local) lock() error {
-	return l.lockContext(context.Background())
-}
+	err = l.mu.rlock(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-func (l *Local) unlock() {
-	l.sem <- struct{}{}
+	values := l.metrics.selectBy(c)
+	l.mu.runlock()
+
+	return values, nil
 }
 
-// load загружает метрики из файла в кеш.
-func (l *Local) load() error {
-	err := l.lock()
+// Delete реализует интерфейс Storage.
+func (l *Local) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	if l.isFollower() {
+		return fmt.Errorf("local: %w", ErrReadOnly)
+	}
+
+	err := l.delete(ctx, metrics.Key(name, labels))
 	if err != nil {
 		return err
 	}
-	defer l.unlock()
 
-	err = l.wal.readAll(l.read)
-	if err != nil {
-		return fmt.Errorf("local: reading records from a file: %w", err)
+	if l.synced {
+		err = l.wal.flush()
+		if err != nil {
+			return fmt.Errorf("local: synchronous writing to a file: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// read читает метрику в файла и записывает в кеш.
-func (l *Local) read(e record) error {
-	err := l.metrics.conflict(e.metric)
+// delete удаляет метрику и её историю из кеша и добавляет операцию
+// удаления в буфер WAL.
+func (l *Local) delete(ctx context.Context, key string) error {
+	err := l.lockContext(ctx)
 	if err != nil {
-		return fmt.Errorf("conflicting metrics: %w", err)
+		return err
 	}
+	defer l.unlock()
 
-	switch e.op {
-	case operationAdd:
-		l.metrics.add(e.metric)
-	case operationUpdate:
-		l.metrics.update(e.metric)
+	actual := l.metrics.get(key)
+	if actual.IsEmpty() {
+		return ErrNotFound
+	}
+
+	err = l.write(operationDelete, time.Now(), actual.Zero())
+	if err != nil {
+		return fmt.Errorf("local: writing a delete operation: %w", err)
 	}
 
+	l.remove(key)
+
 	return nil
 }
 
-// write записывает метрику на диск.
-func (l *Local) write(op operation, value metrics.Metric) error {
-	e := record{op, value}
+// Reset реализует интерфейс Storage.
+func (l *Local) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	if l.isFollower() {
+		return metrics.Metric{}, fmt.Errorf("local: %w", ErrReadOnly)
+	}
 
-	err := l.wal.append(e)
+	actual, err := l.reset(ctx, metrics.Key(name, labels))
 	if err != nil {
-		return fmt.Errorf("adding an entry to the buffer: %w", err)
+		return metrics.Metric{}, err
 	}
 
-	return nil
+	if l.synced {
+		err = l.wal.flush()
+		if err != nil {
+			return metrics.Metric{}, fmt.Errorf("local: synchronous writing to a file: %w", err)
+		}
+	}
+
+	return actual, nil
 }
 
-// flush сбрасывает буфер с метриками на диск.
-func (l *Local) flush() error {
-	err := l.lock()
+// reset сбрасывает значение метрики в кеше, добавляет нулевое значение
+// в историю и операцию сброса в буфер WAL.
+func (l *Local) reset(ctx context.Context, key string) (metrics.Metric, error) {
+	err := l.lockContext(ctx)
 	if err != nil {
-		return err
+		return metrics.Metric{}, err
 	}
 	defer l.unlock()
 
-	err = l.wal.flush()
+	actual := l.metrics.get(key)
+	if actual.IsEmpty() {
+		return metrics.Metric{}, ErrNotFound
+	}
+
+	now := time.Now()
+	zero := actual.Zero()
+
+	err = l.write(operationReset, now, zero)
 	if err != nil {
-		return fmt.Errorf("local: writing buffered records to a file: %w", err)
+		return metrics.Metric{}, fmt.Errorf("local: writing a reset operation: %w", err)
 	}
 
-	return nil
+	l.metrics.update(zero, now)
+	l.samples.append(now, zero)
+
+	return actual, nil
 }
 
-func (l *Local) flushing(d time.Duration) {
-	err := l.lock()
+// Range реализует интерфейс Storage.
+func (l *Local) Range(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]Sample, error) {
+	err := l.mu.rlock(ctx)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	if l.term == nil {
-		l.term = make(chan struct{})
-	}
-	if l.singleflight == nil {
-		l.singleflight = make(chan struct{})
+	values := l.samples.between(metrics.Key(name, labels), from, to)
+	l.mu.runlock()
+
+	if len(values) == 0 {
+		return nil, ErrNotFound
 	}
 
-	l.unlock()
+	return values, nil
+}
+
+// Rollups реализует интерфейс Storage.
+func (l *Local) Rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]Rollup, error) {
+	err := l.mu.rlock(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	ticker := time.NewTicker(d)
-	defer ticker.Stop()
+	values := l.rollups.between(resolution, metrics.Key(name, labels), from, to)
+	l.mu.runlock()
 
-	for {
-		select {
-		case <-l.term:
-			// NOTE: дополнительного вызова flush не требуется,
-			// т.к. хранилище при закрытии выполняет flush.
-			close(l.singleflight)
-			return
-		case <-ticker.C:
-			l.flush()
-		}
+	if len(values) == 0 {
+		return nil, ErrNotFound
 	}
+
+	return values, nil
 }
 
-// memstorage определяет храналище метрик в памяти.
-type memstorage map[string]metrics.Metric
+// Retain реализует интерфейс Storage.
+//
+// NOTE: удалённые значения остаются в закрытых сегментах WAL до записи
+// следующего снимка и восстанавливаются при чтении журнала; они удаляются
+// повторно при следующем вызове Retain.
+//
+// Ведомое хранилище только удаляет устаревшую историю, а агрегированные
+// значения получает от ведущего хранилища.
+func (l *Local) Retain(
+	ctx context.Context,
+	retention configs.Retention,
+	now time.Time,
+) error {
+	if retention.IsEmpty() {
+		return nil
+	}
+	if l.isFollower() {
+		return l.prune(ctx, retention, now)
+	}
 
-// conflict возвращает ошибку, если метрика конфликтует с уже записанными
-// метриками.
-func (s memstorage) conflict(value metrics.Metric) error {
-	actual, ok := s[value.Name()]
-	if ok && actual.Kind() != value.Kind() {
-		return fmt.Errorf("expected to get a metric kind %s, got %s",
-			actual.Kind(), value.Kind(),
-		)
+	err := l.retain(ctx, retention, now)
+	if err != nil {
+		return err
+	}
+
+	if l.synced {
+		err = l.wal.flush()
+		if err != nil {
+			return fmt.Errorf("local: synchronous writing to a file: %w", err)
+		}
 	}
+
 	return nil
 }
 
-// add увеличивает значение метрики и возвращает актуальное значение.
-func (s memstorage) add(value metrics.Metric) metrics.Metric {
-	oldValue, ok := s[value.Name()]
-	if !ok {
-		s[value.Name()] = value
-		return value
+// retain агрегирует и удаляет историю метрик в кеше и добавляет
+// агрегированные значения в буфер WAL.
+func (l *Local) retain(
+	ctx context.Context,
+	retention configs.Retention,
+	now time.Time,
+) error {
+	err := l.lockContext(ctx)
+	if err != nil {
+		return err
 	}
+	defer l.unlock()
 
-	value = metrics.Counter(value.Name(), value.Int64()+oldValue.Int64())
-	s[value.Name()] = value
+	rawFrom := now.Add(-retention.Raw)
 
-	return value
-}
+	for _, tier := range retention.Tiers {
+		until := now.Truncate(tier.Resolution)
 
-// update обновляет значение метрики и возвращает предыдущее.
-func (s memstorage) update(value metrics.Metric) metrics.Metric {
-	oldValue := s[value.Name()]
-	s[value.Name()] = value
-	return oldValue
-}
+		for key, values := range l.samples {
+			if len(values) == 0 || !downsampled(values[0].Value.Kind()) {
+				continue
+			}
 
-// get возвращает метрику.
-func (s memstorage) get(name string) metrics.Metric {
-	return s[name]
-}
+			var (
+				prev metrics.Metric
+				from time.Time
+			)
+
+			// NOTE: история агрегируется с первого значения, если уровень
+			// ещё не содержит агрегированных значений, чтобы значения
+			// старше rawFrom не удалялись без агрегирования.
+			if last, ok := l.rollups.last(tier.Resolution, key); ok {
+				prev = last.Value
+				from = last.Time.Add(tier.Resolution)
+			}
 
-// getAll возвращает все метрики.
-func (s memstorage) getAll() []metrics.Metric {
-	values := make([]metrics.Metric, 0, len(s))
-	for _, metric := range s {
-		values = append(values, metric)
-	}
-	return values
-}
+			i := sort.Search(len(values), func(i int) bool {
+				return !values[i].Time.Before(from)
+			})
+			if i > 0 {
+				prev = values[i-1].Value
+			}
 
-var (
-	separator    = '\xb1'
-	separatorLen = utf8.RuneLen(separator)
-)
+			for _, rollup := range downsample(values[i:], prev, tier.Resolution, until) {
+				rollup := rollup
 
-type operation uint8
+				err = l.append(record{
+					op:     operationRollup,
+					time:   rollup.Time,
+					metric: rollup.Value,
+					rollup: &rollup,
+				})
+				if err != nil {
+					return fmt.Errorf("local: writing a rollup operation: %w", err)
+				}
 
-const (
-	operationUnknown operation = iota
-	operationAdd
-	operationUpdate
-)
+				l.rollups.append(rollup)
+			}
+		}
 
-var operations = []operation{
-	operationUnknown,
-	operationAdd,
-	operationUpdate,
+		l.rollups.expire(tier.Resolution, now.Add(-tier.TTL))
+	}
+
+	if l.samples.expire(rawFrom) {
+		l.rewrite = true
+	}
+
+	return nil
 }
 
-func validate(op operation) error {
-	if op > 0 && int(op) < len(operations) {
-		v := operations[op]
-		if v != operationUnknown {
-			return nil
+// Expire реализует интерфейс Storage.
+//
+// Ведомое хранилище не удаляет метрики само: удаления передаются ему
+// ведущим хранилищем.
+func (l *Local) Expire(ctx context.Context, before time.Time) (int, error) {
+	if l.isFollower() {
+		return 0, nil
+	}
+
+	n, err := l.expire(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	if l.synced && n > 0 {
+		err = l.wal.flush()
+		if err != nil {
+			return 0, fmt.Errorf("local: synchronous writing to a file: %w", err)
 		}
 	}
-	return errors.New("operation is unknown")
-}
 
-type record struct {
-	op     operation
-	metric metrics.Metric
+	return n, nil
 }
 
-func (r record) MarshalBinary() ([]byte, error) {
-	data, err := r.metric.MarshalBinary()
+// expire удаляет из кеша метрики, которые не обновлялись с момента before,
+// и добавляет операции удаления в буфер WAL.
+func (l *Local) expire(ctx context.Context, before time.Time) (int, error) {
+	err := l.lockContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("converting a metric to bytes: %w", err)
+		return 0, err
 	}
+	defer l.unlock()
 
-	var buf [binary.MaxVarintLen64]byte
-	n := binary.PutUvarint(buf[:], uint64(len(data)))
+	now := time.Now()
+	n := 0
 
-	start := 4
-	end := start + n + len(data) + 1
+	for key, value := range l.metrics.values {
+		if !value.Updated().Before(before) {
+			continue
+		}
 
-	b := make([]byte, start, end)
-	b = append(b, byte(r.op))
-	b = append(b, buf[:n]...)
-	b = append(b, data...)
+		err = l.write(operationDelete, now, value.Zero())
+		if err != nil {
+			return n, fmt.Errorf("local: writing a delete operation: %w", err)
+		}
 
-	crc := crc32.NewIEEE()
-	crc.Write(b[start:])
-	binary.BigEndian.PutUint32(b, crc.Sum32())
+		l.remove(key)
+		n++
+	}
 
-	return b, nil
+	return n, nil
 }
 
-func (r *record) UnmarshalBinary(data []byte) error {
-	if len(data) < 6 {
-		return errors.New("record too small")
-	}
+func (l *Local) lockContext(ctx context.Context) error {
+	return l.mu.lock(ctx)
+}
+
+func (l *Local) lock() error {
+	return l.lockContext(context.Background())
+}
 
-	op := operation(data[4])
-	if err := validate(op); err != nil {
+func (l *Local) unlock() {
+	l.mu.unlock()
+}
+
+// load загружает метрики из файла в кеш.
+func (l *Local) load() error {
+	err := l.lock()
+	if err != nil {
 		return err
 	}
+	defer l.unlock()
+
+	l.restored = make(map[string]time.Time)
+	defer func() { l.restored = nil }()
 
-	size, n := binary.Uvarint(data[5:])
-	if size <= 0 || len(data[5:])-n < int(size) {
-		return errors.New("record is corrupted")
+	l.recovery, err = l.wal.readAll(l.read)
+	if err != nil {
+		return fmt.Errorf("local: reading records from a file: %w", err)
 	}
 
-	start := 4
-	end := start + n + int(size) + 1
+	// NOTE: история в памяти включает значения из сегментов, которых нет
+	// в истории журнала, поэтому при следующем снимке она перезаписывается.
+	l.rewrite = true
 
-	sum := binary.BigEndian.Uint32(data[:start])
-	crc := crc32.NewIEEE()
-	crc.Write(data[start:end])
+	return nil
+}
 
-	if sum != crc.Sum32() {
-		return errors.New("invalid record")
+// read читает метрику в файла и записывает в кеш.
+func (l *Local) read(e record) error {
+	switch e.op {
+	case operationRollup:
+		l.rollups.append(*e.rollup)
+		return nil
+	case operationSample:
+		l.samples.append(e.time, e.metric)
+		if l.restored != nil {
+			l.restored[e.metric.Key()] = e.time
+		}
+		return nil
+	case operationDelete:
+		l.remove(e.metric.Key())
+		return nil
 	}
 
-	var metric metrics.Metric
-
-	err := metric.UnmarshalBinary(data[end-int(size) : end])
+	err := l.metrics.conflict(e.metric)
 	if err != nil {
-		return err
+		return fmt.Errorf("conflicting metrics: %w", err)
+	}
+
+	// NOTE: метрики, записанные до появления времени обновления, считаются
+	// обновлёнными в момент восстановления.
+	updated := e.time
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	var actual metrics.Metric
+
+	switch e.op {
+	case operationAdd:
+		actual = l.metrics.add(e.metric, updated)
+	case operationUpdate, operationReset:
+		l.metrics.update(e.metric, updated)
+		actual = e.metric
+	case operationState:
+		l.metrics.update(e.metric, updated)
+		return nil
+	}
+
+	// NOTE: записи, сделанные до появления истории, не содержат времени
+	// и в историю не попадают.
+	if e.time.IsZero() {
+		return nil
 	}
 
-	*r = record{
-		op:     op,
-		metric: metric,
+	// NOTE: при сбое во время снимка сегменты, значения которых уже
+	// записаны в историю журнала, не удаляются, поэтому значения не позднее
+	// последнего значения истории пропускаются.
+	if last, ok := l.restored[e.metric.Key()]; ok && !e.time.After(last) {
+		return nil
 	}
 
+	l.samples.append(e.time, actual)
+
 	return nil
 }
 
-// wal определяет файл для упреждающей журнализации.
-type wal struct {
-	buf bytes.Buffer
-	fd  *os.File
+// remove удаляет метрику по ключу вместе с её историей из кеша.
+func (l *Local) remove(key string) {
+	l.metrics.remove(key)
+	delete(l.samples, key)
+	if l.saved[key] > 0 {
+		l.rewrite = true
+	}
+	delete(l.saved, key)
+	for _, tier := range l.rollups {
+		delete(tier, key)
+	}
 }
 
-// close сбрасывает содержимое буфера в конец файла и закрывает его.
-func (w *wal) close() error {
-	err := w.flush()
+// dump передаёт в f записи, из которых восстанавливается текущее состояние
+// хранилища вместе с историей значений.
+func (l *Local) dump(f func(record) error) error {
+	err := l.dumpState(f)
 	if err != nil {
-		return fmt.Errorf("writing buffered record to a file: %w", err)
+		return err
 	}
 
-	err = w.fd.Close()
-	if err != nil {
-		return fmt.Errorf("closing a file: %w", err)
+	for _, values := range l.samples {
+		err = dumpSamples(values, f)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// flush сбрасывает содержимое буфера в конец файла.
-func (w *wal) flush() error {
-	if w.buf.Len() == 0 {
-		return nil
+// dumpHistory передаёт в f записи значений истории, которые ещё не записаны
+// в историю журнала, или всей истории, если её требуется перезаписать.
+func (l *Local) dumpHistory(f func(record) error) error {
+	for key, values := range l.samples {
+		if !l.rewrite {
+			values = values[l.saved[key]:]
+		}
+		err := dumpSamples(values, f)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	_, err := w.fd.Seek(0, io.SeekEnd)
-	if err != nil {
-		return fmt.Errorf("offset to the end: %w", err)
+// dumpSamples передаёт в f записи значений истории.
+func dumpSamples(values []Sample, f func(record) error) error {
+	for _, sample := range values {
+		err := f(record{op: operationSample, time: sample.Time, metric: sample.Value})
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	_, err = w.buf.WriteTo(w.fd)
-	if err != nil {
-		return fmt.Errorf("writing to a file: %w", err)
+// dumpState передаёт в f записи текущих значений метрик и агрегированных
+// значений.
+func (l *Local) dumpState(f func(record) error) error {
+	for _, value := range l.metrics.values {
+		err := f(record{op: operationState, time: value.Updated(), metric: value})
+		if err != nil {
+			return err
+		}
 	}
 
-	w.buf.Reset()
+	for _, tier := range l.rollups {
+		for _, values := range tier {
+			for i := range values {
+				err := f(record{
+					op:     operationRollup,
+					time:   values[i].Time,
+					metric: values[i].Value,
+					rollup: &values[i],
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
 
-	err = w.fd.Sync()
+	return nil
+}
+
+// write записывает метрику на диск.
+func (l *Local) write(op operation, t time.Time, value metrics.Metric) error {
+	e := record{op: op, time: t, metric: value}
+
+	err := l.append(e)
 	if err != nil {
-		return fmt.Errorf("file synchronization: %w", err)
+		return fmt.Errorf("adding an entry to the buffer: %w", err)
 	}
 
 	return nil
 }
 
-// append добавляет запись в конец буфера.
-func (w *wal) append(r record) error {
-	b, err := r.MarshalBinary()
+// append добавляет запись в буфер WAL и в журнал репликации.
+func (l *Local) append(e record) error {
+	b, err := e.MarshalBinary()
 	if err != nil {
 		return fmt.Errorf("converting a record to bytes: %w", err)
 	}
 
-	w.buf.Write(b)
-	w.buf.WriteRune(separator)
+	l.wal.append(b)
+	if l.log != nil {
+		l.log.append(b)
+	}
 
 	return nil
 }
 
-// readAll считывает хранимые в файле записи и передает их в f.
-func (w *wal) readAll(f func(record) error) error {
-	_, err := w.fd.Seek(0, io.SeekStart)
+// flush сбрасывает буфер с метриками на диск.
+func (l *Local) flush() error {
+	err := l.wal.flush()
 	if err != nil {
-		return fmt.Errorf("offset to the beginning: %w", err)
+		return fmt.Errorf("local: writing buffered records to a file: %w", err)
 	}
 
-	err = scan(w.fd, f)
-	if err != nil {
-		return fmt.Errorf("scanning a file: %w", err)
-	}
+	return nil
+}
 
+// background периодически выполняет f в фоне до закрытия хранилища.
+func (l *Local) background(d time.Duration, f func() error) {
+	l.wg.Add(1)
+
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.term:
+				// NOTE: дополнительного вызова flush не требуется,
+				// т.к. хранилище при закрытии выполняет flush.
+				return
+			case <-ticker.C:
+				_ = f()
+			}
+		}
+	}()
+}
+
+// memstorage определяет храналище метрик в памяти, ключом которого является
+// имя метрики вместе с её метками.
+type memstorage struct {
+	values map[string]metrics.Metric
+	keys   []string // Отсортированные ключи метрик.
+}
+
+func newMemstorage() *memstorage {
+	return &memstorage{values: make(map[string]metrics.Metric)}
+}
+
+// conflict возвращает ошибку, если метрика конфликтует с уже записанными
+// метриками.
+func (s *memstorage) conflict(value metrics.Metric) error {
+	actual, ok := s.values[value.Key()]
+	if !ok {
+		return nil
+	}
+	if actual.Kind() != value.Kind() {
+		return fmt.Errorf("expected to get a metric kind %s, got %s",
+			actual.Kind(), value.Kind(),
+		)
+	}
+	switch value.Kind() {
+	case metrics.KindHistogram:
+		return actual.Histogram().Compatible(value.Histogram())
+	case metrics.KindSummary:
+		return actual.Summary().Compatible(value.Summary())
+	}
 	return nil
 }
 
-func scan(r io.Reader, f func(record) error) error {
-	scanner := bufio.NewScanner(r)
-	scanner.Split(split)
+// add увеличивает значение счётчика или объединяет значения гистограмм
+// и сводок, устанавливает время обновления t и возвращает актуальное
+// значение.
+func (s *memstorage) add(value metrics.Metric, t time.Time) metrics.Metric {
+	key := value.Key()
+
+	oldValue, ok := s.values[key]
+	if !ok {
+		value = value.WithUpdated(t)
+		s.put(key, value)
+		return value
+	}
+
+	switch value.Kind() {
+	case metrics.KindCounter:
+		value = metrics.Counter(
+			value.Name(),
+			value.Int64()+oldValue.Int64(),
+			value.Labels()...,
+		)
+	case metrics.KindHistogram:
+		// NOTE: совместимость гистограмм проверяется в conflict.
+		h := oldValue.Histogram().Clone()
+		_ = h.Merge(value.Histogram())
+		value = metrics.Histogram(value.Name(), h, value.Labels()...)
+	case metrics.KindSummary:
+		// NOTE: совместимость скетчей проверяется в conflict.
+		sketch := oldValue.Summary().Clone()
+		_ = sketch.Merge(value.Summary())
+		value = metrics.Summary(value.Name(), sketch, value.Labels()...)
+	}
 
-	for scanner.Scan() {
-		var e record
+	value = value.WithUpdated(t)
+	s.values[key] = value
 
-		err := e.UnmarshalBinary(scanner.Bytes())
-		if err != nil {
-			return err
+	return value
+}
+
+// update обновляет значение метрики, устанавливает время обновления t
+// и возвращает предыдущее значение.
+func (s *memstorage) update(value metrics.Metric, t time.Time) metrics.Metric {
+	key := value.Key()
+	oldValue := s.values[key]
+	s.put(key, value.WithUpdated(t))
+	return oldValue
+}
+
+// put сохраняет метрику по ключу и добавляет ключ в индекс.
+func (s *memstorage) put(key string, value metrics.Metric) {
+	if _, ok := s.values[key]; !ok {
+		i := sort.SearchStrings(s.keys, key)
+		s.keys = append(s.keys, "")
+		copy(s.keys[i+1:], s.keys[i:])
+		s.keys[i] = key
+	}
+	s.values[key] = value
+}
+
+// remove удаляет метрику по ключу вместе с ключом из индекса.
+func (s *memstorage) remove(key string) {
+	if _, ok := s.values[key]; !ok {
+		return
+	}
+	i := sort.SearchStrings(s.keys, key)
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+	delete(s.values, key)
+}
+
+// get возвращает метрику по ключу.
+func (s *memstorage) get(key string) metrics.Metric {
+	return s.values[key]
+}
+
+// getAll возвращает все метрики в порядке возрастания ключа.
+func (s *memstorage) getAll() []metrics.Metric {
+	values := make([]metrics.Metric, 0, len(s.keys))
+	for _, key := range s.keys {
+		values = append(values, s.values[key])
+	}
+	return values
+}
+
+// selectBy возвращает метрики, удовлетворяющие условиям выборки,
+// в порядке возрастания ключа.
+//
+// NOTE: ключ метрики начинается с её имени, поэтому метрики с общим
+// префиксом имени занимают в индексе непрерывный диапазон.
+func (s *memstorage) selectBy(m *matcher) []metrics.Metric {
+	prefix := m.prefix()
+
+	var values []metrics.Metric
+
+	for i := sort.SearchStrings(s.keys, prefix); i < len(s.keys); i++ {
+		key := s.keys[i]
+		if !strings.HasPrefix(key, prefix) {
+			break
 		}
+		if value := s.values[key]; m.match(value) {
+			values = append(values, value)
+		}
+	}
 
-		if err = f(e); err != nil {
-			return err
+	return values
+}
+
+// samples определяет историю значений метрик в памяти, ключом которой
+// является имя метрики вместе с её метками.
+type samples map[string][]Sample
+
+// append добавляет в историю значение метрики в момент времени t.
+func (s samples) append(t time.Time, value metrics.Metric) {
+	key := value.Key()
+	s[key] = append(s[key], Sample{Time: t, Value: value.WithUpdated(time.Time{})})
+}
+
+// between возвращает копию значений метрики по ключу в полуинтервале
+// [from, to).
+func (s samples) between(key string, from, to time.Time) []Sample {
+	values := s[key]
+
+	i := sort.Search(len(values), func(i int) bool {
+		return !values[i].Time.Before(from)
+	})
+	j := sort.Search(len(values), func(j int) bool {
+		return !values[j].Time.Before(to)
+	})
+	if i >= j {
+		return nil
+	}
+
+	return append([]Sample(nil), values[i:j]...)
+}
+
+// expire удаляет значения, сохранённые до момента t, и возвращает true,
+// если какие-либо значения были удалены.
+func (s samples) expire(t time.Time) bool {
+	var expired bool
+	for key, values := range s {
+		i := sort.Search(len(values), func(i int) bool {
+			return !values[i].Time.Before(t)
+		})
+		if i == len(values) {
+			delete(s, key)
+		} else if i > 0 {
+			s[key] = append([]Sample(nil), values[i:]...)
 		}
+		expired = expired || i > 0
 	}
+	return expired
+}
 
-	return scanner.Err()
+// rollups определяет агрегированные значения метрик в памяти по уровням
+// хранения, ключом которых является имя метрики вместе с её метками.
+type rollups map[time.Duration]map[string][]Rollup
+
+// append добавляет агрегированные значения метрики.
+func (r rollups) append(rollup Rollup) {
+	tier, ok := r[rollup.Resolution]
+	if !ok {
+		tier = make(map[string][]Rollup)
+		r[rollup.Resolution] = tier
+	}
+	key := rollup.Value.Key()
+	tier[key] = append(tier[key], rollup)
 }
 
-func split(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return
+// last возвращает последние агрегированные значения метрики по ключу.
+func (r rollups) last(resolution time.Duration, key string) (Rollup, bool) {
+	values := r[resolution][key]
+	if len(values) == 0 {
+		return Rollup{}, false
 	}
-	n := bytes.IndexRune(data, separator)
-	if n > 0 {
-		return n + separatorLen, data[0:n], nil
+	return values[len(values)-1], true
+}
+
+// between возвращает копию агрегированных значений метрики по ключу,
+// начало интервала которых попадает в полуинтервал [from, to).
+func (r rollups) between(resolution time.Duration, key string, from, to time.Time) []Rollup {
+	values := r[resolution][key]
+
+	i := sort.Search(len(values), func(i int) bool {
+		return !values[i].Time.Before(from)
+	})
+	j := sort.Search(len(values), func(j int) bool {
+		return !values[j].Time.Before(to)
+	})
+	if i >= j {
+		return nil
 	}
-	if atEOF {
-		return len(data), data, nil
+
+	return append([]Rollup(nil), values[i:j]...)
+}
+
+// expire удаляет агрегированные значения уровня resolution, интервал
+// которых начался до момента t.
+func (r rollups) expire(resolution time.Duration, t time.Time) {
+	tier := r[resolution]
+	for key, values := range tier {
+		i := sort.Search(len(values), func(i int) bool {
+			return !values[i].Time.Before(t)
+		})
+		if i == len(values) {
+			delete(tier, key)
+		} else if i > 0 {
+			tier[key] = append([]Rollup(nil), values[i:]...)
+		}
 	}
-	return
 }
@@ -1,12 +1,19 @@
 package storage_test
 
 import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/sergeizaitcev/metrics/internal/configs"
 	"github.com/sergeizaitcev/metrics/internal/metrics"
 	"github.com/sergeizaitcev/metrics/internal/storage"
 	"github.com/sergeizaitcev/metrics/pkg/testutil"
@@ -87,7 +94,7 @@ func TestStorage_reopen(t *testing.T) {
 	t.Cleanup(func() { opened.Close() })
 
 	for _, metric := range want {
-		got, err := opened.Get(ctx, metric.Name())
+		got, err := opened.Get(ctx, metric.Name(), metric.Labels())
 		require.NoError(t, err)
 
 		require.True(
@@ -195,7 +202,7 @@ func TestLocal(t *testing.T) {
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				got, err := storage.Get(ctx, tc.metric)
+				got, err := storage.Get(ctx, tc.metric, nil)
 				if tc.wantError {
 					require.Error(t, err)
 				} else {
@@ -220,4 +227,905 @@ func TestLocal(t *testing.T) {
 		require.True(t, want[0].Equal(got[1]))
 		require.True(t, want[1].Equal(got[0]))
 	})
+
+	t.Run("select", func(t *testing.T) {
+		store, _ := testLocal(t, true)
+		testSelect(t, ctx, store)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		store, _ := testLocal(t, true)
+		testWatch(t, ctx, store)
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		hostA := metrics.Label{Name: "host", Value: "a"}
+		hostB := metrics.Label{Name: "host", Value: "b"}
+
+		storage, _ := testLocal(
+			t,
+			false,
+			metrics.Counter("counter", 1, hostA),
+			metrics.Counter("counter", 2, hostB),
+			metrics.Counter("counter", 3),
+			metrics.Counter("counter", 1, hostA),
+		)
+
+		got, err := storage.Get(ctx, "counter", metrics.NewLabels(hostA))
+		require.NoError(t, err)
+		want := metrics.Counter("counter", 2, hostA)
+		require.True(t, want.Equal(got))
+
+		got, err = storage.Get(ctx, "counter", metrics.NewLabels(hostB))
+		require.NoError(t, err)
+		want = metrics.Counter("counter", 2, hostB)
+		require.True(t, want.Equal(got))
+
+		got, err = storage.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		want = metrics.Counter("counter", 3)
+		require.True(t, want.Equal(got))
+
+		_, err = storage.Save(ctx, metrics.Gauge("counter", 1, hostA))
+		require.Error(t, err)
+
+		_, err = storage.Save(ctx, metrics.Gauge("counter", 1, metrics.Label{Name: "host", Value: "c"}))
+		require.NoError(t, err)
+
+		values, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 4)
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		bounds := []float64{1, 2}
+
+		h1, _ := metrics.NewHistogramValue(bounds)
+		h1.Observe(0.5)
+
+		h2, _ := metrics.NewHistogramValue(bounds)
+		h2.Observe(3)
+
+		store, name := testLocal(t, true, metrics.Histogram("histogram", h1))
+
+		got, err := store.Save(ctx, metrics.Histogram("histogram", h2))
+		require.NoError(t, err)
+
+		want, _ := metrics.NewHistogramValue(bounds)
+		want.Observe(0.5)
+		want.Observe(3)
+		require.True(t, want.Equal(got[0].Histogram()))
+
+		mismatch, _ := metrics.NewHistogramValue([]float64{1})
+		mismatch.Observe(1)
+
+		_, err = store.Save(ctx, metrics.Histogram("histogram", mismatch))
+		require.Error(t, err)
+
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		actual, err := opened.Get(ctx, "histogram", nil)
+		require.NoError(t, err)
+		require.True(t, want.Equal(actual.Histogram()))
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		s1, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		s1.Add(1)
+
+		s2, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		s2.Add(100)
+
+		store, name := testLocal(t, true, metrics.Summary("summary", s1))
+
+		got, err := store.Save(ctx, metrics.Summary("summary", s2))
+		require.NoError(t, err)
+
+		want, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		want.Add(1)
+		want.Add(100)
+		require.True(t, want.Equal(got[0].Summary()))
+
+		mismatch, _ := metrics.NewSketch(0.05)
+		mismatch.Add(1)
+
+		_, err = store.Save(ctx, metrics.Summary("summary", mismatch))
+		require.Error(t, err)
+
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		actual, err := opened.Get(ctx, "summary", nil)
+		require.NoError(t, err)
+		require.True(t, want.Equal(actual.Summary()))
+	})
+	t.Run("range", func(t *testing.T) {
+		store, name := testLocal(t, true)
+
+		start := time.Now()
+
+		_, err := store.Save(ctx, metrics.Counter("counter", 1), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		middle := time.Now()
+
+		_, err = store.Save(ctx, metrics.Counter("counter", 2), metrics.Gauge("gauge", 2))
+		require.NoError(t, err)
+
+		end := time.Now().Add(time.Nanosecond)
+
+		check := func(t *testing.T, store storage.Storage) {
+			got, err := store.Range(ctx, "counter", nil, start, end)
+			require.NoError(t, err)
+			require.Len(t, got, 2)
+			require.EqualValues(t, 1, got[0].Value.Int64())
+			require.EqualValues(t, 3, got[1].Value.Int64())
+			require.False(t, got[1].Time.Before(got[0].Time))
+
+			got, err = store.Range(ctx, "gauge", nil, middle, end)
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			require.EqualValues(t, 2, got[0].Value.Float64())
+
+			_, err = store.Range(ctx, "gauge", nil, end, end.Add(time.Hour))
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			_, err = store.Range(ctx, "unknown", nil, start, end)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+		}
+
+		check(t, store)
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		check(t, opened)
+	})
+	t.Run("delete", func(t *testing.T) {
+		host := metrics.Label{Name: "host", Value: "a"}
+
+		store, name := testLocal(t, true,
+			metrics.Counter("counter", 1),
+			metrics.Counter("counter", 2, host),
+			metrics.Gauge("gauge", 1),
+		)
+
+		require.NoError(t, store.Delete(ctx, "counter", nil))
+		require.ErrorIs(t, store.Delete(ctx, "counter", nil), storage.ErrNotFound)
+
+		check := func(t *testing.T, store storage.Storage) {
+			_, err := store.Get(ctx, "counter", nil)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			_, err = store.Range(ctx, "counter", nil, time.Time{}, time.Now())
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			got, err := store.Get(ctx, "counter", metrics.NewLabels(host))
+			require.NoError(t, err)
+			require.EqualValues(t, 2, got.Int64())
+
+			values, err := store.GetAll(ctx)
+			require.NoError(t, err)
+			require.Len(t, values, 2)
+		}
+
+		check(t, store)
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		check(t, opened)
+
+		_, err = opened.Save(ctx, metrics.Counter("counter", 5))
+		require.NoError(t, err)
+
+		got, err := opened.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, got.Int64())
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		h, _ := metrics.NewHistogramValue([]float64{1, 2})
+		h.Observe(0.5)
+
+		store, name := testLocal(t, true,
+			metrics.Counter("counter", 10),
+			metrics.Histogram("histogram", h),
+		)
+
+		got, err := store.Reset(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 10, got.Int64())
+
+		_, err = store.Reset(ctx, "histogram", nil)
+		require.NoError(t, err)
+
+		_, err = store.Reset(ctx, "unknown", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		_, err = store.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+
+		check := func(t *testing.T, store storage.Storage) {
+			got, err := store.Get(ctx, "counter", nil)
+			require.NoError(t, err)
+			require.EqualValues(t, 1, got.Int64())
+
+			got, err = store.Get(ctx, "histogram", nil)
+			require.NoError(t, err)
+			require.Zero(t, got.Histogram().Count)
+			require.Equal(t, []float64{1, 2}, got.Histogram().Bounds)
+
+			samples, err := store.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+			require.NoError(t, err)
+			require.Len(t, samples, 3)
+			require.EqualValues(t, 0, samples[1].Value.Int64())
+		}
+
+		check(t, store)
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		check(t, opened)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		store, name := testLocal(t, true, metrics.Counter("counter", 1))
+
+		before := time.Now()
+
+		_, err := store.Save(ctx, metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		n, err := store.Expire(ctx, before)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		check := func(t *testing.T, store storage.Storage) {
+			_, err := store.Get(ctx, "counter", nil)
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			_, err = store.Range(ctx, "counter", nil, time.Time{}, time.Now())
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			got, err := store.Get(ctx, "gauge", nil)
+			require.NoError(t, err)
+			require.False(t, got.Updated().Before(before))
+		}
+
+		check(t, store)
+		require.NoError(t, store.Snapshot(ctx))
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		check(t, opened)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		name := filename(t)
+
+		// NOTE: записи версии 1 без времени, сделанные до появления истории;
+		// имя датчика содержит разделитель записей.
+		var data []byte
+		for _, value := range []metrics.Metric{
+			metrics.Counter("counter", 1),
+			metrics.Gauge("gauge±", 1),
+			metrics.Counter("counter", 2),
+		} {
+			b, err := value.MarshalBinary()
+			require.NoError(t, err)
+
+			op := byte(1)
+			if value.Kind() == metrics.KindGauge {
+				op = 2
+			}
+
+			e := append([]byte{op}, binary.AppendUvarint(nil, uint64(len(b)))...)
+			e = append(e, b...)
+
+			data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(e))
+			data = append(data, e...)
+			data = append(data, "\xc2\xb1"...)
+		}
+		require.NoError(t, os.WriteFile(name, data, 0o644))
+
+		store, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+
+		require.Equal(t, storage.Recovery{Records: 3}, store.Recovery())
+
+		got, err := store.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, got.Int64())
+
+		gauge, err := store.Get(ctx, "gauge±", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, gauge.Float64())
+
+		_, err = store.Range(ctx, "counter", nil, time.Time{}, time.Now())
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		_, err = store.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		got, err = opened.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 4, got.Int64())
+	})
+	t.Run("torn", func(t *testing.T) {
+		store, name := testLocal(t, true,
+			metrics.Counter("counter", 1),
+			metrics.Counter("counter", 2),
+			metrics.Counter("counter", 3),
+		)
+		require.NoError(t, store.Close())
+
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(name, data[:len(data)-3], 0o644))
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+
+		recovery := opened.Recovery()
+		require.Equal(t, 2, recovery.Records)
+		require.Greater(t, recovery.Dropped, int64(0))
+
+		got, err := opened.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, got.Int64())
+
+		_, err = opened.Save(ctx, metrics.Counter("counter", 4))
+		require.NoError(t, err)
+		require.NoError(t, opened.Close())
+
+		reopened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { reopened.Close() })
+
+		require.Equal(t, storage.Recovery{Records: 3}, reopened.Recovery())
+
+		got, err = reopened.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 7, got.Int64())
+	})
+	t.Run("read_only", func(t *testing.T) {
+		// NOTE: журнал версии 1 из одной записи.
+		value := metrics.Counter("counter", 5)
+		b, err := value.MarshalBinary()
+		require.NoError(t, err)
+		e := append([]byte{1}, binary.AppendUvarint(nil, uint64(len(b)))...)
+		e = append(e, b...)
+		legacy := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(e))
+		legacy = append(legacy, e...)
+		legacy = append(legacy, "\xc2\xb1"...)
+
+		store, torn := testLocal(t, true,
+			metrics.Counter("counter", 1),
+			metrics.Counter("counter", 2),
+		)
+		require.NoError(t, store.Close())
+
+		data, err := os.ReadFile(torn)
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name string
+			data []byte
+			want int64
+		}{
+			{name: "legacy", data: legacy, want: 5},
+			{name: "torn", data: data[:len(data)-3], want: 1},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				name := filename(t)
+				require.NoError(t, os.WriteFile(name, tc.data, 0o644))
+
+				opened, err := storage.NewLocal(name, &storage.LocalOpts{ReadOnly: true})
+				require.NoError(t, err)
+
+				got, err := opened.Get(ctx, "counter", nil)
+				require.NoError(t, err)
+				require.Equal(t, tc.want, got.Int64())
+
+				_, err = opened.Save(ctx, metrics.Counter("counter", 1))
+				require.ErrorIs(t, err, storage.ErrReadOnly)
+				require.ErrorIs(t, opened.Snapshot(ctx), storage.ErrReadOnly)
+				require.ErrorIs(t, opened.Promote(ctx), storage.ErrReadOnly)
+				require.NoError(t, opened.Close())
+
+				entries, err := os.ReadDir(filepath.Dir(name))
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+
+				content, err := os.ReadFile(name)
+				require.NoError(t, err)
+				require.Equal(t, tc.data, content)
+			})
+		}
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		store, name := testLocal(t, true,
+			metrics.Counter("counter", 1),
+			metrics.Gauge("gauge", 1),
+		)
+		require.NoError(t, store.Close())
+
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+
+		// NOTE: повреждение тела первой записи после заголовка.
+		data[16] ^= 0xff
+		require.NoError(t, os.WriteFile(name, data, 0o644))
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		require.Equal(t, 0, opened.Recovery().Records)
+		require.EqualValues(t, len(data)-5, opened.Recovery().Dropped)
+
+		_, err = opened.Get(ctx, "gauge", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+	})
+	t.Run("retain", func(t *testing.T) {
+		store, name := testLocal(t, true)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := store.Save(ctx,
+			metrics.Counter("counter", 1), metrics.Gauge("gauge", 1),
+			metrics.Counter("counter", 2), metrics.Gauge("gauge", 3),
+		)
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := store.Range(ctx, "counter", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		require.NoError(t, store.Retain(ctx, retention, now.Add(2*time.Minute)))
+
+		check := func(t *testing.T, store storage.Storage) {
+			counter, err := store.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+			require.NoError(t, err)
+			require.Len(t, counter, 1)
+			require.True(t, start.Equal(counter[0].Time))
+			require.EqualValues(t, 2, counter[0].Count)
+			require.Equal(t, 3.0, counter[0].Sum)
+			require.Equal(t, 3.0/60, counter[0].Rate)
+			require.EqualValues(t, 3, counter[0].Value.Int64())
+
+			gauge, err := store.Rollups(ctx, "gauge", nil, time.Minute, start, start.Add(time.Minute))
+			require.NoError(t, err)
+			require.Len(t, gauge, 1)
+			require.Equal(t, 1.0, gauge[0].Min)
+			require.Equal(t, 3.0, gauge[0].Max)
+			require.Equal(t, 2.0, gauge[0].Avg)
+			require.EqualValues(t, 3, gauge[0].Value.Float64())
+		}
+
+		check(t, store)
+
+		// NOTE: повторная агрегация не создаёт дубликатов.
+		require.NoError(t, store.Retain(ctx, retention, now.Add(3*time.Minute)))
+		check(t, store)
+
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		check(t, opened)
+
+		require.NoError(t, opened.Snapshot(ctx))
+		require.NoError(t, opened.Retain(ctx, retention, now.Add(2*time.Hour)))
+
+		_, err = opened.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.ErrorIs(t, err, storage.ErrNotFound)
+		check(t, opened)
+
+		// NOTE: история журнала перезаписывается без устаревших значений.
+		require.NoError(t, opened.Snapshot(ctx))
+		require.NoError(t, opened.Close())
+
+		opened, err = storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		_, err = opened.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.ErrorIs(t, err, storage.ErrNotFound)
+		check(t, opened)
+
+		require.NoError(t, opened.Retain(ctx, retention, now.Add(25*time.Hour)))
+
+		_, err = opened.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.ErrorIs(t, err, storage.ErrNotFound)
+	})
+	t.Run("retain_late", func(t *testing.T) {
+		store, _ := testLocal(t, true)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := store.Save(ctx, metrics.Counter("counter", 1), metrics.Counter("counter", 2))
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := store.Range(ctx, "counter", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		// NOTE: первая агрегация выполняется после истечения срока хранения
+		// исходных значений.
+		require.NoError(t, store.Retain(ctx, retention, now.Add(2*time.Hour)))
+
+		_, err = store.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		counter, err := store.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, counter, 1)
+		require.Equal(t, 3.0, counter[0].Sum)
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		store, name := testLocal(t, true)
+
+		for i := 0; i < 3; i++ {
+			_, err := store.Save(ctx, metrics.Counter("counter", 1), metrics.Gauge("gauge", float64(i)))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, store.Snapshot(ctx))
+
+		_, err := store.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+
+		require.NoError(t, store.Snapshot(ctx))
+
+		snapshots, err := filepath.Glob(name + ".snapshot.*")
+		require.NoError(t, err)
+		require.Len(t, snapshots, 1)
+
+		segments, err := filepath.Glob(name + ".0*")
+		require.NoError(t, err)
+		require.Empty(t, segments)
+
+		_, err = store.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		counter, err := opened.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, counter.Int64())
+
+		gauge, err := opened.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, gauge.Float64())
+
+		samples, err := opened.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, 5)
+		require.EqualValues(t, 5, samples[4].Value.Int64())
+	})
+	t.Run("snapshot_size", func(t *testing.T) {
+		store, name := testLocal(t, true)
+
+		size := func(t *testing.T) int64 {
+			snapshots, err := filepath.Glob(name + ".snapshot.*")
+			require.NoError(t, err)
+			require.Len(t, snapshots, 1)
+
+			info, err := os.Stat(snapshots[0])
+			require.NoError(t, err)
+
+			return info.Size()
+		}
+
+		_, err := store.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+		require.NoError(t, store.Snapshot(ctx))
+
+		want := size(t)
+
+		for i := 0; i < 10; i++ {
+			_, err = store.Save(ctx, metrics.Counter("counter", 1))
+			require.NoError(t, err)
+			require.NoError(t, store.Snapshot(ctx))
+			require.Equal(t, want, size(t))
+		}
+
+		require.NoError(t, store.Close())
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { opened.Close() })
+
+		samples, err := opened.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, 11)
+		require.EqualValues(t, 11, samples[10].Value.Int64())
+	})
+	t.Run("segments", func(t *testing.T) {
+		name := filename(t)
+
+		store, err := storage.NewLocal(name, &storage.LocalOpts{SegmentSize: 64})
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			_, err = store.Save(ctx, metrics.Counter("counter", 1))
+			require.NoError(t, err)
+		}
+		require.NoError(t, store.Close())
+
+		segments, err := filepath.Glob(name + ".0*")
+		require.NoError(t, err)
+		require.NotEmpty(t, segments)
+
+		opened, err := storage.NewLocal(name, &storage.LocalOpts{Restore: true, SegmentSize: 64})
+		require.NoError(t, err)
+
+		counter, err := opened.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 10, counter.Int64())
+
+		require.NoError(t, opened.Snapshot(ctx))
+		require.NoError(t, opened.Close())
+
+		segments, err = filepath.Glob(name + ".0*")
+		require.NoError(t, err)
+		require.Empty(t, segments)
+
+		// NOTE: без восстановления журнал начинается заново.
+		truncated, err := storage.NewLocal(name, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { truncated.Close() })
+
+		_, err = truncated.Get(ctx, "counter", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		snapshots, err := filepath.Glob(name + ".snapshot.*")
+		require.NoError(t, err)
+		require.Empty(t, snapshots)
+	})
+	t.Run("concurrency", func(t *testing.T) {
+		store, _ := testLocal(t, true)
+
+		const (
+			readers = 8
+			writers = 4
+			n       = 100
+		)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < n; j++ {
+					_, err := store.Save(ctx, metrics.Counter("counter", 1))
+					assert.NoError(t, err)
+				}
+			}()
+		}
+
+		done := make(chan struct{})
+
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					_, err := store.GetAll(ctx)
+					assert.NoError(t, err)
+				}
+			}()
+		}
+
+		require.Eventually(t, func() bool {
+			got, err := store.Get(ctx, "counter", nil)
+			return err == nil && got.Int64() == writers*n
+		}, 10*time.Second, 10*time.Millisecond)
+
+		close(done)
+		wg.Wait()
+	})
+
+	t.Run("order", func(t *testing.T) {
+		store, _ := testLocal(t, true)
+
+		const (
+			writers = 4
+			n       = 50 // NOTE: изменения помещаются в буфер подписчика.
+		)
+
+		watched, err := store.Watch(ctx, storage.Matcher{})
+		require.NoError(t, err)
+
+		received := make(chan []int64, 1)
+		go func() {
+			var values []int64
+			for sample := range watched {
+				values = append(values, sample.Value.Int64())
+				if len(values) == writers*n {
+					break
+				}
+			}
+			received <- values
+		}()
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < n; j++ {
+					_, err := store.Save(ctx, metrics.Counter("counter", 1))
+					assert.NoError(t, err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		samples, err := store.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, writers*n)
+
+		for i := 1; i < len(samples); i++ {
+			require.False(t, samples[i].Time.Before(samples[i-1].Time))
+			require.Equal(t, samples[i-1].Value.Int64()+1, samples[i].Value.Int64())
+		}
+
+		// NOTE: подписчик получает изменения в порядке сохранения.
+		values := <-received
+		require.Len(t, values, writers*n)
+		for i, v := range values {
+			require.EqualValues(t, i+1, v)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		store, _ := testLocal(t, true, metrics.Counter("counter", 1))
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := store.Get(canceled, "counter", nil)
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = store.Save(canceled, metrics.Counter("counter", 1))
+		require.ErrorIs(t, err, context.Canceled)
+
+		require.NoError(t, store.Close())
+
+		require.ErrorIs(t, store.Ping(ctx), storage.ErrStorageClosed)
+		require.ErrorIs(t, store.Close(), storage.ErrStorageClosed)
+
+		_, err = store.Get(ctx, "counter", nil)
+		require.ErrorIs(t, err, storage.ErrStorageClosed)
+
+		_, err = store.GetAll(ctx)
+		require.ErrorIs(t, err, storage.ErrStorageClosed)
+
+		_, err = store.Save(ctx, metrics.Counter("counter", 1))
+		require.ErrorIs(t, err, storage.ErrStorageClosed)
+	})
+}
+
+func benchmarkLocal(b *testing.B) *storage.Local {
+	f, err := os.CreateTemp(b.TempDir(), "bench-*.wal")
+	require.NoError(b, err)
+	require.NoError(b, f.Close())
+
+	store, err := storage.NewLocal(f.Name(), nil)
+	require.NoError(b, err)
+	b.Cleanup(func() { store.Close() })
+
+	_, err = store.Save(context.Background(), metrics.Snapshot()...)
+	require.NoError(b, err)
+
+	return store
+}
+
+func BenchmarkLocal_Get(b *testing.B) {
+	store := benchmarkLocal(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = store.Get(ctx, "PollCount", nil)
+		}
+	})
+}
+
+func BenchmarkLocal_GetAll(b *testing.B) {
+	store := benchmarkLocal(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = store.GetAll(ctx)
+		}
+	})
+}
+
+// BenchmarkLocal_GetAllWithSave измеряет чтение при непрерывной синхронной
+// записи: синхронизация файла выполняется вне блокировки и не задерживает
+// чтение.
+func BenchmarkLocal_GetAllWithSave(b *testing.B) {
+	store := benchmarkLocal(b)
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_, _ = store.Save(ctx, metrics.Snapshot()...)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = store.GetAll(ctx)
+		}
+	})
+	b.StopTimer()
+
+	close(done)
+	<-stopped
 }
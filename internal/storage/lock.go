@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// rwlock определяет блокировку с одним писателем и множеством читателей,
+// захват которой прерывается контекстом.
+//
+// Ожидающий писатель блокирует захват новыми читателями, поэтому
+// непрерывный поток чтения не откладывает запись бесконечно. После закрытия
+// блокировки любой захват возвращает ErrStorageClosed.
+type rwlock struct {
+	mu      sync.Mutex
+	readers int // Количество читателей; -1, если захвачена писателем.
+	writers int // Количество ожидающих писателей.
+	closed  bool
+	wake    chan struct{} // Закрывается при каждом освобождении.
+}
+
+func newRWLock() *rwlock {
+	return &rwlock{wake: make(chan struct{})}
+}
+
+// lock захватывает блокировку на запись.
+func (l *rwlock) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.writers++
+
+	for {
+		if l.closed {
+			l.writers--
+			l.mu.Unlock()
+			return ErrStorageClosed
+		}
+		if l.readers == 0 {
+			l.readers = -1
+			l.writers--
+			l.mu.Unlock()
+			return nil
+		}
+
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.writers--
+			// NOTE: читатели, ожидающие ухода писателя, должны проснуться.
+			l.broadcast()
+			l.mu.Unlock()
+			return ctx.Err()
+		case <-wake:
+		}
+
+		l.mu.Lock()
+	}
+}
+
+// unlock освобождает блокировку на запись.
+func (l *rwlock) unlock() {
+	l.mu.Lock()
+	l.readers = 0
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// rlock захватывает блокировку на чтение.
+func (l *rwlock) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+
+	for {
+		if l.closed {
+			l.mu.Unlock()
+			return ErrStorageClosed
+		}
+		if l.readers >= 0 && l.writers == 0 {
+			l.readers++
+			l.mu.Unlock()
+			return nil
+		}
+
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+
+		l.mu.Lock()
+	}
+}
+
+// runlock освобождает блокировку на чтение.
+func (l *rwlock) runlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.broadcast()
+	}
+	l.mu.Unlock()
+}
+
+// close освобождает захваченную на запись блокировку и закрывает её.
+func (l *rwlock) close() {
+	l.mu.Lock()
+	l.readers = 0
+	l.closed = true
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+func (l *rwlock) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
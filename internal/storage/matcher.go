@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// Matcher определяет условия выборки метрик. Метрика попадает в выборку,
+// если она удовлетворяет всем непустым условиям.
+type Matcher struct {
+	// Префикс имени метрики.
+	Prefix string
+
+	// Шаблон имени метрики, в котором * соответствует любой
+	// последовательности символов, а ? — любому символу.
+	Glob string
+
+	// Регулярное выражение, которое должно найтись в имени метрики.
+	//
+	// Выражение проверяется в синтаксисе RE2 после чтения метрик;
+	// хранилища БД выбирают метрики только по литеральному префиксу
+	// выражения, привязанного к началу имени.
+	Regex string
+
+	// Тип метрики.
+	Kind metrics.Kind
+
+	// Метки, которые должна содержать метрика.
+	Labels metrics.Labels
+}
+
+// IsEmpty возвращает true, если условия выборки пусты.
+func (m Matcher) IsEmpty() bool {
+	return m.Prefix == "" &&
+		m.Glob == "" &&
+		m.Regex == "" &&
+		m.Kind == metrics.KindUnknown &&
+		len(m.Labels) == 0
+}
+
+// Validate возвращает ошибку, если условия выборки некорректны.
+func (m Matcher) Validate() error {
+	_, err := m.compile()
+	return err
+}
+
+// compile возвращает скомпилированные условия выборки.
+func (m Matcher) compile() (*matcher, error) {
+	c := &matcher{Matcher: m}
+
+	if m.Glob != "" {
+		c.glob = regexp.MustCompile(globRegex(m.Glob))
+	}
+
+	if m.Regex != "" {
+		re, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		c.regex = re
+	}
+
+	return c, nil
+}
+
+// matcher определяет скомпилированные условия выборки.
+type matcher struct {
+	Matcher
+	glob  *regexp.Regexp
+	regex *regexp.Regexp
+}
+
+// match возвращает true, если метрика удовлетворяет условиям выборки.
+func (m *matcher) match(value metrics.Metric) bool {
+	name := value.Name()
+	switch {
+	case !strings.HasPrefix(name, m.Prefix):
+		return false
+	case m.glob != nil && !m.glob.MatchString(name):
+		return false
+	case m.regex != nil && !m.regex.MatchString(name):
+		return false
+	case m.Kind != metrics.KindUnknown && m.Kind != value.Kind():
+		return false
+	}
+	return value.Labels().Match(m.Labels)
+}
+
+// prefix возвращает префикс, с которого начинаются имена всех метрик,
+// удовлетворяющих условиям выборки.
+func (m *matcher) prefix() string {
+	prefix := m.Glob
+	if i := strings.IndexAny(prefix, "*?"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if len(m.Prefix) > len(prefix) {
+		prefix = m.Prefix
+	}
+	return prefix
+}
+
+// globRegex возвращает регулярное выражение, соответствующее шаблону
+// имени метрики.
+func globRegex(glob string) string {
+	var b strings.Builder
+
+	b.WriteString(`^(?s:`)
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(`)$`)
+
+	return b.String()
+}
+
+// globLike возвращает шаблон SQL LIKE с экранирующим символом \,
+// соответствующий шаблону имени метрики.
+func globLike(glob string) string {
+	var b strings.Builder
+
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		default:
+			b.WriteString(likeEscaper.Replace(string(r)))
+		}
+	}
+
+	return b.String()
+}
+
+// prefixLike возвращает шаблон SQL LIKE с экранирующим символом \,
+// соответствующий префиксу имени метрики.
+func prefixLike(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+// regexPrefix возвращает литеральный префикс, с которого начинается любое
+// имя, в котором находится регулярное выражение expr, или пустую строку,
+// если выражение не привязано к началу имени или не начинается с литерала.
+func regexPrefix(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+
+	lit := re.Sub[1]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return ""
+	}
+
+	return string(lit.Rune)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// globSQLite возвращает шаблон SQLite GLOB, соответствующий шаблону
+// имени метрики.
+func globSQLite(glob string) string {
+	return strings.ReplaceAll(glob, "[", "[[]")
+}
+
+// prefixSQLite возвращает шаблон SQLite GLOB, соответствующий префиксу
+// имени метрики.
+func prefixSQLite(prefix string) string {
+	return strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(prefix) + "*"
+}
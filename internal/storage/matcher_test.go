@@ -0,0 +1,143 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+)
+
+// testSelect проверяет выборку метрик из пустого хранилища s.
+func testSelect(t *testing.T, ctx context.Context, s storage.Storage) {
+	t.Helper()
+
+	hostA := metrics.Label{Name: "host", Value: "a"}
+	hostB := metrics.Label{Name: "host", Value: "b"}
+
+	_, err := s.Save(ctx,
+		metrics.Counter("go_gc_total", 1, hostA),
+		metrics.Counter("go_gc_total", 2, hostB),
+		metrics.Gauge("go_goroutines", 3, hostA),
+		metrics.Gauge("go_mem%_bytes", 4),
+		metrics.Counter("http_requests_total", 5),
+		metrics.Gauge("gauge", 6),
+	)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		matcher   storage.Matcher
+		wantKeys  []string
+		wantError bool
+	}{
+		{
+			name:    "all",
+			matcher: storage.Matcher{},
+			wantKeys: []string{
+				`gauge`,
+				`go_gc_total{host="a"}`,
+				`go_gc_total{host="b"}`,
+				`go_goroutines{host="a"}`,
+				`go_mem%_bytes`,
+				`http_requests_total`,
+			},
+		},
+		{
+			name:    "prefix",
+			matcher: storage.Matcher{Prefix: "go_g"},
+			wantKeys: []string{
+				`go_gc_total{host="a"}`,
+				`go_gc_total{host="b"}`,
+				`go_goroutines{host="a"}`,
+			},
+		},
+		{
+			name:     "prefix with wildcard characters",
+			matcher:  storage.Matcher{Prefix: "go_mem%"},
+			wantKeys: []string{`go_mem%_bytes`},
+		},
+		{
+			name:    "glob",
+			matcher: storage.Matcher{Glob: "*_total"},
+			wantKeys: []string{
+				`go_gc_total{host="a"}`,
+				`go_gc_total{host="b"}`,
+				`http_requests_total`,
+			},
+		},
+		{
+			name:     "glob with single character",
+			matcher:  storage.Matcher{Glob: "g?uge"},
+			wantKeys: []string{`gauge`},
+		},
+		{
+			name:     "glob with literal characters",
+			matcher:  storage.Matcher{Glob: "go_mem%_*"},
+			wantKeys: []string{`go_mem%_bytes`},
+		},
+		{
+			name:    "regex",
+			matcher: storage.Matcher{Regex: "^go_g(c|oroutines)"},
+			wantKeys: []string{
+				`go_gc_total{host="a"}`,
+				`go_gc_total{host="b"}`,
+				`go_goroutines{host="a"}`,
+			},
+		},
+		{
+			name:     "regex with RE2 syntax",
+			matcher:  storage.Matcher{Regex: `(?i)^GAUGE\b`},
+			wantKeys: []string{`gauge`},
+		},
+		{
+			name:     "regex prefix with wildcard characters",
+			matcher:  storage.Matcher{Regex: `^go_mem%_\w+`},
+			wantKeys: []string{`go_mem%_bytes`},
+		},
+		{
+			name:    "kind",
+			matcher: storage.Matcher{Prefix: "go_", Kind: metrics.KindGauge},
+			wantKeys: []string{
+				`go_goroutines{host="a"}`,
+				`go_mem%_bytes`,
+			},
+		},
+		{
+			name:    "labels",
+			matcher: storage.Matcher{Labels: metrics.NewLabels(hostA)},
+			wantKeys: []string{
+				`go_gc_total{host="a"}`,
+				`go_goroutines{host="a"}`,
+			},
+		},
+		{
+			name:    "nothing",
+			matcher: storage.Matcher{Prefix: "go_", Glob: "http_*"},
+		},
+		{
+			name:      "invalid regex",
+			matcher:   storage.Matcher{Regex: "("},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := s.Select(ctx, tc.matcher)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			keys := make([]string, 0, len(values))
+			for _, value := range values {
+				keys = append(keys, value.Key())
+			}
+			require.ElementsMatch(t, tc.wantKeys, keys)
+		})
+	}
+}
@@ -2,9 +2,11 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
+	"github.com/sergeizaitcev/metrics/internal/configs"
 	"github.com/sergeizaitcev/metrics/internal/metrics"
 	"github.com/sergeizaitcev/metrics/internal/storage"
 )
@@ -41,8 +43,12 @@ func (m *MockStorage) Save(
 	return vals, err
 }
 
-func (m *MockStorage) Get(ctx context.Context, name string) (metrics.Metric, error) {
-	args := m.Called(ctx, name)
+func (m *MockStorage) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	args := m.Called(ctx, name, labels)
 	value := args.Get(0).(metrics.Metric)
 	err := args.Error(1)
 	return value, err
@@ -54,3 +60,86 @@ func (m *MockStorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
 	err := args.Error(1)
 	return values, err
 }
+
+func (m *MockStorage) Select(
+	ctx context.Context,
+	matcher storage.Matcher,
+) ([]metrics.Metric, error) {
+	args := m.Called(ctx, matcher)
+	values := args.Get(0).([]metrics.Metric)
+	err := args.Error(1)
+	return values, err
+}
+
+func (m *MockStorage) Watch(
+	ctx context.Context,
+	matcher storage.Matcher,
+) (<-chan storage.Sample, error) {
+	args := m.Called(ctx, matcher)
+	ch, _ := args.Get(0).(chan storage.Sample)
+	err := args.Error(1)
+	return ch, err
+}
+
+func (m *MockStorage) Delete(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) error {
+	args := m.Called(ctx, name, labels)
+	err := args.Error(0)
+	return err
+}
+
+func (m *MockStorage) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	args := m.Called(ctx, name, labels)
+	value := args.Get(0).(metrics.Metric)
+	err := args.Error(1)
+	return value, err
+}
+
+func (m *MockStorage) Range(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]storage.Sample, error) {
+	args := m.Called(ctx, name, labels, from, to)
+	values := args.Get(0).([]storage.Sample)
+	err := args.Error(1)
+	return values, err
+}
+
+func (m *MockStorage) Rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]storage.Rollup, error) {
+	args := m.Called(ctx, name, labels, resolution, from, to)
+	values := args.Get(0).([]storage.Rollup)
+	err := args.Error(1)
+	return values, err
+}
+
+func (m *MockStorage) Retain(
+	ctx context.Context,
+	retention configs.Retention,
+	now time.Time,
+) error {
+	args := m.Called(ctx, retention, now)
+	err := args.Error(0)
+	return err
+}
+
+func (m *MockStorage) Expire(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	n := args.Int(0)
+	err := args.Error(1)
+	return n, err
+}
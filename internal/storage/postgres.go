@@ -3,12 +3,19 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/sergeizaitcev/metrics/deployments/migrations"
+	"github.com/sergeizaitcev/metrics/internal/configs"
 	"github.com/sergeizaitcev/metrics/internal/metrics"
 )
 
@@ -16,7 +23,16 @@ var _ Storage = (*Postgres)(nil)
 
 // Storage определяет хранилище метрик в postgres.
 type Postgres struct {
-	db *sql.DB
+	db   *sql.DB
+	dsn  string
+	feed *feed[Sample]
+
+	invalidations *feed[string] // Ключи удалённых и сброшенных метрик.
+
+	mu       sync.Mutex
+	listener *pq.Listener // Создаётся при первой подписке.
+	closed   bool
+	wg       sync.WaitGroup
 }
 
 // New возвращает новый экземпляр хранилища метрик в postgres.
@@ -26,7 +42,22 @@ func NewPostgres(dsn string) (*Postgres, error) {
 		return nil, fmt.Errorf("storage: connection refused: %w", err)
 	}
 
-	return &Postgres{db: db}, nil
+	return &Postgres{
+		db:   db,
+		dsn:  dsn,
+		feed: newFeed[Sample](),
+
+		invalidations: newFeed[string](),
+	}, nil
+}
+
+// MigrateCheck возвращает ошибку, если в БД применены не все миграции.
+func (p *Postgres) MigrateCheck(ctx context.Context) error {
+	err := migrations.Check(ctx, p.db)
+	if err != nil {
+		return fmt.Errorf("postgres: migration check: %w", err)
+	}
+	return nil
 }
 
 // MigrateUp запускает миграцию в БД.
@@ -58,6 +89,17 @@ func (p *Postgres) Ping(context.Context) error {
 
 // Close реализует интерфейс Storager.
 func (p *Postgres) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.feed.close()
+	p.invalidations.close()
+
 	err := p.db.Close()
 	if err != nil {
 		return fmt.Errorf("postgres: closing database: %w", err)
@@ -66,6 +108,10 @@ func (p *Postgres) Close() error {
 }
 
 // Save реализует интерфейс Storager.
+//
+// Значения сохраняются пакетно: текущие значения метрик блокируются одним
+// запросом, новые значения вычисляются в памяти и записываются вместе
+// с историей двумя запросами, независимо от размера пакета.
 func (p *Postgres) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.Metric, error) {
 	if len(values) == 0 {
 		return nil, errors.New("values is empty")
@@ -79,128 +125,649 @@ func (p *Postgres) Save(ctx context.Context, values ...metrics.Metric) ([]metric
 	}
 	defer tx.Rollback()
 
+	now := time.Now()
+
+	actuals, err := save(ctx, tx, now, values)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: saving metrics: %w", err)
+	}
+
+	err = notify(ctx, tx, changes(now, values, actuals))
+	if err != nil {
+		return nil, fmt.Errorf("postgres: saving metrics: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("postgres: commit transaction: %w", err)
+	}
+
+	return actuals, nil
+}
+
+const (
+	// notifyChannel определяет канал уведомлений о сохранённых значениях
+	// метрик.
+	notifyChannel = "metrics"
+
+	// invalidateChannel определяет канал уведомлений об удалённых
+	// и сброшенных метриках.
+	invalidateChannel = "metrics_invalidate"
+)
+
+// maxNotifyPayload определяет максимальный размер уведомления в байтах.
+//
+// NOTE: postgres ограничивает размер уведомления 8000 байтами.
+const maxNotifyPayload = 7999
+
+// notification определяет уведомление о сохранённом значении метрики.
+type notification struct {
+	Time  time.Time      `json:"time"`
+	Value metrics.Metric `json:"value"`
+
+	// Индикатор уведомления без значения метрики, превысившего
+	// максимальный размер; значение читается из БД.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// notify отправляет уведомления о сохранённых значениях метрик.
+// Уведомления доставляются подписчикам после фиксации транзакции tx.
+func notify(ctx context.Context, tx *sql.Tx, samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	payloads := make([]string, 0, len(samples))
+
+	for _, sample := range samples {
+		n := &notification{Time: sample.Time, Value: sample.Value}
+
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return fmt.Errorf("encoding a notification: %w", err)
+		}
+		if len(payload) > maxNotifyPayload {
+			n.Value = n.Value.Zero()
+			n.Truncated = true
+
+			payload, err = json.Marshal(n)
+			if err != nil {
+				return fmt.Errorf("encoding a notification: %w", err)
+			}
+		}
+
+		payloads = append(payloads, string(payload))
+	}
+
+	query := `SELECT pg_notify($1, payload) FROM unnest($2::text[]) AS payload;`
+
+	_, err := tx.ExecContext(ctx, query, notifyChannel, pq.Array(payloads))
+	if err != nil {
+		return fmt.Errorf("sending notifications: %w", err)
+	}
+
+	return nil
+}
+
+// invalidation определяет уведомление об удалённой или сброшенной метрике.
+type invalidation struct {
+	Name   string          `json:"name"`
+	Labels json.RawMessage `json:"labels"`
+}
+
+// invalidate отправляет уведомление об удалённой или сброшенной метрике.
+// Уведомление доставляется подписчикам после фиксации транзакции tx.
+func invalidate(ctx context.Context, tx *sql.Tx, name string, labels metrics.Labels) error {
+	payload, err := json.Marshal(&invalidation{
+		Name:   name,
+		Labels: json.RawMessage(marshalLabels(labels)),
+	})
+	if err != nil {
+		return fmt.Errorf("encoding a notification: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2);`, invalidateChannel, string(payload))
+	if err != nil {
+		return fmt.Errorf("sending a notification: %w", err)
+	}
+
+	return nil
+}
+
+// Watch реализует интерфейс Storage.
+//
+// Подписка получает значения, сохранённые любым экземпляром хранилища,
+// подключённым к той же БД. При переподключении к БД подписки закрываются,
+// т.к. уведомления, отправленные за это время, теряются.
+func (p *Postgres) Watch(ctx context.Context, m Matcher) (<-chan Sample, error) {
+	err := p.listen()
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	ch, err := watch(ctx, p.feed, m)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	return ch, nil
+}
+
+// Invalidations реализует интерфейс Invalidator.
+//
+// Канал получает ключи метрик, удалённых или сброшенных любым экземпляром
+// хранилища, подключённым к той же БД, в том числе при удалении устаревших
+// метрик. При переподключении к БД канал закрывается.
+func (p *Postgres) Invalidations(ctx context.Context) (<-chan string, error) {
+	err := p.listen()
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	ch, err := p.invalidations.subscribe(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	return ch, nil
+}
+
+// listen начинает прослушивание уведомлений, если оно ещё не начато.
+func (p *Postgres) listen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrStorageClosed
+	}
+	if p.listener != nil {
+		return nil
+	}
+
+	listener := pq.NewListener(p.dsn, time.Second, time.Minute, nil)
+
+	for _, channel := range []string{notifyChannel, invalidateChannel} {
+		err := listener.Listen(channel)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("listening to notifications: %w", err)
+		}
+	}
+
+	p.listener = listener
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.receive(listener.Notify)
+	}()
+
+	return nil
+}
+
+// receive рассылает подписчикам уведомления до закрытия канала notify.
+func (p *Postgres) receive(notify <-chan *pq.Notification) {
+	for n := range notify {
+		// NOTE: nil отправляется после переподключения к БД.
+		if n == nil {
+			p.feed.reset()
+			p.invalidations.reset()
+			continue
+		}
+
+		if n.Channel == invalidateChannel {
+			var payload invalidation
+
+			err := json.Unmarshal([]byte(n.Extra), &payload)
+			if err != nil {
+				continue
+			}
+
+			labels, err := unmarshalLabels(payload.Labels)
+			if err != nil {
+				continue
+			}
+
+			p.invalidations.publish(metrics.Key(payload.Name, labels))
+			continue
+		}
+
+		var payload notification
+
+		err := json.Unmarshal([]byte(n.Extra), &payload)
+		if err != nil {
+			continue
+		}
+
+		if payload.Truncated {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			value, err := p.Get(ctx, payload.Value.Name(), payload.Value.Labels())
+			cancel()
+			if err != nil {
+				continue
+			}
+			payload.Value = value.WithUpdated(time.Time{})
+		}
+
+		p.feed.publish(Sample{Time: payload.Time, Value: payload.Value})
+	}
+}
+
+// series определяет метрику пакета, сохраняемую одной строкой.
+type series struct {
+	value metrics.Metric // Актуальное значение; для счётчика — прирост.
+	base  int64          // Значение счётчика до сохранения пакета.
+}
+
+// save сохраняет пакет значений метрик в транзакции tx и возвращает
+// актуальные значения: для счётчиков, гистограмм и сводок — значение после
+// сохранения, для датчиков — предыдущее значение.
+func save(
+	ctx context.Context,
+	tx *sql.Tx,
+	now time.Time,
+	values []metrics.Metric,
+) ([]metrics.Metric, error) {
+	batch := make(map[string]*series, len(values))
+	keys := make([]string, 0, len(values))
+	zeros := make(map[string]metrics.Metric, len(values))
+
+	for _, value := range values {
+		if value.IsEmpty() {
+			continue
+		}
+		key := seriesKey(value.Name(), value.Labels(), value.Kind())
+		if _, ok := batch[key]; !ok {
+			batch[key] = &series{}
+			keys = append(keys, key)
+			zeros[key] = value.Zero()
+		}
+	}
+
+	if len(keys) == 0 {
+		return make([]metrics.Metric, len(values)), nil
+	}
+
+	sort.Strings(keys)
+
+	var locked rowset
+	for _, key := range keys {
+		locked.append(key, zeros[key])
+	}
+
+	// NOTE: новые метрики вставляются с нулевыми значениями до выборки,
+	// чтобы их строки были заблокированы до конца транзакции: иначе
+	// одновременные транзакции объединяют новые гистограммы и сводки
+	// с пустым значением и перезаписывают результаты друг друга.
+	inserted, err := insertMissing(ctx, tx, now, &locked)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := selectForUpdate(ctx, tx, &locked)
+	if err != nil {
+		return nil, err
+	}
+	for key := range inserted {
+		delete(current, key)
+	}
+
 	actuals := make([]metrics.Metric, len(values))
+	deltas := make([]int64, len(values)) // Прирост счётчика с начала пакета.
 
 	for i, value := range values {
 		if value.IsEmpty() {
 			continue
 		}
 
-		var actual metrics.Metric
+		s := batch[seriesKey(value.Name(), value.Labels(), value.Kind())]
+		old := s.value
+		if old.IsEmpty() {
+			old = current[seriesKey(value.Name(), value.Labels(), value.Kind())]
+		}
 
 		switch value.Kind() {
 		case metrics.KindCounter:
-			actual, err = p.add(ctx, tx, value)
+			deltas[i] = s.value.Int64() + value.Int64()
+			s.value = metrics.Counter(value.Name(), deltas[i], value.Labels()...)
 		case metrics.KindGauge:
-			actual, err = p.update(ctx, tx, value)
+			actuals[i] = old
+			s.value = value
+		case metrics.KindHistogram, metrics.KindSummary:
+			s.value, err = merge(old, value)
+			if err != nil {
+				return nil, err
+			}
+			actuals[i] = s.value
 		}
-		if err != nil {
-			return nil, fmt.Errorf("postgres: saving metrics: %w", err)
+	}
+
+	var rows rowset
+	for _, key := range keys {
+		rows.append(key, batch[key].value)
+	}
+
+	err = upsert(ctx, tx, now, &rows, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples rowset
+
+	for i, value := range values {
+		if value.IsEmpty() {
+			continue
+		}
+
+		if value.Kind() == metrics.KindCounter {
+			s := batch[seriesKey(value.Name(), value.Labels(), value.Kind())]
+			actuals[i] = metrics.Counter(value.Name(), s.base+deltas[i], value.Labels()...)
+		}
+		if value.Kind() != metrics.KindGauge {
+			actuals[i] = actuals[i].WithUpdated(now)
+		}
+
+		sample := actuals[i]
+		if value.Kind() == metrics.KindGauge {
+			sample = value
 		}
 
-		actuals[i] = actual
+		samples.append(seriesKey(value.Name(), value.Labels(), value.Kind()), sample)
 	}
 
-	err = tx.Commit()
+	err = insertSamples(ctx, tx, now, &samples)
 	if err != nil {
-		return nil, fmt.Errorf("postgres: commit transaction: %w", err)
+		return nil, err
 	}
 
 	return actuals, nil
 }
 
-// add увеличивает значение метрики и возвращает его.
-func (p *Postgres) add(
+// insertMissing вставляет отсутствующие метрики пакета и возвращает ключи
+// вставленных строк.
+//
+// NOTE: вставка ожидает завершения транзакции, одновременно вставляющей
+// ту же метрику, после чего строка не вставляется и блокируется выборкой.
+func insertMissing(
 	ctx context.Context,
 	tx *sql.Tx,
-	value metrics.Metric,
-) (metrics.Metric, error) {
+	now time.Time,
+	rows *rowset,
+) (map[string]struct{}, error) {
 	query := `INSERT INTO
-		metrics (name, kind, counter)
-	VALUES
-		($1, $2, $3)
-	ON CONFLICT (name, kind) DO
-	UPDATE
-		SET counter = metrics.counter + $3
-	WHERE
-		metrics.name = $1 AND metrics.kind = $2
-	RETURNING counter;`
+		metrics (name, labels, kind, counter, gauge, histogram, summary, updated)
+	SELECT
+		name, labels, kind, counter, gauge, NULLIF(histogram, ''), NULLIF(summary, ''), $8::timestamptz
+	FROM
+		unnest(
+			$1::varchar[], $2::jsonb[], $3::smallint[],
+			$4::bigint[], $5::double precision[], $6::bytea[], $7::bytea[]
+		) AS b(name, labels, kind, counter, gauge, histogram, summary)
+	ON CONFLICT (name, labels, kind) DO NOTHING
+	RETURNING name, labels, kind;`
+
+	result, err := tx.QueryContext(ctx, query, append(rows.args(), now)...)
+	if err != nil {
+		return nil, fmt.Errorf("inserting the values: %w", err)
+	}
+	defer result.Close()
+
+	inserted := make(map[string]struct{})
+
+	for result.Next() {
+		var (
+			name   string
+			labels []byte
+			kind   metrics.Kind
+		)
+
+		err = result.Scan(&name, &labels, &kind)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("decoding labels: %w", err)
+		}
+
+		inserted[seriesKey(name, ls, kind)] = struct{}{}
+	}
+	if err = result.Err(); err != nil {
+		return nil, fmt.Errorf("iterate by rows: %w", err)
+	}
+
+	return inserted, nil
+}
 
-	var actual int64
+// selectForUpdate блокирует и возвращает текущие значения метрик пакета.
+func selectForUpdate(
+	ctx context.Context,
+	tx *sql.Tx,
+	rows *rowset,
+) (map[string]metrics.Metric, error) {
+	query := `SELECT m.name, m.labels, m.kind, m.counter, m.gauge, m.histogram, m.summary, m.updated
+	FROM metrics m
+	JOIN unnest($1::varchar[], $2::jsonb[], $3::smallint[]) AS b(name, labels, kind)
+		ON m.name = b.name AND m.labels = b.labels AND m.kind = b.kind
+	ORDER BY m.name, m.labels, m.kind
+	FOR UPDATE OF m;`
 
-	err := tx.QueryRowContext(
+	result, err := tx.QueryContext(
 		ctx,
 		query,
-		value.Name(),
-		value.Kind(),
-		value.Int64(),
-	).Scan(&actual)
+		pq.Array(rows.names),
+		pq.Array(rows.labels),
+		pq.Array(rows.kinds),
+	)
 	if err != nil {
-		return metrics.Metric{}, fmt.Errorf("increasing the value: %w", err)
+		return nil, fmt.Errorf("selecting the values: %w", err)
+	}
+	defer result.Close()
+
+	values := make(map[string]metrics.Metric)
+
+	for result.Next() {
+		var (
+			name      string
+			labels    []byte
+			kind      metrics.Kind
+			counter   sql.NullInt64
+			gauge     sql.NullFloat64
+			histogram []byte
+			summary   []byte
+			updated   time.Time
+		)
+
+		err = result.Scan(&name, &labels, &kind, &counter, &gauge, &histogram, &summary, &updated)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("decoding labels: %w", err)
+		}
+
+		metric, err := newMetric(name, ls, kind, counter, gauge, histogram, summary)
+		if err != nil {
+			return nil, err
+		}
+		metric = metric.WithUpdated(updated)
+
+		values[seriesKey(name, ls, kind)] = metric
+	}
+	if err = result.Err(); err != nil {
+		return nil, fmt.Errorf("iterate by rows: %w", err)
 	}
 
-	return metrics.Counter(value.Name(), actual), nil
+	return values, nil
 }
 
-// update обновляет значение метрики и возвращает предыдущее.
-func (p *Postgres) update(
+// upsert записывает значения метрик пакета и сохраняет в batch значения
+// счётчиков до сохранения пакета.
+//
+// NOTE: строки метрик пакета заблокированы в insertMissing
+// и selectForUpdate, поэтому гистограммы и сводки перезаписываются
+// значениями, объединёнными с текущими.
+func upsert(
 	ctx context.Context,
 	tx *sql.Tx,
-	value metrics.Metric,
-) (metrics.Metric, error) {
-	query := `WITH old AS (
-		SELECT gauge FROM metrics WHERE name = $1 AND kind = $2
-	)
-	INSERT INTO
-		metrics (name, kind, gauge)
-	VALUES
-		($1, $2, $3)
-	ON CONFLICT (name, kind) DO
+	now time.Time,
+	rows *rowset,
+	batch map[string]*series,
+) error {
+	query := `INSERT INTO
+		metrics (name, labels, kind, counter, gauge, histogram, summary, updated)
+	SELECT
+		name, labels, kind, counter, gauge, NULLIF(histogram, ''), NULLIF(summary, ''), $8::timestamptz
+	FROM
+		unnest(
+			$1::varchar[], $2::jsonb[], $3::smallint[],
+			$4::bigint[], $5::double precision[], $6::bytea[], $7::bytea[]
+		) AS b(name, labels, kind, counter, gauge, histogram, summary)
+	ON CONFLICT (name, labels, kind) DO
 	UPDATE
-		SET gauge = $3
-		WHERE metrics.name = $1 AND metrics.kind = $2
-	RETURNING (SELECT * FROM old);`
+		SET counter = metrics.counter + EXCLUDED.counter,
+			gauge = EXCLUDED.gauge,
+			histogram = EXCLUDED.histogram,
+			summary = EXCLUDED.summary,
+			updated = EXCLUDED.updated
+	RETURNING name, labels, kind, counter;`
 
-	var (
-		old    sql.NullFloat64
-		metric metrics.Metric
-	)
+	result, err := tx.QueryContext(ctx, query, append(rows.args(), now)...)
+	if err != nil {
+		return fmt.Errorf("updating the values: %w", err)
+	}
+	defer result.Close()
 
-	err := p.db.QueryRowContext(
-		ctx,
-		query,
-		value.Name(),
-		value.Kind(),
-		value.Float64(),
-	).Scan(&old)
+	for result.Next() {
+		var (
+			name    string
+			labels  []byte
+			kind    metrics.Kind
+			counter sql.NullInt64
+		)
+
+		err = result.Scan(&name, &labels, &kind, &counter)
+		if err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return fmt.Errorf("decoding labels: %w", err)
+		}
+
+		if s, ok := batch[seriesKey(name, ls, kind)]; ok && kind == metrics.KindCounter {
+			s.base = counter.Int64 - s.value.Int64()
+		}
+	}
+	if err = result.Err(); err != nil {
+		return fmt.Errorf("iterate by rows: %w", err)
+	}
+
+	return nil
+}
+
+// insertSamples добавляет значения метрик в историю.
+func insertSamples(ctx context.Context, tx *sql.Tx, t time.Time, rows *rowset) error {
+	query := `INSERT INTO
+		samples (name, labels, kind, ts, counter, gauge, histogram, summary)
+	SELECT
+		name, labels, kind, $8::timestamptz, counter, gauge, NULLIF(histogram, ''), NULLIF(summary, '')
+	FROM
+		unnest(
+			$1::varchar[], $2::jsonb[], $3::smallint[],
+			$4::bigint[], $5::double precision[], $6::bytea[], $7::bytea[]
+		) AS b(name, labels, kind, counter, gauge, histogram, summary);`
+
+	_, err := tx.ExecContext(ctx, query, append(rows.args(), t)...)
 	if err != nil {
-		return metrics.Metric{}, fmt.Errorf("updating the value: %w", err)
+		return fmt.Errorf("adding samples: %w", err)
 	}
 
-	if old.Valid {
-		metric = metrics.Gauge(value.Name(), old.Float64)
+	return nil
+}
+
+// rowset определяет строки значений метрик, передаваемые в запрос
+// массивами по колонкам.
+type rowset struct {
+	names      []string
+	labels     []string
+	kinds      []int64
+	counters   []sql.NullInt64
+	gauges     []sql.NullFloat64
+	histograms pq.ByteaArray
+	summaries  pq.ByteaArray
+}
+
+// append добавляет строку метрики с ключом key и значением value.
+func (r *rowset) append(key string, value metrics.Metric) {
+	name, labels, kind := parseSeriesKey(key)
+	counter, gauge, histogram, summary := columns(value)
+
+	r.names = append(r.names, name)
+	r.labels = append(r.labels, labels)
+	r.kinds = append(r.kinds, int64(kind))
+	r.counters = append(r.counters, counter)
+	r.gauges = append(r.gauges, gauge)
+	r.histograms = append(r.histograms, histogram)
+	r.summaries = append(r.summaries, summary)
+}
+
+// args возвращает аргументы запроса.
+func (r *rowset) args() []any {
+	return []any{
+		pq.Array(r.names),
+		pq.Array(r.labels),
+		pq.Array(r.kinds),
+		pq.Array(r.counters),
+		pq.Array(r.gauges),
+		r.histograms,
+		r.summaries,
 	}
+}
 
-	return metric, nil
+// seriesKey возвращает ключ строки метрики в таблице metrics.
+func seriesKey(name string, labels metrics.Labels, kind metrics.Kind) string {
+	return strconv.Itoa(int(kind)) + "\x00" + name + "\x00" + marshalLabels(labels)
+}
+
+// parseSeriesKey возвращает имя, метки в формате JSON и тип метрики
+// по ключу строки.
+func parseSeriesKey(key string) (name, labels string, kind metrics.Kind) {
+	k, rest, _ := strings.Cut(key, "\x00")
+	name, labels, _ = strings.Cut(rest, "\x00")
+	n, _ := strconv.Atoi(k)
+	return name, labels, metrics.Kind(n)
 }
 
 // Get реализует интерфейс storage.Storager.
-func (p *Postgres) Get(ctx context.Context, name string) (metrics.Metric, error) {
-	query := "SELECT kind, counter, gauge FROM metrics WHERE name = $1 LIMIT 1;"
+func (p *Postgres) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	query := `SELECT kind, counter, gauge, histogram, summary, updated FROM metrics
+	WHERE name = $1 AND labels = $2 LIMIT 1;`
 
-	row := p.db.QueryRowContext(ctx, query, name)
+	row := p.db.QueryRowContext(ctx, query, name, marshalLabels(labels))
 	err := row.Err()
 	if err != nil {
 		return metrics.Metric{}, fmt.Errorf("postgres: execution query: %w", err)
 	}
 
 	var (
-		kind    metrics.Kind
-		counter sql.NullInt64
-		gauge   sql.NullFloat64
+		kind      metrics.Kind
+		counter   sql.NullInt64
+		gauge     sql.NullFloat64
+		histogram []byte
+		summary   []byte
+		updated   time.Time
 	)
 
-	err = row.Scan(&kind, &counter, &gauge)
+	err = row.Scan(&kind, &counter, &gauge, &histogram, &summary, &updated)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = ErrNotFound
@@ -208,53 +775,339 @@ func (p *Postgres) Get(ctx context.Context, name string) (metrics.Metric, error)
 		return metrics.Metric{}, fmt.Errorf("postgres: scan row: %w", err)
 	}
 
-	var metric metrics.Metric
-
-	switch kind {
-	case metrics.KindCounter:
-		metric = metrics.Counter(name, counter.Int64)
-	case metrics.KindGauge:
-		metric = metrics.Gauge(name, gauge.Float64)
+	metric, err := newMetric(name, labels, kind, counter, gauge, histogram, summary)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: %w", err)
 	}
 
-	return metric, nil
+	return metric.WithUpdated(updated), nil
 }
 
 // GetAll реализует интерфейс Storager.
 func (p *Postgres) GetAll(ctx context.Context) ([]metrics.Metric, error) {
-	query := "SELECT name, kind, counter, gauge FROM metrics ORDER BY name;"
+	query := `SELECT name, labels, kind, counter, gauge, histogram, summary, updated FROM metrics
+	ORDER BY name, labels;`
 
-	rows, err := p.db.QueryContext(ctx, query)
+	values, err := p.selectMetrics(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("postgres: execution query: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return values, nil
+}
+
+// Select реализует интерфейс Storage.
+//
+// NOTE: регулярное выражение проверяется после чтения строк, а в запросе
+// проверяется только его литеральный префикс.
+func (p *Postgres) Select(ctx context.Context, m Matcher) ([]metrics.Metric, error) {
+	c, err := m.compile()
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	var (
+		conds []string
+		args  []any
+	)
+
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if m.Prefix != "" {
+		where("name LIKE $%d", prefixLike(m.Prefix))
+	}
+	if m.Glob != "" {
+		where("name LIKE $%d", globLike(m.Glob))
+	}
+	if prefix := regexPrefix(m.Regex); prefix != "" {
+		where("name LIKE $%d", prefixLike(prefix))
+	}
+	if m.Kind != metrics.KindUnknown {
+		where("kind = $%d", m.Kind)
+	}
+	if len(m.Labels) > 0 {
+		where("labels @> $%d::jsonb", marshalLabels(m.Labels))
+	}
+
+	query := `SELECT name, labels, kind, counter, gauge, histogram, summary, updated FROM metrics`
+	if len(conds) > 0 {
+		query += "\n\tWHERE " + strings.Join(conds, " AND ")
+	}
+	query += "\n\tORDER BY name, labels;"
+
+	values, err := p.selectMetrics(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	actuals := values[:0]
+	for _, value := range values {
+		if c.match(value) {
+			actuals = append(actuals, value)
+		}
+	}
+
+	return actuals, nil
+}
+
+// selectMetrics возвращает метрики, выбранные запросом query.
+func (p *Postgres) selectMetrics(ctx context.Context, query string, args ...any) ([]metrics.Metric, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: execution query: %w", err)
+	}
+	defer rows.Close()
+
 	values := make([]metrics.Metric, 0, 64)
 
 	for rows.Next() {
 		var (
-			name    string
+			name      string
+			labels    []byte
+			kind      metrics.Kind
+			counter   sql.NullInt64
+			gauge     sql.NullFloat64
+			histogram []byte
+			summary   []byte
+			updated   time.Time
+		)
+
+		err = rows.Scan(&name, &labels, &kind, &counter, &gauge, &histogram, &summary, &updated)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: decoding labels: %w", err)
+		}
+
+		metric, err := newMetric(name, ls, kind, counter, gauge, histogram, summary)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: %w", err)
+		}
+
+		values = append(values, metric.WithUpdated(updated))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres: iterate by rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// Delete реализует интерфейс Storage.
+func (p *Postgres) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return fmt.Errorf("postgres: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ls := marshalLabels(labels)
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM metrics WHERE name = $1 AND labels = $2;`, name, ls)
+	if err != nil {
+		return fmt.Errorf("postgres: deleting the metric: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres: deleting the metric: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	for _, query := range []string{
+		`DELETE FROM samples WHERE name = $1 AND labels = $2;`,
+		`DELETE FROM rollups WHERE name = $1 AND labels = $2;`,
+	} {
+		_, err = tx.ExecContext(ctx, query, name, ls)
+		if err != nil {
+			return fmt.Errorf("postgres: deleting the history: %w", err)
+		}
+	}
+
+	err = invalidate(ctx, tx, name, labels)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("postgres: commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Reset реализует интерфейс Storage.
+func (p *Postgres) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT kind, counter, gauge, histogram, summary, updated FROM metrics
+	WHERE name = $1 AND labels = $2 LIMIT 1
+	FOR UPDATE;`
+
+	var (
+		kind      metrics.Kind
+		counter   sql.NullInt64
+		gauge     sql.NullFloat64
+		histogram []byte
+		summary   []byte
+		updated   time.Time
+	)
+
+	err = tx.QueryRowContext(ctx, query, name, marshalLabels(labels)).
+		Scan(&kind, &counter, &gauge, &histogram, &summary, &updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotFound
+		}
+		return metrics.Metric{}, fmt.Errorf("postgres: scan row: %w", err)
+	}
+
+	actual, err := newMetric(name, labels, kind, counter, gauge, histogram, summary)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: %w", err)
+	}
+	actual = actual.WithUpdated(updated)
+
+	now := time.Now()
+
+	var rows rowset
+	rows.append(seriesKey(name, labels, kind), actual.Zero())
+
+	query = `UPDATE metrics m
+	SET counter = b.counter, gauge = b.gauge,
+		histogram = NULLIF(b.histogram, ''), summary = NULLIF(b.summary, ''),
+		updated = $8::timestamptz
+	FROM
+		unnest(
+			$1::varchar[], $2::jsonb[], $3::smallint[],
+			$4::bigint[], $5::double precision[], $6::bytea[], $7::bytea[]
+		) AS b(name, labels, kind, counter, gauge, histogram, summary)
+	WHERE m.name = b.name AND m.labels = b.labels AND m.kind = b.kind;`
+
+	_, err = tx.ExecContext(ctx, query, append(rows.args(), now)...)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: resetting the value: %w", err)
+	}
+
+	err = insertSamples(ctx, tx, now, &rows)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: %w", err)
+	}
+
+	err = invalidate(ctx, tx, name, labels)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("postgres: commit transaction: %w", err)
+	}
+
+	return actual, nil
+}
+
+// Range реализует интерфейс Storage.
+func (p *Postgres) Range(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]Sample, error) {
+	values, err := selectSamples(ctx, p.db, name, labels, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
+
+// Rollups реализует интерфейс Storage.
+func (p *Postgres) Rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]Rollup, error) {
+	query := `SELECT ts, kind, count, sum, rate, min, max, avg, counter, gauge
+	FROM rollups
+	WHERE name = $1 AND labels = $2 AND resolution = $3 AND ts >= $4 AND ts < $5
+	ORDER BY ts;`
+
+	rows, err := p.db.QueryContext(
+		ctx,
+		query,
+		name,
+		marshalLabels(labels),
+		second(resolution),
+		from,
+		to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: execution query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []Rollup
+
+	for rows.Next() {
+		var (
 			kind    metrics.Kind
 			counter sql.NullInt64
 			gauge   sql.NullFloat64
 		)
 
-		err = rows.Scan(&name, &kind, &counter, &gauge)
+		rollup := Rollup{Resolution: resolution}
+
+		err = rows.Scan(
+			&rollup.Time,
+			&kind,
+			&rollup.Count,
+			&rollup.Sum,
+			&rollup.Rate,
+			&rollup.Min,
+			&rollup.Max,
+			&rollup.Avg,
+			&counter,
+			&gauge,
+		)
 		if err != nil {
 			return nil, fmt.Errorf("postgres: scan row: %w", err)
 		}
 
-		var metric metrics.Metric
-
-		switch kind {
-		case metrics.KindCounter:
-			metric = metrics.Counter(name, counter.Int64)
-		case metrics.KindGauge:
-			metric = metrics.Gauge(name, gauge.Float64)
+		rollup.Value, err = newMetric(name, labels, kind, counter, gauge, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: %w", err)
 		}
 
-		values = append(values, metric)
+		values = append(values, rollup)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("postgres: iterate by rows: %w", err)
@@ -265,3 +1118,383 @@ func (p *Postgres) GetAll(ctx context.Context) ([]metrics.Metric, error) {
 
 	return values, nil
 }
+
+// Retain реализует интерфейс Storage.
+func (p *Postgres) Retain(
+	ctx context.Context,
+	retention configs.Retention,
+	now time.Time,
+) error {
+	if retention.IsEmpty() {
+		return nil
+	}
+
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return fmt.Errorf("postgres: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rawFrom := now.Add(-retention.Raw)
+
+	series, err := selectSeries(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+
+	for _, tier := range retention.Tiers {
+		until := now.Truncate(tier.Resolution)
+
+		for _, value := range series {
+			err = p.downsample(ctx, tx, value, tier.Resolution, until)
+			if err != nil {
+				return fmt.Errorf("postgres: downsampling: %w", err)
+			}
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`DELETE FROM rollups WHERE resolution = $1 AND ts < $2;`,
+			second(tier.Resolution),
+			now.Add(-tier.TTL),
+		)
+		if err != nil {
+			return fmt.Errorf("postgres: deleting expired rollups: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM samples WHERE ts < $1;`, rawFrom)
+	if err != nil {
+		return fmt.Errorf("postgres: deleting expired samples: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("postgres: commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Expire реализует интерфейс Storage.
+func (p *Postgres) Expire(ctx context.Context, before time.Time) (int, error) {
+	query := `WITH expired AS (
+		DELETE FROM metrics WHERE updated < $1 RETURNING name, labels
+	), expired_samples AS (
+		DELETE FROM samples s USING expired e
+		WHERE s.name = e.name AND s.labels = e.labels
+	), expired_rollups AS (
+		DELETE FROM rollups r USING expired e
+		WHERE r.name = e.name AND r.labels = e.labels
+	), invalidated AS (
+		SELECT pg_notify($2, json_build_object('name', name, 'labels', labels)::text)
+		FROM expired
+	)
+	SELECT count(*) FROM invalidated;`
+
+	var n int
+
+	err := p.db.QueryRowContext(ctx, query, before, invalidateChannel).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: deleting expired metrics: %w", err)
+	}
+
+	return n, nil
+}
+
+// downsample агрегирует историю метрики value в уровень resolution,
+// начиная с интервала, следующего за последним агрегированным значением,
+// а при его отсутствии — с первого значения истории.
+func (p *Postgres) downsample(
+	ctx context.Context,
+	tx *sql.Tx,
+	value metrics.Metric,
+	resolution time.Duration,
+	until time.Time,
+) error {
+	labels := marshalLabels(value.Labels())
+
+	var (
+		prev    metrics.Metric
+		ts      time.Time
+		kind    metrics.Kind
+		counter sql.NullInt64
+		gauge   sql.NullFloat64
+	)
+
+	var from time.Time
+
+	query := `SELECT ts, kind, counter, gauge FROM rollups
+	WHERE name = $1 AND labels = $2 AND kind = $3 AND resolution = $4
+	ORDER BY ts DESC LIMIT 1;`
+
+	err := tx.QueryRowContext(ctx, query, value.Name(), labels, value.Kind(), second(resolution)).
+		Scan(&ts, &kind, &counter, &gauge)
+	switch {
+	case err == nil:
+		prev, _ = newMetric(value.Name(), value.Labels(), kind, counter, gauge, nil, nil)
+		from = ts.Add(resolution)
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("selecting the last rollup: %w", err)
+	}
+
+	query = `SELECT kind, counter, gauge FROM samples
+	WHERE name = $1 AND labels = $2 AND kind = $3 AND ts < $4
+	ORDER BY ts DESC LIMIT 1;`
+
+	err = tx.QueryRowContext(ctx, query, value.Name(), labels, value.Kind(), from).
+		Scan(&kind, &counter, &gauge)
+	switch {
+	case err == nil:
+		prev, _ = newMetric(value.Name(), value.Labels(), kind, counter, gauge, nil, nil)
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("selecting the previous sample: %w", err)
+	}
+
+	values, err := selectSamples(ctx, tx, value.Name(), value.Labels(), from, until)
+	if err != nil {
+		return err
+	}
+	values = ofKind(values, value.Kind())
+
+	query = `INSERT INTO
+		rollups (name, labels, kind, resolution, ts, count, sum, rate, min, max, avg, counter, gauge)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (name, labels, kind, resolution, ts) DO NOTHING;`
+
+	for _, rollup := range downsample(values, prev, resolution, until) {
+		counter, gauge, _, _ := columns(rollup.Value)
+
+		_, err = tx.ExecContext(
+			ctx,
+			query,
+			value.Name(),
+			labels,
+			rollup.Value.Kind(),
+			second(resolution),
+			rollup.Time,
+			rollup.Count,
+			rollup.Sum,
+			rollup.Rate,
+			rollup.Min,
+			rollup.Max,
+			rollup.Avg,
+			counter,
+			gauge,
+		)
+		if err != nil {
+			return fmt.Errorf("adding a rollup: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// querier описывает интерфейс выполнения запросов к БД.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// selectSeries возвращает счётчики и датчики без значений, у которых есть
+// история.
+func selectSeries(ctx context.Context, q querier) ([]metrics.Metric, error) {
+	query := `SELECT DISTINCT name, labels, kind FROM samples
+	WHERE kind IN ($1, $2);`
+
+	rows, err := q.QueryContext(ctx, query, metrics.KindCounter, metrics.KindGauge)
+	if err != nil {
+		return nil, fmt.Errorf("execution query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []metrics.Metric
+
+	for rows.Next() {
+		var (
+			name   string
+			labels []byte
+			kind   metrics.Kind
+		)
+
+		err = rows.Scan(&name, &labels, &kind)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("decoding labels: %w", err)
+		}
+
+		metric, err := newMetric(name, ls, kind, sql.NullInt64{}, sql.NullFloat64{}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, metric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate by rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// selectSamples возвращает историю метрики name с метками labels
+// в полуинтервале [from, to).
+func selectSamples(
+	ctx context.Context,
+	q querier,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]Sample, error) {
+	query := `SELECT ts, kind, counter, gauge, histogram, summary FROM samples
+	WHERE name = $1 AND labels = $2 AND ts >= $3 AND ts < $4
+	ORDER BY ts;`
+
+	rows, err := q.QueryContext(ctx, query, name, marshalLabels(labels), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("execution query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []Sample
+
+	for rows.Next() {
+		var (
+			ts        time.Time
+			kind      metrics.Kind
+			counter   sql.NullInt64
+			gauge     sql.NullFloat64
+			histogram []byte
+			summary   []byte
+		)
+
+		err = rows.Scan(&ts, &kind, &counter, &gauge, &histogram, &summary)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		metric, err := newMetric(name, labels, kind, counter, gauge, histogram, summary)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, Sample{Time: ts, Value: metric})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate by rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// second возвращает длительность d в секундах.
+func second(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+// columns возвращает значения колонок для метрики.
+func columns(value metrics.Metric) (
+	counter sql.NullInt64,
+	gauge sql.NullFloat64,
+	histogram []byte,
+	summary []byte,
+) {
+	switch value.Kind() {
+	case metrics.KindCounter:
+		counter = sql.NullInt64{Int64: value.Int64(), Valid: true}
+	case metrics.KindGauge:
+		gauge = sql.NullFloat64{Float64: value.Float64(), Valid: true}
+	case metrics.KindHistogram:
+		histogram, _ = value.Histogram().MarshalBinary()
+	case metrics.KindSummary:
+		summary, _ = value.Summary().MarshalBinary()
+	}
+	return counter, gauge, histogram, summary
+}
+
+// merge возвращает актуальное значение метрики после сохранения value
+// поверх old: для датчика — предыдущее значение, для гистограммы и сводки —
+// объединённое.
+func merge(old, value metrics.Metric) (metrics.Metric, error) {
+	switch value.Kind() {
+	case metrics.KindGauge:
+		return old, nil
+	case metrics.KindHistogram:
+		h := value.Histogram().Clone()
+		if !old.IsEmpty() {
+			h = old.Histogram().Clone()
+			if err := h.Merge(value.Histogram()); err != nil {
+				return metrics.Metric{}, fmt.Errorf("merging the value: %w", err)
+			}
+		}
+		return metrics.Histogram(value.Name(), h, value.Labels()...), nil
+	case metrics.KindSummary:
+		sketch := value.Summary().Clone()
+		if !old.IsEmpty() {
+			sketch = old.Summary().Clone()
+			if err := sketch.Merge(value.Summary()); err != nil {
+				return metrics.Metric{}, fmt.Errorf("merging the value: %w", err)
+			}
+		}
+		return metrics.Summary(value.Name(), sketch, value.Labels()...), nil
+	}
+	return value, nil
+}
+
+// newMetric возвращает метрику, собранную из значений колонок.
+func newMetric(
+	name string,
+	labels metrics.Labels,
+	kind metrics.Kind,
+	counter sql.NullInt64,
+	gauge sql.NullFloat64,
+	histogram []byte,
+	summary []byte,
+) (metrics.Metric, error) {
+	var metric metrics.Metric
+
+	switch kind {
+	case metrics.KindCounter:
+		metric = metrics.Counter(name, counter.Int64, labels...)
+	case metrics.KindGauge:
+		metric = metrics.Gauge(name, gauge.Float64, labels...)
+	case metrics.KindHistogram:
+		var h metrics.HistogramValue
+		if err := h.UnmarshalBinary(histogram); err != nil {
+			return metrics.Metric{}, fmt.Errorf("decoding a histogram: %w", err)
+		}
+		metric = metrics.Histogram(name, &h, labels...)
+	case metrics.KindSummary:
+		var sketch metrics.Sketch
+		if err := sketch.UnmarshalBinary(summary); err != nil {
+			return metrics.Metric{}, fmt.Errorf("decoding a summary: %w", err)
+		}
+		metric = metrics.Summary(name, &sketch, labels...)
+	}
+
+	return metric, nil
+}
+
+// marshalLabels возвращает метки в формате JSON.
+func marshalLabels(labels metrics.Labels) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	b, _ := json.Marshal(labels.Map())
+	return string(b)
+}
+
+// unmarshalLabels декодирует метки из формата JSON.
+func unmarshalLabels(data []byte) (metrics.Labels, error) {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return metrics.LabelsFromMap(m), nil
+}
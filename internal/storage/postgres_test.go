@@ -2,10 +2,14 @@ package storage_test
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/sergeizaitcev/metrics/internal/configs"
 	"github.com/sergeizaitcev/metrics/internal/metrics"
 	"github.com/sergeizaitcev/metrics/internal/storage"
 	"github.com/sergeizaitcev/metrics/pkg/testutil"
@@ -120,7 +124,7 @@ func TestPostgres(t *testing.T) {
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				got, err := storage.Get(ctx, tc.name)
+				got, err := storage.Get(ctx, tc.name, nil)
 				if tc.wantError {
 					require.Error(t, err)
 				} else {
@@ -145,7 +149,377 @@ func TestPostgres(t *testing.T) {
 		require.NoError(t, err)
 
 		require.Len(t, values, len(want))
-		require.Equal(t, want, values)
+		for i := range want {
+			require.True(t, want[i].Equal(values[i]))
+			require.False(t, values[i].Updated().IsZero())
+		}
+	})
+
+	t.Run("select", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+		testSelect(t, ctx, storage)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+		testWatch(t, ctx, storage)
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		hostA := metrics.Label{Name: "host", Value: "a"}
+		hostB := metrics.Label{Name: "host", Value: "b"}
+
+		_, err := storage.Save(ctx,
+			metrics.Counter("counter", 1, hostA),
+			metrics.Counter("counter", 2, hostB),
+			metrics.Counter("counter", 1, hostA),
+			metrics.Gauge("gauge", 1, hostA),
+		)
+		require.NoError(t, err)
+
+		got, err := storage.Get(ctx, "counter", metrics.NewLabels(hostA))
+		require.NoError(t, err)
+		want := metrics.Counter("counter", 2, hostA)
+		require.True(t, want.Equal(got))
+
+		got, err = storage.Get(ctx, "gauge", metrics.NewLabels(hostA))
+		require.NoError(t, err)
+		want = metrics.Gauge("gauge", 1, hostA)
+		require.True(t, want.Equal(got))
+
+		_, err = storage.Get(ctx, "counter", nil)
+		require.Error(t, err)
+
+		values, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 3)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 10), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		values := []metrics.Metric{
+			metrics.Counter("counter", 1),
+			metrics.Gauge("gauge", 2),
+			{},
+			metrics.Counter("counter", 2, metrics.Label{Name: "host", Value: "a"}),
+			metrics.Counter("counter", 3),
+			metrics.Gauge("gauge", 3),
+			metrics.Gauge("new", 1),
+		}
+
+		want := []metrics.Metric{
+			metrics.Counter("counter", 11),
+			metrics.Gauge("gauge", 1),
+			{},
+			metrics.Counter("counter", 2, metrics.Label{Name: "host", Value: "a"}),
+			metrics.Counter("counter", 14),
+			metrics.Gauge("gauge", 2),
+			{},
+		}
+
+		got, err := storage.Save(ctx, values...)
+		require.NoError(t, err)
+		require.Len(t, got, len(want))
+		for i := range want {
+			require.True(t, want[i].Equal(got[i]), "%d: %s", i, got[i])
+		}
+
+		all, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, all, 4)
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, 3)
+
+		// NOTE: значения одного пакета сохраняются в один момент времени.
+		totals := make([]int64, 0, len(samples))
+		for _, sample := range samples {
+			totals = append(totals, sample.Value.Int64())
+		}
+		require.ElementsMatch(t, []int64{10, 11, 14}, totals)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Delete(ctx, "counter", nil))
+		require.Error(t, storage.Delete(ctx, "counter", nil))
+
+		_, err = storage.Get(ctx, "counter", nil)
+		require.Error(t, err)
+
+		_, err = storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.Error(t, err)
+
+		values, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 1)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+
+		before := time.Now()
+
+		_, err = storage.Save(ctx, metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		n, err := storage.Expire(ctx, before)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		_, err = storage.Get(ctx, "counter", nil)
+		require.Error(t, err)
+
+		_, err = storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.Error(t, err)
+
+		got, err := storage.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.False(t, got.Updated().Before(before))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 10))
+		require.NoError(t, err)
+
+		got, err := storage.Reset(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 10, got.Int64())
+
+		_, err = storage.Reset(ctx, "unknown", nil)
+		require.Error(t, err)
+
+		_, err = storage.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+
+		got, err = storage.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, got.Int64())
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, 3)
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		h, _ := metrics.NewHistogramValue([]float64{1, 2})
+		h.Observe(0.5)
+
+		_, err := storage.Save(ctx,
+			metrics.Histogram("histogram", h),
+			metrics.Histogram("histogram", h),
+		)
+		require.NoError(t, err)
+
+		want, _ := metrics.NewHistogramValue([]float64{1, 2})
+		want.Observe(0.5)
+		want.Observe(0.5)
+
+		got, err := storage.Get(ctx, "histogram", nil)
+		require.NoError(t, err)
+		require.True(t, want.Equal(got.Histogram()))
+
+		mismatch, _ := metrics.NewHistogramValue([]float64{1})
+		mismatch.Observe(1)
+
+		_, err = storage.Save(ctx, metrics.Histogram("histogram", mismatch))
+		require.Error(t, err)
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		s, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		s.Add(0.5)
+
+		_, err := storage.Save(ctx,
+			metrics.Summary("summary", s),
+			metrics.Summary("summary", s),
+		)
+		require.NoError(t, err)
+
+		want, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		want.Add(0.5)
+		want.Add(0.5)
+
+		got, err := storage.Get(ctx, "summary", nil)
+		require.NoError(t, err)
+		require.True(t, want.Equal(got.Summary()))
+
+		mismatch, _ := metrics.NewSketch(0.05)
+		mismatch.Add(1)
+
+		_, err = storage.Save(ctx, metrics.Summary("summary", mismatch))
+		require.Error(t, err)
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		const (
+			writers = 8
+			n       = 20
+		)
+
+		h, _ := metrics.NewHistogramValue([]float64{1, 2})
+		h.Observe(0.5)
+
+		sketch, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		sketch.Add(0.5)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < n; j++ {
+					_, err := storage.Save(ctx,
+						metrics.Counter("counter", 1),
+						metrics.Histogram("histogram", h),
+						metrics.Summary("summary", sketch),
+					)
+					assert.NoError(t, err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		counter, err := storage.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, writers*n, counter.Int64())
+
+		histogram, err := storage.Get(ctx, "histogram", nil)
+		require.NoError(t, err)
+		require.Equal(t, []uint64{writers * n, 0, 0}, histogram.Histogram().Counts)
+
+		summary, err := storage.Get(ctx, "summary", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, writers*n, summary.Summary().Count())
+	})
+
+	t.Run("range", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		start := time.Now()
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		_, err = storage.Save(ctx, metrics.Counter("counter", 2), metrics.Gauge("gauge", 2))
+		require.NoError(t, err)
+
+		end := time.Now().Add(time.Second)
+
+		got, err := storage.Range(ctx, "counter", nil, start.Add(-time.Second), end)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		require.EqualValues(t, 1, got[0].Value.Int64())
+		require.EqualValues(t, 3, got[1].Value.Int64())
+
+		got, err = storage.Range(ctx, "gauge", nil, start.Add(-time.Second), end)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		require.EqualValues(t, 2, got[1].Value.Float64())
+
+		_, err = storage.Range(ctx, "gauge", nil, end, end.Add(time.Hour))
+		require.Error(t, err)
+	})
+
+	t.Run("retain", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := storage.Save(ctx,
+			metrics.Counter("counter", 1), metrics.Gauge("gauge", 1),
+			metrics.Counter("counter", 2), metrics.Gauge("gauge", 3),
+		)
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Minute)))
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(3*time.Minute)))
+
+		counter, err := storage.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, counter, 1)
+		require.Equal(t, 3.0, counter[0].Sum)
+		require.EqualValues(t, 3, counter[0].Value.Int64())
+
+		gauge, err := storage.Rollups(ctx, "gauge", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, gauge, 1)
+		require.Equal(t, 1.0, gauge[0].Min)
+		require.Equal(t, 3.0, gauge[0].Max)
+		require.Equal(t, 2.0, gauge[0].Avg)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Hour)))
+
+		_, err = storage.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.Error(t, err)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(25*time.Hour)))
+
+		_, err = storage.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.Error(t, err)
+	})
+
+	t.Run("retain_late", func(t *testing.T) {
+		storage, ctx := testPostgres(t)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1), metrics.Counter("counter", 2))
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		// NOTE: первая агрегация выполняется после истечения срока хранения
+		// исходных значений.
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Hour)))
+
+		_, err = storage.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.Error(t, err)
+
+		counter, err := storage.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, counter, 1)
+		require.Equal(t, 3.0, counter[0].Sum)
 	})
 
 	t.Run("not_found", func(t *testing.T) {
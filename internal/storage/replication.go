@@ -0,0 +1,564 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/configs"
+)
+
+const (
+	// replicationBatch определяет максимальное количество записей в пакете.
+	replicationBatch = 1024
+
+	// snapshotChunkSize определяет максимальный размер части снимка в байтах.
+	snapshotChunkSize = 1 << 20
+
+	// heartbeatInterval определяет интервал отправки пустых пакетов, по
+	// которым ведомое хранилище узнаёт своё отставание.
+	heartbeatInterval = time.Second
+)
+
+var (
+	errReplicaBehind   = errors.New("replica is too far behind")
+	errReplicaGap      = errors.New("replication batch does not follow the applied records")
+	errReplicaPromoted = errors.New("replica is promoted")
+)
+
+// ReplicationBatch определяет пакет записей WAL ведущего хранилища.
+//
+// Записи передаются в формате WAL версии 2 и нумеруются в пределах эпохи
+// ведущего хранилища последовательными номерами LSN, начиная с единицы.
+type ReplicationBatch struct {
+	// Эпоха журнала ведущего хранилища; меняется при каждом запуске
+	// и повышении хранилища.
+	Epoch uint64
+
+	// LSN последней записи пакета; для снимка — LSN последней записи,
+	// учтённой в снимке.
+	LSN uint64
+
+	// LSN последней записи ведущего хранилища на момент отправки пакета.
+	Head uint64
+
+	// Записи пакета.
+	Records [][]byte
+
+	// Индикатор того, что записи являются частью снимка, который заменяет
+	// состояние ведомого хранилища.
+	Snapshot bool
+
+	// Индикатор последней части снимка.
+	Last bool
+}
+
+// ReplicationSource определяет источник записей ведущего хранилища.
+type ReplicationSource interface {
+	// Replicate передаёт в send записи, следующие за записью lsn эпохи
+	// epoch, и блокируется до отмены ctx или ошибки. Если записи эпохи
+	// недоступны, то сначала передаётся снимок состояния.
+	Replicate(
+		ctx context.Context,
+		epoch, lsn uint64,
+		send func(ReplicationBatch) error,
+	) error
+}
+
+// ReplicationStatus определяет состояние репликации хранилища.
+type ReplicationStatus struct {
+	// Индикатор ведомого хранилища.
+	Follower bool
+
+	// Эпоха журнала ведущего хранилища.
+	Epoch uint64
+
+	// LSN последней применённой записи; для ведущего хранилища — LSN
+	// последней записи журнала.
+	LSN uint64
+
+	// LSN последней записи ведущего хранилища.
+	Head uint64
+
+	// Время получения последнего пакета от ведущего хранилища.
+	Updated time.Time
+
+	// Количество применённых снимков.
+	Snapshots int
+}
+
+// Lag возвращает количество записей ведущего хранилища, которые ещё
+// не применены.
+func (s ReplicationStatus) Lag() uint64 {
+	if s.Head < s.LSN {
+		return 0
+	}
+	return s.Head - s.LSN
+}
+
+// replication определяет состояние репликации локального хранилища.
+type replication struct {
+	mu        sync.Mutex
+	follower  bool
+	epoch     uint64
+	lsn       uint64
+	head      uint64
+	updated   time.Time
+	snapshots int
+	backlog   int                // Размер журнала репликации.
+	syncing   bool               // Индикатор применения снимка.
+	cancel    context.CancelFunc // Отменяет Follow при повышении.
+}
+
+// Replication возвращает состояние репликации хранилища.
+func (l *Local) Replication() ReplicationStatus {
+	l.repl.mu.Lock()
+	defer l.repl.mu.Unlock()
+
+	status := ReplicationStatus{
+		Follower:  l.repl.follower,
+		Epoch:     l.repl.epoch,
+		LSN:       l.repl.lsn,
+		Head:      l.repl.head,
+		Updated:   l.repl.updated,
+		Snapshots: l.repl.snapshots,
+	}
+
+	if !status.Follower && l.log != nil {
+		status.Epoch, status.LSN = l.log.position()
+		status.Head = status.LSN
+	}
+
+	return status
+}
+
+// Replicate реализует интерфейс ReplicationSource.
+func (l *Local) Replicate(
+	ctx context.Context,
+	epoch, lsn uint64,
+	send func(ReplicationBatch) error,
+) error {
+	log := l.source()
+	if log == nil {
+		return fmt.Errorf("local: %w", ErrReplicationDisabled)
+	}
+
+	current, _ := log.position()
+	if epoch != current || !log.contains(lsn+1) {
+		var err error
+		lsn, err = l.sendSnapshot(ctx, log, send)
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		records, last, wait, err := log.read(lsn+1, replicationBatch)
+		if err != nil {
+			return fmt.Errorf("local: %w", err)
+		}
+
+		if len(records) > 0 {
+			_, head := log.position()
+			err = send(ReplicationBatch{
+				Epoch:   current,
+				LSN:     last,
+				Head:    head,
+				Records: records,
+			})
+			if err != nil {
+				return err
+			}
+			lsn = last
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.term:
+			return ErrStorageClosed
+		case <-wait:
+		case <-ticker.C:
+			err = send(ReplicationBatch{Epoch: current, LSN: lsn, Head: last})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSnapshot передаёт в send снимок состояния хранилища частями
+// и возвращает LSN последней учтённой в нём записи.
+func (l *Local) sendSnapshot(
+	ctx context.Context,
+	log *replog,
+	send func(ReplicationBatch) error,
+) (uint64, error) {
+	err := l.mu.rlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// NOTE: журнал дополняется под блокировкой на запись, поэтому снимок
+	// соответствует последней записи журнала.
+	epoch, lsn := log.position()
+
+	var (
+		chunks [][][]byte
+		chunk  [][]byte
+		size   int
+	)
+
+	err = l.dump(func(r record) error {
+		b, err := r.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("converting a record to bytes: %w", err)
+		}
+		if size+len(b) > snapshotChunkSize && len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, b)
+		size += len(b)
+		return nil
+	})
+	l.mu.runlock()
+	if err != nil {
+		return 0, fmt.Errorf("local: dumping a snapshot: %w", err)
+	}
+
+	chunks = append(chunks, chunk)
+
+	for i, records := range chunks {
+		_, head := log.position()
+		err = send(ReplicationBatch{
+			Epoch:    epoch,
+			LSN:      lsn,
+			Head:     head,
+			Records:  records,
+			Snapshot: true,
+			Last:     i == len(chunks)-1,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return lsn, nil
+}
+
+// Follow применяет записи ведущего хранилища src и блокируется до отмены
+// ctx, ошибки или повышения хранилища вызовом Promote; при повышении
+// возвращается nil.
+func (l *Local) Follow(ctx context.Context, src ReplicationSource) error {
+	if l.readOnly {
+		return fmt.Errorf("local: %w", ErrReadOnly)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	l.repl.mu.Lock()
+	if !l.repl.follower {
+		l.repl.mu.Unlock()
+		return nil
+	}
+	l.repl.cancel = cancel
+	l.repl.syncing = false
+	epoch, lsn := l.repl.epoch, l.repl.lsn
+	l.repl.mu.Unlock()
+
+	err := src.Replicate(ctx, epoch, lsn, func(batch ReplicationBatch) error {
+		return l.apply(ctx, batch)
+	})
+
+	if !l.isFollower() {
+		return nil
+	}
+
+	return err
+}
+
+// Promote повышает ведомое хранилище до ведущего: хранилище прекращает
+// применять записи ведущего, начинает принимать изменения и новую эпоху
+// журнала репликации.
+func (l *Local) Promote(ctx context.Context) error {
+	if l.readOnly {
+		return fmt.Errorf("local: %w", ErrReadOnly)
+	}
+
+	err := l.lockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer l.unlock()
+
+	l.repl.mu.Lock()
+	defer l.repl.mu.Unlock()
+
+	if !l.repl.follower {
+		return nil
+	}
+
+	l.repl.follower = false
+	if l.repl.cancel != nil {
+		l.repl.cancel()
+	}
+
+	if l.repl.backlog > 0 {
+		l.log = newReplog(l.repl.backlog)
+	}
+
+	return nil
+}
+
+// source возвращает журнал репликации ведущего хранилища или nil, если
+// хранилище не может быть источником репликации.
+func (l *Local) source() *replog {
+	l.repl.mu.Lock()
+	defer l.repl.mu.Unlock()
+	if l.repl.follower {
+		return nil
+	}
+	return l.log
+}
+
+// isFollower возвращает true, если хранилище является ведомым.
+func (l *Local) isFollower() bool {
+	l.repl.mu.Lock()
+	defer l.repl.mu.Unlock()
+	return l.repl.follower
+}
+
+// apply применяет пакет записей ведущего хранилища.
+func (l *Local) apply(ctx context.Context, batch ReplicationBatch) error {
+	err := l.lockContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: изменения рассылаются под блокировкой в порядке их применения.
+	samples, err := l.applyLocked(batch)
+	if err == nil {
+		l.feed.publish(samples...)
+	}
+	l.unlock()
+	if err != nil {
+		return err
+	}
+
+	if l.synced && !batch.Snapshot {
+		err = l.wal.flush()
+		if err != nil {
+			return fmt.Errorf("local: synchronous writing to a file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// applyLocked выполняет apply под блокировкой и возвращает сохранённые
+// значения метрик.
+func (l *Local) applyLocked(batch ReplicationBatch) ([]Sample, error) {
+	l.repl.mu.Lock()
+	defer l.repl.mu.Unlock()
+
+	if !l.repl.follower {
+		return nil, fmt.Errorf("local: %w", errReplicaPromoted)
+	}
+
+	l.repl.head = batch.Head
+	l.repl.updated = time.Now()
+
+	if batch.Snapshot {
+		return nil, l.applySnapshot(batch)
+	}
+
+	// NOTE: записи после пропуска нельзя применить, поэтому при следующей
+	// попытке запрашивается снимок.
+	first := batch.LSN - uint64(len(batch.Records))
+	if l.repl.syncing || batch.Epoch != l.repl.epoch || first != l.repl.lsn {
+		l.repl.epoch = 0
+		return nil, fmt.Errorf("local: %w", errReplicaGap)
+	}
+
+	var samples []Sample
+
+	for _, b := range batch.Records {
+		var e record
+
+		err := e.UnmarshalBinary(b)
+		if err != nil {
+			l.repl.epoch = 0
+			return nil, fmt.Errorf("local: reading a replicated record: %w", err)
+		}
+
+		err = l.read(e)
+		if err != nil {
+			l.repl.epoch = 0
+			return nil, fmt.Errorf("local: applying a replicated record: %w", err)
+		}
+
+		l.wal.append(b)
+		l.repl.lsn++
+
+		switch e.op {
+		case operationAdd, operationUpdate:
+			value := l.metrics.get(e.metric.Key())
+			samples = append(samples, Sample{
+				Time:  e.time,
+				Value: value.WithUpdated(time.Time{}),
+			})
+		}
+	}
+
+	return samples, nil
+}
+
+// applySnapshot применяет часть снимка ведущего хранилища.
+func (l *Local) applySnapshot(batch ReplicationBatch) error {
+	if !l.repl.syncing {
+		l.repl.syncing = true
+		l.repl.epoch = 0
+		l.metrics = newMemstorage()
+		l.samples = make(samples)
+		l.rollups = make(rollups)
+		l.saved = make(map[string]int)
+		l.rewrite = true
+	}
+
+	for _, b := range batch.Records {
+		var e record
+
+		err := e.UnmarshalBinary(b)
+		if err == nil {
+			err = l.read(e)
+		}
+		if err != nil {
+			return fmt.Errorf("local: applying a snapshot: %w", err)
+		}
+	}
+
+	if !batch.Last {
+		return nil
+	}
+
+	// NOTE: снимок заменяет журнал целиком, поэтому записи, сделанные
+	// до снимка, не восстанавливаются.
+	err := l.compact()
+	if err != nil {
+		return fmt.Errorf("local: writing a snapshot: %w", err)
+	}
+
+	l.repl.syncing = false
+	l.repl.epoch = batch.Epoch
+	l.repl.lsn = batch.LSN
+	l.repl.snapshots++
+
+	return nil
+}
+
+// replog определяет журнал репликации: кольцевой буфер последних записей
+// WAL, пронумерованных в пределах эпохи.
+type replog struct {
+	mu     sync.Mutex
+	epoch  uint64
+	buf    [][]byte
+	last   uint64        // LSN последней записи; 0, если записей нет.
+	notify chan struct{} // Закрывается при добавлении записи.
+}
+
+func newReplog(size int) *replog {
+	return &replog{
+		epoch:  uint64(time.Now().UnixNano()),
+		buf:    make([][]byte, size),
+		notify: make(chan struct{}),
+	}
+}
+
+// append добавляет запись в журнал.
+func (r *replog) append(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.last++
+	r.buf[r.last%uint64(len(r.buf))] = b
+
+	close(r.notify)
+	r.notify = make(chan struct{})
+}
+
+// position возвращает эпоху журнала и LSN последней записи.
+func (r *replog) position() (epoch, lsn uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.epoch, r.last
+}
+
+// contains возвращает true, если запись lsn есть в журнале или будет
+// добавлена следующей.
+func (r *replog) contains(lsn uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return lsn >= r.first() && lsn <= r.last+1
+}
+
+// first возвращает LSN первой записи в журнале.
+func (r *replog) first() uint64 {
+	if r.last < uint64(len(r.buf)) {
+		return 1
+	}
+	return r.last - uint64(len(r.buf)) + 1
+}
+
+// read возвращает не более n записей, начиная с записи from, и LSN
+// последней из них. Если записей нет, то возвращается канал, который
+// закрывается при добавлении записи.
+func (r *replog) read(from uint64, n int) (records [][]byte, last uint64, wait <-chan struct{}, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if from < r.first() {
+		return nil, 0, nil, errReplicaBehind
+	}
+	if from > r.last {
+		return nil, r.last, r.notify, nil
+	}
+
+	last = r.last
+	if last-from >= uint64(n) {
+		last = from + uint64(n) - 1
+	}
+
+	records = make([][]byte, 0, last-from+1)
+	for lsn := from; lsn <= last; lsn++ {
+		records = append(records, r.buf[lsn%uint64(len(r.buf))])
+	}
+
+	return records, last, nil, nil
+}
+
+// prune удаляет историю метрик, срок хранения которой истёк к моменту now,
+// не агрегируя её.
+func (l *Local) prune(ctx context.Context, retention configs.Retention, now time.Time) error {
+	err := l.lockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer l.unlock()
+
+	for _, tier := range retention.Tiers {
+		l.rollups.expire(tier.Resolution, now.Add(-tier.TTL))
+	}
+	if l.samples.expire(now.Add(-retention.Raw)) {
+		l.rewrite = true
+	}
+
+	return nil
+}
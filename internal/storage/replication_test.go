@@ -0,0 +1,137 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+// follow запускает применение записей leader хранилищем follower в фоне.
+func follow(t *testing.T, follower, leader *storage.Local) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- follower.Follow(ctx, leader) }()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// caughtUp ожидает, пока follower не применит все записи ведущего
+// хранилища.
+func caughtUp(t *testing.T, follower, leader *storage.Local) {
+	require.Eventually(t, func() bool {
+		status := follower.Replication()
+		return status.Epoch == leader.Replication().Epoch &&
+			status.LSN == leader.Replication().LSN
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLocal_replication(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	leader, err := storage.NewLocal(filename(t), &storage.LocalOpts{ReplicationBacklog: 4})
+	require.NoError(t, err)
+	t.Cleanup(func() { leader.Close() })
+
+	follower, err := storage.NewLocal(filename(t), &storage.LocalOpts{Follower: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { follower.Close() })
+
+	// NOTE: записей больше, чем вмещает журнал репликации, поэтому
+	// ведомое хранилище догоняет ведущее по снимку.
+	for i := 0; i < 8; i++ {
+		_, err = leader.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+	}
+
+	follow(t, follower, leader)
+
+	t.Run("snapshot", func(t *testing.T) {
+		caughtUp(t, follower, leader)
+
+		got, err := follower.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 8, got.Int64())
+
+		status := follower.Replication()
+		require.True(t, status.Follower)
+		require.Equal(t, 1, status.Snapshots)
+		require.Zero(t, status.Lag())
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		_, err := leader.Save(ctx, metrics.Gauge("gauge", 1.5))
+		require.NoError(t, err)
+		require.NoError(t, leader.Delete(ctx, "counter", nil))
+
+		caughtUp(t, follower, leader)
+
+		got, err := follower.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.Equal(t, 1.5, got.Float64())
+
+		_, err = follower.Get(ctx, "counter", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		require.Equal(t, 1, follower.Replication().Snapshots)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		_, err := follower.Save(ctx, metrics.Gauge("gauge", 2))
+		require.ErrorIs(t, err, storage.ErrReadOnly)
+
+		err = follower.Replicate(ctx, 0, 0, func(storage.ReplicationBatch) error { return nil })
+		require.ErrorIs(t, err, storage.ErrReplicationDisabled)
+	})
+
+	t.Run("promote", func(t *testing.T) {
+		require.NoError(t, follower.Promote(ctx))
+		require.False(t, follower.Replication().Follower)
+
+		_, err := follower.Save(ctx, metrics.Gauge("gauge", 2))
+		require.NoError(t, err)
+
+		got, err := follower.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, got.Float64())
+	})
+}
+
+func TestReplicationStatus_Lag(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status storage.ReplicationStatus
+		want   uint64
+	}{
+		{
+			name:   "behind",
+			status: storage.ReplicationStatus{LSN: 3, Head: 10},
+			want:   7,
+		},
+		{
+			name:   "caught up",
+			status: storage.ReplicationStatus{LSN: 10, Head: 10},
+			want:   0,
+		},
+		{
+			name:   "stale head",
+			status: storage.ReplicationStatus{LSN: 10, Head: 3},
+			want:   0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.status.Lag())
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// Rollup определяет агрегированные значения счётчика или датчика
+// за интервал.
+type Rollup struct {
+	// Начало интервала.
+	Time time.Time
+
+	// Длительность интервала.
+	Resolution time.Duration
+
+	// Последнее значение метрики в интервале.
+	Value metrics.Metric
+
+	// Количество исходных значений в интервале.
+	Count uint64
+
+	// Прирост счётчика или сумма значений датчика за интервал.
+	Sum float64
+
+	// Скорость прироста счётчика в секунду.
+	Rate float64
+
+	// Минимальное, максимальное и среднее значения датчика.
+	Min, Max, Avg float64
+}
+
+// downsample агрегирует отсортированные по времени значения метрики
+// в интервалы длительностью resolution, завершившиеся к моменту until.
+// Для счётчиков prev содержит последнее значение перед values; если prev
+// пуст, счётчик считается начатым с нуля.
+func downsample(
+	values []Sample,
+	prev metrics.Metric,
+	resolution time.Duration,
+	until time.Time,
+) []Rollup {
+	var (
+		rollups []Rollup
+		current *Rollup
+	)
+
+	last := prev.Int64()
+
+	for _, value := range values {
+		start := value.Time.Truncate(resolution)
+		if start.Add(resolution).After(until) {
+			break
+		}
+
+		if current == nil || !current.Time.Equal(start) {
+			rollups = append(rollups, Rollup{
+				Time:       start,
+				Resolution: resolution,
+				Min:        math.Inf(1),
+				Max:        math.Inf(-1),
+			})
+			current = &rollups[len(rollups)-1]
+		}
+
+		current.Value = value.Value
+		current.Count++
+
+		switch value.Value.Kind() {
+		case metrics.KindCounter:
+			delta := value.Value.Int64() - last
+			if delta < 0 {
+				// NOTE: счётчик был сброшен.
+				delta = value.Value.Int64()
+			}
+			last = value.Value.Int64()
+			current.Sum += float64(delta)
+			current.Rate = current.Sum / resolution.Seconds()
+		case metrics.KindGauge:
+			v := value.Value.Float64()
+			current.Sum += v
+			current.Min = math.Min(current.Min, v)
+			current.Max = math.Max(current.Max, v)
+			current.Avg = current.Sum / float64(current.Count)
+		}
+	}
+
+	for i := range rollups {
+		if rollups[i].Value.Kind() == metrics.KindCounter {
+			rollups[i].Min, rollups[i].Max = 0, 0
+		}
+	}
+
+	return rollups
+}
+
+// ofKind возвращает значения values типа kind.
+//
+// NOTE: метрики разных типов могут иметь одинаковые имя и метки, но
+// агрегируются по отдельности.
+func ofKind(values []Sample, kind metrics.Kind) []Sample {
+	n := 0
+	for _, value := range values {
+		if value.Value.Kind() == kind {
+			values[n] = value
+			n++
+		}
+	}
+	return values[:n]
+}
+
+// downsampled возвращает true, если значения метрики агрегируются в уровни
+// хранения.
+func downsampled(kind metrics.Kind) bool {
+	return kind == metrics.KindCounter || kind == metrics.KindGauge
+}
+
+// appendRollup добавляет агрегированные значения, за исключением времени
+// и последнего значения метрики, в конец data.
+func appendRollup(data []byte, r *Rollup) []byte {
+	data = binary.AppendUvarint(data, uint64(r.Resolution))
+	data = binary.AppendUvarint(data, r.Count)
+	for _, v := range [...]float64{r.Sum, r.Rate, r.Min, r.Max, r.Avg} {
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(v))
+	}
+	return data
+}
+
+// readRollup считывает агрегированные значения из data и возвращает
+// оставшиеся данные.
+func readRollup(data []byte, r *Rollup) ([]byte, error) {
+	errCorrupted := errors.New("rollup is corrupted")
+
+	resolution, n := binary.Uvarint(data)
+	if n <= 0 || resolution == 0 || resolution > math.MaxInt64 {
+		return nil, errCorrupted
+	}
+	data = data[n:]
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 || len(data)-n < 40 {
+		return nil, errCorrupted
+	}
+	data = data[n:]
+
+	r.Resolution = time.Duration(resolution)
+	r.Count = count
+
+	for _, v := range [...]*float64{&r.Sum, &r.Rate, &r.Min, &r.Max, &r.Avg} {
+		*v = math.Float64frombits(binary.BigEndian.Uint64(data))
+		data = data[8:]
+	}
+
+	return data, nil
+}
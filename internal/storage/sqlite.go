@@ -0,0 +1,957 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/sergeizaitcev/metrics/deployments/migrations"
+	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+var _ Storage = (*SQLite)(nil)
+
+// SQLite определяет хранилище метрик во встроенной БД SQLite.
+//
+// Время в истории хранится в наносекундах Unix, разрешение агрегирования —
+// в секундах.
+type SQLite struct {
+	db   *sql.DB
+	feed *feed[Sample]
+}
+
+// NewSQLite возвращает новый экземпляр хранилища метрик в файле БД SQLite.
+func NewSQLite(filename string) (*SQLite, error) {
+	query := url.Values{}
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "synchronous(NORMAL)")
+	query.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+filename+"?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: open database: %w", err)
+	}
+
+	// NOTE: SQLite допускает только одну пишущую транзакцию; одно
+	// соединение исключает ошибки SQLITE_BUSY при конкурентной записи.
+	db.SetMaxOpenConns(1)
+
+	return &SQLite{
+		db:   db,
+		feed: newFeed[Sample](),
+	}, nil
+}
+
+// MigrateCheck возвращает ошибку, если в БД применены не все миграции.
+func (s *SQLite) MigrateCheck(ctx context.Context) error {
+	err := migrations.CheckSQLite(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("sqlite: migration check: %w", err)
+	}
+	return nil
+}
+
+// MigrateUp запускает миграцию в БД.
+func (s *SQLite) MigrateUp(ctx context.Context) error {
+	err := migrations.UpSQLite(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("sqlite: migration up: %w", err)
+	}
+	return nil
+}
+
+// MigrateDown откатывает миграцию в БД.
+func (s *SQLite) MigrateDown(ctx context.Context) error {
+	err := migrations.DownSQLite(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("sqlite: migration down: %w", err)
+	}
+	return nil
+}
+
+// Ping реализует интерфейс Storage.
+func (s *SQLite) Ping(ctx context.Context) error {
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("sqlite: ping to database: %w", err)
+	}
+	return nil
+}
+
+// Close реализует интерфейс Storage.
+func (s *SQLite) Close() error {
+	s.feed.close()
+
+	err := s.db.Close()
+	if err != nil {
+		return fmt.Errorf("sqlite: closing database: %w", err)
+	}
+	return nil
+}
+
+// Save реализует интерфейс Storage.
+func (s *SQLite) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.Metric, error) {
+	if len(values) == 0 {
+		return nil, errors.New("values is empty")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actuals := make([]metrics.Metric, len(values))
+	now := time.Now()
+
+	for i, value := range values {
+		if value.IsEmpty() {
+			continue
+		}
+
+		var actual metrics.Metric
+
+		switch value.Kind() {
+		case metrics.KindCounter:
+			actual, err = s.add(ctx, tx, now, value)
+		default:
+			actual, err = s.update(ctx, tx, now, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: saving metrics: %w", err)
+		}
+
+		sample := actual.WithUpdated(time.Time{})
+		if value.Kind() == metrics.KindGauge {
+			sample = value
+		}
+
+		err = s.sample(ctx, tx, now, sample)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: saving metrics: %w", err)
+		}
+
+		actuals[i] = actual
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: commit transaction: %w", err)
+	}
+
+	s.feed.publish(changes(now, values, actuals)...)
+
+	return actuals, nil
+}
+
+// Watch реализует интерфейс Storage.
+func (s *SQLite) Watch(ctx context.Context, m Matcher) (<-chan Sample, error) {
+	ch, err := watch(ctx, s.feed, m)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %w", err)
+	}
+	return ch, nil
+}
+
+// add увеличивает значение счётчика и возвращает его.
+func (s *SQLite) add(
+	ctx context.Context,
+	tx *sql.Tx,
+	now time.Time,
+	value metrics.Metric,
+) (metrics.Metric, error) {
+	query := `INSERT INTO
+		metrics (name, labels, kind, counter, updated)
+	VALUES
+		($1, $2, $3, $4, $5)
+	ON CONFLICT (name, labels, kind) DO
+	UPDATE
+		SET counter = counter + excluded.counter,
+			updated = excluded.updated
+	RETURNING counter;`
+
+	var actual int64
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		value.Name(),
+		marshalLabels(value.Labels()),
+		value.Kind(),
+		value.Int64(),
+		now.UnixNano(),
+	).Scan(&actual)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("increasing the value: %w", err)
+	}
+
+	counter := metrics.Counter(value.Name(), actual, value.Labels()...)
+
+	return counter.WithUpdated(now), nil
+}
+
+// update обновляет значение датчика и возвращает предыдущее или объединяет
+// значение гистограммы или сводки и возвращает актуальное.
+func (s *SQLite) update(
+	ctx context.Context,
+	tx *sql.Tx,
+	now time.Time,
+	value metrics.Metric,
+) (metrics.Metric, error) {
+	labels := marshalLabels(value.Labels())
+
+	query := `SELECT counter, gauge, histogram, summary, updated FROM metrics
+	WHERE name = $1 AND labels = $2 AND kind = $3;`
+
+	var (
+		counter   sql.NullInt64
+		gauge     sql.NullFloat64
+		histogram []byte
+		summary   []byte
+		updated   int64
+		old       metrics.Metric
+	)
+
+	err := tx.QueryRowContext(ctx, query, value.Name(), labels, value.Kind()).
+		Scan(&counter, &gauge, &histogram, &summary, &updated)
+	switch {
+	case err == nil:
+		old, err = newMetric(value.Name(), value.Labels(), value.Kind(), counter, gauge, histogram, summary)
+		if err != nil {
+			return metrics.Metric{}, err
+		}
+		old = old.WithUpdated(time.Unix(0, updated))
+	case !errors.Is(err, sql.ErrNoRows):
+		return metrics.Metric{}, fmt.Errorf("selecting the value: %w", err)
+	}
+
+	actual, err := merge(old, value)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	saved := actual
+	if value.Kind() == metrics.KindGauge {
+		saved = value
+	} else {
+		actual = actual.WithUpdated(now)
+	}
+
+	_, gauge, histogram, summary = columns(saved)
+
+	query = `INSERT INTO
+		metrics (name, labels, kind, gauge, histogram, summary, updated)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (name, labels, kind) DO
+	UPDATE
+		SET gauge = excluded.gauge,
+			histogram = excluded.histogram,
+			summary = excluded.summary,
+			updated = excluded.updated;`
+
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		value.Name(),
+		labels,
+		value.Kind(),
+		gauge,
+		histogram,
+		summary,
+		now.UnixNano(),
+	)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("updating the value: %w", err)
+	}
+
+	return actual, nil
+}
+
+// sample добавляет значение метрики в историю.
+func (s *SQLite) sample(
+	ctx context.Context,
+	tx *sql.Tx,
+	t time.Time,
+	value metrics.Metric,
+) error {
+	query := `INSERT INTO
+		samples (name, labels, kind, ts, counter, gauge, histogram, summary)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8);`
+
+	counter, gauge, histogram, summary := columns(value)
+
+	_, err := tx.ExecContext(
+		ctx,
+		query,
+		value.Name(),
+		marshalLabels(value.Labels()),
+		value.Kind(),
+		t.UnixNano(),
+		counter,
+		gauge,
+		histogram,
+		summary,
+	)
+	if err != nil {
+		return fmt.Errorf("adding a sample: %w", err)
+	}
+
+	return nil
+}
+
+// Get реализует интерфейс Storage.
+func (s *SQLite) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	query := `SELECT kind, counter, gauge, histogram, summary, updated FROM metrics
+	WHERE name = $1 AND labels = $2 LIMIT 1;`
+
+	var (
+		kind      metrics.Kind
+		counter   sql.NullInt64
+		gauge     sql.NullFloat64
+		histogram []byte
+		summary   []byte
+		updated   int64
+	)
+
+	err := s.db.QueryRowContext(ctx, query, name, marshalLabels(labels)).
+		Scan(&kind, &counter, &gauge, &histogram, &summary, &updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotFound
+		}
+		return metrics.Metric{}, fmt.Errorf("sqlite: scan row: %w", err)
+	}
+
+	metric, err := newMetric(name, labels, kind, counter, gauge, histogram, summary)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("sqlite: %w", err)
+	}
+
+	return metric.WithUpdated(time.Unix(0, updated)), nil
+}
+
+// GetAll реализует интерфейс Storage.
+func (s *SQLite) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	query := `SELECT name, labels, kind, counter, gauge, histogram, summary, updated FROM metrics
+	ORDER BY name, labels;`
+
+	values, err := s.selectMetrics(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return values, nil
+}
+
+// Select реализует интерфейс Storage.
+//
+// NOTE: префикс, шаблон имени и тип метрики проверяются в запросе,
+// а регулярное выражение и метки — после чтения строк; в запросе
+// проверяется только литеральный префикс регулярного выражения.
+func (s *SQLite) Select(ctx context.Context, m Matcher) ([]metrics.Metric, error) {
+	c, err := m.compile()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %w", err)
+	}
+
+	var (
+		conds []string
+		args  []any
+	)
+
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if m.Prefix != "" {
+		where("name GLOB $%d", prefixSQLite(m.Prefix))
+	}
+	if m.Glob != "" {
+		where("name GLOB $%d", globSQLite(m.Glob))
+	}
+	if prefix := regexPrefix(m.Regex); prefix != "" {
+		where("name GLOB $%d", prefixSQLite(prefix))
+	}
+	if m.Kind != metrics.KindUnknown {
+		where("kind = $%d", m.Kind)
+	}
+
+	query := `SELECT name, labels, kind, counter, gauge, histogram, summary, updated FROM metrics`
+	if len(conds) > 0 {
+		query += "\n\tWHERE " + strings.Join(conds, " AND ")
+	}
+	query += "\n\tORDER BY name, labels;"
+
+	values, err := s.selectMetrics(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	actuals := values[:0]
+	for _, value := range values {
+		if c.match(value) {
+			actuals = append(actuals, value)
+		}
+	}
+
+	return actuals, nil
+}
+
+// selectMetrics возвращает метрики, выбранные запросом query.
+func (s *SQLite) selectMetrics(ctx context.Context, query string, args ...any) ([]metrics.Metric, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: execution query: %w", err)
+	}
+	defer rows.Close()
+
+	values := make([]metrics.Metric, 0, 64)
+
+	for rows.Next() {
+		var (
+			name      string
+			labels    []byte
+			kind      metrics.Kind
+			counter   sql.NullInt64
+			gauge     sql.NullFloat64
+			histogram []byte
+			summary   []byte
+			updated   int64
+		)
+
+		err = rows.Scan(&name, &labels, &kind, &counter, &gauge, &histogram, &summary, &updated)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: decoding labels: %w", err)
+		}
+
+		metric, err := newMetric(name, ls, kind, counter, gauge, histogram, summary)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: %w", err)
+		}
+
+		values = append(values, metric.WithUpdated(time.Unix(0, updated)))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: iterate by rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// Delete реализует интерфейс Storage.
+func (s *SQLite) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ls := marshalLabels(labels)
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM metrics WHERE name = $1 AND labels = $2;`, name, ls)
+	if err != nil {
+		return fmt.Errorf("sqlite: deleting the metric: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("sqlite: deleting the metric: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	for _, query := range []string{
+		`DELETE FROM samples WHERE name = $1 AND labels = $2;`,
+		`DELETE FROM rollups WHERE name = $1 AND labels = $2;`,
+	} {
+		_, err = tx.ExecContext(ctx, query, name, ls)
+		if err != nil {
+			return fmt.Errorf("sqlite: deleting the history: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("sqlite: commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Reset реализует интерфейс Storage.
+func (s *SQLite) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("sqlite: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT kind, counter, gauge, histogram, summary, updated FROM metrics
+	WHERE name = $1 AND labels = $2 LIMIT 1;`
+
+	var (
+		kind      metrics.Kind
+		counter   sql.NullInt64
+		gauge     sql.NullFloat64
+		histogram []byte
+		summary   []byte
+		updated   int64
+	)
+
+	err = tx.QueryRowContext(ctx, query, name, marshalLabels(labels)).
+		Scan(&kind, &counter, &gauge, &histogram, &summary, &updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotFound
+		}
+		return metrics.Metric{}, fmt.Errorf("sqlite: scan row: %w", err)
+	}
+
+	actual, err := newMetric(name, labels, kind, counter, gauge, histogram, summary)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("sqlite: %w", err)
+	}
+	actual = actual.WithUpdated(time.Unix(0, updated))
+
+	now := time.Now()
+	zero := actual.Zero()
+	counter, gauge, histogram, summary = columns(zero)
+
+	query = `UPDATE metrics SET counter = $4, gauge = $5, histogram = $6, summary = $7, updated = $8
+	WHERE name = $1 AND labels = $2 AND kind = $3;`
+
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		name,
+		marshalLabels(labels),
+		kind,
+		counter,
+		gauge,
+		histogram,
+		summary,
+		now.UnixNano(),
+	)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("sqlite: resetting the value: %w", err)
+	}
+
+	err = s.sample(ctx, tx, now, zero)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("sqlite: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("sqlite: commit transaction: %w", err)
+	}
+
+	return actual, nil
+}
+
+// Range реализует интерфейс Storage.
+func (s *SQLite) Range(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]Sample, error) {
+	values, err := s.samples(ctx, s.db, name, labels, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
+
+// samples возвращает историю метрики name с метками labels
+// в полуинтервале [from, to).
+func (s *SQLite) samples(
+	ctx context.Context,
+	q querier,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]Sample, error) {
+	query := `SELECT ts, kind, counter, gauge, histogram, summary FROM samples
+	WHERE name = $1 AND labels = $2 AND ts >= $3 AND ts < $4
+	ORDER BY ts, rowid;`
+
+	rows, err := q.QueryContext(ctx, query, name, marshalLabels(labels), unixNano(from), unixNano(to))
+	if err != nil {
+		return nil, fmt.Errorf("execution query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []Sample
+
+	for rows.Next() {
+		var (
+			ts        int64
+			kind      metrics.Kind
+			counter   sql.NullInt64
+			gauge     sql.NullFloat64
+			histogram []byte
+			summary   []byte
+		)
+
+		err = rows.Scan(&ts, &kind, &counter, &gauge, &histogram, &summary)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		metric, err := newMetric(name, labels, kind, counter, gauge, histogram, summary)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, Sample{Time: time.Unix(0, ts), Value: metric})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate by rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// Rollups реализует интерфейс Storage.
+func (s *SQLite) Rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]Rollup, error) {
+	query := `SELECT ts, kind, count, sum, rate, min, max, avg, counter, gauge
+	FROM rollups
+	WHERE name = $1 AND labels = $2 AND resolution = $3 AND ts >= $4 AND ts < $5
+	ORDER BY ts;`
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		name,
+		marshalLabels(labels),
+		second(resolution),
+		unixNano(from),
+		unixNano(to),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: execution query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []Rollup
+
+	for rows.Next() {
+		var (
+			ts      int64
+			kind    metrics.Kind
+			counter sql.NullInt64
+			gauge   sql.NullFloat64
+		)
+
+		rollup := Rollup{Resolution: resolution}
+
+		err = rows.Scan(
+			&ts,
+			&kind,
+			&rollup.Count,
+			&rollup.Sum,
+			&rollup.Rate,
+			&rollup.Min,
+			&rollup.Max,
+			&rollup.Avg,
+			&counter,
+			&gauge,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: scan row: %w", err)
+		}
+
+		rollup.Time = time.Unix(0, ts)
+		rollup.Value, err = newMetric(name, labels, kind, counter, gauge, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: %w", err)
+		}
+
+		values = append(values, rollup)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: iterate by rows: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return values, nil
+}
+
+// Retain реализует интерфейс Storage.
+func (s *SQLite) Retain(
+	ctx context.Context,
+	retention configs.Retention,
+	now time.Time,
+) error {
+	if retention.IsEmpty() {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rawFrom := now.Add(-retention.Raw)
+
+	series, err := s.series(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+
+	for _, tier := range retention.Tiers {
+		until := now.Truncate(tier.Resolution)
+
+		for _, value := range series {
+			err = s.downsample(ctx, tx, value, tier.Resolution, until)
+			if err != nil {
+				return fmt.Errorf("sqlite: downsampling: %w", err)
+			}
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`DELETE FROM rollups WHERE resolution = $1 AND ts < $2;`,
+			second(tier.Resolution),
+			unixNano(now.Add(-tier.TTL)),
+		)
+		if err != nil {
+			return fmt.Errorf("sqlite: deleting expired rollups: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM samples WHERE ts < $1;`, unixNano(rawFrom))
+	if err != nil {
+		return fmt.Errorf("sqlite: deleting expired samples: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("sqlite: commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Expire реализует интерфейс Storage.
+func (s *SQLite) Expire(ctx context.Context, before time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM samples WHERE (name, labels) IN
+			(SELECT name, labels FROM metrics WHERE updated < $1);`,
+		`DELETE FROM rollups WHERE (name, labels) IN
+			(SELECT name, labels FROM metrics WHERE updated < $1);`,
+	} {
+		_, err = tx.ExecContext(ctx, query, unixNano(before))
+		if err != nil {
+			return 0, fmt.Errorf("sqlite: deleting the history: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM metrics WHERE updated < $1;`, unixNano(before))
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: deleting expired metrics: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: deleting expired metrics: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: commit transaction: %w", err)
+	}
+
+	return int(n), nil
+}
+
+// series возвращает счётчики и датчики без значений, у которых есть
+// история.
+func (s *SQLite) series(ctx context.Context, tx *sql.Tx) ([]metrics.Metric, error) {
+	query := `SELECT DISTINCT name, labels, kind FROM samples
+	WHERE kind IN ($1, $2);`
+
+	rows, err := tx.QueryContext(ctx, query, metrics.KindCounter, metrics.KindGauge)
+	if err != nil {
+		return nil, fmt.Errorf("execution query: %w", err)
+	}
+	defer rows.Close()
+
+	var values []metrics.Metric
+
+	for rows.Next() {
+		var (
+			name   string
+			labels []byte
+			kind   metrics.Kind
+		)
+
+		err = rows.Scan(&name, &labels, &kind)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		ls, err := unmarshalLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("decoding labels: %w", err)
+		}
+
+		metric, err := newMetric(name, ls, kind, sql.NullInt64{}, sql.NullFloat64{}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, metric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate by rows: %w", err)
+	}
+
+	return values, nil
+}
+
+// downsample агрегирует историю метрики value в уровень resolution,
+// начиная с интервала, следующего за последним агрегированным значением,
+// а при его отсутствии — с первого значения истории.
+func (s *SQLite) downsample(
+	ctx context.Context,
+	tx *sql.Tx,
+	value metrics.Metric,
+	resolution time.Duration,
+	until time.Time,
+) error {
+	labels := marshalLabels(value.Labels())
+
+	var (
+		prev    metrics.Metric
+		ts      int64
+		kind    metrics.Kind
+		counter sql.NullInt64
+		gauge   sql.NullFloat64
+	)
+
+	var from time.Time
+
+	query := `SELECT ts, kind, counter, gauge FROM rollups
+	WHERE name = $1 AND labels = $2 AND kind = $3 AND resolution = $4
+	ORDER BY ts DESC LIMIT 1;`
+
+	err := tx.QueryRowContext(ctx, query, value.Name(), labels, value.Kind(), second(resolution)).
+		Scan(&ts, &kind, &counter, &gauge)
+	switch {
+	case err == nil:
+		prev, _ = newMetric(value.Name(), value.Labels(), kind, counter, gauge, nil, nil)
+		from = time.Unix(0, ts).Add(resolution)
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("selecting the last rollup: %w", err)
+	}
+
+	query = `SELECT kind, counter, gauge FROM samples
+	WHERE name = $1 AND labels = $2 AND kind = $3 AND ts < $4
+	ORDER BY ts DESC, rowid DESC LIMIT 1;`
+
+	err = tx.QueryRowContext(ctx, query, value.Name(), labels, value.Kind(), unixNano(from)).
+		Scan(&kind, &counter, &gauge)
+	switch {
+	case err == nil:
+		prev, _ = newMetric(value.Name(), value.Labels(), kind, counter, gauge, nil, nil)
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("selecting the previous sample: %w", err)
+	}
+
+	values, err := s.samples(ctx, tx, value.Name(), value.Labels(), from, until)
+	if err != nil {
+		return err
+	}
+	values = ofKind(values, value.Kind())
+
+	query = `INSERT INTO
+		rollups (name, labels, kind, resolution, ts, count, sum, rate, min, max, avg, counter, gauge)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (name, labels, kind, resolution, ts) DO NOTHING;`
+
+	for _, rollup := range downsample(values, prev, resolution, until) {
+		counter, gauge, _, _ := columns(rollup.Value)
+
+		_, err = tx.ExecContext(
+			ctx,
+			query,
+			value.Name(),
+			labels,
+			rollup.Value.Kind(),
+			second(resolution),
+			rollup.Time.UnixNano(),
+			rollup.Count,
+			rollup.Sum,
+			rollup.Rate,
+			rollup.Min,
+			rollup.Max,
+			rollup.Avg,
+			counter,
+			gauge,
+		)
+		if err != nil {
+			return fmt.Errorf("adding a rollup: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// unixNano возвращает время t в наносекундах Unix с учётом нулевого
+// значения, которое предшествует любому сохранённому времени.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return math.MinInt64
+	}
+	return t.UnixNano()
+}
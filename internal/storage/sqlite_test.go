@@ -0,0 +1,518 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/deployments/migrations"
+	"github.com/sergeizaitcev/metrics/internal/configs"
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func testSQLite(t *testing.T) (*storage.SQLite, context.Context) {
+	t.Helper()
+
+	storage, err := storage.NewSQLite(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+
+	ctx := testutil.Context(t)
+
+	require.NoError(t, storage.Ping(ctx))
+	require.NoError(t, storage.MigrateUp(ctx))
+	t.Cleanup(func() { storage.MigrateDown(ctx) })
+
+	return storage, ctx
+}
+
+func TestSQLite(t *testing.T) {
+	t.Run("save", func(t *testing.T) {
+		testCases := []struct {
+			name        string
+			metrics     []metrics.Metric
+			wantMetrics []metrics.Metric
+			wantError   bool
+		}{
+			{
+				name:      "empty",
+				wantError: true,
+			},
+			{
+				name:        "first insert",
+				metrics:     []metrics.Metric{metrics.Counter("counter", 1), {}},
+				wantMetrics: []metrics.Metric{metrics.Counter("counter", 1), {}},
+			},
+			{
+				name:        "second insert",
+				metrics:     []metrics.Metric{{}, metrics.Counter("counter", 1)},
+				wantMetrics: []metrics.Metric{{}, metrics.Counter("counter", 2)},
+			},
+			{
+				name:        "first update",
+				metrics:     []metrics.Metric{metrics.Gauge("gauge", 1)},
+				wantMetrics: []metrics.Metric{{}},
+			},
+			{
+				name:        "second update",
+				metrics:     []metrics.Metric{metrics.Gauge("gauge", 2)},
+				wantMetrics: []metrics.Metric{metrics.Gauge("gauge", 1)},
+			},
+		}
+
+		storage, ctx := testSQLite(t)
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				got, err := storage.Save(ctx, tc.metrics...)
+				if tc.wantError {
+					require.Error(t, err)
+				} else {
+					require.NoError(t, err)
+					require.Len(t, got, len(tc.wantMetrics))
+					for i, want := range tc.wantMetrics {
+						require.True(t, want.Equal(got[i]))
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		testCases := []struct {
+			name       string
+			wantMetric metrics.Metric
+			wantError  bool
+		}{
+			{
+				name:       "not found",
+				wantMetric: metrics.Counter("invalid", 0),
+				wantError:  true,
+			},
+			{
+				name:       "counter",
+				wantMetric: metrics.Counter("counter", 1),
+			},
+			{
+				name:       "gauge",
+				wantMetric: metrics.Gauge("gauge", 1),
+			},
+			{
+				name:      "invalid",
+				wantError: true,
+			},
+		}
+
+		storage, ctx := testSQLite(t)
+
+		_, err := storage.Save(ctx,
+			metrics.Counter("counter", 1),
+			metrics.Gauge("gauge", 1),
+		)
+		require.NoError(t, err)
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				got, err := storage.Get(ctx, tc.name, nil)
+				if tc.wantError {
+					require.Error(t, err)
+				} else {
+					require.NoError(t, err)
+					require.True(t, tc.wantMetric.Equal(got))
+				}
+			})
+		}
+	})
+
+	t.Run("get_all", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+		want := []metrics.Metric{
+			metrics.Counter("counter", 1),
+			metrics.Gauge("gauge", 1),
+		}
+
+		_, err := storage.Save(ctx, want...)
+		require.NoError(t, err)
+
+		values, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+
+		require.Len(t, values, len(want))
+		for i := range want {
+			require.True(t, want[i].Equal(values[i]))
+			require.False(t, values[i].Updated().IsZero())
+		}
+	})
+
+	t.Run("select", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+		testSelect(t, ctx, storage)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+		testWatch(t, ctx, storage)
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		hostA := metrics.Label{Name: "host", Value: "a"}
+		hostB := metrics.Label{Name: "host", Value: "b"}
+
+		_, err := storage.Save(ctx,
+			metrics.Counter("counter", 1, hostA),
+			metrics.Counter("counter", 2, hostB),
+			metrics.Counter("counter", 1, hostA),
+			metrics.Gauge("gauge", 1, hostA),
+		)
+		require.NoError(t, err)
+
+		got, err := storage.Get(ctx, "counter", metrics.NewLabels(hostA))
+		require.NoError(t, err)
+		want := metrics.Counter("counter", 2, hostA)
+		require.True(t, want.Equal(got))
+
+		got, err = storage.Get(ctx, "gauge", metrics.NewLabels(hostA))
+		require.NoError(t, err)
+		want = metrics.Gauge("gauge", 1, hostA)
+		require.True(t, want.Equal(got))
+
+		_, err = storage.Get(ctx, "counter", nil)
+		require.Error(t, err)
+
+		values, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 3)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 10), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		values := []metrics.Metric{
+			metrics.Counter("counter", 1),
+			metrics.Gauge("gauge", 2),
+			{},
+			metrics.Counter("counter", 2, metrics.Label{Name: "host", Value: "a"}),
+			metrics.Counter("counter", 3),
+			metrics.Gauge("gauge", 3),
+			metrics.Gauge("new", 1),
+		}
+
+		want := []metrics.Metric{
+			metrics.Counter("counter", 11),
+			metrics.Gauge("gauge", 1),
+			{},
+			metrics.Counter("counter", 2, metrics.Label{Name: "host", Value: "a"}),
+			metrics.Counter("counter", 14),
+			metrics.Gauge("gauge", 2),
+			{},
+		}
+
+		got, err := storage.Save(ctx, values...)
+		require.NoError(t, err)
+		require.Len(t, got, len(want))
+		for i := range want {
+			require.True(t, want[i].Equal(got[i]), "%d: %s", i, got[i])
+		}
+
+		all, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, all, 4)
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, 3)
+
+		// NOTE: значения одного пакета сохраняются в один момент времени.
+		totals := make([]int64, 0, len(samples))
+		for _, sample := range samples {
+			totals = append(totals, sample.Value.Int64())
+		}
+		require.ElementsMatch(t, []int64{10, 11, 14}, totals)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Delete(ctx, "counter", nil))
+		require.Error(t, storage.Delete(ctx, "counter", nil))
+
+		_, err = storage.Get(ctx, "counter", nil)
+		require.Error(t, err)
+
+		_, err = storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.Error(t, err)
+
+		values, err := storage.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 1)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+
+		before := time.Now()
+
+		_, err = storage.Save(ctx, metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		n, err := storage.Expire(ctx, before)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		_, err = storage.Get(ctx, "counter", nil)
+		require.Error(t, err)
+
+		_, err = storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.Error(t, err)
+
+		got, err := storage.Get(ctx, "gauge", nil)
+		require.NoError(t, err)
+		require.False(t, got.Updated().Before(before))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 10))
+		require.NoError(t, err)
+
+		got, err := storage.Reset(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 10, got.Int64())
+
+		_, err = storage.Reset(ctx, "unknown", nil)
+		require.Error(t, err)
+
+		_, err = storage.Save(ctx, metrics.Counter("counter", 1))
+		require.NoError(t, err)
+
+		got, err = storage.Get(ctx, "counter", nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, got.Int64())
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		require.Len(t, samples, 3)
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		h, _ := metrics.NewHistogramValue([]float64{1, 2})
+		h.Observe(0.5)
+
+		_, err := storage.Save(ctx,
+			metrics.Histogram("histogram", h),
+			metrics.Histogram("histogram", h),
+		)
+		require.NoError(t, err)
+
+		want, _ := metrics.NewHistogramValue([]float64{1, 2})
+		want.Observe(0.5)
+		want.Observe(0.5)
+
+		got, err := storage.Get(ctx, "histogram", nil)
+		require.NoError(t, err)
+		require.True(t, want.Equal(got.Histogram()))
+
+		mismatch, _ := metrics.NewHistogramValue([]float64{1})
+		mismatch.Observe(1)
+
+		_, err = storage.Save(ctx, metrics.Histogram("histogram", mismatch))
+		require.Error(t, err)
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		s, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		s.Add(0.5)
+
+		_, err := storage.Save(ctx,
+			metrics.Summary("summary", s),
+			metrics.Summary("summary", s),
+		)
+		require.NoError(t, err)
+
+		want, _ := metrics.NewSketch(metrics.DefaultAccuracy)
+		want.Add(0.5)
+		want.Add(0.5)
+
+		got, err := storage.Get(ctx, "summary", nil)
+		require.NoError(t, err)
+		require.True(t, want.Equal(got.Summary()))
+
+		mismatch, _ := metrics.NewSketch(0.05)
+		mismatch.Add(1)
+
+		_, err = storage.Save(ctx, metrics.Summary("summary", mismatch))
+		require.Error(t, err)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		start := time.Now()
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1), metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+
+		_, err = storage.Save(ctx, metrics.Counter("counter", 2), metrics.Gauge("gauge", 2))
+		require.NoError(t, err)
+
+		end := time.Now().Add(time.Second)
+
+		got, err := storage.Range(ctx, "counter", nil, start.Add(-time.Second), end)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		require.EqualValues(t, 1, got[0].Value.Int64())
+		require.EqualValues(t, 3, got[1].Value.Int64())
+
+		got, err = storage.Range(ctx, "gauge", nil, start.Add(-time.Second), end)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		require.EqualValues(t, 2, got[1].Value.Float64())
+
+		_, err = storage.Range(ctx, "gauge", nil, end, end.Add(time.Hour))
+		require.Error(t, err)
+	})
+
+	t.Run("retain", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := storage.Save(ctx,
+			metrics.Counter("counter", 1), metrics.Gauge("gauge", 1),
+			metrics.Counter("counter", 2), metrics.Gauge("gauge", 3),
+		)
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Minute)))
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(3*time.Minute)))
+
+		counter, err := storage.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, counter, 1)
+		require.Equal(t, 3.0, counter[0].Sum)
+		require.EqualValues(t, 3, counter[0].Value.Int64())
+
+		gauge, err := storage.Rollups(ctx, "gauge", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, gauge, 1)
+		require.Equal(t, 1.0, gauge[0].Min)
+		require.Equal(t, 3.0, gauge[0].Max)
+		require.Equal(t, 2.0, gauge[0].Avg)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Hour)))
+
+		_, err = storage.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.Error(t, err)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(25*time.Hour)))
+
+		_, err = storage.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.Error(t, err)
+	})
+
+	t.Run("retain_late", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := storage.Save(ctx, metrics.Counter("counter", 1), metrics.Counter("counter", 2))
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := storage.Range(ctx, "counter", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		// NOTE: первая агрегация выполняется после истечения срока хранения
+		// исходных значений.
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Hour)))
+
+		_, err = storage.Range(ctx, "counter", nil, start, now.Add(time.Minute))
+		require.Error(t, err)
+
+		counter, err := storage.Rollups(ctx, "counter", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, counter, 1)
+		require.Equal(t, 3.0, counter[0].Sum)
+	})
+
+	t.Run("retain_kinds", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+
+		retention := configs.Retention{
+			Raw:   time.Hour,
+			Tiers: []configs.Tier{{Resolution: time.Minute, TTL: 24 * time.Hour}},
+		}
+
+		_, err := storage.Save(ctx, metrics.Counter("metric", 2), metrics.Gauge("metric", 5))
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		samples, err := storage.Range(ctx, "metric", nil, time.Time{}, now.Add(time.Second))
+		require.NoError(t, err)
+		start := samples[0].Time.Truncate(time.Minute)
+
+		require.NoError(t, storage.Retain(ctx, retention, now.Add(2*time.Minute)))
+
+		got, err := storage.Rollups(ctx, "metric", nil, time.Minute, start, start.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+
+		sums := []float64{got[0].Sum, got[1].Sum}
+		require.ElementsMatch(t, []float64{2, 5}, sums)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		storage, ctx := testSQLite(t)
+		_, err := storage.GetAll(ctx)
+		require.Error(t, err)
+	})
+}
+
+func TestSQLite_MigrateCheck(t *testing.T) {
+	ctx := testutil.Context(t)
+
+	s, err := storage.NewSQLite(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	require.ErrorIs(t, s.MigrateCheck(ctx), migrations.ErrNotMigrated)
+
+	require.NoError(t, s.MigrateUp(ctx))
+	require.NoError(t, s.MigrateCheck(ctx))
+}
@@ -19,11 +19,63 @@ type Storage interface {
 	// Save сохраняет значения метрик и возвращает актуальные значения.
 	Save(context.Context, ...metrics.Metric) ([]metrics.Metric, error)
 
-	// Get возвращает метрику name.
-	Get(context.Context, string) (metrics.Metric, error)
+	// Watch возвращает канал значений метрик, удовлетворяющих условиям
+	// выборки m, которые были сохранены вызовами Save после подписки.
+	//
+	// Канал закрывается при отмене ctx, закрытии хранилища или если
+	// подписчик не успевает читать значения.
+	Watch(ctx context.Context, m Matcher) (<-chan Sample, error)
+
+	// Get возвращает метрику name с метками labels.
+	Get(ctx context.Context, name string, labels metrics.Labels) (metrics.Metric, error)
 
 	// GetAll возвращает все метрики.
 	GetAll(context.Context) ([]metrics.Metric, error)
+
+	// Select возвращает метрики, удовлетворяющие условиям выборки m,
+	// в порядке возрастания имени и меток.
+	Select(ctx context.Context, m Matcher) ([]metrics.Metric, error)
+
+	// Delete удаляет метрику name с метками labels вместе с её историей.
+	Delete(ctx context.Context, name string, labels metrics.Labels) error
+
+	// Reset сбрасывает значение метрики name с метками labels в ноль
+	// и возвращает предыдущее значение.
+	Reset(ctx context.Context, name string, labels metrics.Labels) (metrics.Metric, error)
+
+	// Range возвращает значения метрики name с метками labels, сохранённые
+	// в полуинтервале [from, to), в порядке возрастания времени.
+	Range(
+		ctx context.Context,
+		name string,
+		labels metrics.Labels,
+		from, to time.Time,
+	) ([]Sample, error)
+
+	// Rollups возвращает агрегированные значения метрики name с метками
+	// labels уровня resolution, начало интервала которых попадает
+	// в полуинтервал [from, to), в порядке возрастания времени.
+	Rollups(
+		ctx context.Context,
+		name string,
+		labels metrics.Labels,
+		resolution time.Duration,
+		from, to time.Time,
+	) ([]Rollup, error)
+
+	// Retain агрегирует историю счётчиков и датчиков в уровни политики
+	// retention и удаляет значения, срок хранения которых истёк к моменту now.
+	Retain(ctx context.Context, retention configs.Retention, now time.Time) error
+
+	// Expire удаляет метрики, которые не обновлялись с момента before,
+	// вместе с их историей и возвращает количество удалённых метрик.
+	Expire(ctx context.Context, before time.Time) (int, error)
+}
+
+// Sample определяет значение метрики в момент времени.
+type Sample struct {
+	Time  time.Time
+	Value metrics.Metric
 }
 
 // NewStorage возвращает новый экземпляр хранилища метрик.
@@ -34,6 +86,9 @@ func NewStorage(config *configs.Server) (Storage, error) {
 	if config.DatabaseDSN != "" {
 		return initPostgres(ctx, config)
 	}
+	if config.SQLitePath != "" {
+		return initSQLite(ctx, config)
+	}
 
 	return initLocal(ctx, config)
 }
@@ -57,10 +112,33 @@ func initPostgres(ctx context.Context, config *configs.Server) (*Postgres, error
 	return s, nil
 }
 
+func initSQLite(ctx context.Context, config *configs.Server) (*SQLite, error) {
+	s, err := NewSQLite(config.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Ping(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.MigrateUp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 func initLocal(ctx context.Context, config *configs.Server) (*Local, error) {
 	opts := &LocalOpts{
-		StoreInterval: config.StoreInterval,
-		Restore:       config.Restore,
+		StoreInterval:      config.StoreInterval,
+		Restore:            config.Restore,
+		SnapshotInterval:   config.SnapshotInterval,
+		SegmentSize:        config.SegmentSize,
+		Follower:           config.ReplicaOf != "",
+		ReplicationBacklog: config.ReplicationBacklog,
 	}
 
 	s, err := NewLocal(config.FileStoragePath, opts)
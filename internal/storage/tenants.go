@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// TenantLabel определяет служебную метку, значением которой является
+// арендатор метрики. Метрики арендатора по умолчанию хранятся без неё.
+const TenantLabel = "__tenant__"
+
+type tenantKey struct{}
+
+// WithTenant возвращает копию ctx с арендатором tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext возвращает арендатора из ctx; пустая строка
+// соответствует арендатору по умолчанию.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// TenantLimits определяет ограничения, применяемые к каждому арендатору.
+type TenantLimits struct {
+	// Максимальное количество метрик арендатора.
+	//
+	// При MaxSeries == 0, количество метрик не ограничивается.
+	MaxSeries int
+
+	// Максимальная скорость записи значений в секунду.
+	//
+	// При WriteRate == 0, скорость записи не ограничивается.
+	WriteRate float64
+}
+
+var _ Storage = (*Tenants)(nil)
+
+// Tenants определяет хранилище, разделяющее метрики арендаторов.
+//
+// Арендатор определяется по контексту вызова; метрики арендатора хранятся
+// с меткой TenantLabel, которая скрывается при чтении. Метрики, переданные
+// с меткой TenantLabel, сохраняются как метрики арендатора из контекста.
+//
+// Удаление устаревших метрик и агрегирование истории выполняются для всех
+// арендаторов.
+type Tenants struct {
+	Storage
+	limits TenantLimits
+
+	mu     sync.Mutex
+	quotas map[string]*quota
+}
+
+// NewTenants возвращает хранилище s, разделяющее метрики арендаторов
+// с ограничениями limits.
+func NewTenants(s Storage, limits TenantLimits) *Tenants {
+	return &Tenants{
+		Storage: s,
+		limits:  limits,
+		quotas:  make(map[string]*quota),
+	}
+}
+
+// Save реализует интерфейс Storage.
+func (t *Tenants) Save(ctx context.Context, values ...metrics.Metric) ([]metrics.Metric, error) {
+	tenant := TenantFromContext(ctx)
+
+	scoped := make([]metrics.Metric, len(values))
+	for i, value := range values {
+		if !value.IsEmpty() {
+			scoped[i] = value.WithLabels(tenantLabels(tenant, value.Labels())...)
+		}
+	}
+
+	release, err := t.admit(ctx, tenant, scoped)
+	if err != nil {
+		return nil, err
+	}
+
+	actuals, err := t.Storage.Save(ctx, scoped...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	for i := range actuals {
+		if !actuals[i].IsEmpty() {
+			actuals[i] = unscope(actuals[i])
+		}
+	}
+
+	return actuals, nil
+}
+
+// Get реализует интерфейс Storage.
+func (t *Tenants) Get(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	labels = tenantLabels(TenantFromContext(ctx), labels)
+
+	value, err := t.Storage.Get(ctx, name, labels)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	return unscope(value), nil
+}
+
+// GetAll реализует интерфейс Storage.
+func (t *Tenants) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	return t.Select(ctx, Matcher{})
+}
+
+// Select реализует интерфейс Storage.
+func (t *Tenants) Select(ctx context.Context, m Matcher) ([]metrics.Metric, error) {
+	tenant := TenantFromContext(ctx)
+	m.Labels = tenantLabels(tenant, m.Labels)
+
+	values, err := t.Storage.Select(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := values[:0]
+	for _, value := range values {
+		if owns(tenant, value) {
+			owned = append(owned, unscope(value))
+		}
+	}
+
+	// NOTE: без метки арендатора порядок ключей может измениться.
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].Key() < owned[j].Key()
+	})
+
+	return owned, nil
+}
+
+// Watch реализует интерфейс Storage.
+func (t *Tenants) Watch(ctx context.Context, m Matcher) (<-chan Sample, error) {
+	tenant := TenantFromContext(ctx)
+	m.Labels = tenantLabels(tenant, m.Labels)
+
+	samples, err := t.Storage.Watch(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(chan Sample)
+
+	go func() {
+		defer close(owned)
+
+		for sample := range samples {
+			if !owns(tenant, sample.Value) {
+				continue
+			}
+			sample.Value = unscope(sample.Value)
+
+			select {
+			case owned <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return owned, nil
+}
+
+// Delete реализует интерфейс Storage.
+func (t *Tenants) Delete(ctx context.Context, name string, labels metrics.Labels) error {
+	tenant := TenantFromContext(ctx)
+	labels = tenantLabels(tenant, labels)
+
+	err := t.Storage.Delete(ctx, name, labels)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	q, ok := t.quotas[tenant]
+	t.mu.Unlock()
+
+	if ok {
+		q.mu.Lock()
+		delete(q.series, metrics.Key(name, labels))
+		q.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Reset реализует интерфейс Storage.
+func (t *Tenants) Reset(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+) (metrics.Metric, error) {
+	labels = tenantLabels(TenantFromContext(ctx), labels)
+
+	value, err := t.Storage.Reset(ctx, name, labels)
+	if err != nil {
+		return metrics.Metric{}, err
+	}
+
+	return unscope(value), nil
+}
+
+// Range реализует интерфейс Storage.
+func (t *Tenants) Range(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	from, to time.Time,
+) ([]Sample, error) {
+	labels = tenantLabels(TenantFromContext(ctx), labels)
+
+	samples, err := t.Storage.Range(ctx, name, labels, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range samples {
+		samples[i].Value = unscope(samples[i].Value)
+	}
+
+	return samples, nil
+}
+
+// Rollups реализует интерфейс Storage.
+func (t *Tenants) Rollups(
+	ctx context.Context,
+	name string,
+	labels metrics.Labels,
+	resolution time.Duration,
+	from, to time.Time,
+) ([]Rollup, error) {
+	labels = tenantLabels(TenantFromContext(ctx), labels)
+
+	rollups, err := t.Storage.Rollups(ctx, name, labels, resolution, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rollups {
+		rollups[i].Value = unscope(rollups[i].Value)
+	}
+
+	return rollups, nil
+}
+
+// Expire реализует интерфейс Storage.
+func (t *Tenants) Expire(ctx context.Context, before time.Time) (int, error) {
+	n, err := t.Storage.Expire(ctx, before)
+
+	// NOTE: удалённые метрики неизвестны, поэтому метрики арендаторов
+	// будут прочитаны из хранилища заново.
+	if n > 0 {
+		t.mu.Lock()
+		for _, q := range t.quotas {
+			q.mu.Lock()
+			q.series = nil
+			q.mu.Unlock()
+		}
+		t.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// quota определяет использование ограничений арендатором.
+type quota struct {
+	mu     sync.Mutex
+	series map[string]struct{} // Ключи метрик; nil, если не прочитаны.
+	tokens float64             // Доступное количество значений для записи.
+	last   time.Time           // Время последнего пополнения tokens.
+}
+
+// quota возвращает использование ограничений арендатором tenant.
+//
+// NOTE: записи не вытесняются, поэтому арендатор должен определяться
+// ключом API, а не заголовком запроса; иначе каждый новый заголовок
+// добавляет запись. Конфигурация сервера требует ключи API при заданных
+// ограничениях арендаторов.
+func (t *Tenants) quota(tenant string) *quota {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	q, ok := t.quotas[tenant]
+	if !ok {
+		q = &quota{tokens: t.limits.WriteRate, last: time.Now()}
+		t.quotas[tenant] = q
+	}
+
+	return q
+}
+
+// admit проверяет, что сохранение значений values не превышает
+// ограничений арендатора tenant, и резервирует новые метрики. Функция
+// release отменяет резервирование, если значения не были сохранены.
+//
+// NOTE: использование ограничений учитывается в памяти экземпляра сервера,
+// поэтому при нескольких экземплярах скорость записи ограничивается
+// для каждого из них отдельно.
+func (t *Tenants) admit(
+	ctx context.Context,
+	tenant string,
+	values []metrics.Metric,
+) (release func(), err error) {
+	release = func() {}
+
+	if t.limits.MaxSeries == 0 && t.limits.WriteRate == 0 {
+		return release, nil
+	}
+
+	q := t.quota(tenant)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var added []string
+
+	if t.limits.MaxSeries > 0 {
+		if q.series == nil {
+			q.series, err = t.series(ctx, tenant)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, value := range values {
+			if value.IsEmpty() {
+				continue
+			}
+			key := value.Key()
+			if _, ok := q.series[key]; ok {
+				continue
+			}
+			q.series[key] = struct{}{}
+			added = append(added, key)
+		}
+
+		if len(q.series) > t.limits.MaxSeries {
+			q.remove(added)
+			return nil, fmt.Errorf("%w: series limit %d", ErrQuotaExceeded, t.limits.MaxSeries)
+		}
+	}
+
+	if t.limits.WriteRate > 0 {
+		n := 0
+		for _, value := range values {
+			if !value.IsEmpty() {
+				n++
+			}
+		}
+
+		now := time.Now()
+		q.tokens = math.Min(q.tokens+now.Sub(q.last).Seconds()*t.limits.WriteRate, t.limits.WriteRate)
+		q.last = now
+
+		// NOTE: пакет, превышающий запас на секунду записи, принимается
+		// при полном запасе, а следующие пакеты ожидают его пополнения.
+		if q.tokens < math.Min(float64(n), t.limits.WriteRate) {
+			q.remove(added)
+			return nil, fmt.Errorf("%w: write rate limit %g", ErrQuotaExceeded, t.limits.WriteRate)
+		}
+		q.tokens -= float64(n)
+	}
+
+	release = func() {
+		q.mu.Lock()
+		q.remove(added)
+		q.mu.Unlock()
+	}
+
+	return release, nil
+}
+
+// series возвращает ключи метрик арендатора tenant из хранилища.
+func (t *Tenants) series(ctx context.Context, tenant string) (map[string]struct{}, error) {
+	values, err := t.Storage.Select(ctx, Matcher{Labels: tenantLabels(tenant, nil)})
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		if owns(tenant, value) {
+			series[value.Key()] = struct{}{}
+		}
+	}
+
+	return series, nil
+}
+
+// remove удаляет из учёта зарезервированные метрики.
+func (q *quota) remove(keys []string) {
+	if q.series == nil {
+		return
+	}
+	for _, key := range keys {
+		delete(q.series, key)
+	}
+}
+
+// tenantLabels возвращает метки labels с меткой арендатора tenant вместо
+// переданной.
+func tenantLabels(tenant string, labels metrics.Labels) metrics.Labels {
+	ls := make([]metrics.Label, 0, len(labels)+1)
+	for _, label := range labels {
+		if label.Name != TenantLabel {
+			ls = append(ls, label)
+		}
+	}
+	ls = append(ls, metrics.Label{Name: TenantLabel, Value: tenant})
+	return metrics.NewLabels(ls...)
+}
+
+// owns возвращает true, если метрика принадлежит арендатору tenant.
+func owns(tenant string, value metrics.Metric) bool {
+	return value.Labels().Get(TenantLabel) == tenant
+}
+
+// unscope возвращает метрику без метки арендатора.
+func unscope(value metrics.Metric) metrics.Metric {
+	return value.WithLabels(tenantLabels("", value.Labels())...)
+}
@@ -0,0 +1,141 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+	"github.com/sergeizaitcev/metrics/internal/storage"
+	"github.com/sergeizaitcev/metrics/pkg/testutil"
+)
+
+func TestTenants(t *testing.T) {
+	ctx := testutil.Context(t)
+	teamA := storage.WithTenant(ctx, "a")
+	teamB := storage.WithTenant(ctx, "b")
+
+	t.Run("isolation", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		store := storage.NewTenants(local, storage.TenantLimits{})
+
+		for i, ctx := range []context.Context{ctx, teamA, teamB} {
+			actuals, err := store.Save(ctx, metrics.Counter("PollCount", int64(i+1)))
+			require.NoError(t, err)
+			require.Equal(t, "PollCount", actuals[0].Key())
+		}
+
+		for i, ctx := range []context.Context{ctx, teamA, teamB} {
+			got, err := store.Get(ctx, "PollCount", nil)
+			require.NoError(t, err)
+			require.EqualValues(t, i+1, got.Int64())
+			require.Empty(t, got.Labels())
+
+			values, err := store.Select(ctx, storage.Matcher{})
+			require.NoError(t, err)
+			require.Len(t, values, 1)
+			require.EqualValues(t, i+1, values[0].Int64())
+
+			samples, err := store.Range(ctx, "PollCount", nil, time.Time{}, time.Now())
+			require.NoError(t, err)
+			require.Len(t, samples, 1)
+			require.Equal(t, "PollCount", samples[0].Value.Key())
+		}
+
+		values, err := local.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, values, 3)
+
+		require.NoError(t, store.Delete(teamA, "PollCount", nil))
+
+		_, err = store.Get(teamA, "PollCount", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		_, err = store.Get(teamB, "PollCount", nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("tenant label", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		store := storage.NewTenants(local, storage.TenantLimits{})
+
+		// NOTE: метка арендатора из значения не позволяет записать метрику
+		// другому арендатору.
+		_, err := store.Save(teamA, metrics.Gauge("gauge", 1, metrics.Label{
+			Name:  storage.TenantLabel,
+			Value: "b",
+		}))
+		require.NoError(t, err)
+
+		_, err = store.Get(teamB, "gauge", nil)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		_, err = store.Get(teamA, "gauge", nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		store := storage.NewTenants(local, storage.TenantLimits{})
+
+		samples, err := store.Watch(teamA, storage.Matcher{})
+		require.NoError(t, err)
+
+		_, err = store.Save(teamB, metrics.Gauge("gauge", 1))
+		require.NoError(t, err)
+		_, err = store.Save(teamA, metrics.Gauge("gauge", 2))
+		require.NoError(t, err)
+
+		select {
+		case sample := <-samples:
+			require.Equal(t, "gauge", sample.Value.Key())
+			require.EqualValues(t, 2, sample.Value.Float64())
+		case <-time.After(5 * time.Second):
+			t.Fatal("waiting for a sample")
+		}
+	})
+
+	t.Run("max series", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		store := storage.NewTenants(local, storage.TenantLimits{MaxSeries: 2})
+
+		_, err := store.Save(teamA, metrics.Gauge("a", 1), metrics.Gauge("b", 1))
+		require.NoError(t, err)
+
+		_, err = store.Save(teamA, metrics.Gauge("c", 1))
+		require.ErrorIs(t, err, storage.ErrQuotaExceeded)
+
+		// NOTE: существующие метрики обновляются без ограничений.
+		_, err = store.Save(teamA, metrics.Gauge("a", 2))
+		require.NoError(t, err)
+
+		_, err = store.Save(teamB, metrics.Gauge("c", 1))
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(teamA, "b", nil))
+
+		_, err = store.Save(teamA, metrics.Gauge("c", 1))
+		require.NoError(t, err)
+	})
+
+	t.Run("write rate", func(t *testing.T) {
+		local, _ := testLocal(t, true)
+		store := storage.NewTenants(local, storage.TenantLimits{WriteRate: 2})
+
+		_, err := store.Save(teamA, metrics.Gauge("a", 1), metrics.Gauge("b", 1))
+		require.NoError(t, err)
+
+		_, err = store.Save(teamA, metrics.Gauge("a", 1))
+		require.ErrorIs(t, err, storage.ErrQuotaExceeded)
+
+		_, err = store.Save(teamB, metrics.Gauge("a", 1))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			_, err := store.Save(teamA, metrics.Gauge("a", 1))
+			return err == nil
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+}
@@ -0,0 +1,1006 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sergeizaitcev/metrics/internal/metrics"
+)
+
+// Журнал версии 2 начинается с заголовка walHeader, за которым следуют
+// записи вида:
+//
+//	[длина тела 4B][crc32 тела 4B][операция 1B][время 8B][данные]
+//
+// Время присутствует только у операций с флагом operationTimestamped.
+//
+// Журнал версии 1 не содержит заголовка и состоит из записей вида:
+//
+//	[crc32 4B][операция 1B][время 8B][размер данных uvarint][данные]
+//
+// разделённых символом separator.
+const (
+	walMagic   = "MWAL"
+	walVersion = 2
+
+	// Максимальный размер тела записи; запись с большей длиной считается
+	// повреждённой.
+	maxRecordSize = 64 << 20
+)
+
+var walHeader = []byte(walMagic + string(rune(walVersion)))
+
+var (
+	separator    = '\xb1'
+	separatorLen = utf8.RuneLen(separator)
+)
+
+type operation uint8
+
+const (
+	operationUnknown operation = iota
+	operationAdd
+	operationUpdate
+	operationRollup
+	operationSample
+	operationDelete
+	operationReset
+	operationState
+)
+
+// operationTimestamped определяет флаг операции, указывающий на наличие
+// времени записи.
+const operationTimestamped operation = 0x80
+
+var operations = []operation{
+	operationUnknown,
+	operationAdd,
+	operationUpdate,
+	operationRollup,
+	operationSample,
+	operationDelete,
+	operationReset,
+	operationState,
+}
+
+func validate(op operation) error {
+	if op > 0 && int(op) < len(operations) {
+		v := operations[op]
+		if v != operationUnknown {
+			return nil
+		}
+	}
+	return errors.New("operation is unknown")
+}
+
+var errRecordCorrupted = errors.New("record is corrupted")
+
+type record struct {
+	op     operation
+	time   time.Time
+	metric metrics.Metric
+	rollup *Rollup // Только для operationRollup.
+}
+
+func (r record) MarshalBinary() ([]byte, error) {
+	data, err := r.metric.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("converting a metric to bytes: %w", err)
+	}
+
+	if r.op == operationRollup {
+		data = append(appendRollup(nil, r.rollup), data...)
+	}
+
+	op := r.op
+	if !r.time.IsZero() {
+		op |= operationTimestamped
+	}
+
+	start := 8
+
+	b := make([]byte, start, start+1+8+len(data))
+	b = append(b, byte(op))
+	if !r.time.IsZero() {
+		b = binary.BigEndian.AppendUint64(b, uint64(r.time.UnixNano()))
+	}
+	b = append(b, data...)
+
+	binary.BigEndian.PutUint32(b, uint32(len(b)-start))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[start:]))
+
+	return b, nil
+}
+
+func (r *record) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return errRecordCorrupted
+	}
+
+	size := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-8) != uint64(size) {
+		return errRecordCorrupted
+	}
+
+	body := data[8:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[4:]) {
+		return errors.New("invalid record")
+	}
+
+	return r.decode(body)
+}
+
+// decode декодирует тело записи версии 2.
+func (r *record) decode(body []byte) error {
+	if len(body) < 2 {
+		return errRecordCorrupted
+	}
+
+	op := operation(body[0])
+	body = body[1:]
+
+	var t time.Time
+
+	if op&operationTimestamped != 0 {
+		if len(body) < 9 {
+			return errRecordCorrupted
+		}
+		t = time.Unix(0, int64(binary.BigEndian.Uint64(body)))
+		op &^= operationTimestamped
+		body = body[8:]
+	}
+
+	return r.set(op, t, body)
+}
+
+// decodeLegacy декодирует запись версии 1 и возвращает её размер.
+func (r *record) decodeLegacy(data []byte) (int, error) {
+	if len(data) < 6 {
+		return 0, errRecordCorrupted
+	}
+
+	op := operation(data[4])
+
+	var t time.Time
+
+	offset := 5
+	if op&operationTimestamped != 0 {
+		if len(data) < offset+9 {
+			return 0, errRecordCorrupted
+		}
+		t = time.Unix(0, int64(binary.BigEndian.Uint64(data[offset:])))
+		op &^= operationTimestamped
+		offset += 8
+	}
+
+	size, n := binary.Uvarint(data[offset:])
+	if n <= 0 || size <= 0 || uint64(len(data[offset:])-n) < size {
+		return 0, errRecordCorrupted
+	}
+
+	end := offset + n + int(size)
+
+	if crc32.ChecksumIEEE(data[4:end]) != binary.BigEndian.Uint32(data) {
+		return 0, errors.New("invalid record")
+	}
+
+	err := r.set(op, t, data[end-int(size):end])
+	if err != nil {
+		return 0, err
+	}
+
+	return end, nil
+}
+
+// set заполняет запись операцией op, временем t и данными payload.
+func (r *record) set(op operation, t time.Time, payload []byte) error {
+	if err := validate(op); err != nil {
+		return err
+	}
+
+	var rollup *Rollup
+
+	if op == operationRollup {
+		rollup = &Rollup{Time: t}
+
+		var err error
+
+		payload, err = readRollup(payload, rollup)
+		if err != nil {
+			return err
+		}
+	}
+
+	var metric metrics.Metric
+
+	err := metric.UnmarshalBinary(payload)
+	if err != nil {
+		return err
+	}
+
+	if rollup != nil {
+		rollup.Value = metric
+	}
+
+	*r = record{
+		op:     op,
+		time:   t,
+		metric: metric,
+		rollup: rollup,
+	}
+
+	return nil
+}
+
+// wal определяет файл для упреждающей журнализации.
+//
+// Журнал состоит из активного сегмента, расположенного по пути path,
+// закрытых сегментов "<path>.<номер>", снимков "<path>.snapshot.<номер>"
+// и истории "<path>.history". Снимок содержит состояние хранилища на момент
+// закрытия сегмента с тем же номером, а история — значения метрик, которые
+// дописываются в неё при записи снимков, поэтому при восстановлении
+// читается история, последний снимок, закрытые сегменты с большими номерами
+// и активный сегмент.
+type wal struct {
+	path string
+	seq  uint64 // Номер последнего закрытого сегмента.
+
+	mu  sync.Mutex // Защищает buf.
+	buf bytes.Buffer
+
+	// Упорядочивает запись в файл; операции с файлами выполняются под этой
+	// блокировкой.
+	flushMu sync.Mutex
+	out     []byte // Данные, записываемые в файл.
+	fd      *os.File
+	size    int64 // Размер активного сегмента.
+
+	// Размер активного сегмента, при превышении которого сегмент
+	// закрывается.
+	//
+	// При segmentSize == 0, сегменты не закрываются.
+	segmentSize int64
+
+	// Индикатор журнала только для чтения: файлы журнала не создаются,
+	// не переименовываются и не усекаются.
+	readOnly bool
+}
+
+// openWAL открывает журнал по пути path. Если restore == false, то
+// существующие сегменты и снимки удаляются.
+func openWAL(path string, segmentSize int64, restore bool) (*wal, error) {
+	w := &wal{
+		path:        path,
+		segmentSize: segmentSize,
+	}
+
+	segments, snapshots, err := w.files()
+	if err != nil {
+		return nil, err
+	}
+
+	flags := os.O_RDWR | os.O_CREATE
+	if !restore {
+		flags |= os.O_TRUNC
+		for _, seq := range segments {
+			if err = os.Remove(w.segment(seq)); err != nil {
+				return nil, fmt.Errorf("removing a segment: %w", err)
+			}
+		}
+		for _, seq := range snapshots {
+			if err = os.Remove(w.snapshot(seq)); err != nil {
+				return nil, fmt.Errorf("removing a snapshot: %w", err)
+			}
+		}
+		err = os.Remove(w.history())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("removing a history: %w", err)
+		}
+	} else {
+		if n := len(segments); n > 0 {
+			w.seq = segments[n-1]
+		}
+		if n := len(snapshots); n > 0 && snapshots[n-1] > w.seq {
+			w.seq = snapshots[n-1]
+		}
+	}
+
+	// NOTE: недописанные снимок и история остаются после аварийного
+	// завершения.
+	_ = os.Remove(w.path + ".snapshot.tmp")
+	_ = os.Remove(w.history() + ".tmp")
+
+	if restore {
+		// NOTE: записи версии 2 не дописываются в журнал версии 1, поэтому
+		// журнал версии 1 закрывается как сегмент и читается отдельно.
+		legacy, err := isLegacy(path)
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			err = os.Rename(path, w.segment(w.seq+1))
+			if err != nil {
+				return nil, fmt.Errorf("sealing a legacy segment: %w", err)
+			}
+			w.seq++
+		}
+	}
+
+	err = w.open(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// openWALReadOnly открывает журнал по пути path только для чтения.
+// Отсутствующий активный сегмент считается пустым, а журнал версии 1
+// читается как активный сегмент.
+func openWALReadOnly(path string) (*wal, error) {
+	w := &wal{
+		path:     path,
+		readOnly: true,
+	}
+
+	fd, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	w.fd = fd
+	w.size = info.Size()
+
+	return w, nil
+}
+
+// open открывает активный сегмент и записывает в него заголовок, если
+// сегмент пуст или заголовок записан не полностью.
+func (w *wal) open(flags int) error {
+	fd, err := os.OpenFile(w.path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+
+	head, err := readHead(fd)
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("reading a header: %w", err)
+	}
+
+	v, err := version(head)
+	if err == nil && v == 1 {
+		err = errors.New("segment has a legacy format")
+	}
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	if v == 0 {
+		err = fd.Truncate(0)
+		if err == nil {
+			_, err = fd.WriteAt(walHeader, 0)
+		}
+		if err == nil {
+			err = fd.Sync()
+		}
+		if err != nil {
+			fd.Close()
+			return fmt.Errorf("writing a header: %w", err)
+		}
+	}
+
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	w.fd = fd
+	w.size = info.Size()
+
+	return nil
+}
+
+// close сбрасывает содержимое буфера в конец файла и закрывает его.
+func (w *wal) close() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	if w.readOnly {
+		if w.fd == nil {
+			return nil
+		}
+		return w.fd.Close()
+	}
+
+	err := w.write()
+	if err != nil {
+		return fmt.Errorf("writing buffered record to a file: %w", err)
+	}
+
+	err = w.fd.Close()
+	if err != nil {
+		return fmt.Errorf("closing a file: %w", err)
+	}
+
+	return nil
+}
+
+// flush сбрасывает содержимое буфера в конец файла и закрывает активный
+// сегмент, если его размер превысил segmentSize.
+//
+// NOTE: flush может выполняться одновременно с append; в файл попадают
+// все записи, добавленные в буфер до вызова flush.
+func (w *wal) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	return w.write()
+}
+
+// write выполняет flush под блокировкой flushMu.
+func (w *wal) write() error {
+	w.mu.Lock()
+	w.out = append(w.out[:0], w.buf.Bytes()...)
+	w.buf.Reset()
+	w.mu.Unlock()
+
+	if len(w.out) == 0 {
+		return nil
+	}
+
+	_, err := w.fd.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("offset to the end: %w", err)
+	}
+
+	n, err := w.fd.Write(w.out)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing to a file: %w", err)
+	}
+
+	err = w.fd.Sync()
+	if err != nil {
+		return fmt.Errorf("file synchronization: %w", err)
+	}
+
+	if w.segmentSize > 0 && w.size >= w.segmentSize {
+		return w.rotate()
+	}
+
+	return nil
+}
+
+// rotate закрывает активный сегмент и открывает новый; выполняется под
+// блокировкой flushMu.
+func (w *wal) rotate() error {
+	err := w.write()
+	if err != nil {
+		return err
+	}
+
+	if w.size <= int64(len(walHeader)) {
+		return nil
+	}
+
+	err = w.fd.Close()
+	if err != nil {
+		return fmt.Errorf("closing a segment: %w", err)
+	}
+
+	err = os.Rename(w.path, w.segment(w.seq+1))
+	if err != nil {
+		return fmt.Errorf("sealing a segment: %w", err)
+	}
+	w.seq++
+
+	err = w.open(os.O_RDWR | os.O_CREATE | os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("opening a segment: %w", err)
+	}
+
+	return nil
+}
+
+// compact закрывает активный сегмент, дописывает в историю записи, которые
+// передаются в history, записывает снимок из записей, которые передаются
+// в state, и удаляет закрытые сегменты и снимки, покрываемые новым снимком.
+// Если rewrite равен true, то история записывается заново.
+func (w *wal) compact(state, history func(func(record) error) error, rewrite bool) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	err := w.rotate()
+	if err != nil {
+		return err
+	}
+
+	// NOTE: история записывается до снимка, чтобы значения закрытых
+	// сегментов не терялись при сбое между записью снимка и истории.
+	if rewrite {
+		tmp := w.history() + ".tmp"
+
+		err = writeSnapshot(tmp, history)
+		if err == nil {
+			err = os.Rename(tmp, w.history())
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("rewriting a history: %w", err)
+		}
+	} else {
+		err = appendHistory(w.history(), history)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp := w.path + ".snapshot.tmp"
+
+	err = writeSnapshot(tmp, state)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, w.snapshot(w.seq))
+	if err != nil {
+		return fmt.Errorf("renaming a snapshot: %w", err)
+	}
+
+	segments, snapshots, err := w.files()
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range segments {
+		if seq <= w.seq {
+			if err = os.Remove(w.segment(seq)); err != nil {
+				return fmt.Errorf("removing a segment: %w", err)
+			}
+		}
+	}
+	for _, seq := range snapshots {
+		if seq < w.seq {
+			if err = os.Remove(w.snapshot(seq)); err != nil {
+				return fmt.Errorf("removing a snapshot: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeSnapshot записывает в файл name записи, которые передаются в f.
+func writeSnapshot(name string, f func(func(record) error) error) error {
+	fd, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating a snapshot: %w", err)
+	}
+	defer fd.Close()
+
+	buf := bufio.NewWriter(fd)
+	buf.Write(walHeader)
+
+	err = f(func(r record) error {
+		b, err := r.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("converting a record to bytes: %w", err)
+		}
+		buf.Write(b)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = buf.Flush()
+	if err != nil {
+		return fmt.Errorf("writing a snapshot: %w", err)
+	}
+
+	err = fd.Sync()
+	if err != nil {
+		return fmt.Errorf("snapshot synchronization: %w", err)
+	}
+
+	return fd.Close()
+}
+
+// appendHistory дописывает в конец истории name записи, которые передаются
+// в f.
+func appendHistory(name string, f func(func(record) error) error) error {
+	fd, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening a history: %w", err)
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(fd)
+	if info.Size() == 0 {
+		buf.Write(walHeader)
+	}
+
+	err = f(func(r record) error {
+		b, err := r.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("converting a record to bytes: %w", err)
+		}
+		buf.Write(b)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = buf.Flush()
+	if err != nil {
+		return fmt.Errorf("writing a history: %w", err)
+	}
+
+	err = fd.Sync()
+	if err != nil {
+		return fmt.Errorf("history synchronization: %w", err)
+	}
+
+	return fd.Close()
+}
+
+// append добавляет запись, преобразованную в байты, в конец буфера.
+func (w *wal) append(b []byte) {
+	w.mu.Lock()
+	w.buf.Write(b)
+	w.mu.Unlock()
+}
+
+// readAll считывает записи из истории, последнего снимка, закрытых после
+// него сегментов и активного сегмента и передает их в f.
+//
+// Повреждённая или записанная не полностью запись и все записи после неё
+// отбрасываются, а файл усекается до последней корректной записи, если
+// журнал открыт не только для чтения.
+func (w *wal) readAll(f func(record) error) (Recovery, error) {
+	var recovery Recovery
+
+	segments, snapshots, err := w.files()
+	if err != nil {
+		return recovery, err
+	}
+
+	read := func(name string) error {
+		records, dropped, err := readFile(name, f, !w.readOnly)
+		recovery.Records += records
+		recovery.Dropped += dropped
+		return err
+	}
+
+	err = read(w.history())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return recovery, fmt.Errorf("reading a history: %w", err)
+	}
+
+	var last uint64
+
+	if n := len(snapshots); n > 0 {
+		last = snapshots[n-1]
+		if err = read(w.snapshot(last)); err != nil {
+			return recovery, fmt.Errorf("reading a snapshot: %w", err)
+		}
+	}
+
+	for _, seq := range segments {
+		if seq <= last {
+			continue
+		}
+		if err = read(w.segment(seq)); err != nil {
+			return recovery, fmt.Errorf("reading a segment: %w", err)
+		}
+	}
+
+	if w.fd == nil {
+		return recovery, nil
+	}
+
+	valid, records, err := scan(io.NewSectionReader(w.fd, 0, w.size), f)
+	recovery.Records += records
+	if err != nil {
+		return recovery, fmt.Errorf("scanning a file: %w", err)
+	}
+
+	if valid < w.size {
+		recovery.Dropped += w.size - valid
+		if w.readOnly {
+			return recovery, nil
+		}
+
+		err = w.fd.Truncate(valid)
+		if err == nil {
+			err = w.fd.Sync()
+		}
+		if err != nil {
+			return recovery, fmt.Errorf("truncating a file: %w", err)
+		}
+
+		w.size = valid
+	}
+
+	return recovery, nil
+}
+
+// files возвращает отсортированные номера закрытых сегментов и снимков.
+func (w *wal) files() (segments, snapshots []uint64, err error) {
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading a directory: %w", err)
+	}
+
+	prefix := filepath.Base(w.path) + "."
+
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		list := &segments
+		if s, ok := strings.CutPrefix(suffix, "snapshot."); ok {
+			suffix, list = s, &snapshots
+		}
+
+		seq, err := strconv.ParseUint(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		*list = append(*list, seq)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+
+	return segments, snapshots, nil
+}
+
+// segment возвращает имя закрытого сегмента с номером seq.
+func (w *wal) segment(seq uint64) string {
+	return fmt.Sprintf("%s.%020d", w.path, seq)
+}
+
+// history возвращает имя истории.
+func (w *wal) history() string {
+	return w.path + ".history"
+}
+
+// snapshot возвращает имя снимка с номером seq.
+func (w *wal) snapshot(seq uint64) string {
+	return fmt.Sprintf("%s.snapshot.%020d", w.path, seq)
+}
+
+// readFile считывает записи из файла name, передает их в f и, если
+// truncate равен true, усекает файл до последней корректной записи.
+func readFile(
+	name string,
+	f func(record) error,
+	truncate bool,
+) (records int, dropped int64, err error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	valid, records, err := scan(fd, f)
+	if err != nil {
+		return records, 0, err
+	}
+
+	if valid < info.Size() {
+		dropped = info.Size() - valid
+		if !truncate {
+			return records, dropped, nil
+		}
+		if err = os.Truncate(name, valid); err != nil {
+			return records, dropped, err
+		}
+	}
+
+	return records, dropped, nil
+}
+
+// isLegacy возвращает true, если файл name содержит журнал версии 1.
+func isLegacy(name string) (bool, error) {
+	fd, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fd.Close()
+
+	head, err := readHead(fd)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := version(head)
+	if err != nil {
+		return false, err
+	}
+
+	return v == 1, nil
+}
+
+// readHead считывает начало файла размером не более заголовка.
+func readHead(r io.ReaderAt) ([]byte, error) {
+	head := make([]byte, len(walHeader))
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// version возвращает версию журнала по его началу head или 0, если
+// заголовок отсутствует или записан не полностью.
+func version(head []byte) (int, error) {
+	switch {
+	case bytes.HasPrefix(head, walHeader):
+		return walVersion, nil
+	case len(head) == len(walHeader) && bytes.HasPrefix(head, []byte(walMagic)):
+		return 0, fmt.Errorf("unsupported wal version %d", head[len(walMagic)])
+	case bytes.HasPrefix(walHeader, head):
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// scan считывает записи из r и передает их в f до первой повреждённой
+// записи. Возвращает размер корректно прочитанных данных и количество
+// записей; ошибка возвращается только при ошибке чтения или ошибке f.
+func scan(r io.Reader, f func(record) error) (valid int64, records int, err error) {
+	br := bufio.NewReader(r)
+
+	head, err := br.Peek(len(walHeader))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, 0, err
+	}
+
+	v, err := version(head)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch v {
+	case 0:
+		return 0, 0, nil
+	case 1:
+		return scanLegacy(br, f)
+	}
+
+	_, _ = br.Discard(len(walHeader))
+	valid = int64(len(walHeader))
+
+	var frame [8]byte
+
+	for {
+		_, err = io.ReadFull(br, frame[:])
+		if err != nil {
+			return valid, records, eof(err)
+		}
+
+		size := binary.BigEndian.Uint32(frame[:])
+		if size == 0 || size > maxRecordSize {
+			return valid, records, nil
+		}
+
+		body := make([]byte, size)
+
+		_, err = io.ReadFull(br, body)
+		if err != nil {
+			return valid, records, eof(err)
+		}
+
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(frame[4:]) {
+			return valid, records, nil
+		}
+
+		var e record
+
+		if e.decode(body) != nil {
+			return valid, records, nil
+		}
+
+		if err = f(e); err != nil {
+			return valid, records, err
+		}
+
+		valid += int64(len(frame)) + int64(size)
+		records++
+	}
+}
+
+// scanLegacy считывает записи журнала версии 1.
+func scanLegacy(r io.Reader, f func(record) error) (valid int64, records int, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sep := []byte(string(separator))
+
+	for len(data) > 0 {
+		var e record
+
+		// NOTE: размер записи определяется её заголовком, т.к. разделитель
+		// может встречаться внутри данных.
+		n, err := e.decodeLegacy(data)
+		if err != nil {
+			break
+		}
+
+		rest := data[n:]
+		if len(rest) > separatorLen {
+			rest = rest[:separatorLen]
+		}
+
+		// NOTE: разделитель последней записи может быть записан
+		// не полностью.
+		if !bytes.HasPrefix(rest, sep) && !bytes.HasPrefix(sep, rest) {
+			break
+		}
+
+		if err = f(e); err != nil {
+			return valid, records, err
+		}
+
+		n += len(rest)
+		valid += int64(n)
+		records++
+		data = data[n:]
+	}
+
+	return valid, records, nil
+}
+
+// eof возвращает nil, если err означает конец данных.
+func eof(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return err
+}
@@ -9,6 +9,10 @@ import (
 const (
 	keyRealIP  = "real_ip"
 	keyHash256 = "hash_256"
+	keyAPIKey  = "api_key"
+	keyTenant  = "tenant"
+
+	keyReplicationKey = "replication_key"
 )
 
 // SetRealIP устанавливает в контекст IP-адрес.
@@ -31,6 +35,36 @@ func GetHash256(ctx context.Context) string {
 	return getKey(ctx, keyHash256)
 }
 
+// SetAPIKey устанавливает в контекст ключ API.
+func SetAPIKey(ctx context.Context, key string) context.Context {
+	return setKey(ctx, keyAPIKey, key)
+}
+
+// GetAPIKey возвращает ключ API из контекста.
+func GetAPIKey(ctx context.Context) string {
+	return getKey(ctx, keyAPIKey)
+}
+
+// SetTenant устанавливает в контекст арендатора.
+func SetTenant(ctx context.Context, tenant string) context.Context {
+	return setKey(ctx, keyTenant, tenant)
+}
+
+// GetTenant возвращает арендатора из контекста.
+func GetTenant(ctx context.Context) string {
+	return getKey(ctx, keyTenant)
+}
+
+// SetReplicationKey устанавливает в контекст ключ репликации.
+func SetReplicationKey(ctx context.Context, key string) context.Context {
+	return setKey(ctx, keyReplicationKey, key)
+}
+
+// GetReplicationKey возвращает ключ репликации из контекста.
+func GetReplicationKey(ctx context.Context) string {
+	return getKey(ctx, keyReplicationKey)
+}
+
 func setKey(ctx context.Context, key, value string) context.Context {
 	md, ok := metadata.FromOutgoingContext(ctx)
 	if !ok {
@@ -16,13 +16,33 @@ func Subnet(subnet *net.IPNet) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
 		resp any, err error,
 	) {
-		ip := md.GetRealIP(ctx)
-		if ip == "" || !subnet.Contains(net.ParseIP(ip)) {
-			return nil, status.Error(
-				codes.Internal,
-				"real IP address is not contained in the subnet",
-			)
+		if err := checkSubnet(ctx, subnet); err != nil {
+			return nil, err
 		}
 		return handler(ctx, req)
 	}
 }
+
+// SubnetStream проверяет IP-адрес входящего потока на вхождение
+// в доверенную подсеть.
+func SubnetStream(subnet *net.IPNet) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkSubnet(ss.Context(), subnet); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// checkSubnet возвращает ошибку, если IP-адрес из метаданных не входит
+// в подсеть subnet.
+func checkSubnet(ctx context.Context, subnet *net.IPNet) error {
+	ip := md.GetRealIP(ctx)
+	if ip == "" || !subnet.Contains(net.ParseIP(ip)) {
+		return status.Error(
+			codes.Internal,
+			"real IP address is not contained in the subnet",
+		)
+	}
+	return nil
+}
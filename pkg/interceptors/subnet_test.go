@@ -125,3 +125,67 @@ func TestSubnet(t *testing.T) {
 		})
 	}
 }
+
+func TestSubnetStream(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("127.0.0.1/24")
+
+	testCases := []struct {
+		name      string
+		context   context.Context
+		wantError bool
+	}{
+		{
+			name:    "contains",
+			context: md.SetRealIP(context.Background(), "127.0.0.1"),
+		},
+		{
+			name:      "empty",
+			context:   context.Background(),
+			wantError: true,
+		},
+		{
+			name:      "no contains",
+			context:   md.SetRealIP(context.Background(), "127.0.1.1"),
+			wantError: true,
+		},
+	}
+
+	hsrv := health.NewServer()
+	hsrv.SetServingStatus("test", pb.HealthCheckResponse_SERVING)
+
+	srv := grpc.NewServer(grpc.StreamInterceptor(interceptors.SubnetStream(subnet)))
+	srv.RegisterService(&pb.Health_ServiceDesc, hsrv)
+
+	lis := newLocalListener()
+	t.Cleanup(func() { lis.Close() })
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().Network(),
+		grpc.WithContextDialer(contextDialer(lis)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	client := pb.NewHealthClient(conn)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(tc.context)
+			defer cancel()
+
+			stream, err := client.Watch(ctx, &pb.HealthCheckRequest{Service: "test"})
+			require.NoError(t, err)
+
+			res, err := stream.Recv()
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, pb.HealthCheckResponse_SERVING, res.Status)
+		})
+	}
+}
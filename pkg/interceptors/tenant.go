@@ -0,0 +1,52 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sergeizaitcev/metrics/pkg/interceptors/md"
+)
+
+// ResolveFunc возвращает копию ctx с арендатором, определённым по ключу API
+// apiKey или явно переданному арендатору tenant.
+type ResolveFunc = func(ctx context.Context, apiKey, tenant string) (context.Context, error)
+
+// Tenant определяет арендатора запроса по метаданным и передаёт его
+// в контексте запроса; если арендатор не определён, запрос отклоняется.
+func Tenant(resolve ResolveFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		resp any, err error,
+	) {
+		ctx, err = resolve(ctx, md.GetAPIKey(ctx), md.GetTenant(ctx))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TenantStream определяет арендатора потока по метаданным и передаёт его
+// в контексте потока; если арендатор не определён, поток отклоняется.
+func TenantStream(resolve ResolveFunc) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		ctx, err := resolve(ctx, md.GetAPIKey(ctx), md.GetTenant(ctx))
+		if err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream определяет поток с заменённым контекстом.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,86 @@
+package interceptors_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/sergeizaitcev/metrics/pkg/interceptors"
+	"github.com/sergeizaitcev/metrics/pkg/interceptors/md"
+)
+
+type tenantKey struct{}
+
+func TestTenant(t *testing.T) {
+	resolve := func(ctx context.Context, apiKey, tenant string) (context.Context, error) {
+		if apiKey != "" {
+			if apiKey != "secret" {
+				return nil, errors.New("unknown api key")
+			}
+			tenant = "team"
+		}
+		return context.WithValue(ctx, tenantKey{}, tenant), nil
+	}
+
+	testCases := []struct {
+		name       string
+		context    context.Context
+		wantTenant string
+		wantError  bool
+	}{
+		{
+			name:    "default",
+			context: context.Background(),
+		},
+		{
+			name:       "api key",
+			context:    md.SetAPIKey(context.Background(), "secret"),
+			wantTenant: "team",
+		},
+		{
+			name:       "tenant",
+			context:    md.SetTenant(context.Background(), "other"),
+			wantTenant: "other",
+		},
+		{
+			name:      "unknown api key",
+			context:   md.SetAPIKey(context.Background(), "unknown"),
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tenant string
+
+			tenantInterceptor := interceptors.Tenant(resolve)
+			interceptor := func(
+				ctx context.Context,
+				req any,
+				info *grpc.UnaryServerInfo,
+				handler grpc.UnaryHandler,
+			) (any, error) {
+				return tenantInterceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					tenant, _ = ctx.Value(tenantKey{}).(string)
+					return handler(ctx, req)
+				})
+			}
+
+			testServer(t, interceptor, func(check checkFunc) {
+				_, err := check(tc.context, &pb.HealthCheckRequest{Service: "test"})
+				if tc.wantError {
+					require.Equal(t, codes.Unauthenticated, status.Code(err))
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, tc.wantTenant, tenant)
+			})
+		})
+	}
+}
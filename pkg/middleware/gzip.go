@@ -108,6 +108,18 @@ func (w *gzipResponseWriter) Write(p []byte) (int, error) {
 	return w.ResponseWriter.Write(p)
 }
 
+// Flush отправляет клиенту буферизованные данные.
+func (w *gzipResponseWriter) Flush() {
+	if w.checkCType() {
+		w.gw.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w *gzipResponseWriter) checkCType() bool {
 	ctype := strings.ToLower(w.ResponseWriter.Header().Get("Content-Type"))
 	for _, target := range w.ctypes {
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	TenantHeader = "X-Tenant"
+)
+
+// ResolveFunc возвращает копию ctx с арендатором, определённым по ключу API
+// apiKey или явно переданному арендатору tenant.
+type ResolveFunc = func(ctx context.Context, apiKey, tenant string) (context.Context, error)
+
+// Tenant определяет арендатора запроса по заголовкам APIKeyHeader
+// и TenantHeader и передаёт его в контексте запроса; если арендатор
+// не определён, запрос отклоняется.
+func Tenant(resolve ResolveFunc) Middleware {
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			ctx, err := resolve(
+				r.Context(),
+				r.Header.Get(APIKeyHeader),
+				r.Header.Get(TenantHeader),
+			)
+			if err != nil {
+				WriteError(w, err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r.WithContext(ctx), p)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/pkg/middleware"
+)
+
+type tenantKey struct{}
+
+func resolveTenant(ctx context.Context, apiKey, tenant string) (context.Context, error) {
+	if apiKey != "" {
+		if apiKey != "secret" {
+			return nil, errors.New("unknown api key")
+		}
+		tenant = "team"
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant), nil
+}
+
+func TestTenant(t *testing.T) {
+	testCases := []struct {
+		name       string
+		apiKey     string
+		tenant     string
+		wantCode   int
+		wantTenant string
+	}{
+		{
+			name:     "default",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "api key",
+			apiKey:     "secret",
+			wantCode:   http.StatusOK,
+			wantTenant: "team",
+		},
+		{
+			name:       "header",
+			tenant:     "other",
+			wantCode:   http.StatusOK,
+			wantTenant: "other",
+		},
+		{
+			name:     "unknown api key",
+			apiKey:   "unknown",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tenant string
+
+			next := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+				tenant, _ = r.Context().Value(tenantKey{}).(string)
+				w.WriteHeader(http.StatusOK)
+			}
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tc.apiKey != "" {
+				req.Header.Set(middleware.APIKeyHeader, tc.apiKey)
+			}
+			if tc.tenant != "" {
+				req.Header.Set(middleware.TenantHeader, tc.tenant)
+			}
+
+			handle := middleware.Use(next, middleware.Tenant(resolveTenant))
+			handle(rec, req, httprouter.Params{})
+
+			require.Equal(t, tc.wantCode, rec.Code)
+			require.Equal(t, tc.wantTenant, tenant)
+		})
+	}
+}
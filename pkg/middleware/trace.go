@@ -51,6 +51,7 @@ func Trace(paramsFunc func(*Params)) Middleware {
 type traceResponseWriter struct {
 	http.ResponseWriter
 	body       bytes.Buffer
+	streaming  bool // Индикатор потокового ответа.
 	statusCode int
 	err        error
 }
@@ -64,10 +65,26 @@ func WriteError(w http.ResponseWriter, err error) {
 }
 
 func (w *traceResponseWriter) Write(p []byte) (int, error) {
-	w.body.Write(p)
+	if !w.streaming {
+		w.body.Write(p)
+	}
 	return w.ResponseWriter.Write(p)
 }
 
+// Flush отправляет клиенту буферизованные данные.
+//
+// NOTE: ответ, который отправляется частями, может не завершаться долго,
+// поэтому после вызова Flush его тело не сохраняется в Params.Body.
+func (w *traceResponseWriter) Flush() {
+	w.streaming = true
+	w.body.Reset()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *traceResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w *traceResponseWriter) WriteHeader(statusCode int) {
 	w.statusCode = statusCode
 	w.ResponseWriter.WriteHeader(statusCode)
@@ -0,0 +1,212 @@
+// Package snappy реализует блочный формат сжатия snappy, который
+// используется в протоколе Prometheus remote-write.
+//
+// Блок начинается с длины несжатых данных в формате uvarint, за которой
+// следуют элементы: литералы и ссылки на уже распакованные данные.
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+
+	// Минимальная длина совпадения, которое кодируется ссылкой.
+	minMatch = 4
+
+	// Максимальное смещение ссылки, создаваемой Encode.
+	maxOffset = 1<<16 - 1
+
+	tableBits = 14
+)
+
+var (
+	// ErrCorrupt возвращается, если данные не являются блоком snappy.
+	ErrCorrupt = errors.New("snappy: corrupt input")
+
+	// ErrTooLarge возвращается, если длина несжатых данных превышает
+	// допустимую.
+	ErrTooLarge = errors.New("snappy: decoded block is too large")
+)
+
+// DecodedLen возвращает длину несжатых данных блока src.
+func DecodedLen(src []byte) (int, error) {
+	n, _, err := decodedLen(src)
+	return n, err
+}
+
+func decodedLen(src []byte) (int, int, error) {
+	v, n := binary.Uvarint(src)
+	if n <= 0 || v > 1<<32-1 {
+		return 0, 0, ErrCorrupt
+	}
+	if uint64(int(v)) != v {
+		return 0, 0, ErrTooLarge
+	}
+	return int(v), n, nil
+}
+
+// Decode возвращает несжатые данные блока src.
+//
+// NOTE: Decode выделяет память под несжатые данные заранее, поэтому
+// размер недоверенных блоков следует проверять с помощью DecodedLen.
+func Decode(src []byte) ([]byte, error) {
+	dLen, s, err := decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := make([]byte, dLen)
+	d := 0
+
+	for s < len(src) {
+		var length, offset int
+
+		switch src[s] & 0x03 {
+		case tagLiteral:
+			x := int(src[s] >> 2)
+			s++
+			if x >= 60 {
+				n := x - 59
+				if len(src)-s < n {
+					return nil, ErrCorrupt
+				}
+				x = 0
+				for i := n - 1; i >= 0; i-- {
+					x = x<<8 | int(src[s+i])
+				}
+				s += n
+			}
+			length = x + 1
+			if length <= 0 || length > len(src)-s || length > len(dst)-d {
+				return nil, ErrCorrupt
+			}
+			d += copy(dst[d:], src[s:s+length])
+			s += length
+			continue
+		case tagCopy1:
+			if len(src)-s < 2 {
+				return nil, ErrCorrupt
+			}
+			length = minMatch + int(src[s]>>2)&0x07
+			offset = int(src[s]&0xe0)<<3 | int(src[s+1])
+			s += 2
+		case tagCopy2:
+			if len(src)-s < 3 {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(src[s]>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case tagCopy4:
+			if len(src)-s < 5 {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(src[s]>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+
+		if offset <= 0 || offset > d || length > len(dst)-d {
+			return nil, ErrCorrupt
+		}
+
+		// NOTE: ссылка может перекрывать записываемые данные, поэтому
+		// байты копируются по одному.
+		for end := d + length; d < end; d++ {
+			dst[d] = dst[d-offset]
+		}
+	}
+
+	if d != len(dst) {
+		return nil, ErrCorrupt
+	}
+
+	return dst, nil
+}
+
+// Encode возвращает блок snappy с данными src.
+func Encode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)+len(src)/6+16), uint64(len(src)))
+
+	var table [1 << tableBits]int32
+
+	lit := 0
+
+	for i := 0; i+minMatch <= len(src); {
+		h := hash(load32(src, i))
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate > maxOffset || load32(src, candidate) != load32(src, i) {
+			i++
+			continue
+		}
+
+		length := minMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = appendLiteral(dst, src[lit:i])
+		dst = appendCopy(dst, i-candidate, length)
+
+		i += length
+		lit = i
+	}
+
+	return appendLiteral(dst, src[lit:])
+}
+
+// appendLiteral добавляет в dst литерал lit.
+func appendLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+
+	n := uint32(len(lit) - 1)
+
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+
+	return append(dst, lit...)
+}
+
+// appendCopy добавляет в dst ссылку на length байт со смещением offset.
+func appendCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-minMatch)<<2|tagCopy1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+}
+
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
+
+func hash(v uint32) uint32 {
+	return (v * 0x1e35a7bd) >> (32 - tableBits)
+}
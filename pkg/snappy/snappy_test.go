@@ -0,0 +1,119 @@
+package snappy_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sergeizaitcev/metrics/pkg/randutil"
+	"github.com/sergeizaitcev/metrics/pkg/snappy"
+)
+
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		src     []byte
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "empty",
+			src:  []byte{0x00},
+			want: []byte{},
+		},
+		{
+			name: "literal",
+			src:  []byte{0x03, 0x08, 'a', 'b', 'c'},
+			want: []byte("abc"),
+		},
+		{
+			name: "overlapping copy",
+			src:  []byte{0x09, 0x08, 'a', 'b', 'c', 0x09, 0x03},
+			want: []byte("abcabcabc"),
+		},
+		{
+			name: "copy2",
+			src:  []byte{0x05, 0x00, 'a', 0x0e, 0x01, 0x00},
+			want: []byte("aaaaa"),
+		},
+		{
+			name:    "invalid length",
+			src:     []byte{0xff},
+			wantErr: snappy.ErrCorrupt,
+		},
+		{
+			name:    "short literal",
+			src:     []byte{0x03, 0x08, 'a'},
+			wantErr: snappy.ErrCorrupt,
+		},
+		{
+			name:    "invalid offset",
+			src:     []byte{0x05, 0x00, 'a', 0x01, 0x02},
+			wantErr: snappy.ErrCorrupt,
+		},
+		{
+			name:    "length mismatch",
+			src:     []byte{0x04, 0x08, 'a', 'b', 'c'},
+			wantErr: snappy.ErrCorrupt,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := snappy.Decode(tc.src)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  []byte
+	}{
+		{
+			name: "empty",
+			src:  nil,
+		},
+		{
+			name: "short",
+			src:  []byte("abc"),
+		},
+		{
+			name: "repeated",
+			src:  bytes.Repeat([]byte("metrics"), 1000),
+		},
+		{
+			name: "long match",
+			src:  append([]byte("header"), bytes.Repeat([]byte{'x'}, 1<<17)...),
+		},
+		{
+			name: "random",
+			src:  randutil.Bytes(1 << 16),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded := snappy.Encode(tc.src)
+
+			n, err := snappy.DecodedLen(encoded)
+			require.NoError(t, err)
+			require.Equal(t, len(tc.src), n)
+
+			got, err := snappy.Decode(encoded)
+			require.NoError(t, err)
+			require.Equal(t, len(tc.src), len(got))
+			require.True(t, bytes.Equal(tc.src, got))
+		})
+	}
+
+	src := bytes.Repeat([]byte("metrics"), 1000)
+	require.Less(t, len(snappy.Encode(src)), len(src)/10)
+}